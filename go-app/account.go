@@ -0,0 +1,403 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/dgrijalva/jwt-go"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// メールアドレス変更の確認リンクの用途（有効期限はtokenLifetimes.EmailChange）
+const emailChangePurpose = "change-email"
+
+// 退会の申請から実際に削除するまでの猶予期間（この間は取り消しできる）
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// 猶予期間を過ぎたアカウントを削除する間隔
+const accountPurgeInterval = 1 * time.Hour
+
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password"`
+    NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+    NewEmail string `json:"new_email"`
+    Password string `json:"password"`
+}
+
+type ConfirmEmailChangeRequest struct {
+    Token string `json:"token"`
+}
+
+type DeleteAccountRequest struct {
+    Password string `json:"password"`
+}
+
+type AccountDeletionResponse struct {
+    Message     string    `json:"message"`
+    ScheduledAt time.Time `json:"scheduled_at"` // この日時以降に削除される
+}
+
+// 退会の猶予期間中かどうか
+func isPendingDeletion(user User) bool {
+    return user.DeletionRequestedAt.Valid
+}
+
+// ログイン中のユーザーを取得し、パスワードを再確認する
+// 失敗した場合はエラーレスポンスを書き込んでfalseを返す
+func verifyCurrentPassword(w http.ResponseWriter, r *http.Request, db Database, userID int, password string) (User, bool) {
+    user, err := db.GetUserByID(userID)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
+        return User{}, false
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+        writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidPassword)
+        return User{}, false
+    }
+    return user, true
+}
+
+// パスワードの変更：現在のパスワードを確認し、他のセッションをすべて失効させる
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    var req ChangePasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+    if len(req.NewPassword) < minPasswordLength {
+        writeFieldErrors(w, r, newFieldError("new_password", FieldErrTooShort, minPasswordLength))
+        return
+    }
+
+    if _, ok := verifyCurrentPassword(w, r, db, claims.ID, req.CurrentPassword); !ok {
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+    if err != nil {
+        serverError(w, r, "Error while hashing password", err)
+        return
+    }
+    if err := db.UpdateUserPassword(claims.ID, string(hashedPassword)); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    // 現在のセッション以外はログアウトさせる
+    if err := db.RevokeUserSessions(claims.ID, claims.SessionID); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{Message: "Password has been changed"})
+}
+
+// メールアドレスの変更申請：新しいアドレスに確認リンクを送信する
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database, mailer Mailer, appBaseURL string) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    var req ChangeEmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+    newEmail := strings.TrimSpace(req.NewEmail)
+    if details := validateFields(check("new_email", newEmail, required(), emailAddress())); len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
+
+    user, ok := verifyCurrentPassword(w, r, db, claims.ID, req.Password)
+    if !ok {
+        return
+    }
+    if strings.EqualFold(user.Email, newEmail) {
+        writeError(w, r, http.StatusBadRequest, ErrCodeSameEmail)
+        return
+    }
+
+    // メールアドレスの重複チェック
+    if _, err := db.GetUserByEmail(newEmail); err != sql.ErrNoRows {
+        if err != nil {
+            serverError(w, r, "Database query error", err)
+            return
+        }
+        writeError(w, r, http.StatusConflict, ErrCodeEmailTaken)
+        return
+    }
+
+    // 新しいアドレスを含む署名付きトークンを、新しいアドレス宛てに送る
+    token, err := generateEmailChangeToken(user, newEmail, auth.keys)
+    if err != nil {
+        serverError(w, r, "Error generating token", err)
+        return
+    }
+    confirmURL := appBaseURL + "/account/email/confirm?token=" + url.QueryEscape(token)
+    body := fmt.Sprintf("メールアドレスの変更が申請されました。\n以下のリンクから%d時間以内に変更を確定してください。\n\n%s\n\nこのメールに心当たりがない場合は破棄してください。",
+        int(tokenLifetimes.EmailChange.Hours()), confirmURL)
+    if err := mailer.Send(newEmail, "【CCGallery】メールアドレス変更の確認", body); err != nil {
+        requestLogger(r).Error("Failed to send email change confirmation", "error", err)
+        writeError(w, r, http.StatusInternalServerError, ErrCodeEmailDeliveryFailed)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{Message: "A confirmation link has been sent to the new email address"})
+}
+
+// メールアドレス変更の確認トークンを生成する
+// 申請時のアドレスも含め、確定するまでに別の変更が確定したリンクは使えないようにする
+func generateEmailChangeToken(user User, newEmail string, keys *KeySet) (string, error) {
+    claims := &Claims{
+        ID:            user.ID,
+        Email:         newEmail,
+        PreviousEmail: user.Email,
+        Purpose:       emailChangePurpose,
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: time.Now().Add(tokenLifetimes.EmailChange).Unix(),
+            IssuedAt:  time.Now().Unix(),
+        },
+    }
+    return keys.Sign(claims)
+}
+
+// メールアドレスの変更確定：確認リンクのトークンを検証してアドレスを更新する
+func ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request, keys *KeySet, db Database, mailer Mailer) {
+    var req ConfirmEmailChangeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    claims, err := ValidateActionToken(req.Token, emailChangePurpose, keys)
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidConfirmationLink)
+        return
+    }
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidConfirmationLink)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+
+    // 同じリンクが再度開かれた場合は成功として扱う
+    if user.Email != claims.Email {
+        // 申請後にアドレスが変わっている場合（古いリンクの再利用など）は受け付けない
+        if user.Email != claims.PreviousEmail {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidConfirmationLink)
+            return
+        }
+
+        // 申請後に他のユーザーが同じアドレスを登録していないか確認する
+        if _, err := db.GetUserByEmail(claims.Email); err != sql.ErrNoRows {
+            if err != nil {
+                serverError(w, r, "Database query error", err)
+                return
+            }
+            writeError(w, r, http.StatusConflict, ErrCodeEmailTaken)
+            return
+        }
+
+        // 新しいアドレスはリンクを開いた時点で確認済みになる
+        if err := db.UpdateUserEmail(user.ID, claims.Email); err == ErrEmailTaken {
+            writeError(w, r, http.StatusConflict, ErrCodeEmailTaken)
+            return
+        } else if err != nil {
+            serverError(w, r, "Database execution failed", err)
+            return
+        }
+
+        // 乗っ取りに気付けるよう、以前のアドレスにも通知する
+        body := fmt.Sprintf("CCGalleryアカウントのメールアドレスが %s に変更されました。\nこの変更に心当たりがない場合は、至急パスワードを再設定してください。", claims.Email)
+        if err := mailer.Send(user.Email, "【CCGallery】メールアドレスが変更されました", body); err != nil {
+            requestLogger(r).Warn("Failed to send email change notification", "error", err)
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{Message: "Email address has been changed"})
+}
+
+// 退会の申請：猶予期間の後にアカウントと関連データを削除する
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    var req DeleteAccountRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    if _, ok := verifyCurrentPassword(w, r, db, claims.ID, req.Password); !ok {
+        return
+    }
+
+    // 退会の申請とすべてのセッションのログアウトを同時に行う
+    requestedAt := time.Now()
+    err := db.Transaction(func(tx Database) error {
+        if err := tx.RequestAccountDeletion(claims.ID, requestedAt); err != nil {
+            return err
+        }
+        return tx.RevokeUserSessions(claims.ID, "")
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    auth.clearSessionCookies(w)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(AccountDeletionResponse{
+        Message:     "Account is scheduled for deletion",
+        ScheduledAt: requestedAt.Add(accountDeletionGracePeriod),
+    })
+}
+
+// 退会の取り消し：猶予期間中であれば、メールアドレスとパスワードで退会申請を取り消す
+// 取り消し後は通常どおりログインする（二要素認証を迂回させないため、ここではトークンを発行しない）
+func RestoreAccountHandler(w http.ResponseWriter, r *http.Request, db Database, throttle *LoginThrottle) {
+    var creds Credentials
+    if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    // ログインと同じ試行回数の制限を適用する
+    // 退会の取り消しはログイン試行として記録しない
+    user, ok := authenticateCredentials(w, r, db, throttle, creds, nil)
+    if !ok {
+        return
+    }
+
+    if !isPendingDeletion(user) {
+        writeError(w, r, http.StatusConflict, ErrCodeAccountNotPendingDeletion)
+        return
+    }
+
+    if err := db.CancelAccountDeletion(user.ID); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{Message: "Account has been restored"})
+}
+
+// 猶予期間を過ぎたアカウントを削除する
+func purgeDeletedAccounts(db Database, imageDir string, now time.Time) error {
+    users, err := db.ListUsersPendingDeletion(now.Add(-accountDeletionGracePeriod))
+    if err != nil {
+        return err
+    }
+
+    for _, user := range users {
+        if err := db.DeleteUserAccount(user.ID); err != nil {
+            return err
+        }
+        // アップロードされた画像（{imageDir}/{user_uuid}）も削除する
+        if user.user_uuid != "" {
+            if err := os.RemoveAll(filepath.Join(imageDir, user.user_uuid)); err != nil {
+                slog.Warn("Failed to remove images of deleted account", "user_id", user.ID, "error", err)
+            }
+        }
+        slog.Info("Deleted account", "user_id", user.ID)
+    }
+    return nil
+}
+
+// 猶予期間を過ぎたアカウントの削除を定期的に行う
+func StartAccountPurger(db Database, imageDir string) {
+    go func() {
+        ticker := time.NewTicker(accountPurgeInterval)
+        defer ticker.Stop()
+        for {
+            if err := purgeDeletedAccounts(db, imageDir, time.Now()); err != nil {
+                slog.Error("Failed to purge deleted accounts", "error", err)
+            }
+            <-ticker.C
+        }
+    }()
+}
+
+// メールアドレスを更新する（確認リンク経由のため確認済みとする）
+func (db *SQLDatabase) UpdateUserEmail(userID int, email string) error {
+    _, err := db.db.Exec("UPDATE users SET email = ?, email_verified = TRUE WHERE id = ?", email, userID)
+    if db.db.dialect.IsUniqueViolation(err) {
+        return ErrEmailTaken
+    }
+    return err
+}
+
+func (db *SQLDatabase) RequestAccountDeletion(userID int, requestedAt time.Time) error {
+    _, err := db.db.Exec("UPDATE users SET deletion_requested_at = ? WHERE id = ?", requestedAt, userID)
+    return err
+}
+
+func (db *SQLDatabase) CancelAccountDeletion(userID int) error {
+    _, err := db.db.Exec("UPDATE users SET deletion_requested_at = NULL WHERE id = ?", userID)
+    return err
+}
+
+// before以前に退会を申請したユーザーの一覧
+func (db *SQLDatabase) ListUsersPendingDeletion(before time.Time) ([]User, error) {
+    rows, err := db.db.Query("SELECT id, user_uuid FROM users WHERE deletion_requested_at IS NOT NULL AND deletion_requested_at <= ?", before)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var users []User
+    for rows.Next() {
+        var user User
+        if err := rows.Scan(&user.ID, &user.user_uuid); err != nil {
+            return nil, err
+        }
+        users = append(users, user)
+    }
+    return users, rows.Err()
+}
+
+// ユーザーと関連するすべてのデータを削除する
+func (db *SQLDatabase) DeleteUserAccount(userID int) error {
+    statements := []string{
+        "DELETE FROM Portfolio WHERE user_id = ?",
+        "DELETE FROM Profile WHERE user_id = ?",
+        "DELETE FROM refresh_tokens WHERE user_id = ?",
+        "DELETE FROM sessions WHERE user_id = ?",
+        "DELETE FROM password_reset_tokens WHERE user_id = ?",
+        "DELETE FROM recovery_codes WHERE user_id = ?",
+        "DELETE FROM user_identities WHERE user_id = ?",
+        "DELETE FROM personal_access_tokens WHERE user_id = ?",
+        "DELETE FROM users WHERE id = ?",
+    }
+    return db.inTransaction(func(tx *SQLDatabase) error {
+        for _, stmt := range statements {
+            if _, err := tx.db.Exec(stmt, userID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
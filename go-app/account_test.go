@@ -0,0 +1,215 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+// 現在のセッション("current")のJWTを付けたリクエストを作成する
+func newAccountRequest(t *testing.T, keys *KeySet, target string, payload interface{}) *http.Request {
+    token, err := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com"}, "current", keys)
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+    body, _ := json.Marshal(payload)
+    req := httptest.NewRequest("POST", target, bytes.NewReader(body))
+    req.Header.Set("Authorization", "Bearer "+token)
+    return req
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    _, validUser := setupValidLoginCredentials()
+
+    // 現在のパスワードが一致しない場合
+    expectCurrentSession(db)
+    db.EXPECT().GetUserByID(2).Return(validUser, nil)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newAccountRequest(t, keys, "/api/account/password", ChangePasswordRequest{CurrentPassword: "wrongpassword", NewPassword: "brandnewpassword"}))
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+
+    // 変更に成功すると、現在のセッション以外が失効する
+    expectCurrentSession(db)
+    db.EXPECT().GetUserByID(2).Return(validUser, nil)
+    db.EXPECT().UpdateUserPassword(2, gomock.Any()).Return(nil)
+    db.EXPECT().RevokeUserSessions(2, "current").Return(nil)
+
+    w = httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newAccountRequest(t, keys, "/api/account/password", ChangePasswordRequest{CurrentPassword: "newpassword", NewPassword: "brandnewpassword"}))
+    verifyResponse(t, w, http.StatusOK, "Password has been changed", false)
+}
+
+func TestChangeEmailHandlerSendsConfirmationToNewAddress(t *testing.T) {
+    db, keys := setupMock(t)
+    _, validUser := setupValidLoginCredentials()
+    mailer := &MemoryMailer{}
+
+    expectCurrentSession(db)
+    db.EXPECT().GetUserByID(2).Return(validUser, nil)
+    db.EXPECT().GetUserByEmail("new@example.com").Return(User{}, sql.ErrNoRows)
+
+    app := newTestApp(db, keys)
+    app.Mailer = mailer
+    w := serveTestRouter(app, newAccountRequest(t, keys, "/api/account/email", ChangeEmailRequest{NewEmail: "new@example.com", Password: "newpassword"}))
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status OK, got %v: %s", w.Code, w.Body.String())
+    }
+    msg, _ := mailer.Last()
+    if msg.To != "new@example.com" || !strings.Contains(msg.Body, "/account/email/confirm?token=") {
+        t.Errorf("Expected confirmation link sent to the new address, got %+v", msg)
+    }
+}
+
+func TestChangeEmailHandlerRejectsAddressInUse(t *testing.T) {
+    db, keys := setupMock(t)
+    _, validUser := setupValidLoginCredentials()
+
+    expectCurrentSession(db)
+    db.EXPECT().GetUserByID(2).Return(validUser, nil)
+    db.EXPECT().GetUserByEmail("taken@example.com").Return(User{ID: 3, Email: "taken@example.com"}, nil)
+
+    app := newTestApp(db, keys)
+    w := serveTestRouter(app, newAccountRequest(t, keys, "/api/account/email", ChangeEmailRequest{NewEmail: "taken@example.com", Password: "newpassword"}))
+    if w.Code != http.StatusConflict {
+        t.Errorf("Expected status Conflict, got %v", w.Code)
+    }
+}
+
+func TestConfirmEmailChangeHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    mailer := &MemoryMailer{}
+
+    token, _ := generateEmailChangeToken(User{ID: 2, Email: "old@example.com"}, "new@example.com", keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "old@example.com"}, nil)
+    db.EXPECT().GetUserByEmail("new@example.com").Return(User{}, sql.ErrNoRows)
+    db.EXPECT().UpdateUserEmail(2, "new@example.com").Return(nil)
+
+    body, _ := json.Marshal(ConfirmEmailChangeRequest{Token: token})
+    w := httptest.NewRecorder()
+    ConfirmEmailChangeHandler(w, httptest.NewRequest("POST", "/api/account/email/confirm", bytes.NewReader(body)), keys, db, mailer)
+
+    verifyResponse(t, w, http.StatusOK, "Email address has been changed", false)
+    if msg, _ := mailer.Last(); msg.To != "old@example.com" {
+        t.Errorf("Expected a notification to the previous address, got %+v", msg)
+    }
+
+    // 他の用途のトークンは受け付けない
+    otherToken, _ := GenerateActionToken(2, "new@example.com", emailVerificationPurpose, time.Hour, keys)
+    body, _ = json.Marshal(ConfirmEmailChangeRequest{Token: otherToken})
+    w = httptest.NewRecorder()
+    ConfirmEmailChangeHandler(w, httptest.NewRequest("POST", "/api/account/email/confirm", bytes.NewReader(body)), keys, db, mailer)
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("Expected status Bad Request, got %v", w.Code)
+    }
+}
+
+// 確定前に別の変更が確定した場合、古いリンクでは変更できない
+func TestConfirmEmailChangeHandlerRejectsStaleLink(t *testing.T) {
+    db, keys := setupMock(t)
+
+    // old → new のリンクを発行した後に、new → other の変更が確定している
+    token, _ := generateEmailChangeToken(User{ID: 2, Email: "old@example.com"}, "new@example.com", keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "other@example.com"}, nil)
+
+    body, _ := json.Marshal(ConfirmEmailChangeRequest{Token: token})
+    w := httptest.NewRecorder()
+    ConfirmEmailChangeHandler(w, httptest.NewRequest("POST", "/api/account/email/confirm", bytes.NewReader(body)), keys, db, &MemoryMailer{})
+
+    verifyErrorResponse(t, w, http.StatusBadRequest, ErrCodeInvalidConfirmationLink)
+}
+
+func TestChangeEmailHandlerValidation(t *testing.T) {
+    db, keys := setupMock(t)
+
+    for _, email := range []string{"", "no-at-sign", "Name <name@example.com>", "name@"} {
+        expectCurrentSession(db)
+        w := serveTestRouter(newTestApp(db, keys), newAccountRequest(t, keys, "/api/account/email", ChangeEmailRequest{NewEmail: email, Password: "newpassword"}))
+
+        response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+        if len(response.Error.Details) != 1 || response.Error.Details[0].Field != "new_email" {
+            t.Errorf("Expected a field error for new_email with %q, got %+v", email, response.Error.Details)
+        }
+    }
+}
+
+func TestDeleteAccountHandlerSchedulesDeletion(t *testing.T) {
+    db, keys := setupMock(t)
+    _, validUser := setupValidLoginCredentials()
+
+    expectCurrentSession(db)
+    db.EXPECT().GetUserByID(2).Return(validUser, nil)
+    expectTransaction(db)
+    db.EXPECT().RequestAccountDeletion(2, gomock.Any()).Return(nil)
+    db.EXPECT().RevokeUserSessions(2, "").Return(nil)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newAccountRequest(t, keys, "/api/account/delete", DeleteAccountRequest{Password: "newpassword"}))
+
+    var response AccountDeletionResponse
+    json.NewDecoder(w.Body).Decode(&response)
+    if w.Code != http.StatusOK || response.ScheduledAt.Before(time.Now().Add(accountDeletionGracePeriod-time.Minute)) {
+        t.Errorf("Expected deletion to be scheduled after the grace period, got %v %+v", w.Code, response)
+    }
+}
+
+func TestLoginHandlerRejectsAccountPendingDeletion(t *testing.T) {
+    db, keys := setupMock(t)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    validUser.DeletionRequestedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+
+    w := postLogin(NewLoginThrottle(), db, keys, validCreds)
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status Forbidden, got %v", w.Code)
+    }
+}
+
+func TestRestoreAccountHandler(t *testing.T) {
+    db, _ := setupMock(t)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    validUser.DeletionRequestedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+    db.EXPECT().CancelAccountDeletion(2).Return(nil)
+
+    body, _ := json.Marshal(validCreds)
+    w := httptest.NewRecorder()
+    RestoreAccountHandler(w, httptest.NewRequest("POST", "/api/account/restore", bytes.NewReader(body)), db, NewLoginThrottle())
+
+    verifyResponse(t, w, http.StatusOK, "Account has been restored", false)
+}
+
+func TestPurgeDeletedAccountsRemovesImages(t *testing.T) {
+    db, _ := setupMock(t)
+
+    imageDir := t.TempDir()
+    userDir := filepath.Join(imageDir, "uuid-2")
+    os.MkdirAll(filepath.Join(userDir, "profile"), 0755)
+    os.WriteFile(filepath.Join(userDir, "profile", "icon.png"), []byte("png"), 0644)
+
+    now := time.Now()
+    db.EXPECT().ListUsersPendingDeletion(now.Add(-accountDeletionGracePeriod)).Return([]User{{ID: 2, user_uuid: "uuid-2"}}, nil)
+    db.EXPECT().DeleteUserAccount(2).Return(nil)
+
+    if err := purgeDeletedAccounts(db, imageDir, now); err != nil {
+        t.Fatalf("Failed to purge accounts: %v", err)
+    }
+    if _, err := os.Stat(userDir); !os.IsNotExist(err) {
+        t.Errorf("Expected images directory to be removed")
+    }
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/dgrijalva/jwt-go"
+)
+
+// ユーザーのロール
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
+
+// 管理者向けのユーザー一覧の件数
+const (
+    defaultAdminUserLimit = 50
+    maxAdminUserLimit     = 200
+)
+
+// 管理者の操作で受け付けるリクエストボディの上限と、理由の最大文字数
+const (
+    maxAdminBodyBytes    = 16 << 10
+    maxAdminReasonLength = 500
+)
+
+// 管理者の操作（監査ログに記録する）
+const (
+    AdminActionSuspend     = "suspend"
+    AdminActionUnsuspend   = "unsuspend"
+    AdminActionUnpublish   = "unpublish"
+    AdminActionImpersonate = "impersonate"
+)
+
+var (
+    // 必要なロールを持っていない場合のエラー
+    ErrForbidden = errors.New("You do not have permission to perform this action")
+    // 代理ログイン中に許可されていない操作を行った場合のエラー
+    ErrImpersonationNotAllowed = errors.New("This action is not allowed while impersonating a user")
+    // 利用停止中のアカウントのエラー
+    ErrAccountSuspended = errors.New("Account is suspended")
+    // 退会の猶予期間中のアカウントのエラー
+    ErrAccountPendingDeletion = errors.New("Account deletion has been requested")
+)
+
+// 管理者向けのユーザー情報
+type AdminUser struct {
+    ID                int    `json:"id"`
+    Email             string `json:"email"`
+    UserUUID          string `json:"user_uuid"`
+    Role              string `json:"role"`
+    EmailVerified     bool   `json:"email_verified"`
+    Suspended         bool   `json:"suspended"`
+    DeletionRequested bool   `json:"deletion_requested"`
+}
+
+// admin_audit_logテーブルの1レコード
+type AdminAuditLog struct {
+    ID           int
+    AdminID      int
+    Action       string
+    TargetUserID int    // 対象のユーザー（ない場合は0）
+    Target       string // 対象のポートフォリオUUIDなど
+    Reason       string
+    IPAddress    string
+    CreatedAt    time.Time
+}
+
+type SuspendUserRequest struct {
+    UserID    int    `json:"user_id"`
+    Suspended bool   `json:"suspended"`
+    Reason    string `json:"reason"`
+}
+
+type UnpublishPortfolioRequest struct {
+    PortfolioUUID string `json:"portfolio_uuid"`
+    Reason        string `json:"reason"`
+}
+
+type ImpersonateRequest struct {
+    UserID int    `json:"user_id"`
+    Reason string `json:"reason"`
+}
+
+// 指定したロールを持っているかどうか（管理者はすべてのロールを持つ）
+func (c *Claims) HasRole(role string) bool {
+    return c.Role == role || c.Role == RoleAdmin
+}
+
+// ログインセッションで認証し、指定したロールを持っていることを確認する
+// トークン発行後にロールが変更・利用停止されている場合に備え、データベースの値でも確認する
+func (a *Authenticator) RequireRole(r *http.Request, role string) (*Claims, error) {
+    claims, err := a.AuthenticateSession(r)
+    if err != nil {
+        return nil, err
+    }
+    if !claims.HasRole(role) {
+        return nil, ErrForbidden
+    }
+
+    user, err := withRequestContext(a.db, r).GetUserByID(claims.ID)
+    if err != nil {
+        return nil, err
+    }
+    if user.SuspendedAt.Valid {
+        return nil, ErrAccountSuspended
+    }
+    if user.Role != role && user.Role != RoleAdmin {
+        return nil, ErrForbidden
+    }
+    return claims, nil
+}
+
+// 代理ログインのトークンがまだ使えるかどうかを確認する
+// セッションで失効できるトークンのみ受け付け、発行後に管理者・対象ユーザーが利用停止された場合や
+// 管理者のロールが外された場合は使えなくする
+func checkImpersonation(db Database, claims *Claims) error {
+    if claims.SessionID == "" {
+        return ErrSessionRevoked
+    }
+
+    admin, err := db.GetUserByID(claims.ImpersonatorID)
+    if err == sql.ErrNoRows {
+        return ErrSessionRevoked
+    } else if err != nil {
+        return err
+    }
+    if admin.SuspendedAt.Valid || admin.Role != RoleAdmin {
+        return ErrSessionRevoked
+    }
+
+    user, err := db.GetUserByID(claims.ID)
+    if err == sql.ErrNoRows {
+        return ErrSessionRevoked
+    } else if err != nil {
+        return err
+    }
+    if user.SuspendedAt.Valid {
+        return ErrAccountSuspended
+    }
+    return nil
+}
+
+// 管理者の操作を監査ログに記録する
+func writeAdminAuditLog(db Database, r *http.Request, adminID int, action string, targetUserID int, target string, reason string) error {
+    return db.CreateAdminAuditLog(AdminAuditLog{
+        AdminID:      adminID,
+        Action:       action,
+        TargetUserID: targetUserID,
+        Target:       target,
+        Reason:       reason,
+        IPAddress:    clientIP(r),
+        CreatedAt:    time.Now(),
+    })
+}
+
+// ユーザーの一覧・検索(GET ?q=&limit=&offset=)
+// ルーターのRoleMiddleware(RoleAdmin)で認証済み
+func AdminUsersHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    query := strings.TrimSpace(r.URL.Query().Get("q"))
+    limit := defaultAdminUserLimit
+    if v := r.URL.Query().Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 || n > maxAdminUserLimit {
+            writeFieldErrors(w, r, newFieldError("limit", FieldErrOutOfRange, 1, maxAdminUserLimit))
+            return
+        }
+        limit = n
+    }
+    offset := 0
+    if v := r.URL.Query().Get("offset"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 {
+            writeFieldErrors(w, r, newFieldError("offset", FieldErrNegative))
+            return
+        }
+        offset = n
+    }
+
+    users, err := db.SearchUsers(query, limit, offset)
+    if err != nil {
+        serverError(w, r, "Database query failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(users)
+}
+
+// ユーザーの利用停止・停止解除(POST /api/admin/users/{id}/suspend)
+// 利用停止したユーザーのセッションはすべて失効させる
+// 利用停止・セッションの失効・監査ログの記録は1つのトランザクションで行う
+func AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのRoleMiddleware(RoleAdmin)で認証済み
+    claims := requestClaims(r)
+
+    var req SuspendUserRequest
+    if !decodeJSONBody(w, r, &req, maxAdminBodyBytes) {
+        return
+    }
+    // パスのユーザーIDを優先する（旧ルートではリクエストボディで指定する）
+    if id := r.PathValue("id"); id != "" {
+        userID, err := strconv.Atoi(id)
+        if err != nil {
+            writeFieldErrors(w, r, newFieldError("id", FieldErrInvalid))
+            return
+        }
+        req.UserID = userID
+    }
+    details := validateFields(check("reason", req.Reason, required(), maxLength(maxAdminReasonLength)))
+    if req.UserID <= 0 {
+        details = append([]FieldError{newFieldError("user_id", FieldErrRequired)}, details...)
+    }
+    if len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
+    if req.UserID == claims.ID {
+        writeError(w, r, http.StatusBadRequest, ErrCodeCannotSuspendSelf)
+        return
+    }
+
+    action := AdminActionUnsuspend
+    if req.Suspended {
+        action = AdminActionSuspend
+    }
+    var found bool
+    err := db.Transaction(func(tx Database) error {
+        var err error
+        if found, err = tx.SetUserSuspended(req.UserID, req.Suspended); err != nil || !found {
+            return err
+        }
+        if req.Suspended {
+            if err := tx.RevokeUserSessions(req.UserID, ""); err != nil {
+                return err
+            }
+        }
+        return writeAdminAuditLog(tx, r, claims.ID, action, req.UserID, "", req.Reason)
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    if !found {
+        writeError(w, r, http.StatusNotFound, ErrCodeUserNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// ポートフォリオの強制非公開(POST /api/admin/portfolios/{uuid}/unpublish)
+// 非公開への変更と監査ログの記録は1つのトランザクションで行う
+func AdminUnpublishPortfolioHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのRoleMiddleware(RoleAdmin)で認証済み
+    claims := requestClaims(r)
+
+    var req UnpublishPortfolioRequest
+    if !decodeJSONBody(w, r, &req, maxAdminBodyBytes) {
+        return
+    }
+    // パスのUUIDを優先する（旧ルートではリクエストボディで指定する）
+    if portfolioUUID := r.PathValue("uuid"); portfolioUUID != "" {
+        req.PortfolioUUID = portfolioUUID
+    }
+    details := validateFields(
+        check("portfolio_uuid", req.PortfolioUUID, required()),
+        check("reason", req.Reason, required(), maxLength(maxAdminReasonLength)),
+    )
+    if len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
+
+    var found bool
+    err := db.Transaction(func(tx Database) error {
+        var err error
+        if found, err = tx.UnpublishPortfolio(req.PortfolioUUID); err != nil || !found {
+            return err
+        }
+        return writeAdminAuditLog(tx, r, claims.ID, AdminActionUnpublish, 0, req.PortfolioUUID, req.Reason)
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    if !found {
+        writeError(w, r, http.StatusNotFound, ErrCodePortfolioNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// サポートのための代理ログイン(POST)
+// 対象ユーザーとして短時間だけ有効なアクセストークンを発行する（リフレッシュトークンは発行しない）
+// トークンは対象ユーザーのセッションとして記録し、通常のセッションと同じく失効できる
+func AdminImpersonateHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database) {
+    // ルーターのRoleMiddleware(RoleAdmin)で認証済み
+    claims := requestClaims(r)
+
+    var req ImpersonateRequest
+    if !decodeJSONBody(w, r, &req, maxAdminBodyBytes) {
+        return
+    }
+    details := validateFields(check("reason", req.Reason, required(), maxLength(maxAdminReasonLength)))
+    if req.UserID <= 0 {
+        details = append([]FieldError{newFieldError("user_id", FieldErrRequired)}, details...)
+    }
+    if len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
+
+    user, err := db.GetUserByID(req.UserID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusNotFound, ErrCodeUserNotFound)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+    // 他の管理者の権限は借りられないようにする
+    if user.Role == RoleAdmin {
+        writeError(w, r, http.StatusForbidden, ErrCodeCannotImpersonateAdmin)
+        return
+    }
+    if user.SuspendedAt.Valid {
+        writeError(w, r, http.StatusForbidden, ErrCodeAccountSuspended)
+        return
+    }
+
+    // トークンを発行する前に監査ログを記録する
+    if err := writeAdminAuditLog(db, r, claims.ID, AdminActionImpersonate, user.ID, "", req.Reason); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    session, err := createSession(db, r, user.ID)
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    token, err := auth.keys.Sign(&Claims{
+        ID:             user.ID,
+        Email:          user.Email,
+        Role:           user.Role,
+        SessionID:      session.ID,
+        ImpersonatorID: claims.ID,
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: time.Now().Add(tokenLifetimes.Impersonation).Unix(),
+        },
+    })
+    if err != nil {
+        serverError(w, r, "Error generating JWT", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{
+        Message: "Impersonation token issued",
+        Token:   token,
+    })
+}
+
+// メールアドレスまたはuser_uuidの部分一致でユーザーを検索する（queryが空の場合はすべて）
+func (db *SQLDatabase) SearchUsers(query string, limit int, offset int) ([]AdminUser, error) {
+    like := "%" + escapeLike(query) + "%"
+    rows, err := db.db.Query(`SELECT id, email, user_uuid, role, email_verified, suspended_at IS NOT NULL, deletion_requested_at IS NOT NULL
+        FROM users WHERE `+db.db.Like("email")+` OR `+db.db.Like("user_uuid")+` ORDER BY id LIMIT ? OFFSET ?`, like, like, limit, offset)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    users := []AdminUser{}
+    for rows.Next() {
+        var user AdminUser
+        if err := rows.Scan(&user.ID, &user.Email, &user.UserUUID, &user.Role, &user.EmailVerified, &user.Suspended, &user.DeletionRequested); err != nil {
+            return nil, err
+        }
+        users = append(users, user)
+    }
+    return users, rows.Err()
+}
+
+// 利用停止・解除を設定し、ユーザーが存在したかどうかを返す
+// MySQLは値が変わらないUPDATEの件数を0と報告するため、存在の確認には件数を使わない
+func (db *SQLDatabase) SetUserSuspended(userID int, suspended bool) (bool, error) {
+    var exists int
+    err := db.db.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    var suspendedAt sql.NullTime
+    if suspended {
+        suspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    }
+    _, err = db.db.Exec("UPDATE users SET suspended_at = ? WHERE id = ?", suspendedAt, userID)
+    return err == nil, err
+}
+
+// ポートフォリオを非公開(Status 0)にする
+func (db *SQLDatabase) UnpublishPortfolio(portfolioUUID string) (bool, error) {
+    var exists int
+    err := db.db.QueryRow("SELECT 1 FROM Portfolio WHERE portfolio_uuid = ?", portfolioUUID).Scan(&exists)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    _, err = db.db.Exec("UPDATE Portfolio SET status = '0' WHERE portfolio_uuid = ?", portfolioUUID)
+    return err == nil, err
+}
+
+func (db *SQLDatabase) CreateAdminAuditLog(entry AdminAuditLog) error {
+    var targetUserID sql.NullInt64
+    if entry.TargetUserID != 0 {
+        targetUserID = sql.NullInt64{Int64: int64(entry.TargetUserID), Valid: true}
+    }
+    _, err := db.db.Exec("INSERT INTO admin_audit_log (admin_id, action, target_user_id, target, reason, ip_address, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+        entry.AdminID, entry.Action, targetUserID, entry.Target, entry.Reason, entry.IPAddress, entry.CreatedAt)
+    return err
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+// 管理者(ID 1)としてのリクエストを作成する
+func newAdminRequest(t *testing.T, keys *KeySet, method string, target string, body interface{}) *http.Request {
+    token, err := GenerateSessionJWT(User{ID: 1, Email: "admin@example.com", Role: RoleAdmin}, "", keys)
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+    var payload []byte
+    if body != nil {
+        payload, _ = json.Marshal(body)
+    }
+    req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+    req.Header.Set("Authorization", "Bearer "+token)
+    return req
+}
+
+func expectAdminUser(db *MockDatabase) {
+    db.EXPECT().GetUserByID(1).Return(User{ID: 1, Email: "admin@example.com", Role: RoleAdmin}, nil)
+}
+
+func TestAdminHandlersRequireAdminRole(t *testing.T) {
+    db, keys := setupMock(t)
+    router := NewRouter(newTestApp(db, keys))
+
+    // 一般ユーザーのトークン
+    token, _ := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com", Role: RoleUser}, "", keys)
+    req := httptest.NewRequest("GET", "/api/admin/users", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, req)
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403 for a regular user, got %v", w.Code)
+    }
+
+    // トークン発行後に管理者ロールを外された場合
+    db.EXPECT().GetUserByID(1).Return(User{ID: 1, Email: "admin@example.com", Role: RoleUser}, nil)
+    w = httptest.NewRecorder()
+    router.ServeHTTP(w, newAdminRequest(t, keys, "GET", "/api/admin/users", nil))
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403 for a demoted admin, got %v", w.Code)
+    }
+
+    // 利用停止された管理者
+    db.EXPECT().GetUserByID(1).Return(User{ID: 1, Role: RoleAdmin, SuspendedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+    w = httptest.NewRecorder()
+    router.ServeHTTP(w, newAdminRequest(t, keys, "GET", "/api/admin/users", nil))
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403 for a suspended admin, got %v", w.Code)
+    }
+}
+
+func TestAdminUsersHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+    db.EXPECT().SearchUsers("example", 10, 20).Return([]AdminUser{{ID: 2, Email: "test2@example.com", Role: RoleUser}}, nil)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newAdminRequest(t, keys, "GET", "/api/admin/users?q=example&limit=10&offset=20", nil))
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    var users []AdminUser
+    json.NewDecoder(w.Body).Decode(&users)
+    if len(users) != 1 || users[0].Email != "test2@example.com" {
+        t.Errorf("Unexpected users: %+v", users)
+    }
+}
+
+func TestAdminSuspendUserHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+    expectTransaction(db)
+    db.EXPECT().SetUserSuspended(2, true).Return(true, nil)
+    db.EXPECT().RevokeUserSessions(2, "").Return(nil)
+    db.EXPECT().CreateAdminAuditLog(gomock.Any()).DoAndReturn(func(entry AdminAuditLog) error {
+        if entry.AdminID != 1 || entry.Action != AdminActionSuspend || entry.TargetUserID != 2 || entry.Reason != "spam" {
+            t.Errorf("Unexpected audit log entry: %+v", entry)
+        }
+        return nil
+    })
+
+    w := httptest.NewRecorder()
+    req := newAdminRequest(t, keys, "POST", "/api/admin/users/2/suspend", SuspendUserRequest{Suspended: true, Reason: "spam"})
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+}
+
+func TestAdminSuspendUserHandlerRequiresReason(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+
+    // 旧ルートではユーザーIDをリクエストボディで指定する
+    w := httptest.NewRecorder()
+    req := newAdminRequest(t, keys, "POST", "/api/admin/users/suspend", SuspendUserRequest{UserID: 2, Suspended: true})
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+
+    // 理由の長さとリクエストボディのキーも検証する
+    for _, body := range []map[string]interface{}{
+        {"suspended": true, "reason": strings.Repeat("a", maxAdminReasonLength+1)},
+        {"suspended": true, "reason": "spam", "role": "admin"},
+    } {
+        expectAdminUser(db)
+        w := serveTestRouter(newTestApp(db, keys), newAdminRequest(t, keys, "POST", "/api/admin/users/2/suspend", body))
+        verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    }
+}
+
+// 監査ログを記録できない場合は、利用停止もセッションの失効も確定しない
+func TestAdminSuspendUserHandlerFailsWithoutAuditLog(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+    db.EXPECT().Transaction(gomock.Any()).DoAndReturn(func(fn func(tx Database) error) error {
+        err := fn(db)
+        if err == nil {
+            t.Errorf("Expected the transaction to be rolled back")
+        }
+        return err
+    })
+    db.EXPECT().SetUserSuspended(2, true).Return(true, nil)
+    db.EXPECT().RevokeUserSessions(2, "").Return(nil)
+    db.EXPECT().CreateAdminAuditLog(gomock.Any()).Return(errors.New("disk full"))
+
+    w := serveTestRouter(newTestApp(db, keys), newAdminRequest(t, keys, "POST", "/api/admin/users/2/suspend", SuspendUserRequest{Suspended: true, Reason: "spam"}))
+    verifyErrorResponse(t, w, http.StatusInternalServerError, ErrCodeInternal)
+}
+
+func TestAdminUnpublishPortfolioHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+    expectTransaction(db)
+    db.EXPECT().UnpublishPortfolio("portfolio-1").Return(true, nil)
+    db.EXPECT().CreateAdminAuditLog(gomock.Any()).DoAndReturn(func(entry AdminAuditLog) error {
+        if entry.Action != AdminActionUnpublish || entry.Target != "portfolio-1" {
+            t.Errorf("Unexpected audit log entry: %+v", entry)
+        }
+        return nil
+    })
+
+    w := httptest.NewRecorder()
+    req := newAdminRequest(t, keys, "POST", "/api/admin/portfolios/portfolio-1/unpublish", UnpublishPortfolioRequest{Reason: "copyright"})
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+}
+
+func TestAdminImpersonateHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", Role: RoleUser}, nil)
+    db.EXPECT().CreateAdminAuditLog(gomock.Any()).DoAndReturn(func(entry AdminAuditLog) error {
+        if entry.Action != AdminActionImpersonate || entry.TargetUserID != 2 {
+            t.Errorf("Unexpected audit log entry: %+v", entry)
+        }
+        return nil
+    })
+    var session Session
+    db.EXPECT().CreateSession(gomock.Any()).DoAndReturn(func(s Session) error {
+        session = s
+        return nil
+    })
+
+    w := httptest.NewRecorder()
+    req := newAdminRequest(t, keys, "POST", "/api/admin/impersonate", ImpersonateRequest{UserID: 2, Reason: "support ticket #42"})
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+
+    // 発行されたトークンは対象ユーザーのセッションとして扱われ、代理ログインであることが記録されている
+    var response ResponseData
+    json.NewDecoder(w.Body).Decode(&response)
+    claims, err := ValidateToken("Bearer "+response.Token, keys)
+    if err != nil || claims.ID != 2 || claims.ImpersonatorID != 1 || session.UserID != 2 || claims.SessionID != session.ID {
+        t.Errorf("Unexpected impersonation claims: %+v (%v)", claims, err)
+    }
+    if response.RefreshToken != "" {
+        t.Errorf("Impersonation must not issue a refresh token")
+    }
+}
+
+func TestImpersonationTokenCannotUseSessionEndpoints(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := NewAuthenticator(keys, db)
+
+    token, _ := keys.Sign(&Claims{ID: 2, Email: "test2@example.com", Role: RoleUser, SessionID: "imp-session", ImpersonatorID: 1})
+    db.EXPECT().GetSession("imp-session").Return(Session{ID: "imp-session", UserID: 2, LastSeenAt: time.Now()}, nil)
+    expectAdminUser(db)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", Role: RoleUser}, nil)
+    req := httptest.NewRequest("POST", "/api/account/password", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+
+    if _, err := auth.AuthenticateSession(req); err != ErrImpersonationNotAllowed {
+        t.Errorf("Expected ErrImpersonationNotAllowed, got %v", err)
+    }
+}
+
+func TestAdminImpersonateHandlerRejectsSuspendedUser(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Role: RoleUser, SuspendedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+
+    w := serveTestRouter(newTestApp(db, keys), newAdminRequest(t, keys, "POST", "/api/admin/impersonate", ImpersonateRequest{UserID: 2, Reason: "support"}))
+    verifyErrorResponse(t, w, http.StatusForbidden, ErrCodeAccountSuspended)
+}
+
+func TestAdminImpersonateHandlerValidation(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+
+    w := serveTestRouter(newTestApp(db, keys), newAdminRequest(t, keys, "POST", "/api/admin/impersonate", map[string]interface{}{"reason": " "}))
+    response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    if len(response.Error.Details) != 2 || response.Error.Details[0].Field != "user_id" || response.Error.Details[1].Field != "reason" {
+        t.Errorf("Expected errors for user_id and reason, got %+v", response.Error.Details)
+    }
+}
+
+// 代理ログインのトークンは、セッションがないもの・管理者か対象ユーザーが利用停止されたものは使えない
+func TestImpersonationTokenIsRevocable(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := NewAuthenticator(keys, db)
+    suspended := sql.NullTime{Time: time.Now(), Valid: true}
+
+    authenticate := func(claims *Claims) error {
+        token, _ := keys.Sign(claims)
+        req := httptest.NewRequest("GET", "/api/me/portfolios", nil)
+        req.Header.Set("Authorization", "Bearer "+token)
+        _, err := auth.Authenticate(req, ScopePortfolioRead)
+        return err
+    }
+    expectSession := func() {
+        db.EXPECT().GetSession("imp-session").Return(Session{ID: "imp-session", UserID: 2, LastSeenAt: time.Now()}, nil)
+    }
+
+    if err := authenticate(&Claims{ID: 2, ImpersonatorID: 1}); err != ErrSessionRevoked {
+        t.Errorf("Expected a token without a session to be rejected, got %v", err)
+    }
+
+    expectSession()
+    db.EXPECT().GetUserByID(1).Return(User{ID: 1, Role: RoleAdmin, SuspendedAt: suspended}, nil)
+    if err := authenticate(&Claims{ID: 2, SessionID: "imp-session", ImpersonatorID: 1}); err != ErrSessionRevoked {
+        t.Errorf("Expected the token to stop working once the admin is suspended, got %v", err)
+    }
+
+    expectSession()
+    expectAdminUser(db)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Role: RoleUser, SuspendedAt: suspended}, nil)
+    if err := authenticate(&Claims{ID: 2, SessionID: "imp-session", ImpersonatorID: 1}); err != ErrAccountSuspended {
+        t.Errorf("Expected the token to stop working once the user is suspended, got %v", err)
+    }
+
+    db.EXPECT().GetSession("imp-session").Return(Session{ID: "imp-session", UserID: 2, RevokedAt: suspended}, nil)
+    if err := authenticate(&Claims{ID: 2, SessionID: "imp-session", ImpersonatorID: 1}); err != ErrSessionRevoked {
+        t.Errorf("Expected a revoked impersonation session to be rejected, got %v", err)
+    }
+}
+
+func TestLoginHandlerRejectsSuspendedUser(t *testing.T) {
+    db, keys := setupMock(t)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    validUser.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+
+    body, _ := json.Marshal(validCreds)
+    w := httptest.NewRecorder()
+    LoginHandler(w, httptest.NewRequest("POST", "/api/login", bytes.NewReader(body)), NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403, got %v", w.Code)
+    }
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+)
+
+// エラーコード（クライアントはメッセージではなくコードで分岐する）
+const (
+    // リクエストの形式
+    ErrCodeInvalidRequest   = "invalid_request"   // JSONなどの形式が不正
+    ErrCodeValidationFailed = "validation_failed" // 項目の値が不正（detailsに項目ごとの内容）
+    ErrCodeRequestTooLarge  = "request_too_large"
+    ErrCodeImageRequired    = "image_required"
+
+    // 認証
+    ErrCodeUnauthorized             = "unauthorized"
+    ErrCodeInvalidCredentials       = "invalid_credentials"
+    ErrCodeInvalidPassword          = "invalid_password"
+    ErrCodeInvalidVerificationToken = "invalid_verification_token"
+    ErrCodeInvalidResetToken        = "invalid_reset_token"
+    ErrCodeInvalidConfirmationLink  = "invalid_confirmation_link"
+    ErrCodeInvalidChallengeToken    = "invalid_challenge_token"
+    ErrCodeInvalidRefreshToken      = "invalid_refresh_token"
+    ErrCodeRefreshTokenExpired      = "refresh_token_expired"
+    ErrCodeRefreshTokenReused       = "refresh_token_reused"
+    ErrCodeSessionRevoked           = "session_revoked"
+    ErrCodeSessionUnknown           = "session_unknown"
+    ErrCodeInvalidTwoFactorCode     = "invalid_two_factor_code"
+    ErrCodeTooManyLoginAttempts     = "too_many_login_attempts"
+
+    // 権限
+    ErrCodeForbidden               = "forbidden"
+    ErrCodeInsufficientScope       = "insufficient_scope"
+    ErrCodeCSRFTokenMismatch       = "csrf_token_mismatch"
+    ErrCodeImpersonationNotAllowed = "impersonation_not_allowed"
+    ErrCodeAccountSuspended        = "account_suspended"
+    ErrCodeAccountPendingDeletion  = "account_pending_deletion"
+    ErrCodeEmailNotVerified        = "email_not_verified"
+    ErrCodeCannotSuspendSelf       = "cannot_suspend_self"
+    ErrCodeCannotImpersonateAdmin  = "cannot_impersonate_admin"
+    ErrCodeOriginNotAllowed        = "origin_not_allowed"
+    ErrCodeCORSMethodNotAllowed    = "cors_method_not_allowed"
+
+    // 状態の競合
+    ErrCodeEmailTaken                 = "email_taken"
+    ErrCodeSameEmail                  = "same_email"
+    ErrCodeAccountNotPendingDeletion  = "account_not_pending_deletion"
+    ErrCodeTwoFactorAlreadyEnabled    = "two_factor_already_enabled"
+    ErrCodeTwoFactorNotEnabled        = "two_factor_not_enabled"
+    ErrCodeTwoFactorSetupNotStarted   = "two_factor_setup_not_started"
+    ErrCodeVerificationEmailRateLimit = "verification_email_rate_limited"
+
+    // 対象が存在しない
+    ErrCodeNotFound               = "not_found"
+    ErrCodeMethodNotAllowed       = "method_not_allowed"
+    ErrCodeUserNotFound           = "user_not_found"
+    ErrCodePortfolioNotFound      = "portfolio_not_found"
+    ErrCodeTokenNotFound          = "token_not_found"
+    ErrCodeSessionNotFound        = "session_not_found"
+    ErrCodeShareLinkNotFound      = "share_link_not_found"
+    ErrCodeOAuthNotConfigured     = "oauth_not_configured"
+    ErrCodeCookieSessionsDisabled = "cookie_sessions_disabled"
+
+    // サーバー側のエラー
+    ErrCodeEmailDeliveryFailed = "email_delivery_failed"
+    ErrCodeInternal            = "internal_error"
+)
+
+// 項目ごとのエラーコード（FieldError.Code）
+const (
+    FieldErrRequired        = "required"
+    FieldErrTooShort        = "too_short"
+    FieldErrTooLong         = "too_long"
+    FieldErrInvalidEmail    = "invalid_email"
+    FieldErrInvalid         = "invalid"
+    FieldErrInvalidType     = "invalid_type"
+    FieldErrInvalidURL      = "invalid_url"
+    FieldErrHostNotAllowed  = "host_not_allowed"
+    FieldErrInvalidUsername = "invalid_username"
+    FieldErrNotAllowed      = "not_allowed"
+    FieldErrUnknownField    = "unknown_field"
+    FieldErrOutOfRange      = "out_of_range"
+    FieldErrNegative        = "negative"
+    FieldErrUnknownScope    = "unknown_scope"
+)
+
+// エラーレスポンス
+// {"error": {"code": "...", "message": "...", "details": [...], "request_id": "..."}}
+type ErrorResponse struct {
+    Error APIError `json:"error"`
+}
+
+type APIError struct {
+    Code      string       `json:"code"`
+    Message   string       `json:"message"`              // Accept-Languageに応じた表示用のメッセージ
+    Details   []FieldError `json:"details,omitempty"`    // 項目ごとの入力エラー
+    RequestID string       `json:"request_id,omitempty"` // 問い合わせ時にログと突き合わせるためのID
+}
+
+// 項目ごとの入力エラー
+type FieldError struct {
+    Field   string `json:"field"`
+    Code    string `json:"code"`
+    Message string `json:"message"`
+
+    args []interface{} // メッセージの書式に埋め込む値
+}
+
+// 項目ごとの入力エラーを作成する（メッセージはレスポンスを書き込むときに言語に合わせて設定する）
+func newFieldError(field string, code string, args ...interface{}) FieldError {
+    return FieldError{Field: field, Code: code, args: args}
+}
+
+// エラーレスポンスを書き込む
+// メッセージはcodeに対応する文言をAccept-Languageの言語で返す（argsは文言の書式に埋め込む値）
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, args ...interface{}) {
+    writeErrorResponse(w, r, status, code, nil, args...)
+}
+
+// 入力エラー（422 validation_failed）を不正な項目すべての内容とともに書き込む
+func writeFieldErrors(w http.ResponseWriter, r *http.Request, details ...FieldError) {
+    writeErrorResponse(w, r, http.StatusUnprocessableEntity, ErrCodeValidationFailed, details)
+}
+
+// 認証・認可のエラーを対応するステータスコードとエラーコードで書き込む
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+    writeError(w, r, authErrorStatus(err), authErrorCode(err))
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code string, details []FieldError, args ...interface{}) {
+    lang := negotiateLanguage(r.Header.Get("Accept-Language"))
+    apiErr := APIError{
+        Code:    code,
+        Message: localizeError(lang, code, args...),
+    }
+    for _, detail := range details {
+        detail.Message = localizeFieldError(lang, detail.Code, detail.args...)
+        apiErr.Details = append(apiErr.Details, detail)
+    }
+    if info := requestInfoFromContext(r.Context()); info != nil {
+        apiErr.RequestID = info.ID
+    }
+
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.Header().Set("Content-Language", lang)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.Header().Add("Vary", "Accept-Language")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(ErrorResponse{Error: apiErr})
+}
+
+// 認証・認可のエラーに対応するエラーコード
+func authErrorCode(err error) string {
+    switch err {
+    case ErrInsufficientScope:
+        return ErrCodeInsufficientScope
+    case ErrCSRFTokenMismatch:
+        return ErrCodeCSRFTokenMismatch
+    case ErrForbidden:
+        return ErrCodeForbidden
+    case ErrImpersonationNotAllowed:
+        return ErrCodeImpersonationNotAllowed
+    case ErrAccountSuspended:
+        return ErrCodeAccountSuspended
+    case ErrAccountPendingDeletion:
+        return ErrCodeAccountPendingDeletion
+    case ErrSessionRevoked:
+        return ErrCodeSessionRevoked
+    }
+    return ErrCodeUnauthorized
+}
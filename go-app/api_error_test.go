@@ -0,0 +1,111 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// エラーレスポンスのステータスコードとエラーコードを検証する
+func verifyErrorResponse(t *testing.T, w *httptest.ResponseRecorder, expectedStatusCode int, expectedCode string) ErrorResponse {
+    t.Helper()
+    if w.Code != expectedStatusCode {
+        t.Errorf("Expected status %v, got %v", expectedStatusCode, w.Code)
+    }
+    var response ErrorResponse
+    if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+        t.Fatalf("Failed to decode error response: %v", err)
+    }
+    if response.Error.Code != expectedCode {
+        t.Errorf("Expected error code %q, got %q", expectedCode, response.Error.Code)
+    }
+    return response
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+    tests := []struct {
+        header string
+        want   string
+    }{
+        {"", langEN},
+        {"ja", langJA},
+        {"ja-JP,ja;q=0.9,en;q=0.8", langJA},
+        {"en-US,en;q=0.9,ja;q=0.8", langEN},
+        {"fr-FR,ja;q=0.5", langJA},
+        {"fr-FR", langEN},
+        {"en;q=0.2,ja;q=0.7", langJA},
+    }
+    for _, tt := range tests {
+        if got := negotiateLanguage(tt.header); got != tt.want {
+            t.Errorf("negotiateLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+        }
+    }
+}
+
+func TestErrorMessagesAreComplete(t *testing.T) {
+    for code, messages := range errorMessages {
+        if messages[langEN] == "" || messages[langJA] == "" {
+            t.Errorf("Missing translation for error code %q", code)
+        }
+    }
+    for code, messages := range fieldErrorMessages {
+        if messages[langEN] == "" || messages[langJA] == "" {
+            t.Errorf("Missing translation for field error code %q", code)
+        }
+    }
+}
+
+func TestErrorResponseIsLocalized(t *testing.T) {
+    db, keys := setupMock(t)
+
+    req := httptest.NewRequest("GET", "/api/me/portfolios", nil)
+    req.Header.Set("Accept-Language", "ja-JP,ja;q=0.9")
+    req.Header.Set(requestIDHeader, "req-ja")
+    w := serveTestRouter(newTestApp(db, keys), req)
+
+    response := verifyErrorResponse(t, w, http.StatusUnauthorized, ErrCodeUnauthorized)
+    if response.Error.Message != errorMessages[ErrCodeUnauthorized][langJA] {
+        t.Errorf("Expected the Japanese message, got %q", response.Error.Message)
+    }
+    if response.Error.RequestID != "req-ja" {
+        t.Errorf("Expected the request ID in the error, got %q", response.Error.RequestID)
+    }
+    if w.Header().Get("Content-Language") != langJA {
+        t.Errorf("Expected Content-Language ja, got %q", w.Header().Get("Content-Language"))
+    }
+}
+
+func TestFieldErrorDetails(t *testing.T) {
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("Accept-Language", "en")
+    w := httptest.NewRecorder()
+    writeFieldErrors(w, req, newFieldError("password", FieldErrTooShort, 8))
+
+    response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    if len(response.Error.Details) != 1 {
+        t.Fatalf("Expected one field error, got %+v", response.Error.Details)
+    }
+    detail := response.Error.Details[0]
+    if detail.Field != "password" || detail.Code != FieldErrTooShort || detail.Message != "Must be at least 8 characters." {
+        t.Errorf("Unexpected field error: %+v", detail)
+    }
+}
+
+func TestRouterNotFoundIsJSON(t *testing.T) {
+    db, keys := setupMock(t)
+
+    w := serveTestRouter(newTestApp(db, keys), httptest.NewRequest("GET", "/api/no-such-route", nil))
+    verifyErrorResponse(t, w, http.StatusNotFound, ErrCodeNotFound)
+}
+
+func TestRouterMethodNotAllowedIsJSON(t *testing.T) {
+    db, keys := setupMock(t)
+
+    w := serveTestRouter(newTestApp(db, keys), httptest.NewRequest("GET", "/api/login", nil))
+    verifyErrorResponse(t, w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed)
+    if allow := w.Header().Get("Allow"); !strings.Contains(allow, "POST") {
+        t.Errorf("Expected Allow to contain POST, got %q", allow)
+    }
+}
@@ -9,31 +9,175 @@ import (
     "net/http"
     "strings"
     "time"
-	"log"
 )
 
 type Claims struct {
-    ID    int    `json:"id"`
-    Email string `json:"email"`
+    ID             int      `json:"id"`
+    Email          string   `json:"email"`
+    Purpose        string   `json:"purpose,omitempty"`    // メール認証などの用途限定トークンで設定される
+    Scopes         []string `json:"scopes,omitempty"`     // パーソナルアクセストークンで認証した場合のスコープ
+    SessionID      string   `json:"sid,omitempty"`        // ログインセッションのID（失効の確認に使う）
+    Role           string   `json:"role,omitempty"`       // ユーザーのロール（管理者など）
+    ImpersonatorID int      `json:"imp,omitempty"`        // サポートのために代理ログインしている管理者のID
+    PreviousEmail  string   `json:"prev_email,omitempty"` // メールアドレス変更の確認リンクで、申請時のメールアドレス
     jwt.StandardClaims
 }
 
-func GenerateJWT(id int, email string, jwtKey string) (string, error) {
+// スコープを持つかどうか（JWTでログインしている場合はすべての操作を許可する）
+func (c *Claims) HasScope(scope string) bool {
+    if c.Scopes == nil {
+        return true
+    }
+    for _, s := range c.Scopes {
+        if s == scope {
+            return true
+        }
+    }
+    return false
+}
+
+// リクエストの認証を行う（Bearer JWTとパーソナルアクセストークンの両方に対応）
+// Cookieセッションモードが有効な場合は、HttpOnly CookieのJWTも受け付ける
+type Authenticator struct {
+    keys    *KeySet
+    db      Database
+    cookies *SessionCookieConfig // nilの場合はCookieセッションモード無効
+    metrics *Metrics             // nilの場合はログイン試行を記録しない
+}
+
+func NewAuthenticator(keys *KeySet, db Database) *Authenticator {
+    return &Authenticator{keys: keys, db: db}
+}
+
+// Authorizationヘッダーを検証してClaimsを返す
+// パーソナルアクセストークンの場合はscopeを持っている必要がある（scopeが空の場合は有効なトークンであればよい）
+func (a *Authenticator) Authenticate(r *http.Request, scope string) (*Claims, error) {
+    authHeader := r.Header.Get("Authorization")
+    if authHeader == "" && a.cookies != nil {
+        return a.authenticateCookie(r)
+    }
+
+    db := withRequestContext(a.db, r)
+    headerParts := strings.Split(authHeader, " ")
+    if len(headerParts) == 2 && headerParts[0] == "Bearer" && isPersonalAccessToken(headerParts[1]) {
+        claims, err := validatePersonalAccessToken(db, headerParts[1])
+        if err != nil {
+            return nil, err
+        }
+        if scope != "" && !claims.HasScope(scope) {
+            return nil, ErrInsufficientScope
+        }
+        return claims, nil
+    }
+
+    return a.validateToken(db, authHeader)
+}
+
+// アクセストークンを検証し、セッションが失効していないことを確認する
+func (a *Authenticator) ValidateToken(authHeader string) (*Claims, error) {
+    return a.validateToken(a.db, authHeader)
+}
+
+func (a *Authenticator) validateToken(db Database, authHeader string) (*Claims, error) {
+    claims, err := ValidateToken(authHeader, a.keys)
+    if err != nil {
+        return nil, err
+    }
+    if claims.SessionID != "" && db != nil {
+        if err := checkSession(db, claims); err != nil {
+            return nil, err
+        }
+    }
+    if claims.ImpersonatorID != 0 && db != nil {
+        if err := checkImpersonation(db, claims); err != nil {
+            return nil, err
+        }
+    }
+    return claims, nil
+}
+
+// ログインセッション（JWT）でのみ認証する
+// トークン管理や二要素認証の設定など、パーソナルアクセストークンや代理ログインに許可しない操作で使う
+func (a *Authenticator) AuthenticateSession(r *http.Request) (*Claims, error) {
+    var claims *Claims
+    var err error
+    authHeader := r.Header.Get("Authorization")
+    if authHeader == "" && a.cookies != nil {
+        claims, err = a.authenticateCookie(r)
+    } else {
+        claims, err = a.validateToken(withRequestContext(a.db, r), authHeader)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if claims.ImpersonatorID != 0 {
+        return nil, ErrImpersonationNotAllowed
+    }
+    return claims, nil
+}
+
+// トークンに必要なスコープがない場合のエラー
+var ErrInsufficientScope = errors.New("Token does not have the required scope")
+
+// 認証エラーに対応するHTTPステータスコード
+func authErrorStatus(err error) int {
+    if err == ErrInsufficientScope || err == ErrCSRFTokenMismatch || err == ErrForbidden || err == ErrImpersonationNotAllowed || err == ErrAccountSuspended || err == ErrAccountPendingDeletion {
+        return http.StatusForbidden
+    }
+    return http.StatusUnauthorized
+}
+
+func GenerateJWT(id int, email string, keys *KeySet) (string, error) {
+    return GenerateSessionJWT(User{ID: id, Email: email}, "", keys)
+}
+
+// ログインしたユーザーのロールとセッションIDを含むアクセストークンを生成する
+func GenerateSessionJWT(user User, sessionID string, keys *KeySet) (string, error) {
     // expirationTime := time.Now().Add(1 * time.Hour) 
-    expirationTime := time.Now().Add(time.Hour * 1) // 有効期限を1時間後に設定
+    expirationTime := time.Now().Add(tokenLifetimes.Access) // 有効期限を設定（既定は1時間後）
 
     claims := &Claims{
-        ID:    id,
-        Email: email,
+        ID:        user.ID,
+        Email:     user.Email,
+        Role:      user.Role,
+        SessionID: sessionID,
         StandardClaims: jwt.StandardClaims{
             ExpiresAt: expirationTime.Unix(),
         },
     }
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    tokenString, err := token.SignedString([]byte(jwtKey))
+    // 鍵セットの署名鍵で署名する（RS256/EdDSAの場合はヘッダーにkidを含める）
+    return keys.Sign(claims)
+}
+
+// 特定の用途（メール認証など）にのみ使える署名付きトークンを生成する
+func GenerateActionToken(id int, email string, purpose string, lifetime time.Duration, keys *KeySet) (string, error) {
+    claims := &Claims{
+        ID:      id,
+        Email:   email,
+        Purpose: purpose,
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: time.Now().Add(lifetime).Unix(),
+            IssuedAt:  time.Now().Unix(),
+        },
+    }
+
+    return keys.Sign(claims)
+}
+
+// 用途限定トークンを検証し、用途が一致する場合のみClaimsを返す
+func ValidateActionToken(tokenString string, purpose string, keys *KeySet) (*Claims, error) {
+    claims := &Claims{}
+    token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
+    if err != nil {
+        return nil, err
+    }
+
+    if !token.Valid || claims.Purpose != purpose {
+        return nil, errors.New("Invalid token")
+    }
 
-    return tokenString, err
+    return claims, nil
 }
 
 func GenerateCSRFToken() (string, error) {
@@ -45,7 +189,7 @@ func GenerateCSRFToken() (string, error) {
     return base64.StdEncoding.EncodeToString(b), nil
 }
 
-func ValidateToken(authHeader string, jwtKey string) (*Claims, error) {
+func ValidateToken(authHeader string, keys *KeySet) (*Claims, error) {
 	headerParts := strings.Split(authHeader, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 		return nil, errors.New("Authorization header must be in format 'Bearer {token}'")
@@ -53,50 +197,39 @@ func ValidateToken(authHeader string, jwtKey string) (*Claims, error) {
 
 	tokenString := headerParts[1]
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if !token.Valid {
+	// 用途限定トークンはアクセストークンとして受け付けない
+	if !token.Valid || claims.Purpose != "" {
 		return nil, errors.New("Invalid token")
 	}
 
 	return claims, nil
 }
 
-func AuthHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
-    // CORSプリフライトリクエストへの対応
-    if r.Method == "OPTIONS" {
-        EnableCORS(w)
-        w.WriteHeader(http.StatusOK)
-        return
-    }
-
-    EnableCORS(w) // 通常のリクエストに対するCORSヘッダーの設定
-
-
-    // AuthorizationヘッダーからJWTトークンを検証
-    claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
+func AuthHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator) {
+    // Authorizationヘッダーからトークンを検証
+    claims, err := auth.Authenticate(r, "")
     if err != nil {
         // エラーの内容に基づいた適切なHTTPステータスコードでレスポンスを返す
         httpStatus := http.StatusUnauthorized
         if err == jwt.ErrSignatureInvalid {
-            log.Println("Auth Error: Token signature is invalid")
+            requestLogger(r).Info("Auth Error: Token signature is invalid")
             httpStatus = http.StatusUnauthorized // トークンの署名が無効
         } else {
-            log.Printf("Auth Error: Error parsing token: %v\n", err)
+            requestLogger(r).Info("Auth Error: Error parsing token", "error", err)
             httpStatus = http.StatusBadRequest // トークンの解析エラー
         }
-        http.Error(w, err.Error(), httpStatus)
+        writeError(w, r, httpStatus, ErrCodeUnauthorized)
         return
     }
 
     // トークンが有効であれば、認証成功のレスポンスを返す
-    log.Println("Auth Success: Token is valid")
+    requestLogger(r).Debug("Auth Success: Token is valid", "user_id", claims.ID)
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(claims)
 }
@@ -8,43 +8,21 @@ import (
 		"time"
 )
 
-func TestEnableCORS(t *testing.T) {
-    // レスポンスライターをモック
-    res := httptest.NewRecorder()
-
-    // EnableCORS関数を実行
-    EnableCORS(res)
-
-    // レスポンスヘッダーを取得
-    headers := res.Header()
-
-    // 各ヘッダーの検証
-    if headers.Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
-        t.Errorf("Expected 'Access-Control-Allow-Origin' header to be 'http://localhost:3000', got '%s'", headers.Get("Access-Control-Allow-Origin"))
-    }
-
-    if headers.Get("Access-Control-Allow-Credentials") != "true" {
-        t.Errorf("Expected 'Access-Control-Allow-Credentials' to be 'true', got '%s'", headers.Get("Access-Control-Allow-Credentials"))
-    }
-
-    // 他のヘッダーも同様に検証...
-}
-
 func TestGenerateJWT(t *testing.T) {
     // テスト用のユーザーIDとメールアドレス
     userID := 123
     userEmail := "test@example.com"
-    jwtKey := "testkey"
+    keys := NewHMACKeySet("testkey")
 
     // JWTトークンを生成
-    tokenString, err := GenerateJWT(userID, userEmail, jwtKey)
+    tokenString, err := GenerateJWT(userID, userEmail, keys)
     if err != nil {
         t.Fatalf("Failed to generate token: %v", err)
     }
 
     // 生成されたトークンを解析
     token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(jwtKey), nil
+        return []byte("testkey"), nil
     })
     if err != nil {
         t.Fatalf("Failed to parse token: %v", err)
@@ -85,20 +63,20 @@ func TestGenerateCSRFToken(t *testing.T) {
 
 
 func TestValidateToken(t *testing.T) {
-    validToken, _ := GenerateJWT(123, "test@example.com", "testkey")
+    validToken, _ := GenerateJWT(123, "test@example.com", NewHMACKeySet("testkey"))
     authHeader := "Bearer " + validToken
 
-    _, err := ValidateToken(authHeader, "testkey")
+    _, err := ValidateToken(authHeader, NewHMACKeySet("testkey"))
     if err != nil {
         t.Errorf("Valid token was not accepted: %v", err)
     }
 
-    _, err = ValidateToken("InvalidTokenFormat", "testkey")
+    _, err = ValidateToken("InvalidTokenFormat", NewHMACKeySet("testkey"))
     if err == nil {
         t.Errorf("Invalid token format was accepted")
     }
 
-    _, err = ValidateToken("Bearer InvalidToken", "testkey")
+    _, err = ValidateToken("Bearer InvalidToken", NewHMACKeySet("testkey"))
     if err == nil {
         t.Errorf("Invalid token was accepted")
     }
@@ -106,22 +84,14 @@ func TestValidateToken(t *testing.T) {
 
 
 func TestAuthHandler(t *testing.T) {
-    jwtKey := "testkey"
-    validToken, _ := GenerateJWT(123, "test@example.com", jwtKey)
-
-    // OPTIONSリクエストのテスト
-    req := httptest.NewRequest(http.MethodOptions, "/api/auth", nil)
-    res := httptest.NewRecorder()
-    AuthHandler(res, req, jwtKey)
-    if res.Code != http.StatusOK {
-        t.Errorf("OPTIONS request failed: expected status 200, got %v", res.Code)
-    }
+    keys := NewHMACKeySet("testkey")
+    validToken, _ := GenerateJWT(123, "test@example.com", keys)
 
     // 有効なAuthorizationヘッダーを持つリクエストのテスト
-    req = httptest.NewRequest(http.MethodGet, "/api/auth", nil)
+    req := httptest.NewRequest(http.MethodGet, "/api/auth", nil)
     req.Header.Set("Authorization", "Bearer "+validToken)
-    res = httptest.NewRecorder()
-    AuthHandler(res, req, jwtKey)
+    res := httptest.NewRecorder()
+    AuthHandler(res, req, NewAuthenticator(keys, nil))
     if res.Code != http.StatusOK {
         t.Errorf("Valid request failed: expected status 200, got %v", res.Code)
     }
@@ -130,7 +100,7 @@ func TestAuthHandler(t *testing.T) {
     req = httptest.NewRequest(http.MethodGet, "/api/auth", nil)
     req.Header.Set("Authorization", "InvalidToken")
     res = httptest.NewRecorder()
-    AuthHandler(res, req, jwtKey)
+    AuthHandler(res, req, NewAuthenticator(keys, nil))
     if res.Code == http.StatusOK {
         t.Errorf("Invalid request was accepted")
     }
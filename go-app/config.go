@@ -0,0 +1,323 @@
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "errors"
+    "flag"
+    "fmt"
+    "io/fs"
+    "log/slog"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/joho/godotenv"
+)
+
+// 設定の既定値
+const (
+    defaultListenAddr = ":8080"
+    defaultImageDir   = "images"
+    defaultAppBaseURL = "http://localhost:3000"
+    defaultEnvFile    = "../.env"
+)
+
+// AES秘密鍵の長さ（AES-256）
+const aesKeyLength = 32
+
+// サーバーの設定
+// 値はコマンドライン引数 > 環境変数（.envファイルを含む） > 設定ファイル > 既定値 の順に優先する
+type Config struct {
+    ListenAddr           string // 待ち受けるアドレス（LISTEN_ADDR）
+    ImageDir             string // アップロードされた画像の保存先（IMAGE_DIR）
+    AppBaseURL           string // メール内のリンクに使うフロントエンドのURL（APP_BASE_URL）
+    RequireVerifiedEmail bool   // メールアドレス未確認のユーザーはポートフォリオを公開できない（REQUIRE_EMAIL_VERIFICATION）
+    AutoMigrate          bool   // 起動時に未適用のマイグレーションを適用する（AUTO_MIGRATE）
+    AESKey               []byte // 共有リンクの暗号化鍵（AES_SECRET_KEY、base64）
+    TOTPKey              []byte // TOTPシークレットの暗号化鍵（TOTP_SECRET_KEY、base64、AES_SECRET_KEYとは別の鍵。未設定の場合は二要素認証を使えない）
+    LogLevel             slog.Level // 出力するログの最低レベル（LOG_LEVEL: debug / info / warn / error）
+
+    Server   ServerConfig
+    Database DBConfig
+    DBPool   DBPoolConfig
+    JWT      JWTConfig
+    Tokens   TokenLifetimes
+    CORS     CORSConfig
+    Cookies  *SessionCookieConfig // Cookieセッションモードが無効の場合はnil
+    Mail     MailConfig
+    OAuth    *OAuthConfig // 外部プロバイダーでのログインが無効の場合はnil
+}
+
+// 各トークンの有効期限
+type TokenLifetimes struct {
+    Access             time.Duration // アクセストークン(JWT)とセッションCookie（ACCESS_TOKEN_LIFETIME）
+    Refresh            time.Duration // リフレッシュトークン（REFRESH_TOKEN_LIFETIME）
+    EmailVerification  time.Duration // メールアドレス確認のリンク（EMAIL_VERIFICATION_LIFETIME）
+    EmailChange        time.Duration // メールアドレス変更の確認リンク（EMAIL_CHANGE_LIFETIME）
+    PasswordReset      time.Duration // パスワードリセットのリンク（PASSWORD_RESET_LIFETIME）
+    Impersonation      time.Duration // 管理者の代理ログイン（IMPERSONATION_TOKEN_LIFETIME）
+    TwoFactorChallenge time.Duration // 二要素認証の2段階目までの猶予（TWO_FACTOR_CHALLENGE_LIFETIME）
+}
+
+var defaultTokenLifetimes = TokenLifetimes{
+    Access:             1 * time.Hour,
+    Refresh:            30 * 24 * time.Hour,
+    EmailVerification:  24 * time.Hour,
+    EmailChange:        24 * time.Hour,
+    PasswordReset:      1 * time.Hour,
+    Impersonation:      15 * time.Minute,
+    TwoFactorChallenge: 5 * time.Minute,
+}
+
+// 現在のトークンの有効期限（起動時にConfigの値で置き換える）
+var tokenLifetimes = defaultTokenLifetimes
+
+// 設定値の取得元
+type configSource struct {
+    flags map[string]string // コマンドライン引数（-set KEY=VALUE と個別のフラグ）
+    file  map[string]string // 設定ファイル（環境変数と同じKEY=VALUE形式）
+}
+
+// 設定値を取得する（コマンドライン引数 > 環境変数 > 設定ファイル、いずれにもない場合は空）
+func (s configSource) get(key string) string {
+    if value, ok := s.flags[key]; ok {
+        return value
+    }
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return s.file[key]
+}
+
+// 期間（例: 720h）を読み込む（未設定の場合はdefaultValue）
+func (s configSource) duration(key string, defaultValue time.Duration) (time.Duration, error) {
+    value := s.get(key)
+    if value == "" {
+        return defaultValue, nil
+    }
+    d, err := time.ParseDuration(value)
+    if err != nil {
+        return 0, fmt.Errorf("invalid %s: %v", key, err)
+    }
+    return d, nil
+}
+
+// 0以上の整数を読み込む（未設定の場合はdefaultValue）
+func (s configSource) integer(key string, defaultValue int) (int, error) {
+    value := s.get(key)
+    if value == "" {
+        return defaultValue, nil
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("invalid %s: %q", key, value)
+    }
+    return n, nil
+}
+
+// true / false を読み込む（未設定の場合はdefaultValue）
+func (s configSource) boolean(key string, defaultValue bool) (bool, error) {
+    value := s.get(key)
+    if value == "" {
+        return defaultValue, nil
+    }
+    b, err := strconv.ParseBool(value)
+    if err != nil {
+        return false, fmt.Errorf("invalid %s: %q", key, value)
+    }
+    return b, nil
+}
+
+// -set KEY=VALUE（複数指定可）
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+    return ""
+}
+
+func (f keyValueFlag) Set(value string) error {
+    key, v, ok := strings.Cut(value, "=")
+    if !ok || key == "" {
+        return fmt.Errorf("expected KEY=VALUE, got %q", value)
+    }
+    f[key] = v
+    return nil
+}
+
+// コマンドライン引数・環境変数・設定ファイルから設定を読み込み、すべての値を検証する
+// フラグ以外の引数（migrateサブコマンドなど）を2番目の戻り値として返す
+func LoadConfig(args []string) (*Config, []string, error) {
+    flags := flag.NewFlagSet("go-app", flag.ContinueOnError)
+    configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "設定ファイル（KEY=VALUE形式）")
+    envFile := flags.String("env-file", defaultEnvFile, ".envファイル（存在しない場合は読み込まない）")
+    // よく使う設定には個別のフラグを用意する（それ以外は-setで指定する）
+    named := map[string]*string{
+        "LISTEN_ADDR":          flags.String("listen", "", "待ち受けるアドレス（LISTEN_ADDR）"),
+        "IMAGE_DIR":            flags.String("image-dir", "", "画像の保存先（IMAGE_DIR）"),
+        "APP_BASE_URL":         flags.String("app-base-url", "", "フロントエンドのURL（APP_BASE_URL）"),
+        "DB_DRIVER":            flags.String("db-driver", "", "mysql または sqlite（DB_DRIVER）"),
+        "CORS_ALLOWED_ORIGINS": flags.String("cors-origins", "", "CORSで許可するオリジン（CORS_ALLOWED_ORIGINS）"),
+    }
+    overrides := keyValueFlag{}
+    flags.Var(overrides, "set", "任意の設定をKEY=VALUEで指定する（複数指定可）")
+    if err := flags.Parse(args); err != nil {
+        return nil, nil, err
+    }
+
+    src := configSource{flags: map[string]string{}}
+    for key, value := range overrides {
+        src.flags[key] = value
+    }
+    flagNames := map[string]string{"listen": "LISTEN_ADDR", "image-dir": "IMAGE_DIR", "app-base-url": "APP_BASE_URL", "db-driver": "DB_DRIVER", "cors-origins": "CORS_ALLOWED_ORIGINS"}
+    flags.Visit(func(f *flag.Flag) {
+        if key, ok := flagNames[f.Name]; ok {
+            src.flags[key] = *named[key]
+        }
+    })
+
+    // .envファイルの値は、すでに設定されている環境変数を上書きしない
+    if err := godotenv.Load(*envFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return nil, nil, fmt.Errorf("failed to load %s: %v", *envFile, err)
+    }
+    if *configFile != "" {
+        values, err := godotenv.Read(*configFile)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to read config file %s: %v", *configFile, err)
+        }
+        src.file = values
+    }
+
+    config, err := loadConfig(src)
+    if err != nil {
+        return nil, nil, err
+    }
+    return config, flags.Args(), nil
+}
+
+// srcから設定を読み込む（エラーはまとめて返す）
+func loadConfig(src configSource) (*Config, error) {
+    config := &Config{
+        ListenAddr: src.get("LISTEN_ADDR"),
+        ImageDir:   src.get("IMAGE_DIR"),
+        AppBaseURL: strings.TrimRight(src.get("APP_BASE_URL"), "/"),
+    }
+    if config.ListenAddr == "" {
+        config.ListenAddr = defaultListenAddr
+    }
+    if config.ImageDir == "" {
+        config.ImageDir = defaultImageDir
+    }
+    if config.AppBaseURL == "" {
+        config.AppBaseURL = defaultAppBaseURL
+    }
+
+    var errs []error
+    check := func(err error) {
+        if err != nil {
+            errs = append(errs, err)
+        }
+    }
+
+    var err error
+    config.RequireVerifiedEmail, err = src.boolean("REQUIRE_EMAIL_VERIFICATION", false)
+    check(err)
+    config.AutoMigrate, err = src.boolean("AUTO_MIGRATE", false)
+    check(err)
+    if level := src.get("LOG_LEVEL"); level != "" {
+        if err := config.LogLevel.UnmarshalText([]byte(level)); err != nil {
+            errs = append(errs, fmt.Errorf("invalid LOG_LEVEL: %q", level))
+        }
+    }
+    config.AESKey, err = loadAESKey(src)
+    check(err)
+    config.TOTPKey, err = loadTOTPKey(src)
+    check(err)
+    if config.AESKey != nil && bytes.Equal(config.AESKey, config.TOTPKey) {
+        errs = append(errs, errors.New("TOTP_SECRET_KEY must differ from AES_SECRET_KEY"))
+    }
+    config.Server, err = loadServerConfig(src)
+    check(err)
+    config.Database, err = loadDBConfig(src)
+    check(err)
+    config.DBPool, err = loadDBPoolConfig(src)
+    check(err)
+    config.JWT, err = loadJWTConfig(src)
+    check(err)
+    config.Tokens, err = loadTokenLifetimes(src)
+    check(err)
+    config.CORS, err = loadCORSConfig(src)
+    check(err)
+    config.Cookies, err = loadSessionCookieConfig(src)
+    check(err)
+    config.Mail = loadMailConfig(src)
+    config.OAuth, err = loadOAuthConfig(src)
+    check(err)
+
+    if len(errs) > 0 {
+        return nil, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+    }
+    return config, nil
+}
+
+// AES_SECRET_KEY（base64エンコードされた32バイトの鍵）を読み込む
+func loadAESKey(src configSource) ([]byte, error) {
+    return loadEncryptionKey(src, "AES_SECRET_KEY")
+}
+
+// TOTP_SECRET_KEY（base64エンコードされた32バイトの鍵）を読み込む
+// 二要素認証を使わない環境では未設定でもよく、その場合はTOTPシークレットの暗号化・復号時にエラーになる
+func loadTOTPKey(src configSource) ([]byte, error) {
+    if src.get("TOTP_SECRET_KEY") == "" {
+        return nil, nil
+    }
+    return loadEncryptionKey(src, "TOTP_SECRET_KEY")
+}
+
+func loadEncryptionKey(src configSource, name string) ([]byte, error) {
+    value := src.get(name)
+    if value == "" {
+        return nil, fmt.Errorf("%s must be set", name)
+    }
+    key, err := base64.StdEncoding.DecodeString(value)
+    if err != nil {
+        return nil, fmt.Errorf("%s must be base64-encoded: %v", name, err)
+    }
+    if len(key) != aesKeyLength {
+        return nil, fmt.Errorf("%s must be %d bytes after decoding, got %d", name, aesKeyLength, len(key))
+    }
+    return key, nil
+}
+
+// 各トークンの有効期限を読み込む
+func loadTokenLifetimes(src configSource) (TokenLifetimes, error) {
+    lifetimes := defaultTokenLifetimes
+    var errs []error
+    for _, field := range []struct {
+        key   string
+        value *time.Duration
+    }{
+        {"ACCESS_TOKEN_LIFETIME", &lifetimes.Access},
+        {"REFRESH_TOKEN_LIFETIME", &lifetimes.Refresh},
+        {"EMAIL_VERIFICATION_LIFETIME", &lifetimes.EmailVerification},
+        {"EMAIL_CHANGE_LIFETIME", &lifetimes.EmailChange},
+        {"PASSWORD_RESET_LIFETIME", &lifetimes.PasswordReset},
+        {"IMPERSONATION_TOKEN_LIFETIME", &lifetimes.Impersonation},
+        {"TWO_FACTOR_CHALLENGE_LIFETIME", &lifetimes.TwoFactorChallenge},
+    } {
+        d, err := src.duration(field.key, *field.value)
+        if err == nil && d <= 0 {
+            err = fmt.Errorf("%s must be positive", field.key)
+        }
+        if err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        *field.value = d
+    }
+    if lifetimes.Access > lifetimes.Refresh {
+        errs = append(errs, errors.New("ACCESS_TOKEN_LIFETIME must not exceed REFRESH_TOKEN_LIFETIME"))
+    }
+    return lifetimes, errors.Join(errs...)
+}
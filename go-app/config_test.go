@@ -0,0 +1,160 @@
+package main
+
+import (
+    "encoding/base64"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// テスト用のAES_SECRET_KEY・TOTP_SECRET_KEY（32バイト）
+var (
+    testAESSecretKey  = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+    testTOTPSecretKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+// 設定ファイルを一時ディレクトリに作成する
+func writeConfigFile(t *testing.T, content string) string {
+    path := filepath.Join(t.TempDir(), "app.conf")
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatalf("Failed to write config file: %v", err)
+    }
+    return path
+}
+
+// 環境変数の影響を受けないように、テストで使う設定を空にする
+func clearConfigEnv(t *testing.T) {
+    for _, key := range []string{"CONFIG_FILE", "LISTEN_ADDR", "IMAGE_DIR", "APP_BASE_URL", "AES_SECRET_KEY", "TOTP_SECRET_KEY", "DB_DRIVER", "JWT_SIGNING_ALG", "JWT_SECRET_KEY", "ACCESS_TOKEN_LIFETIME", "REFRESH_TOKEN_LIFETIME", "CORS_ALLOWED_ORIGINS", "AUTH_COOKIE_MODE", "OAUTH_CLIENT_ID"} {
+        t.Setenv(key, "")
+    }
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+    clearConfigEnv(t)
+    t.Setenv("AES_SECRET_KEY", testAESSecretKey)
+    t.Setenv("TOTP_SECRET_KEY", testTOTPSecretKey)
+    t.Setenv("JWT_SECRET_KEY", "secret")
+
+    config, args, err := LoadConfig([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if config.ListenAddr != defaultListenAddr || config.ImageDir != defaultImageDir || config.AppBaseURL != defaultAppBaseURL {
+        t.Errorf("Unexpected defaults: %+v", config)
+    }
+    if config.Tokens != defaultTokenLifetimes {
+        t.Errorf("Unexpected token lifetimes: %+v", config.Tokens)
+    }
+    if config.Database.Driver != "mysql" || config.Cookies != nil || config.OAuth != nil {
+        t.Errorf("Unexpected config: %+v", config)
+    }
+    if len(args) != 0 {
+        t.Errorf("Expected no remaining arguments, got %v", args)
+    }
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+    clearConfigEnv(t)
+    file := writeConfigFile(t, strings.Join([]string{
+        "AES_SECRET_KEY=" + testAESSecretKey,
+        "TOTP_SECRET_KEY=" + testTOTPSecretKey,
+        "JWT_SECRET_KEY=secret",
+        "LISTEN_ADDR=:7000",
+        "IMAGE_DIR=/var/file-images",
+        "APP_BASE_URL=https://file.example.com",
+        "ACCESS_TOKEN_LIFETIME=30m",
+    }, "\n"))
+    // 環境変数は設定ファイルより優先される
+    t.Setenv("IMAGE_DIR", "/var/env-images")
+    t.Setenv("APP_BASE_URL", "https://env.example.com/")
+    t.Setenv("LISTEN_ADDR", ":7001")
+
+    // コマンドライン引数は環境変数より優先される
+    config, args, err := LoadConfig([]string{
+        "-env-file", filepath.Join(t.TempDir(), "missing.env"),
+        "-config", file,
+        "-listen", ":9000",
+        "-set", "REFRESH_TOKEN_LIFETIME=48h",
+        "migrate", "up",
+    })
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if config.ListenAddr != ":9000" {
+        t.Errorf("Expected the flag to win, got %q", config.ListenAddr)
+    }
+    if config.ImageDir != "/var/env-images" || config.AppBaseURL != "https://env.example.com" {
+        t.Errorf("Expected the environment to win over the file, got %q %q", config.ImageDir, config.AppBaseURL)
+    }
+    if config.Tokens.Access != 30*time.Minute || config.Tokens.Refresh != 48*time.Hour {
+        t.Errorf("Unexpected token lifetimes: %+v", config.Tokens)
+    }
+    if strings.Join(args, " ") != "migrate up" {
+        t.Errorf("Expected the subcommand to remain, got %v", args)
+    }
+}
+
+func TestLoadConfigReportsAllErrors(t *testing.T) {
+    clearConfigEnv(t)
+    t.Setenv("AES_SECRET_KEY", base64.StdEncoding.EncodeToString([]byte("too short")))
+    t.Setenv("TOTP_SECRET_KEY", "not base64!")
+    t.Setenv("DB_DRIVER", "postgres")
+    t.Setenv("ACCESS_TOKEN_LIFETIME", "-1h")
+
+    _, _, err := LoadConfig([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")})
+    if err == nil {
+        t.Fatalf("Expected a validation error")
+    }
+    for _, want := range []string{"AES_SECRET_KEY", "TOTP_SECRET_KEY", "DB_DRIVER", "JWT_SECRET_KEY", "ACCESS_TOKEN_LIFETIME"} {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("Expected the error to mention %s, got %v", want, err)
+        }
+    }
+}
+
+func TestLoadAESKey(t *testing.T) {
+    tests := []struct {
+        value   string
+        wantErr bool
+    }{
+        {testAESSecretKey, false},
+        {"", true},
+        {"not base64!", true},
+        {base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), true},
+    }
+    for _, tt := range tests {
+        _, err := loadAESKey(configSource{flags: map[string]string{"AES_SECRET_KEY": tt.value}})
+        if (err != nil) != tt.wantErr {
+            t.Errorf("loadAESKey(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+        }
+    }
+}
+
+func TestLoadTOTPKey(t *testing.T) {
+    tests := []struct {
+        value   string
+        wantKey bool
+        wantErr bool
+    }{
+        {testTOTPSecretKey, true, false},
+        // 二要素認証を使わない環境では未設定でも起動できる
+        {"", false, false},
+        {"not base64!", false, true},
+        {base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), false, true},
+    }
+    for _, tt := range tests {
+        key, err := loadTOTPKey(configSource{flags: map[string]string{"TOTP_SECRET_KEY": tt.value}})
+        if (err != nil) != tt.wantErr || (key != nil) != tt.wantKey {
+            t.Errorf("loadTOTPKey(%q) = %v, %v, wantKey %v, wantErr %v", tt.value, key, err, tt.wantKey, tt.wantErr)
+        }
+    }
+}
+
+func TestLoadTokenLifetimesRejectsAccessLongerThanRefresh(t *testing.T) {
+    src := configSource{flags: map[string]string{"ACCESS_TOKEN_LIFETIME": "2h", "REFRESH_TOKEN_LIFETIME": "1h"}}
+    if _, err := loadTokenLifetimes(src); err == nil {
+        t.Errorf("Expected an error when the access token outlives the refresh token")
+    }
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// CORSの既定値（Reactアプリの開発サーバー）
+const (
+    defaultCORSAllowedOrigins = "http://localhost:3000"
+    defaultCORSMaxAge         = 10 * time.Minute
+)
+
+// ブラウザから送信を許可するリクエストヘッダー
+var corsAllowedHeaders = []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization", csrfHeaderName, requestIDHeader}
+
+// JavaScriptから読めるようにするレスポンスヘッダー（レート制限・旧ルートの通知・リクエストID）
+var corsExposedHeaders = []string{"Retry-After", "Deprecation", "Link", requestIDHeader}
+
+// ルートが受け付けるかどうかを確認するメソッド（Access-Control-Allow-Methodsに使う）
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// CORSの設定
+type CORSConfig struct {
+    // 許可するオリジン（"https://*.example.com"のようにサブドメインのワイルドカード、"*"ですべてを許可）
+    // "*"はAllowCredentialsがfalseの場合のみ指定できる
+    AllowedOrigins   []string
+    AllowCredentials bool          // Cookieや認証ヘッダーの送信を許可する
+    MaxAge           time.Duration // プリフライトの結果をブラウザがキャッシュする時間
+}
+
+// CORSの設定を読み込む
+// CORS_ALLOWED_ORIGINS（カンマ区切り） / CORS_ALLOW_CREDENTIALS / CORS_MAX_AGE
+func loadCORSConfig(src configSource) (CORSConfig, error) {
+    origins := src.get("CORS_ALLOWED_ORIGINS")
+    if origins == "" {
+        origins = defaultCORSAllowedOrigins
+    }
+
+    allowCredentials, err := src.boolean("CORS_ALLOW_CREDENTIALS", true)
+    if err != nil {
+        return CORSConfig{}, err
+    }
+    config := CORSConfig{AllowCredentials: allowCredentials}
+    for _, origin := range strings.Split(origins, ",") {
+        origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+        if origin == "" {
+            continue
+        }
+        if origin != "*" {
+            if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+                return CORSConfig{}, fmt.Errorf("invalid origin in CORS_ALLOWED_ORIGINS: %q", origin)
+            }
+        }
+        config.AllowedOrigins = append(config.AllowedOrigins, origin)
+    }
+    // "*"と資格情報を組み合わせると、任意のサイトがCookie付きでレスポンス（CSRFトークンなど）を読めてしまう
+    if allowCredentials && slices.Contains(config.AllowedOrigins, "*") {
+        return CORSConfig{}, fmt.Errorf(`CORS_ALLOWED_ORIGINS "*" cannot be used with CORS_ALLOW_CREDENTIALS=true`)
+    }
+
+    if config.MaxAge, err = src.duration("CORS_MAX_AGE", defaultCORSMaxAge); err != nil {
+        return CORSConfig{}, err
+    }
+    return config, nil
+}
+
+// オリジンが許可されているかどうか
+func (c CORSConfig) allowsOrigin(origin string) bool {
+    if origin == "" {
+        return false
+    }
+    for _, allowed := range c.AllowedOrigins {
+        if allowed == "*" || strings.EqualFold(allowed, origin) {
+            return true
+        }
+        // "https://*.example.com"は"https://app.example.com"などのサブドメインに一致する（"https://example.com"には一致しない）
+        if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+            prefix := scheme + "://"
+            if len(origin) > len(prefix) && strings.EqualFold(origin[:len(prefix)], prefix) {
+                host := origin[len(prefix):]
+                if len(host) > len(domain)+1 && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain)) {
+                    return true
+                }
+            }
+        }
+    }
+    return false
+}
+
+// routesに登録されているパスが受け付けるメソッド（パスが登録されていない場合は空）
+func routeMethods(routes *http.ServeMux, r *http.Request) []string {
+    var methods []string
+    for _, method := range corsMethods {
+        probe := r.Clone(r.Context())
+        probe.Method = method
+        if _, pattern := routes.Handler(probe); pattern != "" {
+            methods = append(methods, method)
+        }
+    }
+    return methods
+}
+
+// 許可されたオリジンからのリクエストにCORSヘッダーを設定し、OPTIONSリクエストにはここで応答する
+// Access-Control-Allow-Methodsには、routesにそのパスで登録されているメソッドのみを返す
+func CORSMiddleware(config CORSConfig, routes *http.ServeMux) Middleware {
+    allowedHeaders := strings.Join(corsAllowedHeaders, ", ")
+    exposedHeaders := strings.Join(corsExposedHeaders, ", ")
+    maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            origin := r.Header.Get("Origin")
+            // オリジンによってレスポンスが変わるため、キャッシュを分ける
+            w.Header().Add("Vary", "Origin")
+            allowed := config.allowsOrigin(origin)
+            if allowed {
+                // 資格情報付きのリクエストでは"*"を使えないため、常にオリジンをそのまま返す
+                w.Header().Set("Access-Control-Allow-Origin", origin)
+                if config.AllowCredentials {
+                    w.Header().Set("Access-Control-Allow-Credentials", "true")
+                }
+            }
+
+            if r.Method != http.MethodOptions {
+                if allowed {
+                    w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+                }
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            // OPTIONSはルーターには渡さず、パスに登録されているメソッドを返す
+            methods := routeMethods(routes, r)
+            if len(methods) == 0 {
+                http.NotFound(w, r)
+                return
+            }
+            w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+
+            requestedMethod := r.Header.Get("Access-Control-Request-Method")
+            if origin == "" || requestedMethod == "" {
+                // プリフライトではないOPTIONSリクエスト
+                w.WriteHeader(http.StatusNoContent)
+                return
+            }
+            w.Header().Add("Vary", "Access-Control-Request-Method")
+            w.Header().Add("Vary", "Access-Control-Request-Headers")
+            if !allowed {
+                writeError(w, r, http.StatusForbidden, ErrCodeOriginNotAllowed)
+                return
+            }
+            if !slices.Contains(methods, requestedMethod) {
+                writeError(w, r, http.StatusForbidden, ErrCodeCORSMethodNotAllowed)
+                return
+            }
+
+            w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+            w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+            w.Header().Set("Access-Control-Max-Age", maxAge)
+            w.WriteHeader(http.StatusNoContent)
+        })
+    }
+}
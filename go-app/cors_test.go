@@ -0,0 +1,155 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestLoadCORSConfig(t *testing.T) {
+    t.Setenv("CORS_ALLOWED_ORIGINS", "")
+    config, err := loadCORSConfig(configSource{})
+    if err != nil || len(config.AllowedOrigins) != 1 || config.AllowedOrigins[0] != "http://localhost:3000" || !config.AllowCredentials {
+        t.Errorf("Unexpected default config: %+v (%v)", config, err)
+    }
+
+    t.Setenv("CORS_ALLOWED_ORIGINS", "https://example.com/, https://*.example.com")
+    t.Setenv("CORS_MAX_AGE", "1h")
+    config, err = loadCORSConfig(configSource{})
+    if err != nil || len(config.AllowedOrigins) != 2 || config.AllowedOrigins[0] != "https://example.com" || config.MaxAge != time.Hour {
+        t.Errorf("Unexpected config: %+v (%v)", config, err)
+    }
+
+    t.Setenv("CORS_ALLOWED_ORIGINS", "example.com")
+    if _, err := loadCORSConfig(configSource{}); err == nil {
+        t.Errorf("Expected an error for an origin without a scheme")
+    }
+
+    // すべてのオリジンを許可する場合は、資格情報を許可できない
+    t.Setenv("CORS_ALLOWED_ORIGINS", "https://example.com, *")
+    if _, err := loadCORSConfig(configSource{}); err == nil {
+        t.Errorf(`Expected an error for "*" with credentials`)
+    }
+    t.Setenv("CORS_ALLOW_CREDENTIALS", "false")
+    if config, err := loadCORSConfig(configSource{}); err != nil || config.AllowCredentials {
+        t.Errorf(`Expected "*" to be allowed without credentials: %+v (%v)`, config, err)
+    }
+}
+
+func TestCORSAllowsOrigin(t *testing.T) {
+    config := CORSConfig{AllowedOrigins: []string{"http://localhost:3000", "https://*.example.com"}}
+
+    tests := []struct {
+        origin string
+        want   bool
+    }{
+        {"http://localhost:3000", true},
+        {"http://localhost:3001", false},
+        {"https://app.example.com", true},
+        {"https://a.b.example.com", true},
+        {"https://example.com", false},
+        {"http://app.example.com", false},
+        {"https://evilexample.com", false},
+        {"https://example.com.evil.net", false},
+        {"", false},
+    }
+    for _, tt := range tests {
+        if got := config.allowsOrigin(tt.origin); got != tt.want {
+            t.Errorf("allowsOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+        }
+    }
+}
+
+// テスト用のルートにCORSMiddlewareを適用する
+func newCORSTestHandler(config CORSConfig) http.Handler {
+    mux := http.NewServeMux()
+    ok := func(w http.ResponseWriter, r *http.Request) {}
+    mux.HandleFunc("GET /api/items", ok)
+    mux.HandleFunc("POST /api/items", ok)
+    mux.Handle("GET /images/", http.StripPrefix("/images/", http.FileServer(http.Dir("images"))))
+    return CORSMiddleware(config, mux)(mux)
+}
+
+func newPreflightRequest(target string, origin string, method string) *http.Request {
+    req := httptest.NewRequest(http.MethodOptions, target, nil)
+    req.Header.Set("Origin", origin)
+    req.Header.Set("Access-Control-Request-Method", method)
+    return req
+}
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+    h := newCORSTestHandler(CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true, MaxAge: time.Hour})
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, newPreflightRequest("/api/items", "https://app.example.com", "POST"))
+    if w.Code != http.StatusNoContent {
+        t.Fatalf("Expected status 204, got %v", w.Code)
+    }
+    headers := w.Header()
+    if headers.Get("Access-Control-Allow-Origin") != "https://app.example.com" || headers.Get("Access-Control-Allow-Credentials") != "true" {
+        t.Errorf("Expected the origin to be echoed with credentials, got %v", headers)
+    }
+    if headers.Get("Access-Control-Allow-Methods") != "GET, HEAD, POST" {
+        t.Errorf("Unexpected allowed methods: %q", headers.Get("Access-Control-Allow-Methods"))
+    }
+    if headers.Get("Access-Control-Max-Age") != "3600" {
+        t.Errorf("Unexpected max age: %q", headers.Get("Access-Control-Max-Age"))
+    }
+    if headers.Values("Vary")[0] != "Origin" {
+        t.Errorf("Expected Vary: Origin, got %v", headers.Values("Vary"))
+    }
+
+    // 画像のパスにもプリフライトで応答する
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, newPreflightRequest("/images/profile.png", "https://app.example.com", "GET"))
+    if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "GET, HEAD" {
+        t.Errorf("Unexpected preflight response for images: %v %v", w.Code, w.Header())
+    }
+
+    // ルートが受け付けないメソッド
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, newPreflightRequest("/api/items", "https://app.example.com", "DELETE"))
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403 for an unsupported method, got %v", w.Code)
+    }
+
+    // 許可されていないオリジン
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, newPreflightRequest("/api/items", "https://evil.net", "GET"))
+    if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+        t.Errorf("Expected status 403 without CORS headers, got %v %v", w.Code, w.Header())
+    }
+
+    // 登録されていないパス
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, newPreflightRequest("/api/unknown", "https://app.example.com", "GET"))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404, got %v", w.Code)
+    }
+}
+
+func TestCORSMiddlewareSimpleRequest(t *testing.T) {
+    h := newCORSTestHandler(CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}})
+
+    req := httptest.NewRequest("GET", "/api/items", nil)
+    req.Header.Set("Origin", "http://localhost:3000")
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+        t.Errorf("Expected the origin to be allowed, got %v", w.Header())
+    }
+    // 資格情報の送信を許可していない場合
+    if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+        t.Errorf("Did not expect Access-Control-Allow-Credentials")
+    }
+
+    // 許可されていないオリジンでもリクエスト自体は処理するが、CORSヘッダーは付けない
+    req = httptest.NewRequest("GET", "/api/items", nil)
+    req.Header.Set("Origin", "http://localhost:4000")
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" {
+        t.Errorf("Unexpected response for a disallowed origin: %v %v", w.Code, w.Header())
+    }
+}
@@ -2,49 +2,187 @@ package main
 
 import (
     "database/sql"
-    "os"
-    _ "github.com/go-sql-driver/mysql"
+    "errors"
+    "time"
 )
 
+// メールアドレスが他のユーザーに使われている（usersテーブルの一意制約に違反した）
+var ErrEmailTaken = errors.New("Email address already in use")
+
 type User struct {
-    ID        int
-    Email     string
-    Password  string
-    user_uuid string
+    ID                  int
+    Email               string
+    Password            string
+    user_uuid           string
+    EmailVerified       bool         // メールアドレス確認済みかどうか
+    VerificationSentAt  sql.NullTime // 最後に認証メールを送信した日時
+    TOTPSecret          string       // 暗号化されたTOTPシークレット（未登録の場合は空）
+    TOTPEnabled         bool         // 二要素認証が有効かどうか
+    TOTPLastStep        int64        // 最後に使用されたTOTPのステップ数（再利用防止）
+    DeletionRequestedAt sql.NullTime // 退会を申請した日時（猶予期間中のみ設定される）
+    Role                string       // ロール（user / admin）
+    SuspendedAt         sql.NullTime // 管理者により利用停止された日時
     // 他に必要なフィールドがあればここに追加
 }
 
-type Database interface {
+// ユーザー
+type UserRepository interface {
     GetUserByEmail(email string) (User, error)
+    GetUserByID(id int) (User, error)
+    GetUserIDByUUID(userUUID string) (int, error)
+    CreateUser(user User) (int, error)
+    UpdateUserPassword(userID int, hashedPassword string) error
+}
+
+// プロフィール
+type ProfileRepository interface {
+    GetProfileByUserID(userID int) (Profile, error)
+    CreateProfile(userID int, profile Profile) error
+    UpdateProfile(userID int, profile Profile) error
+}
+
+// ポートフォリオ
+type PortfolioRepository interface {
+    GetPortfolio(portfolioUUID string, userID int) (Portfolio, error)
+    GetPublishedPortfolio(portfolioUUID string) (Portfolio, error)
+    GetPortfolioOwnerID(portfolioUUID string) (int, error)
+    ListPortfoliosByUser(userID int) ([]Portfolio, error)
+    CountPortfoliosByStatus() (map[string]int, error)
+    CreatePortfolio(userID int, portfolio Portfolio) error
+    UpdatePortfolio(userID int, portfolio Portfolio) (bool, error)
+    DeletePortfolio(userID int, portfolioUUID string) (bool, error)
+}
+
+// 技術スタック（ポートフォリオのタグ候補）
+type TechStackRepository interface {
+    SearchTechStacks(prefix string) ([]string, error)
+    AddTechStacks(names []string) error
+}
+
+// 共有リンク（暗号化されたuser_uuid）
+type ShareLinkRepository interface {
+    ShareLinkTargetExists(userUUID string) (bool, error)
+}
+
+type Database interface {
+    UserRepository
+    ProfileRepository
+    PortfolioRepository
+    TechStackRepository
+    ShareLinkRepository
+
+    // fnの中の書き込みを1つのトランザクションで行う（transaction.go）
+    Transaction(fn func(tx Database) error) error
+
+    // アカウント設定
+    UpdateUserEmail(userID int, email string) error
+    RequestAccountDeletion(userID int, requestedAt time.Time) error
+    CancelAccountDeletion(userID int) error
+    ListUsersPendingDeletion(before time.Time) ([]User, error)
+    DeleteUserAccount(userID int) error
+
+    // 管理者機能
+    SearchUsers(query string, limit int, offset int) ([]AdminUser, error)
+    SetUserSuspended(userID int, suspended bool) (bool, error)
+    UnpublishPortfolio(portfolioUUID string) (bool, error)
+    CreateAdminAuditLog(entry AdminAuditLog) error
+
+    // 二要素認証
+    SetTOTPSecret(userID int, encryptedSecret string) error
+    EnableTOTP(userID int) error
+    DisableTOTP(userID int) error
+    UpdateTOTPLastStep(userID int, step int64) (bool, error)
+    ReplaceRecoveryCodes(userID int, codeHashes []string) error
+    UseRecoveryCode(userID int, codeHash string) (bool, error)
+
+    // 外部プロバイダーでのログイン
+    CreateOAuthState(state OAuthState) error
+    ConsumeOAuthState(stateValue string) (OAuthState, error)
+    GetUserIdentity(provider string, subject string) (UserIdentity, error)
+    CreateUserIdentity(identity UserIdentity) error
+    CreateOAuthUser(info OAuthUserInfo, provider string) (User, error)
+
+    // パーソナルアクセストークン
+    CreatePersonalAccessToken(token PersonalAccessToken) (int, error)
+    GetPersonalAccessTokenByPrefix(prefix string) (PersonalAccessToken, error)
+    ListPersonalAccessTokens(userID int) ([]PersonalAccessToken, error)
+    TouchPersonalAccessToken(id int, usedAt time.Time) error
+    RevokePersonalAccessToken(id int, userID int) (bool, error)
+
+    // ログイン試行の制限
+    CreateLoginLockout(lockout LoginLockout) error
+
+    // メールアドレスの確認
+    SetEmailVerified(userID int) error
+    UpdateVerificationSentAt(userID int, sentAt time.Time) error
+
+    // リフレッシュトークン
+    CreateRefreshToken(token RefreshToken) error
+    GetRefreshTokenByHash(tokenHash string) (RefreshToken, error)
+    MarkRefreshTokenUsed(id int) (bool, error)
+    RevokeRefreshTokenFamily(familyID string) error
+
+    // ログインセッション
+    CreateSession(session Session) error
+    GetSession(id string) (Session, error)
+    ListSessions(userID int) ([]Session, error)
+    TouchSession(id string, seenAt time.Time) error
+    RevokeSession(id string, userID int) (bool, error)
+    RevokeUserSessions(userID int, exceptSessionID string) error
+
+    // パスワードリセット
+    CreatePasswordResetToken(token PasswordResetToken) error
+    GetPasswordResetTokenByHash(tokenHash string) (PasswordResetToken, error)
+    MarkPasswordResetTokenUsed(id int) (bool, error)
 }
 
 type SQLDatabase struct {
-    db *sql.DB
+    db *dbConn
 }
 
-func OpenDatabase() (*sql.DB, error) {
-    // 環境変数からデータベース接続情報を取得
-    dbUser := os.Getenv("DB_USER")
-    dbPass := os.Getenv("DB_PASS")
-    dbHost := os.Getenv("DB_HOST")
-    dbPort := os.Getenv("DB_PORT")
-    dbName := os.Getenv("DB_NAME")
+// usersテーブルから読み込むカラム（scanUserと順序を合わせる）
+const userColumns = "id, email, password, user_uuid, email_verified, verification_sent_at, totp_secret, totp_enabled, totp_last_step, deletion_requested_at, role, suspended_at"
 
-    // データソース名（DSN）を組み立てる
-    dsn := dbUser + ":" + dbPass + "@tcp(" + dbHost + ":" + dbPort + ")/" + dbName
-    db, err := sql.Open("mysql", dsn)
+func scanUser(row *dbRow) (User, error) {
+    var user User
+    err := row.Scan(&user.ID, &user.Email, &user.Password, &user.user_uuid, &user.EmailVerified, &user.VerificationSentAt,
+        &user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.DeletionRequestedAt,
+        &user.Role, &user.SuspendedAt)
     if err != nil {
-        return nil, err
+        return User{}, err
     }
-    return db, nil
+    return user, nil
 }
 
 func (db *SQLDatabase) GetUserByEmail(email string) (User, error) {
-    var user User
-    err := db.db.QueryRow("SELECT id, email, password FROM users WHERE email = ?", email).Scan(&user.ID, &user.Email, &user.Password)
+    return scanUser(db.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
+func (db *SQLDatabase) GetUserByID(id int) (User, error) {
+    return scanUser(db.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (db *SQLDatabase) GetUserIDByUUID(userUUID string) (int, error) {
+    var userID int
+    err := db.db.QueryRow("SELECT id FROM users WHERE user_uuid = ?", userUUID).Scan(&userID)
+    return userID, err
+}
+
+// ユーザーを登録し、採番されたIDを返す（Passwordはハッシュ化済みであること）
+// メールアドレスが登録済みの場合はErrEmailTakenを返す
+func (db *SQLDatabase) CreateUser(user User) (int, error) {
+    userID, err := db.db.InsertID("INSERT INTO users(email, password, user_uuid, email_verified) VALUES(?, ?, ?, ?)",
+        user.Email, user.Password, user.user_uuid, user.EmailVerified)
+    if db.db.dialect.IsUniqueViolation(err) {
+        return 0, ErrEmailTaken
+    }
     if err != nil {
-        return User{}, err
+        return 0, err
     }
-    return user, nil
+    return int(userID), nil
 }
 
+func (db *SQLDatabase) UpdateUserPassword(userID int, hashedPassword string) error {
+    _, err := db.db.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, userID)
+    return err
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/glebarez/go-sqlite"
+    "github.com/go-sql-driver/mysql"
+)
+
+// データベースの種類（DB_DRIVERで選択する）
+const (
+    DriverMySQL  = "mysql"
+    DriverSQLite = "sqlite"
+)
+
+// SQLiteのデータベースファイルの既定値
+const defaultSQLitePath = "ccgallery.db"
+
+// データベースごとに異なるSQLの書き方を吸収する
+type sqlDialect interface {
+    // ドライバー名（sql.Openに渡す名前）
+    Driver() string
+    // LIKEで前方一致・部分一致させる条件（パターンはescapeLikeでエスケープしておく）
+    Like(column string) string
+    // INSERTを実行し、採番されたidを返す
+    InsertID(ctx context.Context, q queryer, query string, args ...interface{}) (int64, error)
+    // INSERTの末尾に付けて、columnの一意制約に違反する行は無視させる
+    IgnoreDuplicate(column string) string
+    // 一意制約違反のエラーかどうか
+    IsUniqueViolation(err error) bool
+    // マイグレーションファイルのディレクトリ
+    MigrationDir() string
+    // 複数のインスタンスが同時にマイグレーションしないようにロックを取得する
+    // 返された関数でロックを解放する（failedがtrueの場合は途中までの変更を取り消せるものは取り消す）
+    LockMigrations(ctx context.Context, conn *sql.Conn) (func(failed bool) error, error)
+}
+
+// InsertIDで使う、ExecとQueryRowを持つもの（*sql.DB / *sql.Tx / *sql.Conn）
+type queryer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// LIKEのパターンに含まれる特殊文字をエスケープする（エスケープ文字はバックスラッシュ）
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// 接続先のデータベースの設定
+// DB_DRIVER=mysql（既定）: DB_USER / DB_PASS / DB_HOST / DB_PORT / DB_NAME
+// DB_DRIVER=sqlite: DB_PATH（既定はccgallery.db）
+type DBConfig struct {
+    Driver   string
+    User     string
+    Password string
+    Host     string
+    Port     string
+    Name     string
+    Path     string
+}
+
+// 接続先のデータベースの設定を読み込む
+func loadDBConfig(src configSource) (DBConfig, error) {
+    config := DBConfig{
+        Driver:   src.get("DB_DRIVER"),
+        User:     src.get("DB_USER"),
+        Password: src.get("DB_PASS"),
+        Host:     src.get("DB_HOST"),
+        Port:     src.get("DB_PORT"),
+        Name:     src.get("DB_NAME"),
+        Path:     src.get("DB_PATH"),
+    }
+    switch config.Driver {
+    case "":
+        config.Driver = DriverMySQL
+    case DriverMySQL, DriverSQLite:
+    default:
+        return config, fmt.Errorf("unsupported DB_DRIVER: %s (expected %s or %s)", config.Driver, DriverMySQL, DriverSQLite)
+    }
+    if config.Driver == DriverSQLite && config.Path == "" {
+        config.Path = defaultSQLitePath
+    }
+    return config, nil
+}
+
+// 設定に従ってデータベースを開く
+func OpenDatabase(config DBConfig) (*sql.DB, sqlDialect, error) {
+    switch config.Driver {
+    case DriverMySQL:
+        // DATETIME型をtime.Timeとして読み込むためにparseTimeを有効にする
+        dsn := config.User + ":" + config.Password + "@tcp(" + config.Host + ":" + config.Port + ")/" + config.Name + "?parseTime=true"
+        return openDatabase(mysqlDialect{}, dsn)
+    case DriverSQLite:
+        return openDatabase(sqliteDialect{}, sqliteDSN(config.Path))
+    default:
+        return nil, nil, fmt.Errorf("unsupported DB_DRIVER: %s (expected %s or %s)", config.Driver, DriverMySQL, DriverSQLite)
+    }
+}
+
+func openDatabase(dialect sqlDialect, dsn string) (*sql.DB, sqlDialect, error) {
+    db, err := sql.Open(dialect.Driver(), dsn)
+    if err != nil {
+        return nil, nil, err
+    }
+    return db, dialect, nil
+}
+
+// 外部キーを有効にし、他のコネクションが書き込み中の場合は待つようにする
+func sqliteDSN(path string) string {
+    return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Driver() string { return "mysql" }
+
+// MySQLのLIKEのエスケープ文字は既定でバックスラッシュ
+func (mysqlDialect) Like(column string) string { return column + " LIKE ?" }
+
+func (mysqlDialect) InsertID(ctx context.Context, q queryer, query string, args ...interface{}) (int64, error) {
+    result, err := q.ExecContext(ctx, query, args...)
+    if err != nil {
+        return 0, err
+    }
+    return result.LastInsertId()
+}
+
+func (mysqlDialect) IgnoreDuplicate(column string) string {
+    return " ON DUPLICATE KEY UPDATE " + column + " = " + column
+}
+
+// ER_DUP_ENTRY
+func (mysqlDialect) IsUniqueViolation(err error) bool {
+    var mysqlErr *mysql.MySQLError
+    return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func (mysqlDialect) MigrationDir() string { return "migrations/mysql" }
+
+// GET_LOCKはコネクションに紐付くため、解放するまで同じコネクションを使う
+// MySQLのDDLは暗黙的にコミットされるため、失敗しても取り消しはできない
+func (mysqlDialect) LockMigrations(ctx context.Context, conn *sql.Conn) (func(failed bool) error, error) {
+    var acquired sql.NullInt64
+    if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Scan(&acquired); err != nil {
+        return nil, err
+    }
+    if acquired.Int64 != 1 {
+        return nil, errors.New("another instance is running migrations, timed out waiting for the lock")
+    }
+    return func(failed bool) error {
+        _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName)
+        return err
+    }, nil
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Driver() string { return "sqlite" }
+
+// SQLiteのLIKEには既定のエスケープ文字がない
+func (sqliteDialect) Like(column string) string { return column + ` LIKE ? ESCAPE '\'` }
+
+// LastInsertIdに頼らず、RETURNINGで採番されたidを受け取る
+func (sqliteDialect) InsertID(ctx context.Context, q queryer, query string, args ...interface{}) (int64, error) {
+    var id int64
+    err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+    return id, err
+}
+
+func (sqliteDialect) IgnoreDuplicate(column string) string {
+    return " ON CONFLICT (" + column + ") DO NOTHING"
+}
+
+// SQLITE_CONSTRAINT_UNIQUE / SQLITE_CONSTRAINT_PRIMARYKEY
+func (sqliteDialect) IsUniqueViolation(err error) bool {
+    var sqliteErr *sqlite.Error
+    return errors.As(err, &sqliteErr) && (sqliteErr.Code() == 2067 || sqliteErr.Code() == 1555)
+}
+
+func (sqliteDialect) MigrationDir() string { return "migrations/sqlite" }
+
+// BEGIN IMMEDIATEで書き込みロックを取得する（他のインスタンスはbusy_timeoutまで待つ）
+// SQLiteのDDLはトランザクションに含められるため、失敗した場合はすべて取り消す
+func (sqliteDialect) LockMigrations(ctx context.Context, conn *sql.Conn) (func(failed bool) error, error) {
+    if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+        return nil, err
+    }
+    return func(failed bool) error {
+        if failed {
+            _, err := conn.ExecContext(context.Background(), "ROLLBACK")
+            return err
+        }
+        _, err := conn.ExecContext(context.Background(), "COMMIT")
+        return err
+    }, nil
+}
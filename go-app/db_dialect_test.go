@@ -0,0 +1,300 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/go-sql-driver/mysql"
+    "github.com/google/uuid"
+)
+
+// 一時ファイルのSQLiteにマイグレーションを適用したDatabaseを作成する
+func newSQLiteTestDatabase(t *testing.T) *SQLDatabase {
+    pool, err := sql.Open(sqliteDialect{}.Driver(), sqliteDSN(filepath.Join(t.TempDir(), "test.db")))
+    if err != nil {
+        t.Fatalf("Failed to open SQLite database: %v", err)
+    }
+    t.Cleanup(func() { pool.Close() })
+
+    migrator, err := NewMigrator(pool, sqliteDialect{})
+    if err != nil {
+        t.Fatalf("Failed to load migrations: %v", err)
+    }
+    if _, err := migrator.Up(context.Background()); err != nil {
+        t.Fatalf("Failed to apply migrations: %v", err)
+    }
+    return NewSQLDatabase(pool, sqliteDialect{}, time.Second)
+}
+
+// SQLiteにテスト用のユーザーを登録し、idを返す（user_uuidを指定しない場合は生成する）
+func createSQLiteTestUser(t *testing.T, db *SQLDatabase, user User) int {
+    if user.user_uuid == "" {
+        user.user_uuid = uuid.NewString()
+    }
+    if user.Password == "" {
+        user.Password = "hashed"
+    }
+    userID, err := db.CreateUser(user)
+    if err != nil {
+        t.Fatalf("Failed to create user %s: %v", user.Email, err)
+    }
+    return userID
+}
+
+func TestOpenDatabase(t *testing.T) {
+    pool, dialect, err := OpenDatabase(DBConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "app.db")})
+    if err != nil {
+        t.Fatalf("Failed to open SQLite database: %v", err)
+    }
+    defer pool.Close()
+    if _, ok := dialect.(sqliteDialect); !ok {
+        t.Errorf("Expected the SQLite dialect, got %T", dialect)
+    }
+    if err := pool.Ping(); err != nil {
+        t.Errorf("Failed to connect to SQLite database: %v", err)
+    }
+
+    if _, _, err := OpenDatabase(DBConfig{Driver: "postgres"}); err == nil {
+        t.Errorf("Expected an error for an unsupported driver")
+    }
+}
+
+func TestMySQLIsUniqueViolation(t *testing.T) {
+    if !(mysqlDialect{}).IsUniqueViolation(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}) {
+        t.Errorf("Expected ER_DUP_ENTRY to be a unique violation")
+    }
+    if (mysqlDialect{}).IsUniqueViolation(&mysql.MySQLError{Number: 1452}) || (mysqlDialect{}).IsUniqueViolation(sql.ErrNoRows) {
+        t.Errorf("Expected other errors not to be unique violations")
+    }
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+    pool, err := sql.Open(sqliteDialect{}.Driver(), sqliteDSN(filepath.Join(t.TempDir(), "test.db")))
+    if err != nil {
+        t.Fatalf("Failed to open SQLite database: %v", err)
+    }
+    defer pool.Close()
+    migrator, err := NewMigrator(pool, sqliteDialect{})
+    if err != nil {
+        t.Fatalf("Failed to load migrations: %v", err)
+    }
+    ctx := context.Background()
+
+    done, err := migrator.Up(ctx)
+    if err != nil || len(done) != len(migrator.migrations) {
+        t.Fatalf("Expected all migrations to be applied, got %d (%v)", len(done), err)
+    }
+    if done, err := migrator.Up(ctx); err != nil || len(done) != 0 {
+        t.Errorf("Expected no pending migrations, got %d (%v)", len(done), err)
+    }
+
+    // すべて取り消してから再適用できる
+    if done, err := migrator.Down(ctx, len(migrator.migrations)); err != nil || len(done) != len(migrator.migrations) {
+        t.Fatalf("Expected all migrations to be reverted, got %d (%v)", len(done), err)
+    }
+    statuses, err := migrator.Status(ctx)
+    if err != nil {
+        t.Fatalf("Failed to get migration status: %v", err)
+    }
+    for _, status := range statuses {
+        if status.AppliedAt != nil {
+            t.Errorf("Expected migration %d_%s to be pending", status.Version, status.Name)
+        }
+    }
+    if _, err := migrator.Up(ctx); err != nil {
+        t.Errorf("Failed to re-apply migrations: %v", err)
+    }
+}
+
+func TestSQLiteRepositories(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+
+    userID, err := db.CreateUser(User{Email: "Test@example.com", Password: "hashed", user_uuid: uuid.NewString()})
+    if err != nil || userID != 1 {
+        t.Fatalf("Expected user id 1, got %d (%v)", userID, err)
+    }
+    // MySQLと同様に、メールアドレスは大文字と小文字を区別しない
+    if _, err := db.CreateUser(User{Email: "test@example.com", Password: "hashed", user_uuid: uuid.NewString()}); err != ErrEmailTaken {
+        t.Errorf("Expected ErrEmailTaken regardless of case, got %v", err)
+    }
+    user, err := db.GetUserByID(userID)
+    if err != nil || user.Email != "Test@example.com" || user.Role != RoleUser || user.EmailVerified {
+        t.Errorf("Unexpected user: %+v (%v)", user, err)
+    }
+
+    if err := db.CreateProfile(userID, Profile{FullName: "Test User"}); err != nil {
+        t.Fatalf("Failed to create profile: %v", err)
+    }
+    if profile, err := db.GetProfileByUserID(userID); err != nil || profile.FullName != "Test User" {
+        t.Errorf("Unexpected profile: %+v (%v)", profile, err)
+    }
+
+    portfolio := Portfolio{Title: "Title", Content: "Content", Status: "1", PortfolioUUID: uuid.NewString()}
+    if err := db.CreatePortfolio(userID, portfolio); err != nil {
+        t.Fatalf("Failed to create portfolio: %v", err)
+    }
+    portfolio.Title = "Updated"
+    if updated, err := db.UpdatePortfolio(userID, portfolio); err != nil || !updated {
+        t.Errorf("Failed to update portfolio: %v", err)
+    }
+    // 内容が変わらない保存も、存在するポートフォリオとして扱う
+    if updated, err := db.UpdatePortfolio(userID, portfolio); err != nil || !updated {
+        t.Errorf("Expected an unchanged portfolio to be updated, got %v (%v)", updated, err)
+    }
+    if updated, err := db.UpdatePortfolio(userID+1, portfolio); err != nil || updated {
+        t.Errorf("Expected another user's portfolio not to be updated, got %v (%v)", updated, err)
+    }
+    if got, err := db.GetPublishedPortfolio(portfolio.PortfolioUUID); err != nil || got.Title != "Updated" || got.UpdatedAt == "" {
+        t.Errorf("Unexpected portfolio: %+v (%v)", got, err)
+    }
+    if counts, err := db.CountPortfoliosByStatus(); err != nil || len(counts) != 1 || counts["1"] != 1 {
+        t.Errorf("Unexpected portfolio counts: %v (%v)", counts, err)
+    }
+    if deleted, err := db.DeletePortfolio(userID, portfolio.PortfolioUUID); err != nil || !deleted {
+        t.Errorf("Failed to delete portfolio: %v", err)
+    }
+
+    // 登録済みの技術スタックは無視される
+    if err := db.AddTechStacks([]string{"Go", "Godot", "G_o", "Go"}); err != nil {
+        t.Fatalf("Failed to add tech stacks: %v", err)
+    }
+    // LIKEの特殊文字はエスケープされる
+    if names, err := db.SearchTechStacks("G_"); err != nil || len(names) != 1 || names[0] != "G_o" {
+        t.Errorf("Unexpected tech stacks: %v (%v)", names, err)
+    }
+    if users, err := db.SearchUsers("example", 10, 0); err != nil || len(users) != 1 || users[0].ID != userID {
+        t.Errorf("Unexpected users: %+v (%v)", users, err)
+    }
+
+    // 利用停止されていないユーザーの解除も、存在するユーザーとして扱う
+    if found, err := db.SetUserSuspended(userID, false); err != nil || !found {
+        t.Errorf("Expected unsuspending an active user to succeed, got %v (%v)", found, err)
+    }
+    if found, err := db.SetUserSuspended(999, true); err != nil || found {
+        t.Errorf("Expected a missing user to be reported, got %v (%v)", found, err)
+    }
+
+    // トランザクション内のINSERTでもidが返される
+    oauthUser, err := db.CreateOAuthUser(OAuthUserInfo{Subject: "12345", Email: "oauth@example.com", EmailVerified: true}, "github")
+    if err != nil || oauthUser.ID != 2 {
+        t.Errorf("Unexpected OAuth user: %+v (%v)", oauthUser, err)
+    }
+
+    tokenID, err := db.CreatePersonalAccessToken(PersonalAccessToken{UserID: userID, Name: "ci", Prefix: "abc123", TokenHash: "hash", Scopes: []string{"read"}, CreatedAt: time.Now()})
+    if err != nil || tokenID != 1 {
+        t.Errorf("Expected token id 1, got %d (%v)", tokenID, err)
+    }
+    if token, err := db.GetPersonalAccessTokenByPrefix("abc123"); err != nil || token.UserID != userID || token.ExpiresAt != nil || token.UserDeleting {
+        t.Errorf("Unexpected personal access token: %+v (%v)", token, err)
+    }
+    if err := db.RequestAccountDeletion(userID, time.Now()); err != nil {
+        t.Fatalf("Failed to request account deletion: %v", err)
+    }
+    if token, err := db.GetPersonalAccessTokenByPrefix("abc123"); err != nil || !token.UserDeleting {
+        t.Errorf("Expected the token owner to be pending deletion: %+v (%v)", token, err)
+    }
+}
+
+func TestSQLiteTransaction(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+
+    // エラーを返した場合はすべて取り消される
+    errAbort := errors.New("abort")
+    err := db.Transaction(func(tx Database) error {
+        userID, err := tx.CreateUser(User{Email: "test@example.com", Password: "hashed", user_uuid: uuid.NewString()})
+        if err != nil {
+            return err
+        }
+        if err := tx.CreateProfile(userID, Profile{}); err != nil {
+            return err
+        }
+        return errAbort
+    })
+    if err != errAbort {
+        t.Fatalf("Expected the error from fn, got %v", err)
+    }
+    if _, err := db.GetUserByEmail("test@example.com"); err != sql.ErrNoRows {
+        t.Errorf("Expected the user to be rolled back, got %v", err)
+    }
+
+    // 入れ子のTransactionは外側のトランザクションに含まれる
+    err = db.Transaction(func(tx Database) error {
+        return tx.Transaction(func(inner Database) error {
+            _, err := inner.CreateUser(User{Email: "test@example.com", Password: "hashed", user_uuid: uuid.NewString()})
+            return err
+        })
+    })
+    if err != nil {
+        t.Fatalf("Failed to commit transaction: %v", err)
+    }
+    user, err := db.GetUserByEmail("test@example.com")
+    if err != nil {
+        t.Fatalf("Expected the user to be committed: %v", err)
+    }
+
+    // 退会時は関連データもまとめて削除される
+    if err := db.CreateProfile(user.ID, Profile{}); err != nil {
+        t.Fatalf("Failed to create profile: %v", err)
+    }
+    if err := db.DeleteUserAccount(user.ID); err != nil {
+        t.Fatalf("Failed to delete account: %v", err)
+    }
+    if _, err := db.GetProfileByUserID(user.ID); err != sql.ErrNoRows {
+        t.Errorf("Expected the profile to be deleted, got %v", err)
+    }
+}
+
+func TestSQLiteMultiStatementWrites(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+    userID := createSQLiteTestUser(t, db, User{Email: "test@example.com"})
+
+    now := time.Now()
+    for _, id := range []string{"session-1", "session-2"} {
+        if err := db.CreateSession(Session{ID: id, UserID: userID, CreatedAt: now, LastSeenAt: now}); err != nil {
+            t.Fatalf("Failed to create session: %v", err)
+        }
+        if err := db.CreateRefreshToken(RefreshToken{UserID: userID, TokenHash: "hash-" + id, FamilyID: id, ExpiresAt: now.Add(time.Hour)}); err != nil {
+            t.Fatalf("Failed to create refresh token: %v", err)
+        }
+    }
+
+    // セッションとリフレッシュトークンはまとめて失効する
+    if revoked, err := db.RevokeSession("session-1", userID); err != nil || !revoked {
+        t.Fatalf("Failed to revoke session: %v", err)
+    }
+    if revoked, err := db.RevokeSession("session-1", userID); err != nil || revoked {
+        t.Errorf("Expected an already revoked session not to be revoked again, got %v (%v)", revoked, err)
+    }
+    if token, err := db.GetRefreshTokenByHash("hash-session-1"); err != nil || !token.RevokedAt.Valid {
+        t.Errorf("Expected the refresh token to be revoked: %+v (%v)", token, err)
+    }
+
+    // 外側のトランザクションの中でも使える
+    err := db.Transaction(func(tx Database) error {
+        return tx.RevokeUserSessions(userID, "")
+    })
+    if err != nil {
+        t.Fatalf("Failed to revoke user sessions: %v", err)
+    }
+    if session, err := db.GetSession("session-2"); err != nil || !session.RevokedAt.Valid {
+        t.Errorf("Expected the session to be revoked: %+v (%v)", session, err)
+    }
+    if token, err := db.GetRefreshTokenByHash("hash-session-2"); err != nil || !token.RevokedAt.Valid {
+        t.Errorf("Expected the refresh token to be revoked: %+v (%v)", token, err)
+    }
+
+    // stateは一度しか取り出せない
+    if err := db.CreateOAuthState(OAuthState{State: "state-1", CodeVerifier: "verifier", ExpiresAt: now.Add(time.Minute)}); err != nil {
+        t.Fatalf("Failed to create OAuth state: %v", err)
+    }
+    if state, err := db.ConsumeOAuthState("state-1"); err != nil || state.CodeVerifier != "verifier" || state.LinkUserID != 0 {
+        t.Errorf("Unexpected OAuth state: %+v (%v)", state, err)
+    }
+    if _, err := db.ConsumeOAuthState("state-1"); err != sql.ErrNoRows {
+        t.Errorf("Expected a consumed state to be gone, got %v", err)
+    }
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "time"
+)
+
+// コネクションプールの既定値
+const (
+    defaultDBMaxOpenConns    = 25
+    defaultDBMaxIdleConns    = 25
+    defaultDBConnMaxLifetime = 5 * time.Minute
+    defaultDBConnMaxIdleTime = 5 * time.Minute
+    defaultDBQueryTimeout    = 5 * time.Second
+)
+
+// コネクションプールとクエリのタイムアウトの設定
+type DBPoolConfig struct {
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+    ConnMaxIdleTime time.Duration
+    QueryTimeout    time.Duration // 1回のクエリ（トランザクションの場合は全体）の上限（0の場合は無制限）
+}
+
+// コネクションプールの設定を読み込む
+// DB_MAX_OPEN_CONNS / DB_MAX_IDLE_CONNS / DB_CONN_MAX_LIFETIME / DB_CONN_MAX_IDLE_TIME / DB_QUERY_TIMEOUT
+func loadDBPoolConfig(src configSource) (DBPoolConfig, error) {
+    config := DBPoolConfig{}
+    var err error
+
+    if config.MaxOpenConns, err = src.integer("DB_MAX_OPEN_CONNS", defaultDBMaxOpenConns); err != nil {
+        return DBPoolConfig{}, err
+    }
+    if config.MaxIdleConns, err = src.integer("DB_MAX_IDLE_CONNS", defaultDBMaxIdleConns); err != nil {
+        return DBPoolConfig{}, err
+    }
+    if config.ConnMaxLifetime, err = src.duration("DB_CONN_MAX_LIFETIME", defaultDBConnMaxLifetime); err != nil {
+        return DBPoolConfig{}, err
+    }
+    if config.ConnMaxIdleTime, err = src.duration("DB_CONN_MAX_IDLE_TIME", defaultDBConnMaxIdleTime); err != nil {
+        return DBPoolConfig{}, err
+    }
+    if config.QueryTimeout, err = src.duration("DB_QUERY_TIMEOUT", defaultDBQueryTimeout); err != nil {
+        return DBPoolConfig{}, err
+    }
+    return config, nil
+}
+
+// コネクションプールに設定を適用する
+func (c DBPoolConfig) Apply(pool *sql.DB) {
+    pool.SetMaxOpenConns(c.MaxOpenConns)
+    pool.SetMaxIdleConns(c.MaxIdleConns)
+    pool.SetConnMaxLifetime(c.ConnMaxLifetime)
+    pool.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
+
+// コネクションプールをコンテキストとタイムアウト付きで使うためのラッパー
+// 各クエリはctxにQueryTimeoutを加えたコンテキストで実行される
+// txが設定されている場合は、すべてのクエリをそのトランザクションで実行する
+type dbConn struct {
+    pool    *sql.DB
+    tx      *sql.Tx
+    dialect sqlDialect
+    ctx     context.Context
+    timeout time.Duration
+}
+
+// *sql.DBと*sql.Txの共通のメソッド
+type sqlExecutor interface {
+    queryer
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (c *dbConn) executor() sqlExecutor {
+    if c.tx != nil {
+        return c.tx
+    }
+    return c.pool
+}
+
+func (c *dbConn) queryContext() (context.Context, context.CancelFunc) {
+    if c.timeout > 0 {
+        return context.WithTimeout(c.ctx, c.timeout)
+    }
+    return context.WithCancel(c.ctx)
+}
+
+func (c *dbConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+    ctx, cancel := c.queryContext()
+    defer cancel()
+    return c.executor().ExecContext(ctx, query, args...)
+}
+
+// INSERTを実行し、採番されたidを返す
+func (c *dbConn) InsertID(query string, args ...interface{}) (int64, error) {
+    ctx, cancel := c.queryContext()
+    defer cancel()
+    return c.dialect.InsertID(ctx, c.executor(), query, args...)
+}
+
+// LIKEの条件（データベースごとのエスケープ指定を含む）
+func (c *dbConn) Like(column string) string {
+    return c.dialect.Like(column)
+}
+
+// コンテキストはScanの後に解放する
+func (c *dbConn) QueryRow(query string, args ...interface{}) *dbRow {
+    ctx, cancel := c.queryContext()
+    return &dbRow{row: c.executor().QueryRowContext(ctx, query, args...), cancel: cancel}
+}
+
+// コンテキストはCloseの後に解放する
+func (c *dbConn) Query(query string, args ...interface{}) (*dbRows, error) {
+    ctx, cancel := c.queryContext()
+    rows, err := c.executor().QueryContext(ctx, query, args...)
+    if err != nil {
+        cancel()
+        return nil, err
+    }
+    return &dbRows{Rows: rows, cancel: cancel}, nil
+}
+
+type dbRow struct {
+    row    *sql.Row
+    cancel context.CancelFunc
+}
+
+func (r *dbRow) Scan(dest ...interface{}) error {
+    defer r.cancel()
+    return r.row.Scan(dest...)
+}
+
+type dbRows struct {
+    *sql.Rows
+    cancel context.CancelFunc
+}
+
+func (r *dbRows) Close() error {
+    defer r.cancel()
+    return r.Rows.Close()
+}
+
+// 起動時に作成したコネクションプールからDatabaseの実装を作成する
+func NewSQLDatabase(pool *sql.DB, dialect sqlDialect, queryTimeout time.Duration) *SQLDatabase {
+    return &SQLDatabase{db: &dbConn{pool: pool, dialect: dialect, ctx: context.Background(), timeout: queryTimeout}}
+}
+
+// リクエストのコンテキストに結び付けたDatabaseを返す
+// クライアントが切断した場合やタイムアウトした場合は実行中のクエリが中断される
+func (db *SQLDatabase) WithContext(ctx context.Context) Database {
+    return &SQLDatabase{db: &dbConn{pool: db.db.pool, tx: db.db.tx, dialect: db.db.dialect, ctx: ctx, timeout: db.db.timeout}}
+}
+
+// コネクションプールの統計情報
+func (db *SQLDatabase) Stats() sql.DBStats {
+    return db.db.pool.Stats()
+}
+
+// 監視用のコネクションプールの統計情報
+type DBPoolStats struct {
+    MaxOpenConnections int    `json:"max_open_connections"`
+    OpenConnections    int    `json:"open_connections"`
+    InUse              int    `json:"in_use"`
+    Idle               int    `json:"idle"`
+    WaitCount          int64  `json:"wait_count"`
+    WaitDuration       string `json:"wait_duration"`
+    MaxIdleClosed      int64  `json:"max_idle_closed"`
+    MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+    MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+func newDBPoolStats(stats sql.DBStats) DBPoolStats {
+    return DBPoolStats{
+        MaxOpenConnections: stats.MaxOpenConnections,
+        OpenConnections:    stats.OpenConnections,
+        InUse:              stats.InUse,
+        Idle:               stats.Idle,
+        WaitCount:          stats.WaitCount,
+        WaitDuration:       stats.WaitDuration.String(),
+        MaxIdleClosed:      stats.MaxIdleClosed,
+        MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+        MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+    }
+}
+
+// コネクションプールの統計情報(GET、管理者のみ)
+// ルーターのRoleMiddleware(RoleAdmin)で認証済み
+func DBStatsHandler(w http.ResponseWriter, r *http.Request, stats func() sql.DBStats) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(newDBPoolStats(stats()))
+}
+
+// Databaseの実装がコンテキストに対応している場合は、リクエストのコンテキストに結び付ける
+func withRequestContext(db Database, r *http.Request) Database {
+    if c, ok := db.(interface {
+        WithContext(ctx context.Context) Database
+    }); ok {
+        return c.WithContext(r.Context())
+    }
+    return db
+}
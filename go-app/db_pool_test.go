@@ -0,0 +1,71 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestLoadDBPoolConfig(t *testing.T) {
+    t.Setenv("DB_MAX_OPEN_CONNS", "10")
+    t.Setenv("DB_QUERY_TIMEOUT", "2s")
+
+    config, err := loadDBPoolConfig(configSource{})
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if config.MaxOpenConns != 10 || config.QueryTimeout != 2*time.Second {
+        t.Errorf("Unexpected config: %+v", config)
+    }
+    if config.MaxIdleConns != defaultDBMaxIdleConns || config.ConnMaxLifetime != defaultDBConnMaxLifetime {
+        t.Errorf("Expected defaults for unset values, got %+v", config)
+    }
+
+    t.Setenv("DB_MAX_OPEN_CONNS", "many")
+    if _, err := loadDBPoolConfig(configSource{}); err == nil {
+        t.Errorf("Expected an error for an invalid DB_MAX_OPEN_CONNS")
+    }
+}
+
+func TestSQLDatabaseUsesRequestContext(t *testing.T) {
+    // 接続先には実際には接続しない（コンテキストが終了しているため）
+    pool, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/test")
+    if err != nil {
+        t.Fatalf("Failed to open pool: %v", err)
+    }
+    defer pool.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    req := httptest.NewRequest("GET", "/api/profile", nil).WithContext(ctx)
+
+    db := withRequestContext(NewSQLDatabase(pool, mysqlDialect{}, time.Second), req)
+    if _, err := db.GetUserByID(1); err != context.Canceled {
+        t.Errorf("Expected context.Canceled, got %v", err)
+    }
+}
+
+func TestDBStatsHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectAdminUser(db)
+
+    stats := func() sql.DBStats {
+        return sql.DBStats{MaxOpenConnections: 25, OpenConnections: 3, InUse: 1, Idle: 2}
+    }
+    app := newTestApp(db, keys)
+    app.DBStats = stats
+    w := serveTestRouter(app, newAdminRequest(t, keys, "GET", "/api/admin/db/stats", nil))
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    var response DBPoolStats
+    json.NewDecoder(w.Body).Decode(&response)
+    if response.OpenConnections != 3 || response.InUse != 1 || response.Idle != 2 {
+        t.Errorf("Unexpected stats: %+v", response)
+    }
+}
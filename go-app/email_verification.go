@@ -0,0 +1,138 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+// メール認証トークンの用途（有効期限はtokenLifetimes.EmailVerification）
+const emailVerificationPurpose = "verify-email"
+
+// 認証メール再送信の最小間隔
+const verificationResendInterval = 1 * time.Minute
+
+type VerifyEmailRequest struct {
+    Token string `json:"token"`
+}
+
+// 公開（Status 1: 公開, 2: 限定公開）にはメール認証が必要かどうか
+func isPublishingStatus(status string) bool {
+    return status == "1" || status == "2"
+}
+
+// 署名付きの認証リンクを生成してメールで送信し、送信日時を記録する
+func sendVerificationEmail(db Database, mailer Mailer, appBaseURL string, keys *KeySet, userID int, email string) error {
+    token, err := GenerateActionToken(userID, email, emailVerificationPurpose, tokenLifetimes.EmailVerification, keys)
+    if err != nil {
+        return err
+    }
+
+    verifyURL := appBaseURL + "/verify-email?token=" + url.QueryEscape(token)
+    body := fmt.Sprintf("CCGalleryへのご登録ありがとうございます。\n以下のリンクから%d時間以内にメールアドレスの確認を完了してください。\n\n%s\n\nこのメールに心当たりがない場合は破棄してください。",
+        int(tokenLifetimes.EmailVerification.Hours()), verifyURL)
+    if err := mailer.Send(email, "【CCGallery】メールアドレスの確認", body); err != nil {
+        return err
+    }
+
+    return db.UpdateVerificationSentAt(userID, time.Now())
+}
+
+// メールアドレスの確認：認証リンクのトークンを検証する
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, keys *KeySet, db Database) {
+    var req VerifyEmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    claims, err := ValidateActionToken(req.Token, emailVerificationPurpose, keys)
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidVerificationToken)
+        return
+    }
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidVerificationToken)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+
+    // リンク発行後にメールアドレスが変更されている場合は無効
+    if user.Email != claims.Email {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidVerificationToken)
+        return
+    }
+
+    if !user.EmailVerified {
+        if err := db.SetEmailVerified(user.ID); err != nil {
+            serverError(w, r, "Database execution failed", err)
+            return
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{
+        Message: "Email address verified",
+    })
+}
+
+// 認証メールの再送信（ログイン中のユーザー向け、送信間隔を制限する）
+func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database, mailer Mailer, appBaseURL string) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
+        return
+    }
+
+    if user.EmailVerified {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(ResponseData{
+            Message: "Email address is already verified",
+        })
+        return
+    }
+
+    // 前回の送信から一定時間が経過していない場合は429を返す
+    if user.VerificationSentAt.Valid {
+        wait := verificationResendInterval - time.Since(user.VerificationSentAt.Time)
+        if wait > 0 {
+            w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+            writeError(w, r, http.StatusTooManyRequests, ErrCodeVerificationEmailRateLimit)
+            return
+        }
+    }
+
+    if err := sendVerificationEmail(db, mailer, appBaseURL, auth.keys, user.ID, user.Email); err != nil {
+        requestLogger(r).Error("Failed to send verification email", "error", err)
+        writeError(w, r, http.StatusInternalServerError, ErrCodeEmailDeliveryFailed)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{
+        Message: "Verification email sent",
+    })
+}
+
+func (db *SQLDatabase) SetEmailVerified(userID int) error {
+    _, err := db.db.Exec("UPDATE users SET email_verified = TRUE WHERE id = ?", userID)
+    return err
+}
+
+func (db *SQLDatabase) UpdateVerificationSentAt(userID int, sentAt time.Time) error {
+    _, err := db.db.Exec("UPDATE users SET verification_sent_at = ? WHERE id = ?", sentAt, userID)
+    return err
+}
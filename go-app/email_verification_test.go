@@ -0,0 +1,105 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+func TestValidateTokenRejectsActionToken(t *testing.T) {
+    token, _ := GenerateActionToken(2, "test2@example.com", emailVerificationPurpose, time.Hour, NewHMACKeySet("testkey"))
+
+    // 用途限定トークンはアクセストークンとして使えない
+    if _, err := ValidateToken("Bearer "+token, NewHMACKeySet("testkey")); err == nil {
+        t.Errorf("Action token was accepted as an access token")
+    }
+
+    // 別の用途としても使えない
+    if _, err := ValidateActionToken(token, "other-purpose", NewHMACKeySet("testkey")); err == nil {
+        t.Errorf("Action token was accepted for another purpose")
+    }
+}
+
+func TestVerifyEmailHandler(t *testing.T) {
+    db, keys := setupMock(t)
+
+    token, _ := GenerateActionToken(2, "test2@example.com", emailVerificationPurpose, time.Hour, keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com"}, nil)
+    db.EXPECT().SetEmailVerified(2).Return(nil)
+
+    body, _ := json.Marshal(VerifyEmailRequest{Token: token})
+    req := httptest.NewRequest("POST", "/api/verify-email", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    VerifyEmailHandler(w, req, keys, db)
+
+    verifyResponse(t, w, http.StatusOK, "Email address verified", false)
+}
+
+func TestVerifyEmailHandlerRejectsChangedEmail(t *testing.T) {
+    db, keys := setupMock(t)
+
+    // リンク発行後にメールアドレスが変更された場合
+    token, _ := GenerateActionToken(2, "old@example.com", emailVerificationPurpose, time.Hour, keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "new@example.com"}, nil)
+
+    body, _ := json.Marshal(VerifyEmailRequest{Token: token})
+    req := httptest.NewRequest("POST", "/api/verify-email", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    VerifyEmailHandler(w, req, keys, db)
+
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("Expected status Bad Request, got %v", w.Code)
+    }
+}
+
+func TestResendVerificationEmailHandlerThrottles(t *testing.T) {
+    db, keys := setupMock(t)
+    mailer := &MemoryMailer{}
+
+    accessToken, _ := GenerateJWT(2, "test2@example.com", keys)
+    sentAt := sql.NullTime{Time: time.Now().Add(-10 * time.Second), Valid: true}
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", VerificationSentAt: sentAt}, nil)
+
+    req := httptest.NewRequest("POST", "/api/verify-email/resend", nil)
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    app := newTestApp(db, keys)
+    app.Mailer = mailer
+    w := serveTestRouter(app, req)
+
+    if w.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected status Too Many Requests, got %v", w.Code)
+    }
+    if w.Header().Get("Retry-After") == "" {
+        t.Errorf("Expected Retry-After header to be set")
+    }
+    if _, ok := mailer.Last(); ok {
+        t.Errorf("Did not expect an email to be sent")
+    }
+}
+
+func TestResendVerificationEmailHandlerSendsEmail(t *testing.T) {
+    db, keys := setupMock(t)
+    mailer := &MemoryMailer{}
+
+    accessToken, _ := GenerateJWT(2, "test2@example.com", keys)
+    sentAt := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", VerificationSentAt: sentAt}, nil)
+    db.EXPECT().UpdateVerificationSentAt(2, gomock.Any()).Return(nil)
+
+    req := httptest.NewRequest("POST", "/api/verify-email/resend", nil)
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    app := newTestApp(db, keys)
+    app.Mailer = mailer
+    w := serveTestRouter(app, req)
+
+    verifyResponse(t, w, http.StatusOK, "Verification email sent", false)
+    if msg, ok := mailer.Last(); !ok || msg.To != "test2@example.com" {
+        t.Errorf("Expected verification email to 'test2@example.com'")
+    }
+}
@@ -7,25 +7,22 @@ import (
     "crypto/rand"
     "encoding/base64"
 		"encoding/json"
+		"errors"
 		"net/http"
     "io"
-    "os"
     // "strconv"
-		"log"
 		"fmt"
 )
 
-// システムの環境変数からAES秘密鍵を取得する
-func getAESKey() []byte {
-	key := os.Getenv("AES_SECRET_KEY")
-	decodedKey, err := base64.StdEncoding.DecodeString(key)
-	if err != nil {
-		log.Fatalf("getAESKey: failed to decode AES key: %v", err)
-	}
-	if len(decodedKey) != 32 {
-		log.Fatalf("getAESKey: decoded key length is not 32 bytes, key length: %d", len(decodedKey))
-	}
-	return decodedKey
+// 共有リンクの暗号化鍵（起動時にConfigの値で設定する）
+var aesKey []byte
+
+// AES秘密鍵を取得する（鍵の長さは起動時にloadAESKeyで検証済み）
+func getAESKey() ([]byte, error) {
+    if len(aesKey) != aesKeyLength {
+        return nil, errors.New("AES key is not configured")
+    }
+    return aesKey, nil
 }
 
 
@@ -93,7 +90,10 @@ func getAESKey() []byte {
 
 // EncryptString は与えられた文字列をAESで暗号化し、Base64エンコードされた文字列を返します。
 func EncryptString(text string) (string, error) {
-    key := getAESKey()
+    key, err := getAESKey()
+    if err != nil {
+        return "", err
+    }
     block, err := aes.NewCipher(key)
     if err != nil {
         return "", fmt.Errorf("EncryptString: failed to create cipher block: %v", err)
@@ -115,7 +115,10 @@ func EncryptString(text string) (string, error) {
 
 // DecryptString はBase64エンコードされた暗号文を受け取り、AESで復号化した文字列を返します。
 func DecryptString(encoded string) (string, error) {
-    key := getAESKey()
+    key, err := getAESKey()
+    if err != nil {
+        return "", err
+    }
     ciphertext, err := base64.URLEncoding.DecodeString(encoded)
     if err != nil {
         return "", fmt.Errorf("DecryptString: failed to decode ciphertext: %v", err)
@@ -142,45 +145,36 @@ func DecryptString(encoded string) (string, error) {
 
 
 
-func ValidateEncryptedUUID(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w)
-
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
+func ValidateEncryptedUUID(w http.ResponseWriter, r *http.Request, db Database) {
     // クエリから暗号化されたUUIDを取得
     encryptedUUID := r.URL.Query().Get("pass")
     if encryptedUUID == "" {
-        http.Error(w, "Encrypted UUID not provided", http.StatusBadRequest)
+        writeFieldErrors(w, r, newFieldError("pass", FieldErrRequired))
         return
     }
 
-    // 暗号化されたUUIDを復号化
-    decryptedUUID, err := DecryptString(encryptedUUID)
-    if err != nil {
-        http.Error(w, "Failed to decrypt UUID", http.StatusInternalServerError)
+    // 鍵の設定漏れはサーバー側の問題として扱う
+    if _, err := getAESKey(); err != nil {
+        serverError(w, r, "Failed to load AES key", err)
         return
     }
 
-    db, err := OpenDatabase()
+    // 暗号化されたUUIDを復号化（壊れた・改ざんされたパスはリクエストの誤りとして扱う）
+    decryptedUUID, err := DecryptString(encryptedUUID)
     if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
         return
     }
-    defer db.Close()
 
     // 復号化したUUIDがデータベースに存在するかチェック
-    var exists bool
-    err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE user_uuid = ?)`, decryptedUUID).Scan(&exists)
+    exists, err := db.ShareLinkTargetExists(decryptedUUID)
     if err != nil {
-        http.Error(w, "Failed to query database", http.StatusInternalServerError)
+        serverError(w, r, "Failed to query database", err)
         return
     }
 
     if !exists {
-        http.Error(w, "UUID does not exist", http.StatusNotFound)
+        writeError(w, r, http.StatusNotFound, ErrCodeShareLinkNotFound)
         return
     }
 
@@ -190,24 +184,17 @@ func ValidateEncryptedUUID(w http.ResponseWriter, r *http.Request) {
 }
 
 func GenerateEncryptedPass(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w)
-
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
     // クエリからUUIDを取得
     uuid := r.URL.Query().Get("uuid")
     if uuid == "" {
-        http.Error(w, "UUID not provided", http.StatusBadRequest)
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
         return
     }
 
     // UUIDを暗号化
     encryptedPass, err := EncryptString(uuid)
     if err != nil {
-        http.Error(w, "Failed to encrypt UUID", http.StatusInternalServerError)
+        serverError(w, r, "Failed to encrypt UUID", err)
         return
     }
 
@@ -215,3 +202,10 @@ func GenerateEncryptedPass(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{"pass": encryptedPass})
 }
+
+// 共有リンクの対象（user_uuid）が存在するかどうか
+func (db *SQLDatabase) ShareLinkTargetExists(userUUID string) (bool, error) {
+    var exists bool
+    err := db.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE user_uuid = ?)`, userUUID).Scan(&exists)
+    return exists, err
+}
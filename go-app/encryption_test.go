@@ -0,0 +1,32 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+)
+
+func TestValidateEncryptedUUID(t *testing.T) {
+    db, _ := setupMock(t)
+    setupTOTPKey(t)
+
+    pass, err := EncryptString("portfolio-uuid")
+    if err != nil {
+        t.Fatalf("Failed to encrypt UUID: %v", err)
+    }
+    db.EXPECT().ShareLinkTargetExists("portfolio-uuid").Return(true, nil)
+
+    w := httptest.NewRecorder()
+    ValidateEncryptedUUID(w, httptest.NewRequest("GET", "/api/validate-uuid?pass="+url.QueryEscape(pass), nil), db)
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+
+    // 壊れたパスはサーバーエラーではなく、不正なリクエストとして扱う
+    for _, pass := range []string{"not-base64!", "c2hvcnQ="} {
+        w := httptest.NewRecorder()
+        ValidateEncryptedUUID(w, httptest.NewRequest("GET", "/api/validate-uuid?pass="+url.QueryEscape(pass), nil), db)
+        verifyErrorResponse(t, w, http.StatusBadRequest, ErrCodeInvalidRequest)
+    }
+}
@@ -1,6 +1,6 @@
 module go-app
 
-go 1.21.3
+go 1.22
 
 require github.com/go-sql-driver/mysql v1.7.1
 
@@ -10,13 +10,28 @@ require github.com/dgrijalva/jwt-go v3.2.0+incompatible
 
 require github.com/joho/godotenv v1.5.1
 
-require github.com/google/uuid v1.4.0
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/glebarez/go-sqlite v1.22.0
+	github.com/golang/mock v1.6.0
+	github.com/google/uuid v1.5.0
+	github.com/prometheus/client_golang v1.22.0
+)
 
 require (
-	github.com/DATA-DOG/go-sqlmock v1.5.0 // indirect
-	github.com/golang/mock v1.6.0 // indirect
-	golang.org/x/mod v0.4.2 // indirect
-	golang.org/x/sys v0.14.0 // indirect
-	golang.org/x/tools v0.1.1 // indirect
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.62.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	google.golang.org/protobuf v1.36.5 // indirect
+	modernc.org/libc v1.37.6 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.7.2 // indirect
+	modernc.org/sqlite v1.28.0 // indirect
 )
@@ -0,0 +1,67 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "os"
+    "time"
+)
+
+// 準備状態の確認1件あたりのタイムアウト
+const readinessCheckTimeout = 2 * time.Second
+
+// /readyzのレスポンス
+type ReadinessResponse struct {
+    Status string            `json:"status"`
+    Checks map[string]string `json:"checks"`
+}
+
+// プロセスが応答できるかどうかのみを返す（依存先は確認しない）
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// リクエストを受け付けられるかどうか（データベースへの接続と画像ディレクトリへの書き込み）を返す
+// 停止処理中は新しいリクエストが振り分けられないように503を返す
+func ReadyzHandler(w http.ResponseWriter, r *http.Request, app *App) {
+    ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+    defer cancel()
+
+    response := ReadinessResponse{Status: "ok", Checks: map[string]string{}}
+    record := func(name string, err error) {
+        if err != nil {
+            response.Status = "unavailable"
+            response.Checks[name] = err.Error()
+            return
+        }
+        response.Checks[name] = "ok"
+    }
+
+    if app.draining.Load() {
+        response.Status = "unavailable"
+        response.Checks["server"] = "shutting down"
+    }
+    record("database", app.DBPing(ctx))
+    record("image_dir", checkDirWritable(app.ImageDir))
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    if response.Status != "ok" {
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }
+    json.NewEncoder(w).Encode(response)
+}
+
+// ディレクトリに一時ファイルを作成できるかどうかを確認する
+func checkDirWritable(dir string) error {
+    f, err := os.CreateTemp(dir, ".readyz-*")
+    if err != nil {
+        return err
+    }
+    name := f.Name()
+    f.Close()
+    return os.Remove(name)
+}
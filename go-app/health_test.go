@@ -0,0 +1,65 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "testing"
+)
+
+func TestHealthzHandler(t *testing.T) {
+    db, keys := setupMock(t)
+
+    w := serveTestRouter(newTestApp(db, keys), httptest.NewRequest("GET", "/healthz", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v", w.Code)
+    }
+}
+
+func TestReadyzHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    app := newTestApp(db, keys)
+    app.ImageDir = t.TempDir()
+
+    w := serveTestRouter(app, httptest.NewRequest("GET", "/readyz", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    var response ReadinessResponse
+    json.NewDecoder(w.Body).Decode(&response)
+    if response.Checks["database"] != "ok" || response.Checks["image_dir"] != "ok" {
+        t.Errorf("Unexpected checks: %+v", response)
+    }
+}
+
+func TestReadyzHandlerReportsFailures(t *testing.T) {
+    db, keys := setupMock(t)
+    app := newTestApp(db, keys)
+    app.DBPing = func(ctx context.Context) error { return errors.New("connection refused") }
+    app.ImageDir = filepath.Join(t.TempDir(), "missing")
+
+    w := serveTestRouter(app, httptest.NewRequest("GET", "/readyz", nil))
+    if w.Code != http.StatusServiceUnavailable {
+        t.Fatalf("Expected status 503, got %v", w.Code)
+    }
+    var response ReadinessResponse
+    json.NewDecoder(w.Body).Decode(&response)
+    if response.Checks["database"] != "connection refused" || response.Checks["image_dir"] == "ok" {
+        t.Errorf("Unexpected checks: %+v", response)
+    }
+}
+
+func TestReadyzHandlerWhileDraining(t *testing.T) {
+    db, keys := setupMock(t)
+    app := newTestApp(db, keys)
+    app.ImageDir = t.TempDir()
+    app.StartDraining()
+
+    w := serveTestRouter(app, httptest.NewRequest("GET", "/readyz", nil))
+    if w.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503 while shutting down, got %v", w.Code)
+    }
+}
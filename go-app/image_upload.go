@@ -12,59 +12,40 @@ import (
 )
 
 
-// 画像の保存先のベースディレクトリ
-const baseImagePath = "images"
+// 画像を公開するURLのパス（保存先のディレクトリはIMAGE_DIRで設定する）
+const imageURLPath = "/images/"
 
 // レスポンスに含まれる画像のURLを生成する関数
 func generateImageUrl(userID, fileName string) string {
-    return fmt.Sprintf("/%s/%s/%s", baseImagePath, userID, fileName)
+    return fmt.Sprintf("%s%s/%s", imageURLPath, userID, fileName)
 }
 
 // ユーザーIDに基づいてuser_uuidを取得する関数
-func getUserUUIDFromDatabase(userID int) (string, error) {
-    db, err := OpenDatabase() // 仮想のデータベース接続関数
+func getUserUUIDFromDatabase(db Database, userID int) (string, error) {
+    user, err := db.GetUserByID(userID)
     if err != nil {
         return "", err
     }
-    defer db.Close()
 
-    var userUUID string
-    err = db.QueryRow("SELECT user_uuid FROM users WHERE id = ?", userID).Scan(&userUUID)
-    if err != nil {
-        return "", err
-    }
-
-    return userUUID, nil
+    return user.user_uuid, nil
 }
 
 // ユーザープロフィール画像保存（アイコン）
-func UploadProfileImageHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
-    EnableCORS(w) // CORSヘッダーの設定
-
-    // プリフライトリクエストにはここで処理を止める
-    if r.Method == "OPTIONS" {
-        w.WriteHeader(http.StatusOK)
-        return
-    }
-
-    // JWTトークンを検証してユーザーIDを取得
-    claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
-        return
-    }
+func UploadProfileImageHandler(w http.ResponseWriter, r *http.Request, db Database, imageDir string, metrics *Metrics) {
+    // ルーターのAuthMiddleware(ScopeImageWrite)で認証済み
+    claims := requestClaims(r)
     
 	// マルチパートフォームデータを解析する
-    err = r.ParseMultipartForm(10 << 20) // 10 MBの上限
+    err := r.ParseMultipartForm(10 << 20) // 10 MBの上限
     if err != nil {
-        http.Error(w, "フォームの解析エラー", http.StatusBadRequest)
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
         return
     }
 
 		// フォームから画像ファイルを取得
     file, header, err := r.FormFile("image") // 'file' と 'header' を宣言
     if err != nil {
-        http.Error(w, "ファイルの取得エラー", http.StatusBadRequest)
+        writeError(w, r, http.StatusBadRequest, ErrCodeImageRequired)
         return
     }
     defer file.Close()
@@ -73,25 +54,25 @@ func UploadProfileImageHandler(w http.ResponseWriter, r *http.Request, jwtKey st
     // userID := strconv.Itoa(claims.ID)
 
     // userIDを使ってデータベースからuser_uuidを取得
-    userUUID, err := getUserUUIDFromDatabase(claims.ID)
+    userUUID, err := getUserUUIDFromDatabase(db, claims.ID)
     if err != nil {
-        http.Error(w, "Failed to retrieve user UUID", http.StatusInternalServerError)
+        serverError(w, r, "Failed to retrieve user UUID", err)
         return
     }
 
     // "profile"サブディレクトリを含むパスを生成
-    profileImagePath := filepath.Join(baseImagePath, userUUID, "profile")
+    profileImagePath := filepath.Join(imageDir, userUUID, "profile")
 
     // ユーザーのプロファイル画像ディレクトリを作成（存在しなければ）
     if err := os.MkdirAll(profileImagePath, 0755); err != nil {
-        http.Error(w, "ディレクトリの作成エラー", http.StatusInternalServerError)
+        serverError(w, r, "ディレクトリの作成エラー", err)
         return
     }
 
     // profileディレクトリ内の既存のファイルを削除
     dirEntries, err := os.ReadDir(profileImagePath)
     if err != nil {
-        http.Error(w, "既存のファイルの読み取りエラー", http.StatusInternalServerError)
+        serverError(w, r, "既存のファイルの読み取りエラー", err)
         return
     }
     for _, entry := range dirEntries {
@@ -105,14 +86,16 @@ func UploadProfileImageHandler(w http.ResponseWriter, r *http.Request, jwtKey st
     filePath := filepath.Join(profileImagePath, newFileName)
     dst, err := os.Create(filePath)
     if err != nil {
-        http.Error(w, "ファイルの作成エラー", http.StatusInternalServerError)
+        serverError(w, r, "ファイルの作成エラー", err)
         return
     }
     defer dst.Close()
 
     // ファイルをディスクに書き込み
-    if _, err := io.Copy(dst, file); err != nil {
-        http.Error(w, "ファイルの書き込みエラー", http.StatusInternalServerError)
+    written, err := io.Copy(dst, file)
+    metrics.ObserveUpload("profile", written, err)
+    if err != nil {
+        serverError(w, r, "ファイルの書き込みエラー", err)
         return
     }
 
@@ -124,30 +107,19 @@ func UploadProfileImageHandler(w http.ResponseWriter, r *http.Request, jwtKey st
 
 
 // ポートフォリオの画像保存
-func UploadPortfolioImageHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
-    EnableCORS(w) // CORSヘッダーの設定
-
-    if r.Method == "OPTIONS" {
-        w.WriteHeader(http.StatusOK)
-        return
-    }
+func UploadPortfolioImageHandler(w http.ResponseWriter, r *http.Request, db Database, imageDir string, metrics *Metrics) {
+    // ルーターのAuthMiddleware(ScopeImageWrite)で認証済み
+    claims := requestClaims(r)
 
-    // JWTトークンを検証してユーザーIDを取得
-    claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
+    err := r.ParseMultipartForm(10 << 20) // 10 MBの上限
     if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
-        return
-    }
-
-    err = r.ParseMultipartForm(10 << 20) // 10 MBの上限
-    if err != nil {
-        http.Error(w, "フォームの解析エラー", http.StatusBadRequest)
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
         return
     }
 
     file, header, err := r.FormFile("image")
     if err != nil {
-        http.Error(w, "ファイルの取得エラー", http.StatusBadRequest)
+        writeError(w, r, http.StatusBadRequest, ErrCodeImageRequired)
         return
     }
     defer file.Close()
@@ -155,18 +127,18 @@ func UploadPortfolioImageHandler(w http.ResponseWriter, r *http.Request, jwtKey
     // userID := strconv.Itoa(claims.ID)
 
     // userIDを使ってデータベースからuser_uuidを取得
-    userUUID, err := getUserUUIDFromDatabase(claims.ID)
+    userUUID, err := getUserUUIDFromDatabase(db, claims.ID)
     if err != nil {
-        http.Error(w, "Failed to retrieve user UUID", http.StatusInternalServerError)
+        serverError(w, r, "Failed to retrieve user UUID", err)
         return
     }
 
     // "portfolio"サブディレクトリを含むパスを生成
-    portfolioImagePath := filepath.Join(baseImagePath, userUUID, "portfolio")
+    portfolioImagePath := filepath.Join(imageDir, userUUID, "portfolio")
 
     // ユーザーのポートフォリオ画像ディレクトリを作成（存在しなければ）
     if err := os.MkdirAll(portfolioImagePath, 0755); err != nil {
-        http.Error(w, "ディレクトリの作成エラー", http.StatusInternalServerError)
+        serverError(w, r, "ディレクトリの作成エラー", err)
         return
     }
 
@@ -177,13 +149,15 @@ func UploadPortfolioImageHandler(w http.ResponseWriter, r *http.Request, jwtKey
     filePath := filepath.Join(portfolioImagePath, newFileName)
     dst, err := os.Create(filePath)
     if err != nil {
-        http.Error(w, "ファイルの作成エラー", http.StatusInternalServerError)
+        serverError(w, r, "ファイルの作成エラー", err)
         return
     }
     defer dst.Close()
 
-    if _, err := io.Copy(dst, file); err != nil {
-        http.Error(w, "ファイルの書き込みエラー", http.StatusInternalServerError)
+    written, err := io.Copy(dst, file)
+    metrics.ObserveUpload("portfolio", written, err)
+    if err != nil {
+        serverError(w, r, "ファイルの書き込みエラー", err)
         return
     }
 
@@ -0,0 +1,479 @@
+package main
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math/big"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/dgrijalva/jwt-go"
+)
+
+// 対応している署名アルゴリズム
+const (
+    SigningAlgHS256 = "HS256"
+    SigningAlgRS256 = "RS256"
+    SigningAlgEdDSA = "EdDSA"
+)
+
+const (
+    // 新しい鍵は、他のインスタンスやJWKSのキャッシュに行き渡るまで署名に使わない
+    keyActivationDelay = 10 * time.Minute
+    // 鍵ディレクトリを再読み込みする間隔（他のインスタンスが生成した鍵を取り込む）
+    keyReloadInterval = 1 * time.Minute
+    // ローテーション後も古い鍵で検証を続ける期間の既定値（最長のトークン有効期限より長くする）
+    defaultKeyRetention = 48 * time.Hour
+    // JWKSをキャッシュしてよい時間
+    jwksMaxAge = 5 * time.Minute
+    rsaKeyBits = 2048
+)
+
+// jwt-go v3はEd25519に対応していないため、EdDSA(RFC 8037)の署名方式を登録する
+type signingMethodEdDSA struct{}
+
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+    jwt.RegisterSigningMethod(SigningAlgEdDSA, func() jwt.SigningMethod {
+        return SigningMethodEdDSA
+    })
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+    return SigningAlgEdDSA
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+    publicKey, ok := key.(ed25519.PublicKey)
+    if !ok {
+        return jwt.ErrInvalidKeyType
+    }
+    sig, err := jwt.DecodeSegment(signature)
+    if err != nil {
+        return err
+    }
+    if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+        return jwt.ErrSignatureInvalid
+    }
+    return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+    privateKey, ok := key.(ed25519.PrivateKey)
+    if !ok {
+        return "", jwt.ErrInvalidKeyType
+    }
+    return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// 署名・検証に使う1つの鍵
+type tokenKey struct {
+    kid       string
+    alg       string
+    signKey   interface{} // 秘密鍵（検証専用の鍵の場合はnil）
+    verifyKey interface{}
+    createdAt time.Time
+}
+
+func (k *tokenKey) method() jwt.SigningMethod {
+    return jwt.GetSigningMethod(k.alg)
+}
+
+// トークンの署名鍵と検証鍵の集合
+// HS256の場合は共有シークレット1つ、RS256/EdDSAの場合は鍵ディレクトリ内のすべての鍵を検証に使う
+type KeySet struct {
+    mu   sync.RWMutex
+    alg  string
+    dir  string // 鍵ディレクトリ（HS256の場合は空）
+    keys []*tokenKey
+    now  func() time.Time
+}
+
+// 共有シークレットでHS256署名する鍵セット（従来の動作）
+func NewHMACKeySet(secret string) *KeySet {
+    return &KeySet{
+        alg:  SigningAlgHS256,
+        keys: []*tokenKey{{alg: SigningAlgHS256, signKey: []byte(secret), verifyKey: []byte(secret)}},
+        now:  time.Now,
+    }
+}
+
+// 鍵ディレクトリから鍵を読み込む（署名用の鍵がない場合は生成する）
+func NewDirectoryKeySet(dir string, alg string) (*KeySet, error) {
+    if alg != SigningAlgRS256 && alg != SigningAlgEdDSA {
+        return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+    }
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        return nil, err
+    }
+
+    keys := &KeySet{alg: alg, dir: dir, now: time.Now}
+    if err := keys.Reload(); err != nil {
+        return nil, err
+    }
+    if keys.signingKey() == nil {
+        if err := keys.Rotate(); err != nil {
+            return nil, err
+        }
+    }
+    return keys, nil
+}
+
+// JWTの署名鍵の設定
+type JWTConfig struct {
+    Alg              string        // HS256（既定）/ RS256 / EdDSA（JWT_SIGNING_ALG）
+    Secret           string        // HS256の共有シークレット（JWT_SECRET_KEY）
+    KeyDir           string        // RS256 / EdDSAの鍵ディレクトリ（JWT_KEY_DIR、既定はkeys）
+    RotationInterval time.Duration // 鍵のローテーション間隔（JWT_KEY_ROTATION_INTERVAL、0の場合は再読み込みのみ）
+    KeyRetention     time.Duration // ローテーション後も検証に使う期間（JWT_KEY_RETENTION）
+}
+
+// JWTの署名鍵の設定を読み込む
+func loadJWTConfig(src configSource) (JWTConfig, error) {
+    config := JWTConfig{
+        Alg:    src.get("JWT_SIGNING_ALG"),
+        Secret: src.get("JWT_SECRET_KEY"),
+        KeyDir: src.get("JWT_KEY_DIR"),
+    }
+    if config.Alg == "" {
+        config.Alg = SigningAlgHS256
+    }
+    if config.KeyDir == "" {
+        config.KeyDir = "keys"
+    }
+
+    var errs []error
+    switch config.Alg {
+    case SigningAlgHS256:
+        if config.Secret == "" {
+            errs = append(errs, errors.New("JWT_SECRET_KEY must be set when JWT_SIGNING_ALG is HS256"))
+        }
+    case SigningAlgRS256, SigningAlgEdDSA:
+    default:
+        errs = append(errs, fmt.Errorf("unsupported JWT_SIGNING_ALG: %s", config.Alg))
+    }
+
+    var err error
+    if config.RotationInterval, err = src.duration("JWT_KEY_ROTATION_INTERVAL", 0); err != nil {
+        errs = append(errs, err)
+    }
+    if config.KeyRetention, err = src.duration("JWT_KEY_RETENTION", defaultKeyRetention); err != nil {
+        errs = append(errs, err)
+    }
+    return config, errors.Join(errs...)
+}
+
+// 設定から鍵セットを作成する（HS256の場合は共有シークレット、それ以外は鍵ディレクトリの鍵を使う）
+func LoadKeySet(config JWTConfig) (*KeySet, error) {
+    if config.Alg == SigningAlgHS256 {
+        return NewHMACKeySet(config.Secret), nil
+    }
+    return NewDirectoryKeySet(config.KeyDir, config.Alg)
+}
+
+// 鍵ディレクトリの*.pemを読み込み直す
+// 秘密鍵（PKCS#8 / PKCS#1）は署名と検証に、公開鍵（PKIX）は検証のみに使う。ファイル名（拡張子なし）がkidになる
+func (k *KeySet) Reload() error {
+    if k.dir == "" {
+        return nil
+    }
+
+    paths, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+    if err != nil {
+        return err
+    }
+
+    var keys []*tokenKey
+    for _, path := range paths {
+        key, err := loadKeyFile(path)
+        if err != nil {
+            return fmt.Errorf("failed to load key %s: %v", path, err)
+        }
+        keys = append(keys, key)
+    }
+    sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.Before(keys[j].createdAt) })
+
+    k.mu.Lock()
+    k.keys = keys
+    k.mu.Unlock()
+    return nil
+}
+
+func loadKeyFile(path string) (*tokenKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, errors.New("no PEM data found")
+    }
+
+    key := &tokenKey{
+        kid:       strings.TrimSuffix(filepath.Base(path), ".pem"),
+        createdAt: info.ModTime(),
+    }
+
+    var parsed interface{}
+    switch block.Type {
+    case "PRIVATE KEY":
+        parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    case "RSA PRIVATE KEY":
+        parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    case "PUBLIC KEY":
+        parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+    default:
+        return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    switch v := parsed.(type) {
+    case *rsa.PrivateKey:
+        key.alg, key.signKey, key.verifyKey = SigningAlgRS256, v, &v.PublicKey
+    case *rsa.PublicKey:
+        key.alg, key.verifyKey = SigningAlgRS256, v
+    case ed25519.PrivateKey:
+        key.alg, key.signKey, key.verifyKey = SigningAlgEdDSA, v, v.Public()
+    case ed25519.PublicKey:
+        key.alg, key.verifyKey = SigningAlgEdDSA, v
+    default:
+        return nil, fmt.Errorf("unsupported key type %T", parsed)
+    }
+    return key, nil
+}
+
+// 署名に使う鍵を選ぶ
+// 公開から一定時間が経過した鍵のうち最新のもの。まだ該当する鍵がない場合（初回起動時）は最新の鍵を使う
+func (k *KeySet) signingKey() *tokenKey {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    activeBefore := k.now().Add(-keyActivationDelay)
+    var newest, active *tokenKey
+    for _, key := range k.keys {
+        if key.signKey == nil || key.alg != k.alg {
+            continue
+        }
+        newest = key
+        if !key.createdAt.After(activeBefore) {
+            active = key
+        }
+    }
+    if active != nil {
+        return active
+    }
+    return newest
+}
+
+// Claimsに署名してトークン文字列を返す
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+    key := k.signingKey()
+    if key == nil {
+        return "", errors.New("no signing key available")
+    }
+
+    token := jwt.NewWithClaims(key.method(), claims)
+    if key.kid != "" {
+        token.Header["kid"] = key.kid
+    }
+    return token.SignedString(key.signKey)
+}
+
+// トークンのkidとalgに対応する検証鍵を返す（jwt.Keyfuncとして使う）
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+    kid, _ := token.Header["kid"].(string)
+
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    for _, key := range k.keys {
+        if key.kid != kid {
+            continue
+        }
+        // 公開鍵をHMACのシークレットとして使わせないよう、鍵の種類とalgの一致を確認する
+        if token.Method.Alg() != key.alg {
+            return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+        }
+        return key.verifyKey, nil
+    }
+    return nil, errors.New("unknown signing key")
+}
+
+// 新しい鍵を生成して鍵ディレクトリに保存する
+func (k *KeySet) Rotate() error {
+    if k.dir == "" {
+        return errors.New("key rotation requires a key directory")
+    }
+
+    var privateKey crypto.Signer
+    var err error
+    switch k.alg {
+    case SigningAlgRS256:
+        privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+    case SigningAlgEdDSA:
+        _, privateKey, err = ed25519.GenerateKey(rand.Reader)
+    }
+    if err != nil {
+        return err
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+    if err != nil {
+        return err
+    }
+
+    suffix := make([]byte, 4)
+    if _, err := rand.Read(suffix); err != nil {
+        return err
+    }
+    kid := k.now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+
+    // 書き込み途中のファイルを他のインスタンスが読み込まないよう、一時ファイルから名前を変更する
+    path := filepath.Join(k.dir, kid+".pem")
+    tmpPath := path + ".tmp"
+    if err := os.WriteFile(tmpPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+        return err
+    }
+    if err := os.Rename(tmpPath, path); err != nil {
+        return err
+    }
+    slog.Info("Generated new JWT signing key", "kid", kid, "alg", k.alg)
+    return k.Reload()
+}
+
+// 後継の鍵が署名に使われ始めてからretentionが経過した鍵を削除する
+func (k *KeySet) retireKeys(retention time.Duration) error {
+    k.mu.RLock()
+    keys := k.keys
+    k.mu.RUnlock()
+
+    now := k.now()
+    removed := false
+    for i, key := range keys {
+        if i == len(keys)-1 {
+            break
+        }
+        successorActiveAt := keys[i+1].createdAt.Add(keyActivationDelay)
+        if now.Sub(successorActiveAt) < retention {
+            continue
+        }
+        if err := os.Remove(filepath.Join(k.dir, key.kid+".pem")); err != nil && !os.IsNotExist(err) {
+            return err
+        }
+        slog.Info("Retired JWT signing key", "kid", key.kid)
+        removed = true
+    }
+    if removed {
+        return k.Reload()
+    }
+    return nil
+}
+
+// 鍵ディレクトリの再読み込み、定期的な鍵の生成、古い鍵の削除をバックグラウンドで行う
+// intervalが0の場合は鍵を生成せず、再読み込みのみ行う
+func (k *KeySet) StartRotation(interval time.Duration, retention time.Duration) {
+    if k.dir == "" {
+        return
+    }
+
+    go func() {
+        ticker := time.NewTicker(keyReloadInterval)
+        defer ticker.Stop()
+        for range ticker.C {
+            if err := k.rotateIfDue(interval, retention); err != nil {
+                slog.Error("JWT key rotation failed", "error", err)
+            }
+        }
+    }()
+}
+
+func (k *KeySet) rotateIfDue(interval time.Duration, retention time.Duration) error {
+    if err := k.Reload(); err != nil {
+        return err
+    }
+    if interval <= 0 {
+        return nil
+    }
+
+    // 最新の鍵がintervalより古くなったら新しい鍵を生成する
+    k.mu.RLock()
+    var newest *tokenKey
+    for _, key := range k.keys {
+        if key.signKey != nil && key.alg == k.alg {
+            newest = key
+        }
+    }
+    k.mu.RUnlock()
+    if newest == nil || k.now().Sub(newest.createdAt) >= interval {
+        if err := k.Rotate(); err != nil {
+            return err
+        }
+    }
+    return k.retireKeys(retention)
+}
+
+// JSON Web Key（RFC 7517）
+type JWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n,omitempty"`   // RSA
+    E   string `json:"e,omitempty"`   // RSA
+    Crv string `json:"crv,omitempty"` // OKP
+    X   string `json:"x,omitempty"`   // OKP
+}
+
+type JWKS struct {
+    Keys []JWK `json:"keys"`
+}
+
+// 検証に使う公開鍵の一覧（HS256のシークレットは公開しない）
+func (k *KeySet) JWKS() JWKS {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    jwks := JWKS{Keys: []JWK{}}
+    for _, key := range k.keys {
+        switch publicKey := key.verifyKey.(type) {
+        case *rsa.PublicKey:
+            jwks.Keys = append(jwks.Keys, JWK{
+                Kty: "RSA", Kid: key.kid, Use: "sig", Alg: key.alg,
+                N: jwt.EncodeSegment(publicKey.N.Bytes()),
+                E: jwt.EncodeSegment(big.NewInt(int64(publicKey.E)).Bytes()),
+            })
+        case ed25519.PublicKey:
+            jwks.Keys = append(jwks.Keys, JWK{
+                Kty: "OKP", Kid: key.kid, Use: "sig", Alg: key.alg,
+                Crv: "Ed25519", X: jwt.EncodeSegment(publicKey),
+            })
+        }
+    }
+    return jwks
+}
+
+// 他のサービスがCCGalleryのトークンを検証するための公開鍵を返す
+func JWKSHandler(w http.ResponseWriter, r *http.Request, keys *KeySet) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+    json.NewEncoder(w).Encode(keys.JWKS())
+}
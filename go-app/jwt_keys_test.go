@@ -0,0 +1,147 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/dgrijalva/jwt-go"
+)
+
+func tokenHeader(t *testing.T, tokenString string) map[string]interface{} {
+    token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &Claims{})
+    if err != nil {
+        t.Fatalf("Failed to parse token: %v", err)
+    }
+    return token.Header
+}
+
+func TestDirectoryKeySetSignsWithKid(t *testing.T) {
+    for _, alg := range []string{SigningAlgRS256, SigningAlgEdDSA} {
+        t.Run(alg, func(t *testing.T) {
+            keys, err := NewDirectoryKeySet(t.TempDir(), alg)
+            if err != nil {
+                t.Fatalf("Failed to create key set: %v", err)
+            }
+
+            token, err := GenerateJWT(123, "test@example.com", keys)
+            if err != nil {
+                t.Fatalf("Failed to generate token: %v", err)
+            }
+            header := tokenHeader(t, token)
+            if header["alg"] != alg || header["kid"] == "" || header["kid"] == nil {
+                t.Errorf("Expected alg %v with a kid, got %v", alg, header)
+            }
+
+            claims, err := ValidateToken("Bearer "+token, keys)
+            if err != nil || claims.ID != 123 {
+                t.Errorf("Valid token was not accepted: %v", err)
+            }
+
+            // 別の鍵セットで署名されたトークンは受け付けない
+            other, _ := NewDirectoryKeySet(t.TempDir(), alg)
+            otherToken, _ := GenerateJWT(123, "test@example.com", other)
+            if _, err := ValidateToken("Bearer "+otherToken, keys); err == nil {
+                t.Errorf("Token signed by an unknown key was accepted")
+            }
+
+            jwks := keys.JWKS()
+            if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != header["kid"] || jwks.Keys[0].Alg != alg {
+                t.Errorf("Unexpected JWKS: %+v", jwks)
+            }
+        })
+    }
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+    keys, _ := NewDirectoryKeySet(t.TempDir(), SigningAlgRS256)
+    kid := keys.JWKS().Keys[0].Kid
+
+    // 公開鍵をHMACのシークレットとして署名したトークン
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{ID: 1, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}})
+    token.Header["kid"] = kid
+    tokenString, _ := token.SignedString([]byte("anything"))
+
+    if _, err := ValidateToken("Bearer "+tokenString, keys); err == nil {
+        t.Errorf("HS256 token was accepted by an RS256 key")
+    }
+}
+
+func TestKeySetRotation(t *testing.T) {
+    dir := t.TempDir()
+    keys, _ := NewDirectoryKeySet(dir, SigningAlgEdDSA)
+    oldKid := keys.JWKS().Keys[0].Kid
+
+    // 既存の鍵を2時間前に作成されたことにする
+    now := time.Now()
+    keys.now = func() time.Time { return now }
+    past := now.Add(-2 * time.Hour)
+    os.Chtimes(filepath.Join(dir, oldKid+".pem"), past, past)
+    keys.Reload()
+
+    if err := keys.rotateIfDue(time.Hour, time.Hour); err != nil {
+        t.Fatalf("Rotation failed: %v", err)
+    }
+    if len(keys.JWKS().Keys) != 2 {
+        t.Fatalf("Expected a new key to be published, got %+v", keys.JWKS())
+    }
+
+    // 新しい鍵は公開直後には署名に使わない
+    oldToken, _ := GenerateJWT(1, "test@example.com", keys)
+    if kid := tokenHeader(t, oldToken)["kid"]; kid != oldKid {
+        t.Errorf("Expected the previous key to sign until activation, got %v", kid)
+    }
+
+    now = now.Add(keyActivationDelay + time.Minute)
+    newToken, _ := GenerateJWT(1, "test@example.com", keys)
+    if kid := tokenHeader(t, newToken)["kid"]; kid == oldKid {
+        t.Errorf("Expected the new key to sign after activation")
+    }
+
+    // 保持期間中は古い鍵で署名されたトークンも検証できる
+    if err := keys.rotateIfDue(time.Hour, time.Hour); err != nil {
+        t.Fatalf("Rotation failed: %v", err)
+    }
+    if _, err := ValidateToken("Bearer "+oldToken, keys); err != nil {
+        t.Errorf("Token signed by the previous key was rejected: %v", err)
+    }
+
+    // 保持期間を過ぎると古い鍵は削除される
+    now = now.Add(time.Hour)
+    keys.retireKeys(time.Hour)
+    if _, err := os.Stat(filepath.Join(dir, oldKid+".pem")); !os.IsNotExist(err) {
+        t.Errorf("Expected the previous key to be retired")
+    }
+    if _, err := ValidateToken("Bearer "+newToken, keys); err != nil {
+        t.Errorf("Token signed by the current key was rejected: %v", err)
+    }
+}
+
+func TestJWKSHandler(t *testing.T) {
+    keys, _ := NewDirectoryKeySet(t.TempDir(), SigningAlgRS256)
+
+    w := httptest.NewRecorder()
+    JWKSHandler(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil), keys)
+
+    var jwks JWKS
+    if err := json.NewDecoder(w.Body).Decode(&jwks); err != nil {
+        t.Fatalf("Failed to decode JWKS: %v", err)
+    }
+    if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].N == "" || jwks.Keys[0].E != "AQAB" {
+        t.Errorf("Unexpected JWKS: %+v", jwks)
+    }
+    if w.Header().Get("Cache-Control") == "" {
+        t.Errorf("Expected Cache-Control header")
+    }
+
+    // HS256のシークレットは公開しない
+    w = httptest.NewRecorder()
+    JWKSHandler(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil), NewHMACKeySet("testkey"))
+    json.NewDecoder(w.Body).Decode(&jwks)
+    if len(jwks.Keys) != 0 {
+        t.Errorf("Expected no keys for HS256, got %+v", jwks)
+    }
+}
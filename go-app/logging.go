@@ -0,0 +1,83 @@
+package main
+
+import (
+    "context"
+    "io"
+    "log/slog"
+    "net/http"
+
+    "github.com/google/uuid"
+)
+
+// リクエストIDを受け渡すヘッダー
+const requestIDHeader = "X-Request-ID"
+
+// クライアントから受け取るリクエストIDの最大長（これより長い場合は新しく発行する）
+const maxRequestIDLength = 128
+
+// リクエストごとのログの情報（RequestIDMiddlewareが作成し、認証ミドルウェアがユーザーIDを設定する）
+type requestInfo struct {
+    ID     string
+    UserID int // 認証されていない場合は0
+}
+
+type requestInfoContextKey struct{}
+
+// JSON形式でログを出力するロガーを作成する
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+    return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// リクエストのログ情報（RequestIDMiddlewareを通していない場合はnil）
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+    info, _ := ctx.Value(requestInfoContextKey{}).(*requestInfo)
+    return info
+}
+
+// リクエストIDとユーザーIDを付けたロガーを返す
+func requestLogger(r *http.Request) *slog.Logger {
+    info := requestInfoFromContext(r.Context())
+    if info == nil {
+        return slog.Default()
+    }
+    logger := slog.Default().With("request_id", info.ID)
+    if info.UserID != 0 {
+        logger = logger.With("user_id", info.UserID)
+    }
+    return logger
+}
+
+// サーバー側のエラー：実際のエラーはmessageとともにログに記録し、クライアントにはinternal_errorのみを返す
+func serverError(w http.ResponseWriter, r *http.Request, message string, err error) {
+    requestLogger(r).Error(message, "error", err, "method", r.Method, "path", r.URL.Path)
+    writeError(w, r, http.StatusInternalServerError, ErrCodeInternal)
+}
+
+// クライアントから受け取ったリクエストIDをそのまま使えるかどうか（ログを壊さない文字のみ）
+func validRequestID(id string) bool {
+    if id == "" || len(id) > maxRequestIDLength {
+        return false
+    }
+    for _, c := range id {
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+        case c == '-', c == '_', c == '.', c == ':':
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+// X-Request-IDを受け取り（ない場合や不正な場合は発行し）、レスポンスヘッダーとコンテキストに設定する
+func RequestIDMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(requestIDHeader)
+        if !validRequestID(id) {
+            id = uuid.NewString()
+        }
+        w.Header().Set(requestIDHeader, id)
+        ctx := context.WithValue(r.Context(), requestInfoContextKey{}, &requestInfo{ID: id})
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// テスト中のログをバッファに出力する
+func captureLogs(t *testing.T) *bytes.Buffer {
+    var buf bytes.Buffer
+    previous := slog.Default()
+    slog.SetDefault(NewLogger(&buf, slog.LevelDebug))
+    t.Cleanup(func() { slog.SetDefault(previous) })
+    return &buf
+}
+
+// JSON形式のログを1行ずつ読み込む
+func parseLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+    var entries []map[string]interface{}
+    for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+        if line == "" {
+            continue
+        }
+        var entry map[string]interface{}
+        if err := json.Unmarshal([]byte(line), &entry); err != nil {
+            t.Fatalf("Log line is not JSON: %q", line)
+        }
+        entries = append(entries, entry)
+    }
+    return entries
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+    var seen string
+    h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        seen = requestInfoFromContext(r.Context()).ID
+    }))
+
+    // クライアントから受け取ったIDはそのまま使う
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set(requestIDHeader, "abc-123")
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    if seen != "abc-123" || w.Header().Get(requestIDHeader) != "abc-123" {
+        t.Errorf("Expected the request ID to be propagated, got %q / %q", seen, w.Header().Get(requestIDHeader))
+    }
+
+    // 不正なIDは新しいIDに置き換える
+    req = httptest.NewRequest("GET", "/", nil)
+    req.Header.Set(requestIDHeader, "bad id\nwith newline")
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    if seen == "" || strings.Contains(seen, " ") || w.Header().Get(requestIDHeader) != seen {
+        t.Errorf("Expected a generated request ID, got %q", seen)
+    }
+}
+
+func TestAccessLogIncludesRequestIDAndUser(t *testing.T) {
+    buf := captureLogs(t)
+    db, keys := setupMock(t)
+    db.EXPECT().ListPortfoliosByUser(2).Return(nil, nil)
+
+    token, _ := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com"}, "", keys)
+    req := httptest.NewRequest("GET", "/api/me/portfolios", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set(requestIDHeader, "req-1")
+    w := serveTestRouter(newTestApp(db, keys), req)
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+
+    entries := parseLogLines(t, buf)
+    last := entries[len(entries)-1]
+    if last["msg"] != "request" || last["request_id"] != "req-1" || last["user_id"] != float64(2) || last["status"] != float64(200) {
+        t.Errorf("Unexpected access log entry: %v", last)
+    }
+    if _, ok := last["latency_ms"]; !ok {
+        t.Errorf("Expected latency in the access log: %v", last)
+    }
+}
+
+func TestServerErrorLogsUnderlyingError(t *testing.T) {
+    buf := captureLogs(t)
+    db, keys := setupMock(t)
+    db.EXPECT().ListPortfoliosByUser(2).Return(nil, errors.New("connection reset by peer"))
+
+    token, _ := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com"}, "", keys)
+    req := httptest.NewRequest("GET", "/api/me/portfolios", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set(requestIDHeader, "req-2")
+    w := serveTestRouter(newTestApp(db, keys), req)
+
+    // クライアントには内部のエラーを返さない
+    if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "connection reset") {
+        t.Errorf("Unexpected response: %v %q", w.Code, w.Body.String())
+    }
+    found := false
+    for _, entry := range parseLogLines(t, buf) {
+        if entry["level"] == "ERROR" && entry["error"] == "connection reset by peer" && entry["request_id"] == "req-2" {
+            found = true
+        }
+    }
+    if !found {
+        t.Errorf("Expected the underlying error to be logged with the request ID:\n%s", buf.String())
+    }
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+// ログイン失敗の追跡ポリシー
+type LoginThrottlePolicy struct {
+    FreeAttempts     int           // 待ち時間なしで許可する失敗回数
+    LockoutThreshold int           // この回数失敗すると一時的にロックする
+    BaseDelay        time.Duration // バックオフの初期待ち時間（失敗するごとに2倍）
+    LockoutDuration  time.Duration // ロックの期間（バックオフの上限も兼ねる）
+}
+
+var (
+    // アカウント（メールアドレス）単位の制限
+    accountThrottlePolicy = LoginThrottlePolicy{FreeAttempts: 3, LockoutThreshold: 10, BaseDelay: 1 * time.Second, LockoutDuration: 15 * time.Minute}
+    // IPアドレス単位の制限（複数アカウントへの総当たり対策のため緩めに設定）
+    ipThrottlePolicy = LoginThrottlePolicy{FreeAttempts: 10, LockoutThreshold: 50, BaseDelay: 1 * time.Second, LockoutDuration: 15 * time.Minute}
+    // 二要素認証コード（ユーザーID単位）の制限
+    // 6桁のコードは総当たりしやすいため、パスワードよりも少ない回数でロックする
+    twoFactorThrottlePolicy = LoginThrottlePolicy{FreeAttempts: 2, LockoutThreshold: 5, BaseDelay: 1 * time.Second, LockoutDuration: 15 * time.Minute}
+)
+
+// 最後の失敗からこの時間が経過したら失敗回数をリセットする
+const loginFailureWindow = 1 * time.Hour
+
+// 追跡中のエントリ数がこれを超えたら期限切れのエントリを掃除する
+const loginThrottleSweepSize = 10000
+
+// ロックの対象
+const (
+    LockoutScopeAccount   = "account"
+    LockoutScopeIP        = "ip"
+    LockoutScopeTwoFactor = "two_factor"
+)
+
+// login_lockoutsテーブルの1レコード（ロックの監査記録）
+type LoginLockout struct {
+    ID          int
+    Scope       string // "account"、"ip" または "two_factor"
+    Identifier  string // メールアドレス、IPアドレスまたはユーザーID
+    Failures    int
+    IPAddress   string // ロックの原因となったリクエストの送信元
+    LockedUntil time.Time
+    CreatedAt   time.Time
+}
+
+type loginFailures struct {
+    count       int
+    lastFailure time.Time
+    retryAt     time.Time // この時刻まではログインを試行できない
+    lockedAt    time.Time // 最後にロックされた時刻
+}
+
+// ログイン失敗の回数をメモリ上で追跡し、指数バックオフと一時ロックを行う
+type LoginThrottle struct {
+    mu       sync.Mutex
+    accounts  map[string]*loginFailures
+    ips       map[string]*loginFailures
+    twoFactor map[string]*loginFailures // 二要素認証コードの失敗（キーはユーザーID）
+    now       func() time.Time
+}
+
+func NewLoginThrottle() *LoginThrottle {
+    return &LoginThrottle{
+        accounts:  make(map[string]*loginFailures),
+        ips:       make(map[string]*loginFailures),
+        twoFactor: make(map[string]*loginFailures),
+        now:       time.Now,
+    }
+}
+
+// メールアドレスの表記ゆれで制限を回避されないように正規化する
+func normalizeLoginIdentifier(email string) string {
+    return strings.ToLower(strings.TrimSpace(email))
+}
+
+// リクエストの送信元IPアドレス
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+// ログインを試行できるまでの待ち時間を返す（0の場合はすぐに試行できる）
+func (t *LoginThrottle) RetryAfter(email string, ip string) time.Duration {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := t.now()
+    return max(retryAfter(t.accounts, normalizeLoginIdentifier(email), now), retryAfter(t.ips, ip, now))
+}
+
+func retryAfter(entries map[string]*loginFailures, key string, now time.Time) time.Duration {
+    if f := entries[key]; f != nil && f.retryAt.After(now) {
+        return f.retryAt.Sub(now)
+    }
+    return 0
+}
+
+// ログイン失敗を記録する
+// 新たにロックが発生した場合は監査記録用のLoginLockoutを返す
+func (t *LoginThrottle) RecordFailure(email string, ip string) []LoginLockout {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := t.now()
+    if len(t.accounts)+len(t.ips)+len(t.twoFactor) > loginThrottleSweepSize {
+        t.sweep(now)
+    }
+
+    var lockouts []LoginLockout
+    account := normalizeLoginIdentifier(email)
+    if lockout, locked := countLoginFailure(t.accounts, account, accountThrottlePolicy, now); locked {
+        lockout.Scope = LockoutScopeAccount
+        lockout.IPAddress = ip
+        lockouts = append(lockouts, lockout)
+    }
+    if lockout, locked := countLoginFailure(t.ips, ip, ipThrottlePolicy, now); locked {
+        lockout.Scope = LockoutScopeIP
+        lockout.IPAddress = ip
+        lockouts = append(lockouts, lockout)
+    }
+    return lockouts
+}
+
+// ログイン成功時にアカウントの失敗回数をリセットする
+// IPアドレスの失敗回数は、攻撃者が自分のアカウントでリセットできないように残す
+func (t *LoginThrottle) RecordSuccess(email string) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    delete(t.accounts, normalizeLoginIdentifier(email))
+}
+
+// 二要素認証コードを試行できるまでの待ち時間を返す（0の場合はすぐに試行できる）
+func (t *LoginThrottle) TwoFactorRetryAfter(userID int, ip string) time.Duration {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := t.now()
+    return max(retryAfter(t.twoFactor, strconv.Itoa(userID), now), retryAfter(t.ips, ip, now))
+}
+
+// 二要素認証コードの失敗を記録する（IPアドレスの失敗回数にも加算する）
+// 新たにロックが発生した場合は監査記録用のLoginLockoutを返す
+func (t *LoginThrottle) RecordTwoFactorFailure(userID int, ip string) []LoginLockout {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := t.now()
+    if len(t.accounts)+len(t.ips)+len(t.twoFactor) > loginThrottleSweepSize {
+        t.sweep(now)
+    }
+
+    var lockouts []LoginLockout
+    if lockout, locked := countLoginFailure(t.twoFactor, strconv.Itoa(userID), twoFactorThrottlePolicy, now); locked {
+        lockout.Scope = LockoutScopeTwoFactor
+        lockout.IPAddress = ip
+        lockouts = append(lockouts, lockout)
+    }
+    if lockout, locked := countLoginFailure(t.ips, ip, ipThrottlePolicy, now); locked {
+        lockout.Scope = LockoutScopeIP
+        lockout.IPAddress = ip
+        lockouts = append(lockouts, lockout)
+    }
+    return lockouts
+}
+
+// 二要素認証に成功した場合に失敗回数をリセットする
+func (t *LoginThrottle) RecordTwoFactorSuccess(userID int) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    delete(t.twoFactor, strconv.Itoa(userID))
+}
+
+// issuedAtに発行されたチャレンジトークンが、その後のロックで無効になっているかどうか
+// ロックが解除された後も、ロック前に発行されたチャレンジトークンでは再試行させない
+func (t *LoginThrottle) TwoFactorChallengeRevoked(userID int, issuedAt time.Time) bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    f := t.twoFactor[strconv.Itoa(userID)]
+    return f != nil && !f.lockedAt.IsZero() && !issuedAt.After(f.lockedAt)
+}
+
+func countLoginFailure(entries map[string]*loginFailures, key string, policy LoginThrottlePolicy, now time.Time) (LoginLockout, bool) {
+    f := entries[key]
+    if f == nil || now.Sub(f.lastFailure) > loginFailureWindow {
+        f = &loginFailures{}
+        entries[key] = f
+    }
+    f.count++
+    f.lastFailure = now
+
+    if f.count >= policy.LockoutThreshold {
+        f.retryAt = now.Add(policy.LockoutDuration)
+        f.lockedAt = now
+        // ロックに達した時点でのみ監査記録を残す（ロック中の失敗では重複させない）
+        if f.count == policy.LockoutThreshold {
+            return LoginLockout{Identifier: key, Failures: f.count, LockedUntil: f.retryAt, CreatedAt: now}, true
+        }
+        return LoginLockout{}, false
+    }
+
+    if f.count > policy.FreeAttempts {
+        f.retryAt = now.Add(backoffDelay(policy, f.count-policy.FreeAttempts))
+    }
+    return LoginLockout{}, false
+}
+
+// n回目の超過失敗に対する待ち時間（BaseDelay * 2^(n-1)、上限はLockoutDuration）
+func backoffDelay(policy LoginThrottlePolicy, n int) time.Duration {
+    delay := policy.BaseDelay
+    for i := 1; i < n; i++ {
+        delay *= 2
+        if delay >= policy.LockoutDuration {
+            return policy.LockoutDuration
+        }
+    }
+    return delay
+}
+
+func (t *LoginThrottle) sweep(now time.Time) {
+    for _, entries := range []map[string]*loginFailures{t.accounts, t.ips, t.twoFactor} {
+        for key, f := range entries {
+            if now.Sub(f.lastFailure) > loginFailureWindow && !f.retryAt.After(now) {
+                delete(entries, key)
+            }
+        }
+    }
+}
+
+var (
+    dummyPasswordHashOnce sync.Once
+    dummyPasswordHash     []byte
+)
+
+// 存在しないユーザーの場合もbcryptの比較を行い、応答時間からメールアドレスの登録有無を推測されないようにする
+func compareDummyPassword(password string) {
+    dummyPasswordHashOnce.Do(func() {
+        dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+    })
+    bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+func (db *SQLDatabase) CreateLoginLockout(lockout LoginLockout) error {
+    _, err := db.db.Exec("INSERT INTO login_lockouts(scope, identifier, failures, ip_address, locked_until, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+        lockout.Scope, lockout.Identifier, lockout.Failures, lockout.IPAddress, lockout.LockedUntil, lockout.CreatedAt)
+    return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+func newTestLoginThrottle(now *time.Time) *LoginThrottle {
+    throttle := NewLoginThrottle()
+    throttle.now = func() time.Time { return *now }
+    return throttle
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+    now := time.Now()
+    throttle := newTestLoginThrottle(&now)
+
+    // 無料の試行回数までは待ち時間なし
+    for i := 0; i < accountThrottlePolicy.FreeAttempts; i++ {
+        throttle.RecordFailure("user@example.com", "192.0.2.1")
+    }
+    if wait := throttle.RetryAfter("user@example.com", "192.0.2.1"); wait != 0 {
+        t.Fatalf("Expected no wait after free attempts, got %v", wait)
+    }
+
+    // 以降は失敗するごとに待ち時間が倍になる
+    throttle.RecordFailure("user@example.com", "192.0.2.1")
+    if wait := throttle.RetryAfter("USER@example.com ", "192.0.2.2"); wait != accountThrottlePolicy.BaseDelay {
+        t.Errorf("Expected %v wait, got %v", accountThrottlePolicy.BaseDelay, wait)
+    }
+    throttle.RecordFailure("user@example.com", "192.0.2.1")
+    if wait := throttle.RetryAfter("user@example.com", "192.0.2.2"); wait != 2*accountThrottlePolicy.BaseDelay {
+        t.Errorf("Expected %v wait, got %v", 2*accountThrottlePolicy.BaseDelay, wait)
+    }
+
+    // しきい値に達するとロックされ、監査記録が1件だけ返される
+    var lockouts []LoginLockout
+    for i := accountThrottlePolicy.FreeAttempts + 2; i < accountThrottlePolicy.LockoutThreshold+2; i++ {
+        lockouts = append(lockouts, throttle.RecordFailure("user@example.com", "192.0.2.1")...)
+    }
+    if len(lockouts) != 1 || lockouts[0].Scope != LockoutScopeAccount || lockouts[0].Identifier != "user@example.com" {
+        t.Fatalf("Expected a single account lockout, got %+v", lockouts)
+    }
+    if wait := throttle.RetryAfter("user@example.com", "192.0.2.2"); wait != accountThrottlePolicy.LockoutDuration {
+        t.Errorf("Expected lockout of %v, got %v", accountThrottlePolicy.LockoutDuration, wait)
+    }
+
+    // ロック期間が過ぎれば再び試行できる
+    now = now.Add(accountThrottlePolicy.LockoutDuration)
+    if wait := throttle.RetryAfter("user@example.com", "192.0.2.2"); wait != 0 {
+        t.Errorf("Expected lockout to expire, got %v", wait)
+    }
+}
+
+func TestLoginThrottleTracksIPAcrossAccounts(t *testing.T) {
+    now := time.Now()
+    throttle := newTestLoginThrottle(&now)
+
+    var lockouts []LoginLockout
+    for i := 0; i < ipThrottlePolicy.LockoutThreshold; i++ {
+        lockouts = append(lockouts, throttle.RecordFailure("user"+strings.Repeat("x", i)+"@example.com", "192.0.2.1")...)
+    }
+    if len(lockouts) != 1 || lockouts[0].Scope != LockoutScopeIP {
+        t.Fatalf("Expected a single IP lockout, got %+v", lockouts)
+    }
+    if wait := throttle.RetryAfter("other@example.com", "192.0.2.1"); wait == 0 {
+        t.Errorf("Expected locked IP to be throttled for other accounts")
+    }
+    if wait := throttle.RetryAfter("other@example.com", "192.0.2.9"); wait != 0 {
+        t.Errorf("Expected other IPs not to be throttled, got %v", wait)
+    }
+}
+
+func TestLoginThrottleResetsAccountOnSuccess(t *testing.T) {
+    now := time.Now()
+    throttle := newTestLoginThrottle(&now)
+
+    for i := 0; i <= accountThrottlePolicy.FreeAttempts; i++ {
+        throttle.RecordFailure("user@example.com", "192.0.2.1")
+    }
+    throttle.RecordSuccess("user@example.com")
+    if wait := throttle.RetryAfter("user@example.com", "192.0.2.2"); wait != 0 {
+        t.Errorf("Expected account failures to be reset, got %v", wait)
+    }
+}
+
+func postLogin(throttle *LoginThrottle, db *MockDatabase, keys *KeySet, creds Credentials) *httptest.ResponseRecorder {
+    body, _ := json.Marshal(creds)
+    req := httptest.NewRequest("POST", "/api/login", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    LoginHandler(w, req, NewAuthenticator(keys, db), db, throttle)
+    return w
+}
+
+func TestLoginHandlerUniformErrorForUnknownUserAndBadPassword(t *testing.T) {
+    db, keys := setupMock(t)
+    throttle := NewLoginThrottle()
+
+    _, validUser := setupValidLoginCredentials()
+    db.EXPECT().GetUserByEmail("unknown@example.com").Return(User{}, sql.ErrNoRows)
+    db.EXPECT().GetUserByEmail(validUser.Email).Return(validUser, nil)
+
+    unknown := postLogin(throttle, db, keys, Credentials{Email: "unknown@example.com", Password: "password"})
+    badPassword := postLogin(throttle, db, keys, Credentials{Email: validUser.Email, Password: "wrongpassword"})
+
+    if unknown.Code != badPassword.Code || unknown.Body.String() != badPassword.Body.String() {
+        t.Errorf("Expected identical responses, got %v %q and %v %q",
+            unknown.Code, unknown.Body.String(), badPassword.Code, badPassword.Body.String())
+    }
+}
+
+func TestLoginHandlerLocksOutAccount(t *testing.T) {
+    db, keys := setupMock(t)
+    throttle := NewLoginThrottle()
+
+    db.EXPECT().GetUserByEmail("unknown@example.com").Return(User{}, sql.ErrNoRows).Times(accountThrottlePolicy.FreeAttempts + 1)
+
+    for i := 0; i <= accountThrottlePolicy.FreeAttempts; i++ {
+        postLogin(throttle, db, keys, Credentials{Email: "unknown@example.com", Password: "password"})
+    }
+
+    // バックオフ中はデータベースを参照せずに429を返す
+    w := postLogin(throttle, db, keys, Credentials{Email: "unknown@example.com", Password: "password"})
+    if w.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected status Too Many Requests, got %v", w.Code)
+    }
+    if w.Header().Get("Retry-After") == "" {
+        t.Errorf("Expected Retry-After header")
+    }
+}
+
+func TestRecordLoginFailureWritesAuditRecord(t *testing.T) {
+    db, _ := setupMock(t)
+    now := time.Now()
+    throttle := newTestLoginThrottle(&now)
+
+    db.EXPECT().CreateLoginLockout(gomock.Any()).DoAndReturn(func(lockout LoginLockout) error {
+        if lockout.Scope != LockoutScopeAccount || lockout.IPAddress != "192.0.2.1" {
+            t.Errorf("Unexpected lockout record: %+v", lockout)
+        }
+        return nil
+    })
+
+    for i := 0; i < accountThrottlePolicy.LockoutThreshold; i++ {
+        recordLoginFailure(httptest.NewRequest("POST", "/api/login", nil), db, throttle, "user@example.com", "192.0.2.1")
+    }
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+    "fmt"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// メール送信の抽象化
+// 本番ではSMTP、開発・テストではファイルやメモリに書き出す実装を使う
+type Mailer interface {
+    Send(to, subject, body string) error
+}
+
+type MailMessage struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+// SMTPサーバー経由でメールを送信する
+type SMTPMailer struct {
+    Host     string
+    Port     string
+    Username string
+    Password string
+    From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+    var auth smtp.Auth
+    if m.Username != "" {
+        auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+    }
+
+    msg := strings.Join([]string{
+        "From: " + m.From,
+        "To: " + to,
+        "Subject: " + subject,
+        "MIME-Version: 1.0",
+        "Content-Type: text/plain; charset=UTF-8",
+        "",
+        body,
+    }, "\r\n")
+
+    return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg))
+}
+
+// 送信したメールをメモリ上に保持する（テスト用）
+type MemoryMailer struct {
+    mu       sync.Mutex
+    Messages []MailMessage
+}
+
+func (m *MemoryMailer) Send(to, subject, body string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.Messages = append(m.Messages, MailMessage{To: to, Subject: subject, Body: body})
+    return nil
+}
+
+// 最後に送信されたメールを返す
+func (m *MemoryMailer) Last() (MailMessage, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if len(m.Messages) == 0 {
+        return MailMessage{}, false
+    }
+    return m.Messages[len(m.Messages)-1], true
+}
+
+// メールをディレクトリにテキストファイルとして書き出す（ローカル開発用）
+type FileMailer struct {
+    Dir string
+}
+
+func (m *FileMailer) Send(to, subject, body string) error {
+    if err := os.MkdirAll(m.Dir, 0755); err != nil {
+        return err
+    }
+    fileName := time.Now().Format("20060102-150405") + "-" + uuid.NewString() + ".txt"
+    content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", to, subject, body)
+    return os.WriteFile(filepath.Join(m.Dir, fileName), []byte(content), 0644)
+}
+
+// メール送信の設定
+// SMTP_HOSTが設定されていない場合はmailディレクトリに書き出す
+type MailConfig struct {
+    SMTPHost string // SMTP_HOST
+    SMTPPort string // SMTP_PORT（既定は587）
+    Username string // SMTP_USER
+    Password string // SMTP_PASS
+    From     string // MAIL_FROM
+}
+
+// メール送信の設定を読み込む
+func loadMailConfig(src configSource) MailConfig {
+    config := MailConfig{
+        SMTPHost: src.get("SMTP_HOST"),
+        SMTPPort: src.get("SMTP_PORT"),
+        Username: src.get("SMTP_USER"),
+        Password: src.get("SMTP_PASS"),
+        From:     src.get("MAIL_FROM"),
+    }
+    if config.SMTPPort == "" {
+        config.SMTPPort = "587"
+    }
+    return config
+}
+
+// 設定からMailerを生成する
+func NewMailer(config MailConfig) Mailer {
+    if config.SMTPHost == "" {
+        return &FileMailer{Dir: "mail"}
+    }
+
+    return &SMTPMailer{
+        Host:     config.SMTPHost,
+        Port:     config.SMTPPort,
+        Username: config.Username,
+        Password: config.Password,
+        From:     config.From,
+    }
+}
@@ -1,116 +1,118 @@
 package main
 
 import (
+    "context"
     "log"
-    "net/http"
+    "log/slog"
+    "net"
     "os"
-
-    "github.com/joho/godotenv"
-    _ "github.com/go-sql-driver/mysql"
+    "os/signal"
+    "syscall"
 )
 
 
 func main() {
-    // .envファイルから環境変数を読み込む
-    err := godotenv.Load("../.env")
+    // 設定を読み込んで検証する（コマンドライン引数 > 環境変数・../.env > -configの設定ファイル）
+    // 不正な値がある場合は、すべてのエラーを表示して起動しない
+    config, args, err := LoadConfig(os.Args[1:])
     if err != nil {
-        log.Fatal("Error loading .env file")
+        log.Fatal(err)
     }
 
-    // 環境変数からJWTの秘密鍵を取得
-    jwtKey := os.Getenv("JWT_SECRET_KEY")
-    if jwtKey == "" {
-        log.Fatal("JWT_SECRET_KEY must be set in the environment variables")
+    // ログはJSON形式で標準エラー出力に書き出す（logパッケージの出力もslog経由になる）
+    slog.SetDefault(NewLogger(os.Stderr, config.LogLevel))
+
+    // スキーマのマイグレーションのみを行うサブコマンド（例: go-app migrate up / down 1 / status）
+    if len(args) > 0 && args[0] == "migrate" {
+        db, dialect, err := OpenDatabase(config.Database)
+        if err != nil {
+            log.Fatalf("Failed to open database: %v", err)
+        }
+        defer db.Close()
+        if err := runMigrateCommand(db, dialect, args[1:]); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+        return
     }
 
-    // Database インターフェースの実装を初期化
-    db, err := OpenDatabase()
+    // 共有リンクとTOTPシークレットの暗号化鍵、各トークンの有効期限
+    aesKey = config.AESKey
+    totpKey = config.TOTPKey
+    tokenLifetimes = config.Tokens
+
+    // JWTの署名鍵を読み込む（HS256の場合はJWT_SECRET_KEY、RS256/EdDSAの場合は鍵ディレクトリ）
+    keys, err := LoadKeySet(config.JWT)
+    if err != nil {
+        log.Fatalf("Failed to load JWT signing keys: %v", err)
+    }
+
+    // 鍵の定期的なローテーション（JWT_KEY_ROTATION_INTERVALが未設定の場合は鍵ディレクトリの再読み込みのみ）
+    keys.StartRotation(config.JWT.RotationInterval, config.JWT.KeyRetention)
+
+    // コネクションプールを起動時に1つだけ作成し、すべてのハンドラで共有する
+    // DB_DRIVER=sqliteの場合はDB_PATHのファイルを使う（ローカル開発やMySQLを用意できない環境向け）
+    db, dialect, err := OpenDatabase(config.Database)
     if err != nil {
         log.Fatalf("Failed to open database: %v", err)
     }
-    databaseImplementation := &SQLDatabase{db: db}
-    
-
-    // imagesディレクトリを公開する
-    fs := http.FileServer(http.Dir("images"))
-    http.Handle("/images/", http.StripPrefix("/images/", fs))
-
-    // ログイン認証
-    http.HandleFunc("/api/auth", func(w http.ResponseWriter, r *http.Request) {
-        AuthHandler(w, r, jwtKey)
-    })
-
-    // ログイン
-    http.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
-        LoginHandler(w, r, jwtKey, databaseImplementation)
-    })
-
-    // アカウント登録
-    http.HandleFunc("/api/register", func(w http.ResponseWriter, r *http.Request) {
-        RegisterHandler(w, r, jwtKey)
-    })
-
-    // プロファイル登録と更新のハンドラーを追加(GET/POST/PUT)
-    http.HandleFunc("/api/profile", func(w http.ResponseWriter, r *http.Request) {
-        ProfileHandler(w, r, jwtKey)
-    })
-
-    // ユーザープロフィール取得（userUUID）
-    http.HandleFunc("/api/profile/user", func(w http.ResponseWriter, r *http.Request) {
-        GetUserProfileByUUID(w, r)
-    })
-
-    // ユーザープロフィール取得（protfolioUUID）
-    http.HandleFunc("/api/profile/portfolio", func(w http.ResponseWriter, r *http.Request) {
-        GetProfileByPortfolioUUID(w, r)
-    })
-
-
-    // 画像アップロード(Profile)
-    http.HandleFunc("/api/profile/image", func(w http.ResponseWriter, r *http.Request) {
-        UploadProfileImageHandler(w, r, jwtKey)
-    })
-
-    // ポートフォリオ関連(GET/POST/PUT/DELETE)
-    http.HandleFunc("/api/portfolio", func(w http.ResponseWriter, r *http.Request) {
-        PortfolioHandler(w, r, jwtKey)
-    })
-
-    // ポートフォリオ詳細取得（portfolioUUID）
-    http.HandleFunc("/api/portfolio/portfolio", func(w http.ResponseWriter, r *http.Request) {
-        GetPortfolioByPortfolioID(w, r)
-    })
-
-    // ポートフォリオ一覧取得(userID)
-    http.HandleFunc("/api/portfolios", func(w http.ResponseWriter, r *http.Request) {
-        GetUserPortfolios(w, r, jwtKey)
-    })
-
-    // ポートフォリオ一覧取得(userUUID)
-    http.HandleFunc("/api/portfolios/user", func(w http.ResponseWriter, r *http.Request) {
-        GetUserPortfoliosByUUID(w, r)
-    })
-
-    // 画像アップロード(Portfolio)
-    http.HandleFunc("/api/portfolio/image", func(w http.ResponseWriter, r *http.Request) {
-        UploadPortfolioImageHandler(w, r, jwtKey)
-    })
-
-    // 技術スタック追加用(Portfolio)
-    http.HandleFunc("/api/techstacks", func(w http.ResponseWriter, r *http.Request) {
-        GetTechStacksHandler(w, r)
-    })
-    
-    // 限定公開パス検証(Portfolio)
-    http.HandleFunc("/api/validate-uuid", func(w http.ResponseWriter, r *http.Request) {
-        ValidateEncryptedUUID(w, r)
-    })
-
-    // 限定公開パス発行(Portfolio)
-    http.HandleFunc("/api/generate-pass", func(w http.ResponseWriter, r *http.Request) {
-        GenerateEncryptedPass(w, r)
-    })
-
-    log.Println("Server is running on port 8080...")
-    log.Fatal(http.ListenAndServe(":8080", nil))
+    defer db.Close()
+    config.DBPool.Apply(db)
+
+    // AUTO_MIGRATE=trueの場合、起動時に未適用のマイグレーションを適用する
+    if config.AutoMigrate {
+        if err := runMigrateCommand(db, dialect, []string{"up"}); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+    }
+
+    // Database インターフェースの実装を初期化
+    databaseImplementation := NewSQLDatabase(db, dialect, config.DBPool.QueryTimeout)
+
+    // リクエストの認証（JWTとパーソナルアクセストークン）
+    authenticator := NewAuthenticator(keys, databaseImplementation)
+
+    // AUTH_COOKIE_MODE=trueの場合、JWTをHttpOnly Cookieで扱い、CSRFトークンを検証する
+    if config.Cookies != nil {
+        authenticator.EnableCookieSessions(config.Cookies)
+    }
+
+    // Prometheusのメトリクス（/metrics）
+    metrics := NewMetrics(databaseImplementation.Stats, databaseImplementation)
+    authenticator.EnableMetrics(metrics)
+
+    // 猶予期間を過ぎた退会済みアカウントを定期的に削除する
+    StartAccountPurger(databaseImplementation, config.ImageDir)
+
+    app := &App{
+        DB:                   databaseImplementation,
+        DBStats:              databaseImplementation.Stats,
+        DBPing:               db.PingContext,
+        CORS:                 config.CORS,
+        Auth:                 authenticator,
+        Keys:                 keys,
+        LoginThrottle:        NewLoginThrottle(), // ログイン失敗の追跡（総当たり攻撃への対策）
+        Mailer:               NewMailer(config.Mail),
+        OAuth:                config.OAuth,
+        AppBaseURL:           config.AppBaseURL,
+        ImageDir:             config.ImageDir,
+        Metrics:              metrics,
+        RequireVerifiedEmail: config.RequireVerifiedEmail,
+    }
+
+    // SIGTERM / SIGINTを受け取ったら新しい接続の受け付けをやめ、処理中のリクエスト（画像のアップロードなど）の完了を待つ
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+    defer stop()
+
+    listener, err := net.Listen("tcp", config.ListenAddr)
+    if err != nil {
+        log.Fatalf("Failed to listen on %s: %v", config.ListenAddr, err)
+    }
+    server := NewServer(config.Server, config.ListenAddr, NewRouter(app))
+
+    slog.Info("Server is running", "addr", config.ListenAddr)
+    if err := RunServer(ctx, server, listener, config.Server.ShutdownTimeout, app.StartDraining); err != nil {
+        slog.Error("Server stopped with error", "error", err)
+        return
+    }
+    slog.Info("Server stopped")
 }
@@ -1,7 +1,7 @@
 package main
 
 import (
-    "bytes"
+    // "bytes"
     "encoding/json"
     "net/http"
     "net/http/httptest"
@@ -57,18 +57,18 @@ func verifyResponse(t *testing.T, w *httptest.ResponseRecorder, expectedStatusCo
 func TestAuthEndpoint(t *testing.T) {
     // 環境変数のセットアップ（テスト用のJWT鍵など）
     os.Setenv("JWT_SECRET_KEY", "test_jwt_key")
-    jwtKey := os.Getenv("JWT_SECRET_KEY")
+    keys := NewHMACKeySet(os.Getenv("JWT_SECRET_KEY"))
 
     // ハンドラのセットアップ
     http.HandleFunc("/api/auth", func(w http.ResponseWriter, r *http.Request) {
-        AuthHandler(w, r, os.Getenv("JWT_SECRET_KEY"))
+        AuthHandler(w, r, NewAuthenticator(NewHMACKeySet(os.Getenv("JWT_SECRET_KEY")), nil))
     })
 
     // テスト用のリクエストを作成
     req, _ := http.NewRequest("GET", "/api/auth", nil)
 
     // テスト用のJWTトークンをセット
-    validToken, _ := GenerateJWT(123, "test@example.com", os.Getenv("JWT_SECRET_KEY"))
+    validToken, _ := GenerateJWT(123, "test@example.com", NewHMACKeySet(os.Getenv("JWT_SECRET_KEY")))
     req.Header.Set("Authorization", "Bearer "+validToken)
 
     // レスポンスライターのモック
@@ -76,7 +76,7 @@ func TestAuthEndpoint(t *testing.T) {
 
     // ラップされたハンドラ関数の定義
     testHandler := func(w http.ResponseWriter, r *http.Request) {
-        AuthHandler(w, r, jwtKey)
+        AuthHandler(w, r, NewAuthenticator(keys, nil))
     }
 
     // ラップされたハンドラ関数を実行
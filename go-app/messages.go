@@ -0,0 +1,137 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// 対応している言語
+const (
+    langEN = "en"
+    langJA = "ja"
+)
+
+// Accept-Languageがない場合や対応していない言語のみの場合に使う言語
+const defaultLanguage = langEN
+
+// エラーコードごとの表示用メッセージ
+var errorMessages = map[string]map[string]string{
+    ErrCodeInvalidRequest:   {langEN: "The request body is malformed.", langJA: "リクエストの形式が正しくありません。"},
+    ErrCodeValidationFailed: {langEN: "Some fields are invalid.", langJA: "入力内容に誤りがあります。"},
+    ErrCodeRequestTooLarge:  {langEN: "The request body must not exceed %d bytes.", langJA: "リクエストのサイズは%dバイト以下にしてください。"},
+    ErrCodeImageRequired:    {langEN: "An image file is required.", langJA: "画像ファイルを指定してください。"},
+
+    ErrCodeUnauthorized:             {langEN: "Authentication is required.", langJA: "ログインが必要です。"},
+    ErrCodeInvalidCredentials:       {langEN: "Invalid email address or password.", langJA: "メールアドレスまたはパスワードが正しくありません。"},
+    ErrCodeInvalidPassword:          {langEN: "The password is incorrect.", langJA: "パスワードが正しくありません。"},
+    ErrCodeInvalidVerificationToken: {langEN: "The verification link is invalid or has expired.", langJA: "確認リンクが無効か、有効期限が切れています。"},
+    ErrCodeInvalidResetToken:        {langEN: "The password reset link is invalid or has expired.", langJA: "パスワード再設定のリンクが無効か、有効期限が切れています。"},
+    ErrCodeInvalidConfirmationLink:  {langEN: "The confirmation link is invalid or has expired.", langJA: "確認リンクが無効か、有効期限が切れています。"},
+    ErrCodeInvalidChallengeToken:    {langEN: "The login attempt has expired, please log in again.", langJA: "ログインの有効期限が切れました。もう一度ログインしてください。"},
+    ErrCodeInvalidRefreshToken:      {langEN: "The refresh token is invalid.", langJA: "リフレッシュトークンが無効です。"},
+    ErrCodeRefreshTokenExpired:      {langEN: "The refresh token has expired.", langJA: "リフレッシュトークンの有効期限が切れています。"},
+    ErrCodeRefreshTokenReused:       {langEN: "The refresh token has already been used.", langJA: "リフレッシュトークンは使用済みです。"},
+    ErrCodeSessionRevoked:           {langEN: "The session has been revoked.", langJA: "このセッションはログアウトされています。"},
+    ErrCodeSessionUnknown:           {langEN: "The current session is unknown, please log in again.", langJA: "現在のセッションを確認できません。もう一度ログインしてください。"},
+    ErrCodeInvalidTwoFactorCode:     {langEN: "The authentication code is incorrect.", langJA: "認証コードが正しくありません。"},
+    ErrCodeTooManyLoginAttempts:     {langEN: "Too many failed login attempts, please try again later.", langJA: "ログインの失敗が続いたため、しばらくしてから再度お試しください。"},
+
+    ErrCodeForbidden:               {langEN: "You do not have permission to perform this action.", langJA: "この操作を行う権限がありません。"},
+    ErrCodeInsufficientScope:       {langEN: "The token does not have the required scope.", langJA: "トークンに必要なスコープがありません。"},
+    ErrCodeCSRFTokenMismatch:       {langEN: "The CSRF token is missing or invalid.", langJA: "CSRFトークンがないか、正しくありません。"},
+    ErrCodeImpersonationNotAllowed: {langEN: "This action is not allowed while impersonating a user.", langJA: "代理ログイン中はこの操作を行えません。"},
+    ErrCodeAccountSuspended:        {langEN: "This account is suspended.", langJA: "このアカウントは利用停止中です。"},
+    ErrCodeAccountPendingDeletion:  {langEN: "This account is scheduled for deletion, restore it before logging in.", langJA: "このアカウントは退会手続き中です。ログインする前に退会を取り消してください。"},
+    ErrCodeEmailNotVerified:        {langEN: "Verify your email address before publishing a portfolio.", langJA: "ポートフォリオを公開する前にメールアドレスを確認してください。"},
+    ErrCodeCannotSuspendSelf:       {langEN: "You cannot suspend your own account.", langJA: "自分のアカウントは利用停止にできません。"},
+    ErrCodeCannotImpersonateAdmin:  {langEN: "Administrators cannot be impersonated.", langJA: "管理者には代理ログインできません。"},
+    ErrCodeOriginNotAllowed:        {langEN: "The origin is not allowed.", langJA: "許可されていないオリジンです。"},
+    ErrCodeCORSMethodNotAllowed:    {langEN: "The method is not allowed for this route.", langJA: "このパスでは許可されていないメソッドです。"},
+
+    ErrCodeEmailTaken:                 {langEN: "The email address is already in use.", langJA: "このメールアドレスは既に使用されています。"},
+    ErrCodeSameEmail:                  {langEN: "The new email address is the same as the current one.", langJA: "新しいメールアドレスが現在のものと同じです。"},
+    ErrCodeAccountNotPendingDeletion:  {langEN: "This account is not scheduled for deletion.", langJA: "このアカウントは退会手続き中ではありません。"},
+    ErrCodeTwoFactorAlreadyEnabled:    {langEN: "Two-factor authentication is already enabled.", langJA: "二要素認証は既に有効です。"},
+    ErrCodeTwoFactorNotEnabled:        {langEN: "Two-factor authentication is not enabled.", langJA: "二要素認証が有効になっていません。"},
+    ErrCodeTwoFactorSetupNotStarted:   {langEN: "Two-factor authentication setup has not been started.", langJA: "二要素認証の設定が開始されていません。"},
+    ErrCodeVerificationEmailRateLimit: {langEN: "A verification email was sent recently, please try again later.", langJA: "確認メールは送信済みです。しばらくしてから再度お試しください。"},
+
+    ErrCodeNotFound:               {langEN: "The requested resource was not found.", langJA: "指定されたページは存在しません。"},
+    ErrCodeMethodNotAllowed:       {langEN: "The method is not allowed for this resource.", langJA: "このリソースでは許可されていないメソッドです。"},
+    ErrCodeUserNotFound:           {langEN: "The user was not found.", langJA: "ユーザーが見つかりません。"},
+    ErrCodePortfolioNotFound:      {langEN: "The portfolio was not found.", langJA: "ポートフォリオが見つかりません。"},
+    ErrCodeTokenNotFound:          {langEN: "The token was not found.", langJA: "トークンが見つかりません。"},
+    ErrCodeSessionNotFound:        {langEN: "The session was not found.", langJA: "セッションが見つかりません。"},
+    ErrCodeShareLinkNotFound:      {langEN: "The shared link is invalid.", langJA: "共有リンクが無効です。"},
+    ErrCodeOAuthNotConfigured:     {langEN: "Login with an external provider is not available.", langJA: "外部サービスでのログインは利用できません。"},
+    ErrCodeCookieSessionsDisabled: {langEN: "Cookie sessions are not enabled.", langJA: "Cookieセッションは有効になっていません。"},
+
+    ErrCodeEmailDeliveryFailed: {langEN: "Failed to send the email, please try again later.", langJA: "メールを送信できませんでした。しばらくしてから再度お試しください。"},
+    ErrCodeInternal:            {langEN: "An unexpected error occurred, please try again later.", langJA: "予期しないエラーが発生しました。しばらくしてから再度お試しください。"},
+}
+
+// 項目ごとのエラーコードの表示用メッセージ
+var fieldErrorMessages = map[string]map[string]string{
+    FieldErrRequired:        {langEN: "This field is required.", langJA: "入力してください。"},
+    FieldErrTooShort:        {langEN: "Must be at least %d characters.", langJA: "%d文字以上で入力してください。"},
+    FieldErrTooLong:         {langEN: "Must be at most %d characters.", langJA: "%d文字以内で入力してください。"},
+    FieldErrInvalidEmail:    {langEN: "Must be a valid email address.", langJA: "正しいメールアドレスを入力してください。"},
+    FieldErrInvalid:         {langEN: "The value is invalid.", langJA: "値が正しくありません。"},
+    FieldErrInvalidType:     {langEN: "The value has the wrong type.", langJA: "値の型が正しくありません。"},
+    FieldErrInvalidURL:      {langEN: "Must be a valid http or https URL.", langJA: "正しいURL（http・https）を入力してください。"},
+    FieldErrHostNotAllowed:  {langEN: "Must be a URL on %s.", langJA: "%sのURLを入力してください。"},
+    FieldErrInvalidUsername: {langEN: "Use 3 to 30 letters, numbers or underscores.", langJA: "英数字とアンダースコアの3〜30文字で入力してください。"},
+    FieldErrNotAllowed:      {langEN: "Must be one of: %s.", langJA: "次のいずれかを指定してください: %s"},
+    FieldErrUnknownField:    {langEN: "Unknown field.", langJA: "不明な項目です。"},
+    FieldErrOutOfRange:      {langEN: "Must be between %d and %d.", langJA: "%dから%dの範囲で指定してください。"},
+    FieldErrNegative:        {langEN: "Must not be negative.", langJA: "0以上の値を指定してください。"},
+    FieldErrUnknownScope:    {langEN: "Unknown scope: %s.", langJA: "不明なスコープです: %s"},
+}
+
+// エラーコードのメッセージを返す（カタログにないコードの場合はコードをそのまま返す）
+func localizeError(lang string, code string, args ...interface{}) string {
+    return localize(errorMessages, lang, code, args...)
+}
+
+// 項目ごとのエラーコードのメッセージを返す
+func localizeFieldError(lang string, code string, args ...interface{}) string {
+    return localize(fieldErrorMessages, lang, code, args...)
+}
+
+func localize(catalog map[string]map[string]string, lang string, code string, args ...interface{}) string {
+    messages, ok := catalog[code]
+    if !ok {
+        return code
+    }
+    message, ok := messages[lang]
+    if !ok {
+        message = messages[defaultLanguage]
+    }
+    if len(args) > 0 {
+        return fmt.Sprintf(message, args...)
+    }
+    return message
+}
+
+// Accept-Language（例: "ja-JP,ja;q=0.9,en;q=0.8"）から対応している言語のうち最も優先度の高いものを選ぶ
+func negotiateLanguage(header string) string {
+    best, bestQ := defaultLanguage, 0.0
+    for _, part := range strings.Split(header, ",") {
+        tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        q := 1.0
+        if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            parsed, err := strconv.ParseFloat(value, 64)
+            if err != nil {
+                continue
+            }
+            q = parsed
+        }
+        // "ja-JP"のような地域付きのタグは言語の部分で判定する
+        primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+        if (primary == langEN || primary == langJA) && q > bestQ {
+            best, bestQ = primary, q
+        }
+    }
+    return best
+}
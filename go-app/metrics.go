@@ -0,0 +1,218 @@
+package main
+
+import (
+    "database/sql"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// メトリクス名の接頭辞
+const metricsNamespace = "ccgallery"
+
+// ルートに一致しなかったリクエストのroute（パスをそのまま使うとラベルの種類が際限なく増えるため）
+const unmatchedRoute = "unmatched"
+
+// ログイン試行の結果（login_attempts_totalのresult）
+const (
+    LoginResultSuccess           = "success"
+    LoginResultFailure           = "failure"
+    LoginResultLocked            = "locked"
+    LoginResultTwoFactorRequired = "two_factor_required"
+)
+
+// ポートフォリオの公開状態（statusカラムの値）とメトリクスのラベル
+var portfolioStatusLabels = map[string]string{
+    "0": "private",
+    "1": "public",
+    "2": "limited",
+}
+
+// Prometheus形式で公開するメトリクス
+// レジストリはインスタンスごとに作成するため、テストでも独立して収集できる
+type Metrics struct {
+    registry        *prometheus.Registry
+    requests        *prometheus.CounterVec
+    requestDuration *prometheus.HistogramVec
+    inFlight        prometheus.Gauge
+    uploads         *prometheus.CounterVec
+    uploadBytes     *prometheus.CounterVec
+    logins          *prometheus.CounterVec
+}
+
+// メトリクスを作成する
+// dbStatsはコネクションプールの統計情報、dbは収集時に業務指標（ポートフォリオ数など）を集計するために使う
+func NewMetrics(dbStats func() sql.DBStats, db Database) *Metrics {
+    m := &Metrics{
+        registry: prometheus.NewRegistry(),
+        requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: metricsNamespace,
+            Name:      "http_requests_total",
+            Help:      "Number of HTTP requests by route, method and status code.",
+        }, []string{"route", "method", "status"}),
+        requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: metricsNamespace,
+            Name:      "http_request_duration_seconds",
+            Help:      "HTTP request latency by route and method.",
+            Buckets:   prometheus.DefBuckets,
+        }, []string{"route", "method"}),
+        inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+            Namespace: metricsNamespace,
+            Name:      "http_requests_in_flight",
+            Help:      "Number of HTTP requests currently being served.",
+        }),
+        uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: metricsNamespace,
+            Name:      "image_uploads_total",
+            Help:      "Number of image uploads by kind and result.",
+        }, []string{"kind", "result"}),
+        uploadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: metricsNamespace,
+            Name:      "image_upload_bytes_total",
+            Help:      "Bytes of uploaded images written to disk by kind.",
+        }, []string{"kind"}),
+        logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: metricsNamespace,
+            Name:      "login_attempts_total",
+            Help:      "Number of password login attempts by result.",
+        }, []string{"result"}),
+    }
+
+    m.registry.MustRegister(
+        m.requests, m.requestDuration, m.inFlight, m.uploads, m.uploadBytes, m.logins,
+        prometheus.NewGoCollector(),
+        prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+    )
+    if dbStats != nil {
+        m.registry.MustRegister(&dbStatsCollector{stats: dbStats})
+    }
+    if db != nil {
+        m.registry.MustRegister(&portfolioCollector{db: db})
+    }
+    return m
+}
+
+// /metricsのハンドラー
+func (m *Metrics) Handler() http.Handler {
+    return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ログイン試行をmetricsに記録する
+func (a *Authenticator) EnableMetrics(metrics *Metrics) {
+    a.metrics = metrics
+}
+
+// ログイン試行の結果を記録する（mがnilの場合は何もしない）
+func (m *Metrics) ObserveLogin(result string) {
+    if m == nil {
+        return
+    }
+    m.logins.WithLabelValues(result).Inc()
+}
+
+// 画像のアップロードを記録する（kindはprofile / portfolio、書き込みに失敗した場合はバイト数を加算しない）
+func (m *Metrics) ObserveUpload(kind string, bytes int64, err error) {
+    if m == nil {
+        return
+    }
+    if err != nil {
+        m.uploads.WithLabelValues(kind, "error").Inc()
+        return
+    }
+    m.uploads.WithLabelValues(kind, "success").Inc()
+    m.uploadBytes.WithLabelValues(kind).Add(float64(bytes))
+}
+
+// リクエスト数・処理時間・処理中のリクエスト数を記録する
+// routeにはroutesに登録されたパターン（例: /api/portfolios/{uuid}）を使う
+func (m *Metrics) Middleware(routes *http.ServeMux) Middleware {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            route := unmatchedRoute
+            if _, pattern := routes.Handler(r); pattern != "" {
+                // "GET /api/..." のメソッド部分はmethodラベルで表す
+                if _, path, ok := strings.Cut(pattern, " "); ok {
+                    pattern = path
+                }
+                route = pattern
+            }
+
+            m.inFlight.Inc()
+            defer m.inFlight.Dec()
+            start := time.Now()
+            rec := &statusRecorder{ResponseWriter: w}
+            next.ServeHTTP(rec, r)
+            if rec.status == 0 {
+                rec.status = http.StatusOK
+            }
+
+            m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+            m.requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+        })
+    }
+}
+
+// コネクションプールの統計情報を収集時に読み取る
+type dbStatsCollector struct {
+    stats func() sql.DBStats
+}
+
+var (
+    dbMaxOpenDesc      = prometheus.NewDesc(metricsNamespace+"_db_max_open_connections", "Maximum number of open connections to the database.", nil, nil)
+    dbOpenDesc         = prometheus.NewDesc(metricsNamespace+"_db_open_connections", "Number of established connections, both in use and idle.", nil, nil)
+    dbInUseDesc        = prometheus.NewDesc(metricsNamespace+"_db_in_use_connections", "Number of connections currently in use.", nil, nil)
+    dbIdleDesc         = prometheus.NewDesc(metricsNamespace+"_db_idle_connections", "Number of idle connections.", nil, nil)
+    dbWaitCountDesc    = prometheus.NewDesc(metricsNamespace+"_db_wait_count_total", "Total number of connections waited for.", nil, nil)
+    dbWaitDurationDesc = prometheus.NewDesc(metricsNamespace+"_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", nil, nil)
+    dbClosedDesc       = prometheus.NewDesc(metricsNamespace+"_db_closed_connections_total", "Total number of connections closed by reason.", []string{"reason"}, nil)
+)
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+    ch <- dbMaxOpenDesc
+    ch <- dbOpenDesc
+    ch <- dbInUseDesc
+    ch <- dbIdleDesc
+    ch <- dbWaitCountDesc
+    ch <- dbWaitDurationDesc
+    ch <- dbClosedDesc
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+    s := c.stats()
+    ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+    ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(s.OpenConnections))
+    ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(s.InUse))
+    ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(s.Idle))
+    ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(s.WaitCount))
+    ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, s.WaitDuration.Seconds())
+    ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(s.MaxIdleClosed), "max_idle")
+    ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(s.MaxIdleTimeClosed), "max_idle_time")
+    ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(s.MaxLifetimeClosed), "max_lifetime")
+}
+
+// 公開状態ごとのポートフォリオ数を収集時に集計する
+type portfolioCollector struct {
+    db Database
+}
+
+var portfoliosDesc = prometheus.NewDesc(metricsNamespace+"_portfolios", "Number of portfolios by visibility.", []string{"visibility"}, nil)
+
+func (c *portfolioCollector) Describe(ch chan<- *prometheus.Desc) {
+    ch <- portfoliosDesc
+}
+
+func (c *portfolioCollector) Collect(ch chan<- prometheus.Metric) {
+    counts, err := c.db.CountPortfoliosByStatus()
+    if err != nil {
+        ch <- prometheus.NewInvalidMetric(portfoliosDesc, err)
+        return
+    }
+    // 該当するポートフォリオがない状態も0として出力する
+    for status, label := range portfolioStatusLabels {
+        ch <- prometheus.MustNewConstMetric(portfoliosDesc, prometheus.GaugeValue, float64(counts[status]), label)
+    }
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/golang/mock/gomock"
+)
+
+// ルーター経由で/metricsを取得する
+func scrapeMetrics(t *testing.T, app *App) string {
+    w := serveTestRouter(app, httptest.NewRequest("GET", "/metrics", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200 from /metrics, got %v", w.Code)
+    }
+    return w.Body.String()
+}
+
+// Prometheus形式の出力にlineの行が含まれていることを確認する
+func expectMetricLine(t *testing.T, output string, line string) {
+    t.Helper()
+    for _, l := range strings.Split(output, "\n") {
+        if l == line {
+            return
+        }
+    }
+    t.Errorf("Expected metric line %q in:\n%s", line, output)
+}
+
+func TestMetricsRecordsRequestsByRoute(t *testing.T) {
+    db, keys := setupMock(t)
+    db.EXPECT().GetPublishedPortfolio("abc").Return(Portfolio{Title: "Title", PortfolioUUID: "abc"}, nil)
+    db.EXPECT().CountPortfoliosByStatus().Return(map[string]int{"0": 3, "1": 2}, nil)
+    app := newTestApp(db, keys)
+
+    serveTestRouter(app, httptest.NewRequest("GET", "/api/portfolios/abc", nil))
+    serveTestRouter(app, httptest.NewRequest("GET", "/no/such/path", nil))
+
+    output := scrapeMetrics(t, app)
+    // パスパラメーターではなく登録されたパターンで集計する
+    expectMetricLine(t, output, `ccgallery_http_requests_total{method="GET",route="/api/portfolios/{uuid}",status="200"} 1`)
+    expectMetricLine(t, output, `ccgallery_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+    expectMetricLine(t, output, `ccgallery_http_request_duration_seconds_count{method="GET",route="/api/portfolios/{uuid}"} 1`)
+    // /metrics自身のリクエストは処理中として数えられる
+    expectMetricLine(t, output, `ccgallery_http_requests_in_flight 1`)
+    expectMetricLine(t, output, `ccgallery_portfolios{visibility="private"} 3`)
+    expectMetricLine(t, output, `ccgallery_portfolios{visibility="public"} 2`)
+    expectMetricLine(t, output, `ccgallery_portfolios{visibility="limited"} 0`)
+}
+
+func TestMetricsDBPoolStats(t *testing.T) {
+    db, keys := setupMock(t)
+    db.EXPECT().CountPortfoliosByStatus().Return(map[string]int{}, nil)
+    app := newTestApp(db, keys)
+    app.Metrics = NewMetrics(func() sql.DBStats {
+        return sql.DBStats{MaxOpenConnections: 25, OpenConnections: 3, InUse: 1, Idle: 2, WaitCount: 7}
+    }, db)
+
+    output := scrapeMetrics(t, app)
+    expectMetricLine(t, output, `ccgallery_db_max_open_connections 25`)
+    expectMetricLine(t, output, `ccgallery_db_in_use_connections 1`)
+    expectMetricLine(t, output, `ccgallery_db_idle_connections 2`)
+    expectMetricLine(t, output, `ccgallery_db_wait_count_total 7`)
+}
+
+func TestMetricsLoginAttempts(t *testing.T) {
+    db, keys := setupMock(t)
+    db.EXPECT().CountPortfoliosByStatus().Return(map[string]int{}, nil)
+    app := newTestApp(db, keys)
+    app.Auth.EnableMetrics(app.Metrics)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil).Times(2)
+    db.EXPECT().CreateSession(gomock.Any()).Return(nil)
+    db.EXPECT().CreateRefreshToken(gomock.Any()).Return(nil)
+
+    body, _ := json.Marshal(validCreds)
+    serveTestRouter(app, httptest.NewRequest("POST", "/api/login", bytes.NewReader(body)))
+    body, _ = json.Marshal(Credentials{Email: validCreds.Email, Password: "wrong"})
+    serveTestRouter(app, httptest.NewRequest("POST", "/api/login", bytes.NewReader(body)))
+
+    output := scrapeMetrics(t, app)
+    expectMetricLine(t, output, `ccgallery_login_attempts_total{result="success"} 1`)
+    expectMetricLine(t, output, `ccgallery_login_attempts_total{result="failure"} 1`)
+}
+
+func TestMetricsImageUploads(t *testing.T) {
+    db, keys := setupMock(t)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, user_uuid: "uuid-2"}, nil)
+    db.EXPECT().CountPortfoliosByStatus().Return(map[string]int{}, nil)
+    app := newTestApp(db, keys)
+    app.ImageDir = t.TempDir()
+
+    var form bytes.Buffer
+    writer := multipart.NewWriter(&form)
+    part, _ := writer.CreateFormFile("image", "icon.png")
+    io.WriteString(part, "0123456789")
+    writer.Close()
+
+    token, _ := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com"}, "", keys)
+    req := httptest.NewRequest("POST", "/api/profile/image", &form)
+    req.Header.Set("Content-Type", writer.FormDataContentType())
+    req.Header.Set("Authorization", "Bearer "+token)
+    if w := serveTestRouter(app, req); w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+
+    output := scrapeMetrics(t, app)
+    expectMetricLine(t, output, `ccgallery_image_uploads_total{kind="profile",result="success"} 1`)
+    expectMetricLine(t, output, `ccgallery_image_upload_bytes_total{kind="profile"} 10`)
+}
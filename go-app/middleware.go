@@ -1,13 +1,162 @@
 package main
 
 import (
+    "context"
+    "log/slog"
     "net/http"
+    "runtime/debug"
+    "time"
 )
 
-func EnableCORS(w http.ResponseWriter) {
-    // CORSヘッダーの設定
-    w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000") // Reactアプリのオリジンを指定
-    w.Header().Set("Access-Control-Allow-Credentials", "true") // クレデンシャルを許可
-    w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, X-CSRF-TOKEN") // X-CSRF-TOKENを追加
-    w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE")
-}
\ No newline at end of file
+// ハンドラーの前後に共通の処理を追加する
+type Middleware func(http.Handler) http.Handler
+
+// middlewaresを先頭のものが最も外側になるように適用する
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+    for i := len(middlewares) - 1; i >= 0; i-- {
+        h = middlewares[i](h)
+    }
+    return h
+}
+
+// ハンドラー内のpanicを500エラーにし、サーバー全体が停止しないようにする
+func RecoverMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        defer func() {
+            if p := recover(); p != nil {
+                // クライアントの切断による中断はそのまま伝える
+                if p == http.ErrAbortHandler {
+                    panic(p)
+                }
+                requestLogger(r).Error("Panic", "method", r.Method, "path", r.URL.Path, "panic", p, "stack", string(debug.Stack()))
+                writeError(w, r, http.StatusInternalServerError, ErrCodeInternal)
+            }
+        }()
+        next.ServeHTTP(w, r)
+    })
+}
+
+// ステータスコードと送信したバイト数を記録するResponseWriter
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+    bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+    if rec.status == 0 {
+        rec.status = status
+    }
+    rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+    if rec.status == 0 {
+        rec.status = http.StatusOK
+    }
+    n, err := rec.ResponseWriter.Write(b)
+    rec.bytes += n
+    return n, err
+}
+
+// http.ResponseControllerから元のResponseWriterを使えるようにする
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+    return rec.ResponseWriter
+}
+
+// アクセスログ：リクエストID・メソッド・パス・ステータスコード・処理時間・認証されたユーザーIDを記録する
+// RequestIDMiddlewareの内側で使う
+func AccessLogMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w}
+        next.ServeHTTP(rec, r)
+        if rec.status == 0 {
+            rec.status = http.StatusOK
+        }
+
+        attrs := []slog.Attr{
+            slog.String("method", r.Method),
+            slog.String("path", r.URL.Path),
+            slog.Int("status", rec.status),
+            slog.Int("bytes", rec.bytes),
+            slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+            slog.String("remote_addr", r.RemoteAddr),
+        }
+        if info := requestInfoFromContext(r.Context()); info != nil {
+            attrs = append(attrs, slog.String("request_id", info.ID))
+            if info.UserID != 0 {
+                attrs = append(attrs, slog.Int("user_id", info.UserID))
+            }
+        }
+        level := slog.LevelInfo
+        if rec.status >= http.StatusInternalServerError {
+            level = slog.LevelError
+        }
+        slog.LogAttrs(r.Context(), level, "request", attrs...)
+    })
+}
+
+// 旧ルート：後継のパスをDeprecation / Linkヘッダーで通知する
+func DeprecatedMiddleware(successor string) Middleware {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Deprecation", "true")
+            w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+type claimsContextKey struct{}
+
+// 認証ミドルウェアが設定したClaims（認証ミドルウェアを通していない場合はnil）
+func requestClaims(r *http.Request) *Claims {
+    claims, _ := r.Context().Value(claimsContextKey{}).(*Claims)
+    return claims
+}
+
+// authenticateで認証し、成功した場合はClaimsをコンテキストに設定して次のハンドラーを呼び出す
+func authMiddleware(authenticate func(r *http.Request) (*Claims, error)) Middleware {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            claims, err := authenticate(r)
+            if err != nil {
+                writeAuthError(w, r, err)
+                return
+            }
+            // アクセスログに認証されたユーザーを記録する
+            if info := requestInfoFromContext(r.Context()); info != nil {
+                info.UserID = claims.ID
+            }
+            next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims)))
+        })
+    }
+}
+
+// JWTまたはパーソナルアクセストークンで認証する（パーソナルアクセストークンはscopeが必要）
+func (a *Authenticator) AuthMiddleware(scope string) Middleware {
+    return authMiddleware(func(r *http.Request) (*Claims, error) {
+        return a.Authenticate(r, scope)
+    })
+}
+
+// ログインセッション（JWT）でのみ認証する
+func (a *Authenticator) SessionMiddleware() Middleware {
+    return authMiddleware(a.AuthenticateSession)
+}
+
+// ログインセッションで認証し、roleを持っていることを確認する
+func (a *Authenticator) RoleMiddleware(role string) Middleware {
+    return authMiddleware(func(r *http.Request) (*Claims, error) {
+        return a.RequireRole(r, role)
+    })
+}
+
+// パスパラメーターの値を返す（旧ルートの場合はクエリパラメーターlegacyQueryの値）
+func pathParam(r *http.Request, name string, legacyQuery string) string {
+    if value := r.PathValue(name); value != "" {
+        return value
+    }
+    return r.URL.Query().Get(legacyQuery)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "embed"
+    "fmt"
+    "io/fs"
+    "log"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// サーバーに同梱するマイグレーション（migrations/{mysql,sqlite}/{version}_{name}.up.sql / .down.sql）
+//go:embed migrations
+var migrationFiles embed.FS
+
+// 複数のインスタンスが同時にマイグレーションしないためのロック
+const (
+    migrationLockName    = "ccgallery_schema_migrations"
+    migrationLockTimeout = 60 // 秒
+)
+
+// マイグレーション全体の上限
+const migrationTimeout = 10 * time.Minute
+
+// 1つのバージョンのマイグレーション
+type Migration struct {
+    Version int64
+    Name    string
+    Up      string
+    Down    string
+}
+
+// マイグレーションの適用状況
+type MigrationStatus struct {
+    Migration
+    AppliedAt *time.Time // 未適用の場合はnil
+}
+
+// fsys内のdirからマイグレーションを読み込み、バージョン順に並べて返す
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+    entries, err := fs.ReadDir(fsys, dir)
+    if err != nil {
+        return nil, err
+    }
+
+    byVersion := map[int64]*Migration{}
+    for _, entry := range entries {
+        fileName := entry.Name()
+        var direction string
+        switch {
+        case strings.HasSuffix(fileName, ".up.sql"):
+            direction = "up"
+        case strings.HasSuffix(fileName, ".down.sql"):
+            direction = "down"
+        default:
+            continue
+        }
+
+        base := strings.TrimSuffix(fileName, "."+direction+".sql")
+        parts := strings.SplitN(base, "_", 2)
+        version, err := strconv.ParseInt(parts[0], 10, 64)
+        if err != nil || len(parts) != 2 || version <= 0 {
+            return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+        }
+
+        content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+        if err != nil {
+            return nil, err
+        }
+
+        m, ok := byVersion[version]
+        if !ok {
+            m = &Migration{Version: version, Name: parts[1]}
+            byVersion[version] = m
+        } else if m.Name != parts[1] {
+            return nil, fmt.Errorf("migration version %d has conflicting names: %s, %s", version, m.Name, parts[1])
+        }
+        if direction == "up" {
+            m.Up = string(content)
+        } else {
+            m.Down = string(content)
+        }
+    }
+
+    migrations := make([]Migration, 0, len(byVersion))
+    for _, m := range byVersion {
+        if m.Up == "" || m.Down == "" {
+            return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+        }
+        migrations = append(migrations, *m)
+    }
+    sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+    return migrations, nil
+}
+
+// SQLファイルを文ごとに分割する（コメント行は除く。文字列リテラル内のセミコロンには対応しない）
+func splitStatements(script string) []string {
+    var lines []string
+    for _, line := range strings.Split(script, "\n") {
+        if strings.HasPrefix(strings.TrimSpace(line), "--") {
+            continue
+        }
+        lines = append(lines, line)
+    }
+
+    var statements []string
+    for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+        if stmt = strings.TrimSpace(stmt); stmt != "" {
+            statements = append(statements, stmt)
+        }
+    }
+    return statements
+}
+
+// schema_migrationsテーブルでバージョンを管理してマイグレーションを適用する
+type Migrator struct {
+    db         *sql.DB
+    dialect    sqlDialect
+    migrations []Migration
+}
+
+// 同梱のマイグレーションのうち、データベースの種類に合ったものを使うMigratorを作成する
+func NewMigrator(db *sql.DB, dialect sqlDialect) (*Migrator, error) {
+    migrations, err := loadMigrations(migrationFiles, dialect.MigrationDir())
+    if err != nil {
+        return nil, err
+    }
+    return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// ロックを取得した1つのコネクションでfnを実行する
+// ロックはコネクションに紐付くため、ロックの取得から解放まで同じコネクションを使う
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+    conn, err := m.db.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    release, err := m.dialect.LockMigrations(ctx, conn)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if releaseErr := release(err != nil); err == nil {
+            err = releaseErr
+        }
+    }()
+
+    _, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version BIGINT NOT NULL,
+        name VARCHAR(255) NOT NULL,
+        applied_at DATETIME NOT NULL,
+        PRIMARY KEY (version)
+    )`)
+    if err != nil {
+        return err
+    }
+
+    return fn(conn)
+}
+
+// 適用済みのバージョンと適用日時
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+    rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    applied := map[int64]time.Time{}
+    for rows.Next() {
+        var version int64
+        var appliedAt time.Time
+        if err := rows.Scan(&version, &appliedAt); err != nil {
+            return nil, err
+        }
+        applied[version] = appliedAt
+    }
+    return applied, rows.Err()
+}
+
+// 1つのマイグレーションの文を順に実行する
+// MySQLのDDLは暗黙的にコミットされるため、途中で失敗した場合は手動での復旧が必要になる
+// （SQLiteの場合はロック中のトランザクションごと取り消される）
+func execMigration(ctx context.Context, conn *sql.Conn, m Migration, script string) error {
+    for _, stmt := range splitStatements(script) {
+        if _, err := conn.ExecContext(ctx, stmt); err != nil {
+            return fmt.Errorf("migration %d_%s failed: %v", m.Version, m.Name, err)
+        }
+    }
+    return nil
+}
+
+// 未適用のマイグレーションをすべて適用し、適用したものを返す
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+    var done []Migration
+    err := m.withLock(ctx, func(conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for _, migration := range m.migrations {
+            if _, ok := applied[migration.Version]; ok {
+                continue
+            }
+            if err := execMigration(ctx, conn, migration, migration.Up); err != nil {
+                return err
+            }
+            _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+                migration.Version, migration.Name, time.Now())
+            if err != nil {
+                return err
+            }
+            done = append(done, migration)
+        }
+        return nil
+    })
+    return done, err
+}
+
+// 適用済みのマイグレーションを新しい順にsteps件だけ取り消し、取り消したものを返す
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+    var done []Migration
+    err := m.withLock(ctx, func(conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+            migration := m.migrations[i]
+            if _, ok := applied[migration.Version]; !ok {
+                continue
+            }
+            if err := execMigration(ctx, conn, migration, migration.Down); err != nil {
+                return err
+            }
+            if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+                return err
+            }
+            done = append(done, migration)
+        }
+        return nil
+    })
+    return done, err
+}
+
+// すべてのマイグレーションの適用状況を返す
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+    var statuses []MigrationStatus
+    err := m.withLock(ctx, func(conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for _, migration := range m.migrations {
+            status := MigrationStatus{Migration: migration}
+            if appliedAt, ok := applied[migration.Version]; ok {
+                status.AppliedAt = &appliedAt
+            }
+            statuses = append(statuses, status)
+        }
+        return nil
+    })
+    return statuses, err
+}
+
+// migrateサブコマンド：migrate [up | down [N] | status]
+func runMigrateCommand(db *sql.DB, dialect sqlDialect, args []string) error {
+    migrator, err := NewMigrator(db, dialect)
+    if err != nil {
+        return err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+    defer cancel()
+
+    command := "up"
+    if len(args) > 0 {
+        command = args[0]
+    }
+
+    switch command {
+    case "up":
+        done, err := migrator.Up(ctx)
+        for _, migration := range done {
+            log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+        }
+        if err == nil && len(done) == 0 {
+            log.Printf("Database schema is up to date")
+        }
+        return err
+
+    case "down":
+        steps := 1
+        if len(args) > 1 {
+            steps, err = strconv.Atoi(args[1])
+            if err != nil || steps <= 0 {
+                return fmt.Errorf("invalid number of steps: %s", args[1])
+            }
+        }
+        done, err := migrator.Down(ctx, steps)
+        for _, migration := range done {
+            log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+        }
+        return err
+
+    case "status":
+        statuses, err := migrator.Status(ctx)
+        if err != nil {
+            return err
+        }
+        for _, status := range statuses {
+            state := "pending"
+            if status.AppliedAt != nil {
+                state = "applied at " + status.AppliedAt.Format(time.RFC3339)
+            }
+            fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+        }
+        return nil
+
+    default:
+        return fmt.Errorf("unknown migrate command: %s (expected up, down or status)", command)
+    }
+}
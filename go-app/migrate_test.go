@@ -0,0 +1,106 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+    mysqlMigrations, err := loadMigrations(migrationFiles, mysqlDialect{}.MigrationDir())
+    if err != nil {
+        t.Fatalf("Failed to load embedded MySQL migrations: %v", err)
+    }
+    sqliteMigrations, err := loadMigrations(migrationFiles, sqliteDialect{}.MigrationDir())
+    if err != nil {
+        t.Fatalf("Failed to load embedded SQLite migrations: %v", err)
+    }
+
+    // バージョンは1から連番になっている
+    for i, m := range mysqlMigrations {
+        if m.Version != int64(i+1) {
+            t.Errorf("Expected migration version %d, got %d_%s", i+1, m.Version, m.Name)
+        }
+    }
+
+    // どちらのデータベースにも同じバージョンのマイグレーションがある
+    if len(sqliteMigrations) != len(mysqlMigrations) {
+        t.Fatalf("Expected %d SQLite migrations, got %d", len(mysqlMigrations), len(sqliteMigrations))
+    }
+    for i, m := range mysqlMigrations {
+        if sqliteMigrations[i].Version != m.Version || sqliteMigrations[i].Name != m.Name {
+            t.Errorf("SQLite migration %d_%s does not match MySQL migration %d_%s",
+                sqliteMigrations[i].Version, sqliteMigrations[i].Name, m.Version, m.Name)
+        }
+    }
+
+    // 0001より前から存在するusersテーブルにも、メールアドレスの一意制約を追加する
+    var addsUniqueEmail bool
+    for _, m := range mysqlMigrations {
+        for _, stmt := range splitStatements(m.Up) {
+            addsUniqueEmail = addsUniqueEmail || strings.Contains(stmt, "ALTER TABLE users ADD UNIQUE KEY uq_users_email (email)")
+        }
+    }
+    if !addsUniqueEmail {
+        t.Errorf("Expected a MySQL migration adding uq_users_email to existing users tables")
+    }
+
+    // アプリケーションが使うすべてのテーブルが作成される
+    tables := []string{"users", "Profile", "Portfolio", "TechStacks", "refresh_tokens", "password_reset_tokens", "recovery_codes",
+        "oauth_states", "user_identities", "personal_access_tokens", "login_lockouts", "sessions", "admin_audit_log"}
+    for _, migrations := range [][]Migration{mysqlMigrations, sqliteMigrations} {
+        var all strings.Builder
+        for _, m := range migrations {
+            all.WriteString(m.Up)
+        }
+        for _, table := range tables {
+            if !strings.Contains(all.String(), "CREATE TABLE "+table+" (") && !strings.Contains(all.String(), "CREATE TABLE IF NOT EXISTS "+table+" (") {
+                t.Errorf("No migration creates table %s", table)
+            }
+        }
+    }
+}
+
+func TestLoadMigrations(t *testing.T) {
+    fsys := fstest.MapFS{
+        "m/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+        "m/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+        "m/0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INT);")},
+        "m/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+        "m/README.md":            {Data: []byte("ignored")},
+    }
+    migrations, err := loadMigrations(fsys, "m")
+    if err != nil {
+        t.Fatalf("Failed to load migrations: %v", err)
+    }
+    if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Version != 2 || migrations[1].Down != "DROP TABLE b;" {
+        t.Errorf("Unexpected migrations: %+v", migrations)
+    }
+
+    // downファイルがない場合はエラー
+    delete(fsys, "m/0002_second.down.sql")
+    if _, err := loadMigrations(fsys, "m"); err == nil {
+        t.Errorf("Expected an error for a migration without a down file")
+    }
+
+    // バージョンのないファイル名はエラー
+    fsys["m/first.down.sql"] = &fstest.MapFile{Data: []byte("")}
+    if _, err := loadMigrations(fsys, "m"); err == nil {
+        t.Errorf("Expected an error for an invalid file name")
+    }
+}
+
+func TestSplitStatements(t *testing.T) {
+    script := `-- コメント
+CREATE TABLE a (
+    id INT
+);
+
+-- もう一つ
+DROP TABLE b;
+`
+    statements := splitStatements(script)
+    if len(statements) != 2 || !strings.HasPrefix(statements[0], "CREATE TABLE a") || statements[1] != "DROP TABLE b" {
+        t.Errorf("Unexpected statements: %q", statements)
+    }
+}
@@ -0,0 +1,54 @@
+-- 初期スキーマ：ユーザー・プロフィール・ポートフォリオ・技術スタック
+-- 既存の環境でも適用できるよう、テーブルが存在する場合は作成しない
+CREATE TABLE IF NOT EXISTS users (
+    id INT NOT NULL AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    user_uuid CHAR(36) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_users_email (email),
+    UNIQUE KEY uq_users_user_uuid (user_uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS Profile (
+    user_id INT NOT NULL,
+    profile_image VARCHAR(255) NOT NULL DEFAULT '',
+    full_name VARCHAR(255) NOT NULL DEFAULT '',
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    contact_email VARCHAR(255) NOT NULL DEFAULT '',
+    bio TEXT NOT NULL,
+    twitter_url VARCHAR(255) NOT NULL DEFAULT '',
+    github_url VARCHAR(255) NOT NULL DEFAULT '',
+    instagram_url VARCHAR(255) NOT NULL DEFAULT '',
+    youtube_url VARCHAR(255) NOT NULL DEFAULT '',
+    tiktok_url VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_profile_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- statusは0:非公開 1:公開 2:限定公開
+CREATE TABLE IF NOT EXISTS Portfolio (
+    id INT NOT NULL AUTO_INCREMENT,
+    portfolio_uuid CHAR(36) NOT NULL,
+    user_id INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    subtitle VARCHAR(255) NOT NULL DEFAULT '',
+    thumbnail VARCHAR(255) NOT NULL DEFAULT '',
+    github_repo_url VARCHAR(255) NOT NULL DEFAULT '',
+    content MEDIUMTEXT NOT NULL,
+    tags VARCHAR(1024) NOT NULL DEFAULT '',
+    status CHAR(1) NOT NULL DEFAULT '0',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_portfolio_uuid (portfolio_uuid),
+    KEY idx_portfolio_user (user_id),
+    CONSTRAINT fk_portfolio_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS TechStacks (
+    id INT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_techstacks_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+DROP INDEX idx_users_deletion_requested_at ON users;
+
+ALTER TABLE users
+    DROP COLUMN email_verified,
+    DROP COLUMN verification_sent_at,
+    DROP COLUMN totp_secret,
+    DROP COLUMN totp_enabled,
+    DROP COLUMN totp_last_step,
+    DROP COLUMN deletion_requested_at,
+    DROP COLUMN role,
+    DROP COLUMN suspended_at;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
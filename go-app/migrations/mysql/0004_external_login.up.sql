@@ -0,0 +1,19 @@
+-- 外部プロバイダー（GitHub / OpenID Connect）でのログイン
+-- link_user_idは既存アカウントへの連携の場合のユーザーID（ログインの場合は0）
+CREATE TABLE oauth_states (
+    state VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    link_user_id INT NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (state)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE user_identities (
+    provider VARCHAR(32) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (provider, subject),
+    KEY idx_user_identities_user (user_id),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
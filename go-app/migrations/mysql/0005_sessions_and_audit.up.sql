@@ -0,0 +1,41 @@
+-- ログインセッション（IDはリフレッシュトークンのファミリーIDを兼ねる）
+CREATE TABLE sessions (
+    id CHAR(36) NOT NULL,
+    user_id INT NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_sessions_user (user_id, revoked_at),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- ログイン試行の制限によるロックアウトの記録（scopeはaccountまたはip）
+CREATE TABLE login_lockouts (
+    id INT NOT NULL AUTO_INCREMENT,
+    scope VARCHAR(16) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    failures INT NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    locked_until DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_login_lockouts_identifier (scope, identifier)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 管理者の操作の監査ログ（ユーザーの削除後も残すため外部キーは設定しない）
+CREATE TABLE admin_audit_log (
+    id INT NOT NULL AUTO_INCREMENT,
+    admin_id INT NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    target_user_id INT NULL,
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_admin_audit_log_admin (admin_id),
+    KEY idx_admin_audit_log_target_user (target_user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+-- uq_users_emailは0001のテーブル定義にも含まれるため、取り消しでは削除しない
+DO 0;
@@ -0,0 +1,14 @@
+-- 0001より前から存在するusersテーブルには、メールアドレスの一意制約がない
+-- 制約がない場合のみ追加する（0001で作成した環境ではすでに存在する）
+-- 重複したメールアドレスがある場合は"Duplicate entry"で失敗するため、
+-- 重複しているアカウントを統合または削除してから再度適用する
+SET @has_unique_email := (SELECT COUNT(*) FROM information_schema.statistics
+    WHERE table_schema = DATABASE() AND table_name = 'users' AND index_name = 'uq_users_email');
+
+SET @add_unique_email := IF(@has_unique_email = 0,
+    'ALTER TABLE users ADD UNIQUE KEY uq_users_email (email)',
+    'DO 0');
+
+PREPARE add_unique_email FROM @add_unique_email;
+EXECUTE add_unique_email;
+DEALLOCATE PREPARE add_unique_email;
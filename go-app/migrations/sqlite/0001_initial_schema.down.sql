@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS TechStacks;
+DROP TABLE IF EXISTS Portfolio;
+DROP TABLE IF EXISTS Profile;
+DROP TABLE IF EXISTS users;
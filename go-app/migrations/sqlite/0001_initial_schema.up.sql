@@ -0,0 +1,53 @@
+-- 初期スキーマ：ユーザー・プロフィール・ポートフォリオ・技術スタック
+-- MySQLの照合順序に合わせて、メールアドレスは大文字と小文字を区別しない
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(255) NOT NULL COLLATE NOCASE,
+    password VARCHAR(255) NOT NULL,
+    user_uuid CHAR(36) NOT NULL,
+    CONSTRAINT uq_users_email UNIQUE (email),
+    CONSTRAINT uq_users_user_uuid UNIQUE (user_uuid)
+);
+
+CREATE TABLE IF NOT EXISTS Profile (
+    user_id INTEGER NOT NULL,
+    profile_image VARCHAR(255) NOT NULL DEFAULT '',
+    full_name VARCHAR(255) NOT NULL DEFAULT '',
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    contact_email VARCHAR(255) NOT NULL DEFAULT '',
+    bio TEXT NOT NULL,
+    twitter_url VARCHAR(255) NOT NULL DEFAULT '',
+    github_url VARCHAR(255) NOT NULL DEFAULT '',
+    instagram_url VARCHAR(255) NOT NULL DEFAULT '',
+    youtube_url VARCHAR(255) NOT NULL DEFAULT '',
+    tiktok_url VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_profile_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- statusは0:非公開 1:公開 2:限定公開
+-- SQLiteにはON UPDATEがないため、updated_atは更新時に明示的に設定する
+CREATE TABLE IF NOT EXISTS Portfolio (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    portfolio_uuid CHAR(36) NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    subtitle VARCHAR(255) NOT NULL DEFAULT '',
+    thumbnail VARCHAR(255) NOT NULL DEFAULT '',
+    github_repo_url VARCHAR(255) NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    tags VARCHAR(1024) NOT NULL DEFAULT '',
+    status CHAR(1) NOT NULL DEFAULT '0',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_portfolio_uuid UNIQUE (portfolio_uuid),
+    CONSTRAINT fk_portfolio_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_portfolio_user ON Portfolio (user_id);
+
+CREATE TABLE IF NOT EXISTS TechStacks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    CONSTRAINT uq_techstacks_name UNIQUE (name)
+);
@@ -0,0 +1,10 @@
+DROP INDEX idx_users_deletion_requested_at;
+
+ALTER TABLE users DROP COLUMN email_verified;
+ALTER TABLE users DROP COLUMN verification_sent_at;
+ALTER TABLE users DROP COLUMN totp_secret;
+ALTER TABLE users DROP COLUMN totp_enabled;
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN deletion_requested_at;
+ALTER TABLE users DROP COLUMN role;
+ALTER TABLE users DROP COLUMN suspended_at;
@@ -0,0 +1,12 @@
+-- メールアドレスの確認・二要素認証・退会・ロールと利用停止
+-- SQLiteのALTER TABLEは1文で1列ずつしか追加できない
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN verification_sent_at DATETIME NULL;
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN deletion_requested_at DATETIME NULL;
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN suspended_at DATETIME NULL;
+
+CREATE INDEX idx_users_deletion_requested_at ON users (deletion_requested_at);
@@ -0,0 +1,20 @@
+-- 外部プロバイダー（GitHub / OpenID Connect）でのログイン
+-- link_user_idは既存アカウントへの連携の場合のユーザーID（ログインの場合は0）
+CREATE TABLE oauth_states (
+    state VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    link_user_id INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (state)
+);
+
+CREATE TABLE user_identities (
+    provider VARCHAR(32) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (provider, subject),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities (user_id);
@@ -0,0 +1,42 @@
+-- ログインセッション（IDはリフレッシュトークンのファミリーIDを兼ねる）
+CREATE TABLE sessions (
+    id CHAR(36) NOT NULL,
+    user_id INTEGER NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_sessions_user ON sessions (user_id, revoked_at);
+
+-- ログイン試行の制限によるロックアウトの記録（scopeはaccountまたはip）
+CREATE TABLE login_lockouts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope VARCHAR(16) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    locked_until DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_login_lockouts_identifier ON login_lockouts (scope, identifier);
+
+-- 管理者の操作の監査ログ（ユーザーの削除後も残すため外部キーは設定しない）
+CREATE TABLE admin_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_id INTEGER NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    target_user_id INTEGER NULL,
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_admin_audit_log_admin ON admin_audit_log (admin_id);
+CREATE INDEX idx_admin_audit_log_target_user ON admin_audit_log (target_user_id);
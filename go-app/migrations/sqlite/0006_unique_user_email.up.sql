@@ -0,0 +1,3 @@
+-- SQLiteのusersテーブルは0001で一意制約付きで作成されるため、変更はない
+-- （MySQLの0006とバージョンを揃えるためのマイグレーション）
+SELECT 1;
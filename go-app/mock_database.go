@@ -6,10 +6,406 @@ package main
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
 
+// MockUserRepository is a mock of UserRepository interface.
+type MockUserRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserRepositoryMockRecorder
+}
+
+// MockUserRepositoryMockRecorder is the mock recorder for MockUserRepository.
+type MockUserRepositoryMockRecorder struct {
+	mock *MockUserRepository
+}
+
+// NewMockUserRepository creates a new mock instance.
+func NewMockUserRepository(ctrl *gomock.Controller) *MockUserRepository {
+	mock := &MockUserRepository{ctrl: ctrl}
+	mock.recorder = &MockUserRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateUser mocks base method.
+func (m *MockUserRepository) CreateUser(user User) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", user)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockUserRepositoryMockRecorder) CreateUser(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserRepository)(nil).CreateUser), user)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockUserRepository) GetUserByEmail(email string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", email)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserRepositoryMockRecorder) GetUserByEmail(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserRepository)(nil).GetUserByEmail), email)
+}
+
+// GetUserByID mocks base method.
+func (m *MockUserRepository) GetUserByID(id int) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", id)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockUserRepositoryMockRecorder) GetUserByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserRepository)(nil).GetUserByID), id)
+}
+
+// GetUserIDByUUID mocks base method.
+func (m *MockUserRepository) GetUserIDByUUID(userUUID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserIDByUUID", userUUID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserIDByUUID indicates an expected call of GetUserIDByUUID.
+func (mr *MockUserRepositoryMockRecorder) GetUserIDByUUID(userUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIDByUUID", reflect.TypeOf((*MockUserRepository)(nil).GetUserIDByUUID), userUUID)
+}
+
+// UpdateUserPassword mocks base method.
+func (m *MockUserRepository) UpdateUserPassword(userID int, hashedPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", userID, hashedPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockUserRepositoryMockRecorder) UpdateUserPassword(userID, hashedPassword interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockUserRepository)(nil).UpdateUserPassword), userID, hashedPassword)
+}
+
+// MockProfileRepository is a mock of ProfileRepository interface.
+type MockProfileRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockProfileRepositoryMockRecorder
+}
+
+// MockProfileRepositoryMockRecorder is the mock recorder for MockProfileRepository.
+type MockProfileRepositoryMockRecorder struct {
+	mock *MockProfileRepository
+}
+
+// NewMockProfileRepository creates a new mock instance.
+func NewMockProfileRepository(ctrl *gomock.Controller) *MockProfileRepository {
+	mock := &MockProfileRepository{ctrl: ctrl}
+	mock.recorder = &MockProfileRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProfileRepository) EXPECT() *MockProfileRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateProfile mocks base method.
+func (m *MockProfileRepository) CreateProfile(userID int, profile Profile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateProfile", userID, profile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateProfile indicates an expected call of CreateProfile.
+func (mr *MockProfileRepositoryMockRecorder) CreateProfile(userID, profile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProfile", reflect.TypeOf((*MockProfileRepository)(nil).CreateProfile), userID, profile)
+}
+
+// GetProfileByUserID mocks base method.
+func (m *MockProfileRepository) GetProfileByUserID(userID int) (Profile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileByUserID", userID)
+	ret0, _ := ret[0].(Profile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileByUserID indicates an expected call of GetProfileByUserID.
+func (mr *MockProfileRepositoryMockRecorder) GetProfileByUserID(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByUserID", reflect.TypeOf((*MockProfileRepository)(nil).GetProfileByUserID), userID)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockProfileRepository) UpdateProfile(userID int, profile Profile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", userID, profile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockProfileRepositoryMockRecorder) UpdateProfile(userID, profile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockProfileRepository)(nil).UpdateProfile), userID, profile)
+}
+
+// MockPortfolioRepository is a mock of PortfolioRepository interface.
+type MockPortfolioRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockPortfolioRepositoryMockRecorder
+}
+
+// MockPortfolioRepositoryMockRecorder is the mock recorder for MockPortfolioRepository.
+type MockPortfolioRepositoryMockRecorder struct {
+	mock *MockPortfolioRepository
+}
+
+// NewMockPortfolioRepository creates a new mock instance.
+func NewMockPortfolioRepository(ctrl *gomock.Controller) *MockPortfolioRepository {
+	mock := &MockPortfolioRepository{ctrl: ctrl}
+	mock.recorder = &MockPortfolioRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPortfolioRepository) EXPECT() *MockPortfolioRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CountPortfoliosByStatus mocks base method.
+func (m *MockPortfolioRepository) CountPortfoliosByStatus() (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPortfoliosByStatus")
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPortfoliosByStatus indicates an expected call of CountPortfoliosByStatus.
+func (mr *MockPortfolioRepositoryMockRecorder) CountPortfoliosByStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPortfoliosByStatus", reflect.TypeOf((*MockPortfolioRepository)(nil).CountPortfoliosByStatus))
+}
+
+// CreatePortfolio mocks base method.
+func (m *MockPortfolioRepository) CreatePortfolio(userID int, portfolio Portfolio) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePortfolio", userID, portfolio)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePortfolio indicates an expected call of CreatePortfolio.
+func (mr *MockPortfolioRepositoryMockRecorder) CreatePortfolio(userID, portfolio interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePortfolio", reflect.TypeOf((*MockPortfolioRepository)(nil).CreatePortfolio), userID, portfolio)
+}
+
+// DeletePortfolio mocks base method.
+func (m *MockPortfolioRepository) DeletePortfolio(userID int, portfolioUUID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePortfolio", userID, portfolioUUID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePortfolio indicates an expected call of DeletePortfolio.
+func (mr *MockPortfolioRepositoryMockRecorder) DeletePortfolio(userID, portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePortfolio", reflect.TypeOf((*MockPortfolioRepository)(nil).DeletePortfolio), userID, portfolioUUID)
+}
+
+// GetPortfolio mocks base method.
+func (m *MockPortfolioRepository) GetPortfolio(portfolioUUID string, userID int) (Portfolio, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPortfolio", portfolioUUID, userID)
+	ret0, _ := ret[0].(Portfolio)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPortfolio indicates an expected call of GetPortfolio.
+func (mr *MockPortfolioRepositoryMockRecorder) GetPortfolio(portfolioUUID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortfolio", reflect.TypeOf((*MockPortfolioRepository)(nil).GetPortfolio), portfolioUUID, userID)
+}
+
+// GetPortfolioOwnerID mocks base method.
+func (m *MockPortfolioRepository) GetPortfolioOwnerID(portfolioUUID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPortfolioOwnerID", portfolioUUID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPortfolioOwnerID indicates an expected call of GetPortfolioOwnerID.
+func (mr *MockPortfolioRepositoryMockRecorder) GetPortfolioOwnerID(portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortfolioOwnerID", reflect.TypeOf((*MockPortfolioRepository)(nil).GetPortfolioOwnerID), portfolioUUID)
+}
+
+// GetPublishedPortfolio mocks base method.
+func (m *MockPortfolioRepository) GetPublishedPortfolio(portfolioUUID string) (Portfolio, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPublishedPortfolio", portfolioUUID)
+	ret0, _ := ret[0].(Portfolio)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPublishedPortfolio indicates an expected call of GetPublishedPortfolio.
+func (mr *MockPortfolioRepositoryMockRecorder) GetPublishedPortfolio(portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublishedPortfolio", reflect.TypeOf((*MockPortfolioRepository)(nil).GetPublishedPortfolio), portfolioUUID)
+}
+
+// ListPortfoliosByUser mocks base method.
+func (m *MockPortfolioRepository) ListPortfoliosByUser(userID int) ([]Portfolio, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPortfoliosByUser", userID)
+	ret0, _ := ret[0].([]Portfolio)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPortfoliosByUser indicates an expected call of ListPortfoliosByUser.
+func (mr *MockPortfolioRepositoryMockRecorder) ListPortfoliosByUser(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPortfoliosByUser", reflect.TypeOf((*MockPortfolioRepository)(nil).ListPortfoliosByUser), userID)
+}
+
+// UpdatePortfolio mocks base method.
+func (m *MockPortfolioRepository) UpdatePortfolio(userID int, portfolio Portfolio) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePortfolio", userID, portfolio)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdatePortfolio indicates an expected call of UpdatePortfolio.
+func (mr *MockPortfolioRepositoryMockRecorder) UpdatePortfolio(userID, portfolio interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePortfolio", reflect.TypeOf((*MockPortfolioRepository)(nil).UpdatePortfolio), userID, portfolio)
+}
+
+// MockTechStackRepository is a mock of TechStackRepository interface.
+type MockTechStackRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTechStackRepositoryMockRecorder
+}
+
+// MockTechStackRepositoryMockRecorder is the mock recorder for MockTechStackRepository.
+type MockTechStackRepositoryMockRecorder struct {
+	mock *MockTechStackRepository
+}
+
+// NewMockTechStackRepository creates a new mock instance.
+func NewMockTechStackRepository(ctrl *gomock.Controller) *MockTechStackRepository {
+	mock := &MockTechStackRepository{ctrl: ctrl}
+	mock.recorder = &MockTechStackRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTechStackRepository) EXPECT() *MockTechStackRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddTechStacks mocks base method.
+func (m *MockTechStackRepository) AddTechStacks(names []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTechStacks", names)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddTechStacks indicates an expected call of AddTechStacks.
+func (mr *MockTechStackRepositoryMockRecorder) AddTechStacks(names interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTechStacks", reflect.TypeOf((*MockTechStackRepository)(nil).AddTechStacks), names)
+}
+
+// SearchTechStacks mocks base method.
+func (m *MockTechStackRepository) SearchTechStacks(prefix string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchTechStacks", prefix)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchTechStacks indicates an expected call of SearchTechStacks.
+func (mr *MockTechStackRepositoryMockRecorder) SearchTechStacks(prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchTechStacks", reflect.TypeOf((*MockTechStackRepository)(nil).SearchTechStacks), prefix)
+}
+
+// MockShareLinkRepository is a mock of ShareLinkRepository interface.
+type MockShareLinkRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockShareLinkRepositoryMockRecorder
+}
+
+// MockShareLinkRepositoryMockRecorder is the mock recorder for MockShareLinkRepository.
+type MockShareLinkRepositoryMockRecorder struct {
+	mock *MockShareLinkRepository
+}
+
+// NewMockShareLinkRepository creates a new mock instance.
+func NewMockShareLinkRepository(ctrl *gomock.Controller) *MockShareLinkRepository {
+	mock := &MockShareLinkRepository{ctrl: ctrl}
+	mock.recorder = &MockShareLinkRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockShareLinkRepository) EXPECT() *MockShareLinkRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ShareLinkTargetExists mocks base method.
+func (m *MockShareLinkRepository) ShareLinkTargetExists(userUUID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ShareLinkTargetExists", userUUID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ShareLinkTargetExists indicates an expected call of ShareLinkTargetExists.
+func (mr *MockShareLinkRepositoryMockRecorder) ShareLinkTargetExists(userUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShareLinkTargetExists", reflect.TypeOf((*MockShareLinkRepository)(nil).ShareLinkTargetExists), userUUID)
+}
+
 // MockDatabase is a mock of Database interface.
 type MockDatabase struct {
 	ctrl     *gomock.Controller
@@ -33,17 +429,890 @@ func (m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 	return m.recorder
 }
 
-// GetUserByEmail mocks base method.
-func (m *MockDatabase) GetUserByEmail(email string) (User, error) {
+// AddTechStacks mocks base method.
+func (m *MockDatabase) AddTechStacks(names []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByEmail", email)
-	ret0, _ := ret[0].(User)
+	ret := m.ctrl.Call(m, "AddTechStacks", names)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddTechStacks indicates an expected call of AddTechStacks.
+func (mr *MockDatabaseMockRecorder) AddTechStacks(names interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTechStacks", reflect.TypeOf((*MockDatabase)(nil).AddTechStacks), names)
+}
+
+// CancelAccountDeletion mocks base method.
+func (m *MockDatabase) CancelAccountDeletion(userID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelAccountDeletion", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelAccountDeletion indicates an expected call of CancelAccountDeletion.
+func (mr *MockDatabaseMockRecorder) CancelAccountDeletion(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelAccountDeletion", reflect.TypeOf((*MockDatabase)(nil).CancelAccountDeletion), userID)
+}
+
+// ConsumeOAuthState mocks base method.
+func (m *MockDatabase) ConsumeOAuthState(stateValue string) (OAuthState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeOAuthState", stateValue)
+	ret0, _ := ret[0].(OAuthState)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserByEmail indicates an expected call of GetUserByEmail.
-func (mr *MockDatabaseMockRecorder) GetUserByEmail(email interface{}) *gomock.Call {
+// ConsumeOAuthState indicates an expected call of ConsumeOAuthState.
+func (mr *MockDatabaseMockRecorder) ConsumeOAuthState(stateValue interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockDatabase)(nil).GetUserByEmail), email)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeOAuthState", reflect.TypeOf((*MockDatabase)(nil).ConsumeOAuthState), stateValue)
+}
+
+// CountPortfoliosByStatus mocks base method.
+func (m *MockDatabase) CountPortfoliosByStatus() (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPortfoliosByStatus")
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPortfoliosByStatus indicates an expected call of CountPortfoliosByStatus.
+func (mr *MockDatabaseMockRecorder) CountPortfoliosByStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPortfoliosByStatus", reflect.TypeOf((*MockDatabase)(nil).CountPortfoliosByStatus))
+}
+
+// CreateAdminAuditLog mocks base method.
+func (m *MockDatabase) CreateAdminAuditLog(entry AdminAuditLog) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAdminAuditLog", entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAdminAuditLog indicates an expected call of CreateAdminAuditLog.
+func (mr *MockDatabaseMockRecorder) CreateAdminAuditLog(entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAdminAuditLog", reflect.TypeOf((*MockDatabase)(nil).CreateAdminAuditLog), entry)
+}
+
+// CreateLoginLockout mocks base method.
+func (m *MockDatabase) CreateLoginLockout(lockout LoginLockout) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginLockout", lockout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLoginLockout indicates an expected call of CreateLoginLockout.
+func (mr *MockDatabaseMockRecorder) CreateLoginLockout(lockout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginLockout", reflect.TypeOf((*MockDatabase)(nil).CreateLoginLockout), lockout)
+}
+
+// CreateOAuthState mocks base method.
+func (m *MockDatabase) CreateOAuthState(state OAuthState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOAuthState", state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOAuthState indicates an expected call of CreateOAuthState.
+func (mr *MockDatabaseMockRecorder) CreateOAuthState(state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOAuthState", reflect.TypeOf((*MockDatabase)(nil).CreateOAuthState), state)
+}
+
+// CreateOAuthUser mocks base method.
+func (m *MockDatabase) CreateOAuthUser(info OAuthUserInfo, provider string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOAuthUser", info, provider)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOAuthUser indicates an expected call of CreateOAuthUser.
+func (mr *MockDatabaseMockRecorder) CreateOAuthUser(info, provider interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOAuthUser", reflect.TypeOf((*MockDatabase)(nil).CreateOAuthUser), info, provider)
+}
+
+// CreatePasswordResetToken mocks base method.
+func (m *MockDatabase) CreatePasswordResetToken(token PasswordResetToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordResetToken indicates an expected call of CreatePasswordResetToken.
+func (mr *MockDatabaseMockRecorder) CreatePasswordResetToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetToken", reflect.TypeOf((*MockDatabase)(nil).CreatePasswordResetToken), token)
+}
+
+// CreatePersonalAccessToken mocks base method.
+func (m *MockDatabase) CreatePersonalAccessToken(token PersonalAccessToken) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePersonalAccessToken", token)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePersonalAccessToken indicates an expected call of CreatePersonalAccessToken.
+func (mr *MockDatabaseMockRecorder) CreatePersonalAccessToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePersonalAccessToken", reflect.TypeOf((*MockDatabase)(nil).CreatePersonalAccessToken), token)
+}
+
+// CreatePortfolio mocks base method.
+func (m *MockDatabase) CreatePortfolio(userID int, portfolio Portfolio) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePortfolio", userID, portfolio)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePortfolio indicates an expected call of CreatePortfolio.
+func (mr *MockDatabaseMockRecorder) CreatePortfolio(userID, portfolio interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePortfolio", reflect.TypeOf((*MockDatabase)(nil).CreatePortfolio), userID, portfolio)
+}
+
+// CreateProfile mocks base method.
+func (m *MockDatabase) CreateProfile(userID int, profile Profile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateProfile", userID, profile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateProfile indicates an expected call of CreateProfile.
+func (mr *MockDatabaseMockRecorder) CreateProfile(userID, profile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProfile", reflect.TypeOf((*MockDatabase)(nil).CreateProfile), userID, profile)
+}
+
+// CreateRefreshToken mocks base method.
+func (m *MockDatabase) CreateRefreshToken(token RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRefreshToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRefreshToken indicates an expected call of CreateRefreshToken.
+func (mr *MockDatabaseMockRecorder) CreateRefreshToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefreshToken", reflect.TypeOf((*MockDatabase)(nil).CreateRefreshToken), token)
+}
+
+// CreateSession mocks base method.
+func (m *MockDatabase) CreateSession(session Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockDatabaseMockRecorder) CreateSession(session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockDatabase)(nil).CreateSession), session)
+}
+
+// CreateUser mocks base method.
+func (m *MockDatabase) CreateUser(user User) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", user)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockDatabaseMockRecorder) CreateUser(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockDatabase)(nil).CreateUser), user)
+}
+
+// CreateUserIdentity mocks base method.
+func (m *MockDatabase) CreateUserIdentity(identity UserIdentity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserIdentity", identity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUserIdentity indicates an expected call of CreateUserIdentity.
+func (mr *MockDatabaseMockRecorder) CreateUserIdentity(identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserIdentity", reflect.TypeOf((*MockDatabase)(nil).CreateUserIdentity), identity)
+}
+
+// DeletePortfolio mocks base method.
+func (m *MockDatabase) DeletePortfolio(userID int, portfolioUUID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePortfolio", userID, portfolioUUID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePortfolio indicates an expected call of DeletePortfolio.
+func (mr *MockDatabaseMockRecorder) DeletePortfolio(userID, portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePortfolio", reflect.TypeOf((*MockDatabase)(nil).DeletePortfolio), userID, portfolioUUID)
+}
+
+// DeleteUserAccount mocks base method.
+func (m *MockDatabase) DeleteUserAccount(userID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserAccount", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserAccount indicates an expected call of DeleteUserAccount.
+func (mr *MockDatabaseMockRecorder) DeleteUserAccount(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserAccount", reflect.TypeOf((*MockDatabase)(nil).DeleteUserAccount), userID)
+}
+
+// DisableTOTP mocks base method.
+func (m *MockDatabase) DisableTOTP(userID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTOTP", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTOTP indicates an expected call of DisableTOTP.
+func (mr *MockDatabaseMockRecorder) DisableTOTP(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTOTP", reflect.TypeOf((*MockDatabase)(nil).DisableTOTP), userID)
+}
+
+// EnableTOTP mocks base method.
+func (m *MockDatabase) EnableTOTP(userID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP.
+func (mr *MockDatabaseMockRecorder) EnableTOTP(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockDatabase)(nil).EnableTOTP), userID)
+}
+
+// GetPasswordResetTokenByHash mocks base method.
+func (m *MockDatabase) GetPasswordResetTokenByHash(tokenHash string) (PasswordResetToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPasswordResetTokenByHash", tokenHash)
+	ret0, _ := ret[0].(PasswordResetToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPasswordResetTokenByHash indicates an expected call of GetPasswordResetTokenByHash.
+func (mr *MockDatabaseMockRecorder) GetPasswordResetTokenByHash(tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPasswordResetTokenByHash", reflect.TypeOf((*MockDatabase)(nil).GetPasswordResetTokenByHash), tokenHash)
+}
+
+// GetPersonalAccessTokenByPrefix mocks base method.
+func (m *MockDatabase) GetPersonalAccessTokenByPrefix(prefix string) (PersonalAccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPersonalAccessTokenByPrefix", prefix)
+	ret0, _ := ret[0].(PersonalAccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPersonalAccessTokenByPrefix indicates an expected call of GetPersonalAccessTokenByPrefix.
+func (mr *MockDatabaseMockRecorder) GetPersonalAccessTokenByPrefix(prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPersonalAccessTokenByPrefix", reflect.TypeOf((*MockDatabase)(nil).GetPersonalAccessTokenByPrefix), prefix)
+}
+
+// GetPortfolio mocks base method.
+func (m *MockDatabase) GetPortfolio(portfolioUUID string, userID int) (Portfolio, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPortfolio", portfolioUUID, userID)
+	ret0, _ := ret[0].(Portfolio)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPortfolio indicates an expected call of GetPortfolio.
+func (mr *MockDatabaseMockRecorder) GetPortfolio(portfolioUUID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortfolio", reflect.TypeOf((*MockDatabase)(nil).GetPortfolio), portfolioUUID, userID)
+}
+
+// GetPortfolioOwnerID mocks base method.
+func (m *MockDatabase) GetPortfolioOwnerID(portfolioUUID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPortfolioOwnerID", portfolioUUID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPortfolioOwnerID indicates an expected call of GetPortfolioOwnerID.
+func (mr *MockDatabaseMockRecorder) GetPortfolioOwnerID(portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortfolioOwnerID", reflect.TypeOf((*MockDatabase)(nil).GetPortfolioOwnerID), portfolioUUID)
+}
+
+// GetProfileByUserID mocks base method.
+func (m *MockDatabase) GetProfileByUserID(userID int) (Profile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileByUserID", userID)
+	ret0, _ := ret[0].(Profile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileByUserID indicates an expected call of GetProfileByUserID.
+func (mr *MockDatabaseMockRecorder) GetProfileByUserID(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByUserID", reflect.TypeOf((*MockDatabase)(nil).GetProfileByUserID), userID)
+}
+
+// GetPublishedPortfolio mocks base method.
+func (m *MockDatabase) GetPublishedPortfolio(portfolioUUID string) (Portfolio, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPublishedPortfolio", portfolioUUID)
+	ret0, _ := ret[0].(Portfolio)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPublishedPortfolio indicates an expected call of GetPublishedPortfolio.
+func (mr *MockDatabaseMockRecorder) GetPublishedPortfolio(portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublishedPortfolio", reflect.TypeOf((*MockDatabase)(nil).GetPublishedPortfolio), portfolioUUID)
+}
+
+// GetRefreshTokenByHash mocks base method.
+func (m *MockDatabase) GetRefreshTokenByHash(tokenHash string) (RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRefreshTokenByHash", tokenHash)
+	ret0, _ := ret[0].(RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRefreshTokenByHash indicates an expected call of GetRefreshTokenByHash.
+func (mr *MockDatabaseMockRecorder) GetRefreshTokenByHash(tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefreshTokenByHash", reflect.TypeOf((*MockDatabase)(nil).GetRefreshTokenByHash), tokenHash)
+}
+
+// GetSession mocks base method.
+func (m *MockDatabase) GetSession(id string) (Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", id)
+	ret0, _ := ret[0].(Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockDatabaseMockRecorder) GetSession(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockDatabase)(nil).GetSession), id)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockDatabase) GetUserByEmail(email string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", email)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockDatabaseMockRecorder) GetUserByEmail(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockDatabase)(nil).GetUserByEmail), email)
+}
+
+// GetUserByID mocks base method.
+func (m *MockDatabase) GetUserByID(id int) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", id)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockDatabaseMockRecorder) GetUserByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockDatabase)(nil).GetUserByID), id)
+}
+
+// GetUserIDByUUID mocks base method.
+func (m *MockDatabase) GetUserIDByUUID(userUUID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserIDByUUID", userUUID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserIDByUUID indicates an expected call of GetUserIDByUUID.
+func (mr *MockDatabaseMockRecorder) GetUserIDByUUID(userUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIDByUUID", reflect.TypeOf((*MockDatabase)(nil).GetUserIDByUUID), userUUID)
+}
+
+// GetUserIdentity mocks base method.
+func (m *MockDatabase) GetUserIdentity(provider, subject string) (UserIdentity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserIdentity", provider, subject)
+	ret0, _ := ret[0].(UserIdentity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserIdentity indicates an expected call of GetUserIdentity.
+func (mr *MockDatabaseMockRecorder) GetUserIdentity(provider, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIdentity", reflect.TypeOf((*MockDatabase)(nil).GetUserIdentity), provider, subject)
+}
+
+// ListPersonalAccessTokens mocks base method.
+func (m *MockDatabase) ListPersonalAccessTokens(userID int) ([]PersonalAccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPersonalAccessTokens", userID)
+	ret0, _ := ret[0].([]PersonalAccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPersonalAccessTokens indicates an expected call of ListPersonalAccessTokens.
+func (mr *MockDatabaseMockRecorder) ListPersonalAccessTokens(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPersonalAccessTokens", reflect.TypeOf((*MockDatabase)(nil).ListPersonalAccessTokens), userID)
+}
+
+// ListPortfoliosByUser mocks base method.
+func (m *MockDatabase) ListPortfoliosByUser(userID int) ([]Portfolio, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPortfoliosByUser", userID)
+	ret0, _ := ret[0].([]Portfolio)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPortfoliosByUser indicates an expected call of ListPortfoliosByUser.
+func (mr *MockDatabaseMockRecorder) ListPortfoliosByUser(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPortfoliosByUser", reflect.TypeOf((*MockDatabase)(nil).ListPortfoliosByUser), userID)
+}
+
+// ListSessions mocks base method.
+func (m *MockDatabase) ListSessions(userID int) ([]Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSessions", userID)
+	ret0, _ := ret[0].([]Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSessions indicates an expected call of ListSessions.
+func (mr *MockDatabaseMockRecorder) ListSessions(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSessions", reflect.TypeOf((*MockDatabase)(nil).ListSessions), userID)
+}
+
+// ListUsersPendingDeletion mocks base method.
+func (m *MockDatabase) ListUsersPendingDeletion(before time.Time) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsersPendingDeletion", before)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsersPendingDeletion indicates an expected call of ListUsersPendingDeletion.
+func (mr *MockDatabaseMockRecorder) ListUsersPendingDeletion(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsersPendingDeletion", reflect.TypeOf((*MockDatabase)(nil).ListUsersPendingDeletion), before)
+}
+
+// MarkPasswordResetTokenUsed mocks base method.
+func (m *MockDatabase) MarkPasswordResetTokenUsed(id int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkPasswordResetTokenUsed", id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkPasswordResetTokenUsed indicates an expected call of MarkPasswordResetTokenUsed.
+func (mr *MockDatabaseMockRecorder) MarkPasswordResetTokenUsed(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkPasswordResetTokenUsed", reflect.TypeOf((*MockDatabase)(nil).MarkPasswordResetTokenUsed), id)
+}
+
+// MarkRefreshTokenUsed mocks base method.
+func (m *MockDatabase) MarkRefreshTokenUsed(id int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRefreshTokenUsed", id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkRefreshTokenUsed indicates an expected call of MarkRefreshTokenUsed.
+func (mr *MockDatabaseMockRecorder) MarkRefreshTokenUsed(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRefreshTokenUsed", reflect.TypeOf((*MockDatabase)(nil).MarkRefreshTokenUsed), id)
+}
+
+// ReplaceRecoveryCodes mocks base method.
+func (m *MockDatabase) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodes", userID, codeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodes indicates an expected call of ReplaceRecoveryCodes.
+func (mr *MockDatabaseMockRecorder) ReplaceRecoveryCodes(userID, codeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodes", reflect.TypeOf((*MockDatabase)(nil).ReplaceRecoveryCodes), userID, codeHashes)
+}
+
+// RequestAccountDeletion mocks base method.
+func (m *MockDatabase) RequestAccountDeletion(userID int, requestedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestAccountDeletion", userID, requestedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequestAccountDeletion indicates an expected call of RequestAccountDeletion.
+func (mr *MockDatabaseMockRecorder) RequestAccountDeletion(userID, requestedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestAccountDeletion", reflect.TypeOf((*MockDatabase)(nil).RequestAccountDeletion), userID, requestedAt)
+}
+
+// RevokePersonalAccessToken mocks base method.
+func (m *MockDatabase) RevokePersonalAccessToken(id, userID int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokePersonalAccessToken", id, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokePersonalAccessToken indicates an expected call of RevokePersonalAccessToken.
+func (mr *MockDatabaseMockRecorder) RevokePersonalAccessToken(id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokePersonalAccessToken", reflect.TypeOf((*MockDatabase)(nil).RevokePersonalAccessToken), id, userID)
+}
+
+// RevokeRefreshTokenFamily mocks base method.
+func (m *MockDatabase) RevokeRefreshTokenFamily(familyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamily", familyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamily indicates an expected call of RevokeRefreshTokenFamily.
+func (mr *MockDatabaseMockRecorder) RevokeRefreshTokenFamily(familyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamily", reflect.TypeOf((*MockDatabase)(nil).RevokeRefreshTokenFamily), familyID)
+}
+
+// RevokeSession mocks base method.
+func (m *MockDatabase) RevokeSession(id string, userID int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", id, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockDatabaseMockRecorder) RevokeSession(id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockDatabase)(nil).RevokeSession), id, userID)
+}
+
+// RevokeUserSessions mocks base method.
+func (m *MockDatabase) RevokeUserSessions(userID int, exceptSessionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSessions", userID, exceptSessionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSessions indicates an expected call of RevokeUserSessions.
+func (mr *MockDatabaseMockRecorder) RevokeUserSessions(userID, exceptSessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSessions", reflect.TypeOf((*MockDatabase)(nil).RevokeUserSessions), userID, exceptSessionID)
+}
+
+// SearchTechStacks mocks base method.
+func (m *MockDatabase) SearchTechStacks(prefix string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchTechStacks", prefix)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchTechStacks indicates an expected call of SearchTechStacks.
+func (mr *MockDatabaseMockRecorder) SearchTechStacks(prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchTechStacks", reflect.TypeOf((*MockDatabase)(nil).SearchTechStacks), prefix)
+}
+
+// SearchUsers mocks base method.
+func (m *MockDatabase) SearchUsers(query string, limit, offset int) ([]AdminUser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", query, limit, offset)
+	ret0, _ := ret[0].([]AdminUser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockDatabaseMockRecorder) SearchUsers(query, limit, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockDatabase)(nil).SearchUsers), query, limit, offset)
+}
+
+// SetEmailVerified mocks base method.
+func (m *MockDatabase) SetEmailVerified(userID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEmailVerified", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetEmailVerified indicates an expected call of SetEmailVerified.
+func (mr *MockDatabaseMockRecorder) SetEmailVerified(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEmailVerified", reflect.TypeOf((*MockDatabase)(nil).SetEmailVerified), userID)
+}
+
+// SetTOTPSecret mocks base method.
+func (m *MockDatabase) SetTOTPSecret(userID int, encryptedSecret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTOTPSecret", userID, encryptedSecret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTOTPSecret indicates an expected call of SetTOTPSecret.
+func (mr *MockDatabaseMockRecorder) SetTOTPSecret(userID, encryptedSecret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTOTPSecret", reflect.TypeOf((*MockDatabase)(nil).SetTOTPSecret), userID, encryptedSecret)
+}
+
+// SetUserSuspended mocks base method.
+func (m *MockDatabase) SetUserSuspended(userID int, suspended bool) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserSuspended", userID, suspended)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetUserSuspended indicates an expected call of SetUserSuspended.
+func (mr *MockDatabaseMockRecorder) SetUserSuspended(userID, suspended interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserSuspended", reflect.TypeOf((*MockDatabase)(nil).SetUserSuspended), userID, suspended)
+}
+
+// ShareLinkTargetExists mocks base method.
+func (m *MockDatabase) ShareLinkTargetExists(userUUID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ShareLinkTargetExists", userUUID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ShareLinkTargetExists indicates an expected call of ShareLinkTargetExists.
+func (mr *MockDatabaseMockRecorder) ShareLinkTargetExists(userUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShareLinkTargetExists", reflect.TypeOf((*MockDatabase)(nil).ShareLinkTargetExists), userUUID)
+}
+
+// TouchPersonalAccessToken mocks base method.
+func (m *MockDatabase) TouchPersonalAccessToken(id int, usedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchPersonalAccessToken", id, usedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchPersonalAccessToken indicates an expected call of TouchPersonalAccessToken.
+func (mr *MockDatabaseMockRecorder) TouchPersonalAccessToken(id, usedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchPersonalAccessToken", reflect.TypeOf((*MockDatabase)(nil).TouchPersonalAccessToken), id, usedAt)
+}
+
+// TouchSession mocks base method.
+func (m *MockDatabase) TouchSession(id string, seenAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", id, seenAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchSession indicates an expected call of TouchSession.
+func (mr *MockDatabaseMockRecorder) TouchSession(id, seenAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockDatabase)(nil).TouchSession), id, seenAt)
+}
+
+// Transaction mocks base method.
+func (m *MockDatabase) Transaction(fn func(Database) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transaction", fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Transaction indicates an expected call of Transaction.
+func (mr *MockDatabaseMockRecorder) Transaction(fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transaction", reflect.TypeOf((*MockDatabase)(nil).Transaction), fn)
+}
+
+// UnpublishPortfolio mocks base method.
+func (m *MockDatabase) UnpublishPortfolio(portfolioUUID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnpublishPortfolio", portfolioUUID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnpublishPortfolio indicates an expected call of UnpublishPortfolio.
+func (mr *MockDatabaseMockRecorder) UnpublishPortfolio(portfolioUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnpublishPortfolio", reflect.TypeOf((*MockDatabase)(nil).UnpublishPortfolio), portfolioUUID)
+}
+
+// UpdatePortfolio mocks base method.
+func (m *MockDatabase) UpdatePortfolio(userID int, portfolio Portfolio) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePortfolio", userID, portfolio)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdatePortfolio indicates an expected call of UpdatePortfolio.
+func (mr *MockDatabaseMockRecorder) UpdatePortfolio(userID, portfolio interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePortfolio", reflect.TypeOf((*MockDatabase)(nil).UpdatePortfolio), userID, portfolio)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockDatabase) UpdateProfile(userID int, profile Profile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", userID, profile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockDatabaseMockRecorder) UpdateProfile(userID, profile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockDatabase)(nil).UpdateProfile), userID, profile)
+}
+
+// UpdateTOTPLastStep mocks base method.
+func (m *MockDatabase) UpdateTOTPLastStep(userID int, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTOTPLastStep", userID, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateTOTPLastStep indicates an expected call of UpdateTOTPLastStep.
+func (mr *MockDatabaseMockRecorder) UpdateTOTPLastStep(userID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTOTPLastStep", reflect.TypeOf((*MockDatabase)(nil).UpdateTOTPLastStep), userID, step)
+}
+
+// UpdateUserEmail mocks base method.
+func (m *MockDatabase) UpdateUserEmail(userID int, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserEmail", userID, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserEmail indicates an expected call of UpdateUserEmail.
+func (mr *MockDatabaseMockRecorder) UpdateUserEmail(userID, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserEmail", reflect.TypeOf((*MockDatabase)(nil).UpdateUserEmail), userID, email)
+}
+
+// UpdateUserPassword mocks base method.
+func (m *MockDatabase) UpdateUserPassword(userID int, hashedPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", userID, hashedPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockDatabaseMockRecorder) UpdateUserPassword(userID, hashedPassword interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockDatabase)(nil).UpdateUserPassword), userID, hashedPassword)
+}
+
+// UpdateVerificationSentAt mocks base method.
+func (m *MockDatabase) UpdateVerificationSentAt(userID int, sentAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateVerificationSentAt", userID, sentAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateVerificationSentAt indicates an expected call of UpdateVerificationSentAt.
+func (mr *MockDatabaseMockRecorder) UpdateVerificationSentAt(userID, sentAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateVerificationSentAt", reflect.TypeOf((*MockDatabase)(nil).UpdateVerificationSentAt), userID, sentAt)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockDatabase) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", userID, codeHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockDatabaseMockRecorder) UseRecoveryCode(userID, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockDatabase)(nil).UseRecoveryCode), userID, codeHash)
 }
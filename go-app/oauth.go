@@ -0,0 +1,654 @@
+package main
+
+import (
+    "crypto/sha256"
+    "crypto/subtle"
+    "database/sql"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// 認可リクエストのstateの有効期限
+const oauthStateLifetime = 10 * time.Minute
+
+// 認可を開始したブラウザにstateを紐付けるCookie（値はstateのハッシュ）
+// プロバイダーからのリダイレクト（トップレベルのGET）で送信されるようにSameSite=Laxにする
+const oauthStateCookieName = "oauth_state"
+
+// 外部プロバイダー（GitHubまたはOpenID Connect準拠のIdP）の設定
+type OAuthConfig struct {
+    Provider     string // user_identitiesに保存するプロバイダー名
+    ClientID     string
+    ClientSecret string
+    AuthorizeURL string
+    TokenURL     string
+    UserInfoURL  string
+    EmailsURL    string // メールアドレス一覧のエンドポイント（GitHubの/user/emails。OIDCでは不要）
+    RedirectURL  string // /api/oauth/callback の公開URL
+    Scopes       []string
+    HTTPClient   *http.Client
+}
+
+// oauth_statesテーブルの1レコード（PKCEのcode_verifierをサーバー側で保持する）
+type OAuthState struct {
+    State        string
+    CodeVerifier string
+    LinkUserID   int // 既存アカウントへの連携の場合のユーザーID（ログインの場合は0）
+    ExpiresAt    time.Time
+}
+
+// user_identitiesテーブルの1レコード
+type UserIdentity struct {
+    Provider string
+    Subject  string // プロバイダー側のユーザーID
+    UserID   int
+    Email    string
+}
+
+// プロバイダーから取得したユーザー情報
+type OAuthUserInfo struct {
+    Subject       string
+    Email         string
+    EmailVerified bool
+    Username      string
+}
+
+type OAuthLinkResponse struct {
+    AuthorizationURL string `json:"authorization_url"`
+}
+
+// OAuth設定を読み込む（OAUTH_CLIENT_IDが未設定の場合はnil）
+// OAUTH_ISSUERが設定されている場合はOpenID Connect Discoveryでエンドポイントを取得する
+func loadOAuthConfig(src configSource) (*OAuthConfig, error) {
+    clientID := src.get("OAUTH_CLIENT_ID")
+    if clientID == "" {
+        return nil, nil
+    }
+
+    config := &OAuthConfig{
+        Provider:     src.get("OAUTH_PROVIDER"),
+        ClientID:     clientID,
+        ClientSecret: src.get("OAUTH_CLIENT_SECRET"),
+        AuthorizeURL: src.get("OAUTH_AUTHORIZE_URL"),
+        TokenURL:     src.get("OAUTH_TOKEN_URL"),
+        UserInfoURL:  src.get("OAUTH_USERINFO_URL"),
+        EmailsURL:    src.get("OAUTH_EMAILS_URL"),
+        RedirectURL:  src.get("OAUTH_REDIRECT_URL"),
+        HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+    }
+    if config.Provider == "" {
+        config.Provider = "github"
+    }
+    if scopes := src.get("OAUTH_SCOPES"); scopes != "" {
+        config.Scopes = strings.Fields(scopes)
+    }
+
+    if issuer := src.get("OAUTH_ISSUER"); issuer != "" {
+        if err := config.discover(issuer); err != nil {
+            return nil, err
+        }
+    } else if config.Provider == "github" {
+        // GitHubはOIDC Discoveryに対応していないため既定のエンドポイントを使う
+        if config.AuthorizeURL == "" {
+            config.AuthorizeURL = "https://github.com/login/oauth/authorize"
+        }
+        if config.TokenURL == "" {
+            config.TokenURL = "https://github.com/login/oauth/access_token"
+        }
+        if config.UserInfoURL == "" {
+            config.UserInfoURL = "https://api.github.com/user"
+        }
+        if config.EmailsURL == "" {
+            config.EmailsURL = "https://api.github.com/user/emails"
+        }
+        if config.Scopes == nil {
+            config.Scopes = []string{"read:user", "user:email"}
+        }
+    }
+
+    if config.Scopes == nil {
+        config.Scopes = []string{"openid", "email", "profile"}
+    }
+    if config.AuthorizeURL == "" || config.TokenURL == "" || config.UserInfoURL == "" || config.RedirectURL == "" {
+        return nil, errors.New("OAuth authorize, token, userinfo and redirect URLs must be set")
+    }
+    return config, nil
+}
+
+// issuerの/.well-known/openid-configurationから未設定のエンドポイントを補完する
+func (c *OAuthConfig) discover(issuer string) error {
+    resp, err := c.HTTPClient.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+    if err != nil {
+        return fmt.Errorf("OIDC discovery failed: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("OIDC discovery failed: status %d", resp.StatusCode)
+    }
+
+    var metadata struct {
+        AuthorizationEndpoint string `json:"authorization_endpoint"`
+        TokenEndpoint         string `json:"token_endpoint"`
+        UserinfoEndpoint      string `json:"userinfo_endpoint"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+        return fmt.Errorf("OIDC discovery failed: %v", err)
+    }
+
+    if c.AuthorizeURL == "" {
+        c.AuthorizeURL = metadata.AuthorizationEndpoint
+    }
+    if c.TokenURL == "" {
+        c.TokenURL = metadata.TokenEndpoint
+    }
+    if c.UserInfoURL == "" {
+        c.UserInfoURL = metadata.UserinfoEndpoint
+    }
+    return nil
+}
+
+// PKCE (S256) のcode_challengeを計算する
+func pkceChallenge(verifier string) string {
+    sum := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// stateとcode_verifierを保存し、プロバイダーの認可URLを組み立てる
+// 別のブラウザで開始した認可のコールバックを受け付けないように、stateをCookieにも設定する
+func (c *OAuthConfig) startAuthorization(w http.ResponseWriter, db Database, linkUserID int) (string, error) {
+    state, err := generateRandomToken()
+    if err != nil {
+        return "", err
+    }
+    verifier, err := generateRandomToken()
+    if err != nil {
+        return "", err
+    }
+
+    err = db.CreateOAuthState(OAuthState{
+        State:        state,
+        CodeVerifier: verifier,
+        LinkUserID:   linkUserID,
+        ExpiresAt:    time.Now().Add(oauthStateLifetime),
+    })
+    if err != nil {
+        return "", err
+    }
+    http.SetCookie(w, c.stateCookie(hashToken(state), oauthStateLifetime))
+
+    params := url.Values{}
+    params.Set("response_type", "code")
+    params.Set("client_id", c.ClientID)
+    params.Set("redirect_uri", c.RedirectURL)
+    params.Set("scope", strings.Join(c.Scopes, " "))
+    params.Set("state", state)
+    params.Set("code_challenge", pkceChallenge(verifier))
+    params.Set("code_challenge_method", "S256")
+
+    separator := "?"
+    if strings.Contains(c.AuthorizeURL, "?") {
+        separator = "&"
+    }
+    return c.AuthorizeURL + separator + params.Encode(), nil
+}
+
+// stateのCookie（maxAgeが負の場合は削除用）
+// コールバックのURLのみに送信し、コールバックがHTTPSの場合はSecureにする
+func (c *OAuthConfig) stateCookie(value string, maxAge time.Duration) *http.Cookie {
+    path := "/api/oauth/callback"
+    if u, err := url.Parse(c.RedirectURL); err == nil && u.Path != "" {
+        path = u.Path
+    }
+    return &http.Cookie{
+        Name:     oauthStateCookieName,
+        Value:    value,
+        Path:     path,
+        MaxAge:   int(maxAge.Seconds()),
+        Secure:   strings.HasPrefix(c.RedirectURL, "https://"),
+        HttpOnly: true,
+        SameSite: http.SameSiteLaxMode,
+    }
+}
+
+// コールバックのstateが、このブラウザで開始した認可のものかどうか
+func stateMatchesCookie(r *http.Request, state string) bool {
+    cookie, err := r.Cookie(oauthStateCookieName)
+    if err != nil {
+        return false
+    }
+    return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashToken(state))) == 1
+}
+
+// 認可コードをアクセストークンに交換する
+func (c *OAuthConfig) exchangeCode(code string, verifier string) (string, error) {
+    form := url.Values{}
+    form.Set("grant_type", "authorization_code")
+    form.Set("code", code)
+    form.Set("redirect_uri", c.RedirectURL)
+    form.Set("client_id", c.ClientID)
+    form.Set("client_secret", c.ClientSecret)
+    form.Set("code_verifier", verifier)
+
+    req, err := http.NewRequest("POST", c.TokenURL, strings.NewReader(form.Encode()))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json") // GitHubは既定でform形式を返すため
+
+    resp, err := c.HTTPClient.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    var token struct {
+        AccessToken string `json:"access_token"`
+        Error       string `json:"error"`
+    }
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+        return "", fmt.Errorf("token endpoint returned invalid response: status %d", resp.StatusCode)
+    }
+    if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+        return "", fmt.Errorf("token endpoint returned error: status %d %s", resp.StatusCode, token.Error)
+    }
+    return token.AccessToken, nil
+}
+
+// ユーザー情報エンドポイントからプロバイダー側のユーザー情報を取得する
+// OIDCの標準クレーム(sub, email, email_verified, preferred_username)とGitHubの形式(id, login, email)の両方に対応する
+func (c *OAuthConfig) fetchUserInfo(accessToken string) (OAuthUserInfo, error) {
+    req, err := http.NewRequest("GET", c.UserInfoURL, nil)
+    if err != nil {
+        return OAuthUserInfo{}, err
+    }
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := c.HTTPClient.Do(req)
+    if err != nil {
+        return OAuthUserInfo{}, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return OAuthUserInfo{}, fmt.Errorf("userinfo endpoint returned status %d", resp.StatusCode)
+    }
+
+    var raw struct {
+        Sub               string      `json:"sub"`
+        ID                json.Number `json:"id"`
+        Email             string      `json:"email"`
+        EmailVerified     bool        `json:"email_verified"`
+        PreferredUsername string      `json:"preferred_username"`
+        Login             string      `json:"login"`
+    }
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&raw); err != nil {
+        return OAuthUserInfo{}, err
+    }
+
+    info := OAuthUserInfo{
+        Subject:       raw.Sub,
+        Email:         raw.Email,
+        EmailVerified: raw.EmailVerified,
+        Username:      raw.PreferredUsername,
+    }
+    if info.Subject == "" {
+        info.Subject = raw.ID.String()
+    }
+    if info.Username == "" {
+        info.Username = raw.Login
+    }
+    if info.Subject == "" {
+        return OAuthUserInfo{}, errors.New("userinfo response does not contain a subject")
+    }
+
+    // GitHubの/userはメールアドレスを非公開にしていると空になり、確認済みかどうかも返さないため、
+    // メールアドレス一覧から確認済みのプライマリアドレスを使う
+    if c.EmailsURL != "" {
+        email, err := c.fetchPrimaryEmail(accessToken)
+        if err != nil {
+            return OAuthUserInfo{}, err
+        }
+        info.Email = email
+        info.EmailVerified = email != ""
+    }
+    return info, nil
+}
+
+// メールアドレス一覧のエンドポイントから確認済みのプライマリアドレスを取得する（存在しない場合は空文字列）
+func (c *OAuthConfig) fetchPrimaryEmail(accessToken string) (string, error) {
+    req, err := http.NewRequest("GET", c.EmailsURL, nil)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := c.HTTPClient.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("emails endpoint returned status %d", resp.StatusCode)
+    }
+
+    var emails []struct {
+        Email    string `json:"email"`
+        Primary  bool   `json:"primary"`
+        Verified bool   `json:"verified"`
+    }
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&emails); err != nil {
+        return "", err
+    }
+    for _, e := range emails {
+        if e.Primary && e.Verified {
+            return e.Email, nil
+        }
+    }
+    return "", nil
+}
+
+// フロントエンドのコールバック画面へ結果をフラグメントで渡してリダイレクトする
+// （トークンがサーバーログやRefererに残らないようにクエリではなくフラグメントを使う）
+func redirectOAuthResult(w http.ResponseWriter, r *http.Request, appBaseURL string, values url.Values) {
+    http.Redirect(w, r, appBaseURL+"/oauth/callback#"+values.Encode(), http.StatusFound)
+}
+
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, appBaseURL string, code string) {
+    redirectOAuthResult(w, r, appBaseURL, url.Values{"error": {code}})
+}
+
+// 外部プロバイダーでのログインを開始する
+func OAuthLoginHandler(w http.ResponseWriter, r *http.Request, oauth *OAuthConfig, db Database) {
+    if oauth == nil {
+        writeError(w, r, http.StatusNotFound, ErrCodeOAuthNotConfigured)
+        return
+    }
+
+    authorizationURL, err := oauth.startAuthorization(w, db, 0)
+    if err != nil {
+        serverError(w, r, "Failed to start OAuth login", err)
+        return
+    }
+
+    http.Redirect(w, r, authorizationURL, http.StatusFound)
+}
+
+// ログイン中のアカウントに外部IDを連携するための認可URLを発行する
+// ブラウザのリダイレクトではAuthorizationヘッダーを送れないため、URLをJSONで返す
+// stateのCookieを保存させるため、フロントエンドはcredentialsを含めてリクエストする
+func OAuthLinkHandler(w http.ResponseWriter, r *http.Request, oauth *OAuthConfig, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    if oauth == nil {
+        writeError(w, r, http.StatusNotFound, ErrCodeOAuthNotConfigured)
+        return
+    }
+
+    authorizationURL, err := oauth.startAuthorization(w, db, claims.ID)
+    if err != nil {
+        serverError(w, r, "Failed to start OAuth linking", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(OAuthLinkResponse{AuthorizationURL: authorizationURL})
+}
+
+// プロバイダーからのコールバック：外部IDに対応するユーザーでログイン（初回は作成）または連携する
+func OAuthCallbackHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, oauth *OAuthConfig, db Database, appBaseURL string) {
+    if oauth == nil {
+        writeError(w, r, http.StatusNotFound, ErrCodeOAuthNotConfigured)
+        return
+    }
+
+    query := r.URL.Query()
+    if query.Get("error") != "" {
+        redirectOAuthError(w, r, appBaseURL, "access_denied")
+        return
+    }
+
+    code := query.Get("code")
+    stateValue := query.Get("state")
+    if code == "" || stateValue == "" {
+        redirectOAuthError(w, r, appBaseURL, "invalid_request")
+        return
+    }
+
+    // 攻撃者が開始した認可のコールバックURLを踏ませるログインCSRFや、
+    // 攻撃者のアカウントへの外部IDの連携を防ぐため、認可を開始したブラウザからのみ受け付ける
+    http.SetCookie(w, oauth.stateCookie("", -1))
+    if !stateMatchesCookie(r, stateValue) {
+        redirectOAuthError(w, r, appBaseURL, "invalid_state")
+        return
+    }
+
+    // stateは一度しか使えない
+    state, err := db.ConsumeOAuthState(stateValue)
+    if err != nil || time.Now().After(state.ExpiresAt) {
+        if err != nil && err != sql.ErrNoRows {
+            requestLogger(r).Error("OAuth callback: failed to load state", "error", err)
+        }
+        redirectOAuthError(w, r, appBaseURL, "invalid_state")
+        return
+    }
+
+    accessToken, err := oauth.exchangeCode(code, state.CodeVerifier)
+    if err != nil {
+        requestLogger(r).Error("OAuth callback: code exchange failed", "error", err)
+        redirectOAuthError(w, r, appBaseURL, "exchange_failed")
+        return
+    }
+
+    info, err := oauth.fetchUserInfo(accessToken)
+    if err != nil {
+        requestLogger(r).Error("OAuth callback: userinfo request failed", "error", err)
+        redirectOAuthError(w, r, appBaseURL, "userinfo_failed")
+        return
+    }
+
+    identity, err := db.GetUserIdentity(oauth.Provider, info.Subject)
+    if err != nil && err != sql.ErrNoRows {
+        requestLogger(r).Error("OAuth callback: failed to load identity", "error", err)
+        redirectOAuthError(w, r, appBaseURL, "server_error")
+        return
+    }
+    identityExists := err == nil
+
+    // 既存アカウントへの連携
+    if state.LinkUserID != 0 {
+        if identityExists {
+            if identity.UserID != state.LinkUserID {
+                redirectOAuthError(w, r, appBaseURL, "identity_already_linked")
+                return
+            }
+        } else {
+            err = db.CreateUserIdentity(UserIdentity{Provider: oauth.Provider, Subject: info.Subject, UserID: state.LinkUserID, Email: info.Email})
+            if err != nil {
+                requestLogger(r).Error("OAuth callback: failed to link identity", "error", err)
+                redirectOAuthError(w, r, appBaseURL, "server_error")
+                return
+            }
+        }
+        redirectOAuthResult(w, r, appBaseURL, url.Values{"linked": {oauth.Provider}})
+        return
+    }
+
+    var user User
+    if identityExists {
+        user, err = db.GetUserByID(identity.UserID)
+        if err != nil {
+            requestLogger(r).Error("OAuth callback: failed to load user", "error", err)
+            redirectOAuthError(w, r, appBaseURL, "server_error")
+            return
+        }
+    } else {
+        if info.Email == "" {
+            redirectOAuthError(w, r, appBaseURL, "email_required")
+            return
+        }
+
+        // 同じメールアドレスの既存アカウントへ自動で連携するとアカウント乗っ取りにつながるため、
+        // ログイン後に連携してもらう
+        _, err = db.GetUserByEmail(info.Email)
+        if err == nil {
+            redirectOAuthError(w, r, appBaseURL, "account_exists")
+            return
+        }
+        if err != sql.ErrNoRows {
+            requestLogger(r).Error("OAuth callback: failed to look up email", "error", err)
+            redirectOAuthError(w, r, appBaseURL, "server_error")
+            return
+        }
+
+        user, err = db.CreateOAuthUser(info, oauth.Provider)
+        if err != nil {
+            requestLogger(r).Error("OAuth callback: failed to create user", "error", err)
+            redirectOAuthError(w, r, appBaseURL, "server_error")
+            return
+        }
+    }
+
+    // 利用停止中のアカウントはログインできない
+    if user.SuspendedAt.Valid {
+        redirectOAuthError(w, r, appBaseURL, "account_suspended")
+        return
+    }
+
+    // 退会の猶予期間中は、退会を取り消すまでログインできない
+    if isPendingDeletion(user) {
+        redirectOAuthError(w, r, appBaseURL, "account_pending_deletion")
+        return
+    }
+
+    // 二要素認証が有効な場合はチャレンジトークンを渡し、/api/login/2faで続きを行う
+    if user.TOTPEnabled {
+        challengeToken, err := GenerateActionToken(user.ID, user.Email, twoFactorChallengePurpose, tokenLifetimes.TwoFactorChallenge, auth.keys)
+        if err != nil {
+            redirectOAuthError(w, r, appBaseURL, "server_error")
+            return
+        }
+        redirectOAuthResult(w, r, appBaseURL, url.Values{"challenge_token": {challengeToken}})
+        return
+    }
+
+    tokenString, refreshToken, err := startSession(db, r, user, auth.keys)
+    if err != nil {
+        redirectOAuthError(w, r, appBaseURL, "server_error")
+        return
+    }
+
+    // Cookieセッションモードの場合はトークンをCookieに設定し、フラグメントには含めない
+    if auth.cookies != nil {
+        http.SetCookie(w, auth.newCookie(sessionCookieName, tokenString, "/", tokenLifetimes.Access, true))
+        http.SetCookie(w, auth.newCookie(refreshCookieName, refreshToken, "/api", tokenLifetimes.Refresh, true))
+        redirectOAuthResult(w, r, appBaseURL, url.Values{"session": {"cookie"}})
+        return
+    }
+
+    redirectOAuthResult(w, r, appBaseURL, url.Values{
+        "token":         {tokenString},
+        "refresh_token": {refreshToken},
+    })
+}
+
+// link_user_idはログインの場合は0（NULLは許可しない）
+func (db *SQLDatabase) CreateOAuthState(state OAuthState) error {
+    _, err := db.db.Exec("INSERT INTO oauth_states (state, code_verifier, link_user_id, expires_at) VALUES (?, ?, ?, ?)",
+        state.State, state.CodeVerifier, state.LinkUserID, state.ExpiresAt)
+    return err
+}
+
+// stateを取得して削除する（削除できなかった場合は使用済みとしてsql.ErrNoRowsを返す）
+// 取得と削除は1つのトランザクションで行い、同じstateを同時に使われた場合は片方だけが成功する
+func (db *SQLDatabase) ConsumeOAuthState(stateValue string) (OAuthState, error) {
+    var state OAuthState
+    err := db.inTransaction(func(tx *SQLDatabase) error {
+        err := tx.db.QueryRow("SELECT state, code_verifier, link_user_id, expires_at FROM oauth_states WHERE state = ?", stateValue).Scan(
+            &state.State, &state.CodeVerifier, &state.LinkUserID, &state.ExpiresAt)
+        if err != nil {
+            return err
+        }
+
+        res, err := tx.db.Exec("DELETE FROM oauth_states WHERE state = ?", stateValue)
+        if err != nil {
+            return err
+        }
+        rowsAffected, err := res.RowsAffected()
+        if err != nil {
+            return err
+        }
+        if rowsAffected == 0 {
+            return sql.ErrNoRows
+        }
+        return nil
+    })
+    if err != nil {
+        return OAuthState{}, err
+    }
+    return state, nil
+}
+
+func (db *SQLDatabase) GetUserIdentity(provider string, subject string) (UserIdentity, error) {
+    var identity UserIdentity
+    err := db.db.QueryRow("SELECT provider, subject, user_id, email FROM user_identities WHERE provider = ? AND subject = ?", provider, subject).Scan(
+        &identity.Provider, &identity.Subject, &identity.UserID, &identity.Email)
+    if err != nil {
+        return UserIdentity{}, err
+    }
+    return identity, nil
+}
+
+func (db *SQLDatabase) CreateUserIdentity(identity UserIdentity) error {
+    _, err := db.db.Exec("INSERT INTO user_identities (provider, subject, user_id, email) VALUES (?, ?, ?, ?)",
+        identity.Provider, identity.Subject, identity.UserID, identity.Email)
+    return err
+}
+
+// 外部IDで初めてログインしたユーザーを作成する
+// ユーザー・空のプロフィール・外部IDの紐付けを1つのトランザクションで登録する
+func (db *SQLDatabase) CreateOAuthUser(info OAuthUserInfo, provider string) (User, error) {
+    // パスワードでのログインはできないよう、推測不可能なランダム値のハッシュを設定する
+    randomPassword, err := generateRandomToken()
+    if err != nil {
+        return User{}, err
+    }
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+    if err != nil {
+        return User{}, err
+    }
+
+    user := User{Email: info.Email, Password: string(hashedPassword), user_uuid: uuid.NewString(), EmailVerified: info.EmailVerified}
+    err = db.inTransaction(func(tx *SQLDatabase) error {
+        userID, err := tx.CreateUser(user)
+        if err != nil {
+            return err
+        }
+        user.ID = userID
+        if err := tx.CreateProfile(user.ID, Profile{Username: info.Username}); err != nil {
+            return err
+        }
+        return tx.CreateUserIdentity(UserIdentity{Provider: provider, Subject: info.Subject, UserID: user.ID, Email: info.Email})
+    })
+    if err != nil {
+        return User{}, err
+    }
+
+    user.Password = ""
+    return user, nil
+}
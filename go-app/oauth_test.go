@@ -0,0 +1,297 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+// テスト用のスタブプロバイダーを起動する
+// トークンエンドポイントではPKCEのcode_verifierが認可時のcode_challengeと一致するかを検証する
+func setupStubProvider(t *testing.T, challenge *string, userInfo map[string]interface{}) *OAuthConfig {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        if r.Form.Get("code") != "stub-code" || pkceChallenge(r.Form.Get("code_verifier")) != *challenge {
+            w.WriteHeader(http.StatusBadRequest)
+            json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"access_token": "stub-access-token", "token_type": "bearer"})
+    })
+    mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer stub-access-token" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        json.NewEncoder(w).Encode(userInfo)
+    })
+    // GitHubの/user/emailsと同じ形式（EmailsURLを設定したテストのみ使う）
+    mux.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer stub-access-token" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        json.NewEncoder(w).Encode([]map[string]interface{}{
+            {"email": "octocat@users.noreply.github.com", "primary": false, "verified": true},
+            {"email": "unverified@example.com", "primary": true, "verified": false},
+            {"email": "octocat-private@example.com", "primary": true, "verified": true},
+        })
+    })
+    server := httptest.NewServer(mux)
+    t.Cleanup(server.Close)
+
+    return &OAuthConfig{
+        Provider:     "github",
+        ClientID:     "client-id",
+        ClientSecret: "client-secret",
+        AuthorizeURL: server.URL + "/authorize",
+        TokenURL:     server.URL + "/token",
+        UserInfoURL:  server.URL + "/userinfo",
+        RedirectURL:  "http://localhost:8080/api/oauth/callback",
+        Scopes:       []string{"read:user"},
+        HTTPClient:   server.Client(),
+    }
+}
+
+// ログイン開始のリダイレクト先からstateとcode_challengeを、レスポンスからstateのCookieを取り出す
+func startStubLogin(t *testing.T, db *MockDatabase, oauth *OAuthConfig) (OAuthState, string, *http.Cookie) {
+    var saved OAuthState
+    db.EXPECT().CreateOAuthState(gomock.Any()).DoAndReturn(func(state OAuthState) error {
+        saved = state
+        return nil
+    })
+
+    w := httptest.NewRecorder()
+    OAuthLoginHandler(w, httptest.NewRequest("GET", "/api/oauth/login", nil), oauth, db)
+    if w.Code != http.StatusFound {
+        t.Fatalf("Expected status Found, got %v", w.Code)
+    }
+
+    location, _ := url.Parse(w.Header().Get("Location"))
+    query := location.Query()
+    if query.Get("state") != saved.State || query.Get("code_challenge_method") != "S256" {
+        t.Fatalf("Unexpected authorization URL: %v", location)
+    }
+
+    var stateCookie *http.Cookie
+    for _, cookie := range w.Result().Cookies() {
+        if cookie.Name == oauthStateCookieName {
+            stateCookie = cookie
+        }
+    }
+    if stateCookie == nil || !stateCookie.HttpOnly || stateCookie.SameSite != http.SameSiteLaxMode || stateCookie.Path != "/api/oauth/callback" {
+        t.Fatalf("Expected an HttpOnly, SameSite=Lax state cookie, got %+v", stateCookie)
+    }
+    return saved, query.Get("code_challenge"), stateCookie
+}
+
+// stateのCookieを付けたコールバックのリクエストを作成する（cookieがnilの場合は付けない）
+func newCallbackRequest(state string, cookie *http.Cookie) *http.Request {
+    req := httptest.NewRequest("GET", "/api/oauth/callback?code=stub-code&state="+url.QueryEscape(state), nil)
+    if cookie != nil {
+        req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+    }
+    return req
+}
+
+func callbackFragment(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+    location := w.Header().Get("Location")
+    idx := strings.Index(location, "#")
+    if w.Code != http.StatusFound || idx < 0 {
+        t.Fatalf("Expected redirect with fragment, got %v %v", w.Code, location)
+    }
+    values, _ := url.ParseQuery(location[idx+1:])
+    return values
+}
+
+func TestOAuthCallbackCreatesUserOnFirstLogin(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"id": 12345, "login": "octocat", "email": "octocat@example.com"})
+    state, codeChallenge, cookie := startStubLogin(t, db, oauth)
+    challenge = codeChallenge
+
+    db.EXPECT().ConsumeOAuthState(state.State).Return(state, nil)
+    db.EXPECT().GetUserIdentity("github", "12345").Return(UserIdentity{}, sql.ErrNoRows)
+    db.EXPECT().GetUserByEmail("octocat@example.com").Return(User{}, sql.ErrNoRows)
+    db.EXPECT().CreateOAuthUser(gomock.Any(), "github").DoAndReturn(func(info OAuthUserInfo, provider string) (User, error) {
+        if info.Subject != "12345" || info.Username != "octocat" {
+            t.Errorf("Unexpected user info: %+v", info)
+        }
+        return User{ID: 7, Email: info.Email}, nil
+    })
+    db.EXPECT().CreateSession(gomock.Any()).Return(nil)
+    db.EXPECT().CreateRefreshToken(gomock.Any()).Return(nil)
+
+    req := newCallbackRequest(state.State, cookie)
+    w := httptest.NewRecorder()
+    OAuthCallbackHandler(w, req, NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+
+    values := callbackFragment(t, w)
+    claims, err := ValidateToken("Bearer "+values.Get("token"), keys)
+    if err != nil || claims.ID != 7 {
+        t.Errorf("Expected a valid access token for user 7, got error: %v", err)
+    }
+    if values.Get("refresh_token") == "" {
+        t.Errorf("Expected a refresh token")
+    }
+}
+
+// GitHubでメールアドレスを非公開にしている場合も、確認済みのプライマリアドレスで登録する
+func TestOAuthCallbackUsesPrimaryVerifiedEmail(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"id": 12345, "login": "octocat", "email": nil})
+    oauth.EmailsURL = strings.TrimSuffix(oauth.UserInfoURL, "/userinfo") + "/emails"
+    state, codeChallenge, cookie := startStubLogin(t, db, oauth)
+    challenge = codeChallenge
+
+    db.EXPECT().ConsumeOAuthState(state.State).Return(state, nil)
+    db.EXPECT().GetUserIdentity("github", "12345").Return(UserIdentity{}, sql.ErrNoRows)
+    db.EXPECT().GetUserByEmail("octocat-private@example.com").Return(User{}, sql.ErrNoRows)
+    db.EXPECT().CreateOAuthUser(gomock.Any(), "github").DoAndReturn(func(info OAuthUserInfo, provider string) (User, error) {
+        if info.Email != "octocat-private@example.com" || !info.EmailVerified {
+            t.Errorf("Expected the primary verified email, got %+v", info)
+        }
+        return User{ID: 7, Email: info.Email}, nil
+    })
+    db.EXPECT().CreateSession(gomock.Any()).Return(nil)
+    db.EXPECT().CreateRefreshToken(gomock.Any()).Return(nil)
+
+    req := newCallbackRequest(state.State, cookie)
+    w := httptest.NewRecorder()
+    OAuthCallbackHandler(w, req, NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+
+    if values := callbackFragment(t, w); values.Get("token") == "" {
+        t.Errorf("Expected an access token, got %v", values)
+    }
+}
+
+func TestOAuthCallbackDoesNotAutoLinkExistingEmail(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"sub": "abc", "email": "test2@example.com"})
+    state, codeChallenge, cookie := startStubLogin(t, db, oauth)
+    challenge = codeChallenge
+
+    db.EXPECT().ConsumeOAuthState(state.State).Return(state, nil)
+    db.EXPECT().GetUserIdentity("github", "abc").Return(UserIdentity{}, sql.ErrNoRows)
+    db.EXPECT().GetUserByEmail("test2@example.com").Return(User{ID: 2, Email: "test2@example.com"}, nil)
+
+    req := newCallbackRequest(state.State, cookie)
+    w := httptest.NewRecorder()
+    OAuthCallbackHandler(w, req, NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+
+    if values := callbackFragment(t, w); values.Get("error") != "account_exists" {
+        t.Errorf("Expected error 'account_exists', got %v", values)
+    }
+}
+
+func TestOAuthCallbackLinksIdentityToLoggedInUser(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"sub": "abc", "email": "test2@example.com"})
+
+    verifier, _ := generateRandomToken()
+    challenge = pkceChallenge(verifier)
+    state := OAuthState{State: "link-state", CodeVerifier: verifier, LinkUserID: 2, ExpiresAt: time.Now().Add(time.Minute)}
+
+    db.EXPECT().ConsumeOAuthState("link-state").Return(state, nil)
+    db.EXPECT().GetUserIdentity("github", "abc").Return(UserIdentity{}, sql.ErrNoRows)
+    db.EXPECT().CreateUserIdentity(UserIdentity{Provider: "github", Subject: "abc", UserID: 2, Email: "test2@example.com"}).Return(nil)
+
+    req := newCallbackRequest("link-state", &http.Cookie{Name: oauthStateCookieName, Value: hashToken("link-state")})
+    w := httptest.NewRecorder()
+    OAuthCallbackHandler(w, req, NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+
+    if values := callbackFragment(t, w); values.Get("linked") != "github" {
+        t.Errorf("Expected identity to be linked, got %v", values)
+    }
+}
+
+func TestOAuthCallbackRejectsExpiredState(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"sub": "abc"})
+    state := OAuthState{State: "old-state", CodeVerifier: "verifier", ExpiresAt: time.Now().Add(-time.Minute)}
+    db.EXPECT().ConsumeOAuthState("old-state").Return(state, nil)
+
+    req := newCallbackRequest("old-state", &http.Cookie{Name: oauthStateCookieName, Value: hashToken("old-state")})
+    w := httptest.NewRecorder()
+    OAuthCallbackHandler(w, req, NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+
+    if values := callbackFragment(t, w); values.Get("error") != "invalid_state" {
+        t.Errorf("Expected error 'invalid_state', got %v", values)
+    }
+}
+
+// 認可を開始していないブラウザ（stateのCookieがない・一致しない）ではコールバックを受け付けない
+func TestOAuthCallbackRejectsStateFromAnotherBrowser(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"sub": "abc"})
+
+    for _, cookie := range []*http.Cookie{nil, {Name: oauthStateCookieName, Value: hashToken("other-state")}} {
+        w := httptest.NewRecorder()
+        OAuthCallbackHandler(w, newCallbackRequest("attacker-state", cookie), NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+
+        if values := callbackFragment(t, w); values.Get("error") != "invalid_state" {
+            t.Errorf("Expected error 'invalid_state', got %v", values)
+        }
+    }
+}
+
+// ログインの開始からコールバックまでを実際のデータベース（SQLite）で行う
+func TestOAuthLoginFlowWithSQLite(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+    _, keys := setupMock(t)
+
+    var challenge string
+    oauth := setupStubProvider(t, &challenge, map[string]interface{}{"id": 12345, "login": "octocat", "email": "octocat@example.com"})
+
+    w := httptest.NewRecorder()
+    OAuthLoginHandler(w, httptest.NewRequest("GET", "/api/oauth/login", nil), oauth, db)
+    if w.Code != http.StatusFound {
+        t.Fatalf("Expected status Found, got %v: %s", w.Code, w.Body.String())
+    }
+    location, _ := url.Parse(w.Header().Get("Location"))
+    state := location.Query().Get("state")
+    challenge = location.Query().Get("code_challenge")
+    var cookie *http.Cookie
+    for _, c := range w.Result().Cookies() {
+        if c.Name == oauthStateCookieName {
+            cookie = c
+        }
+    }
+
+    w = httptest.NewRecorder()
+    OAuthCallbackHandler(w, newCallbackRequest(state, cookie), NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+    values := callbackFragment(t, w)
+    if claims, err := ValidateToken("Bearer "+values.Get("token"), keys); err != nil || claims.ID != 1 {
+        t.Fatalf("Expected a valid access token for the new user, got %v (%v)", values, err)
+    }
+    if identity, err := db.GetUserIdentity("github", "12345"); err != nil || identity.UserID != 1 {
+        t.Errorf("Unexpected identity: %+v (%v)", identity, err)
+    }
+
+    // stateは一度しか使えない
+    w = httptest.NewRecorder()
+    OAuthCallbackHandler(w, newCallbackRequest(state, cookie), NewAuthenticator(keys, db), oauth, db, "http://localhost:3000")
+    if values := callbackFragment(t, w); values.Get("error") != "invalid_state" {
+        t.Errorf("Expected error 'invalid_state', got %v", values)
+    }
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+
+// パスワードの最小文字数
+const minPasswordLength = 8
+
+// password_reset_tokensテーブルの1レコード
+type PasswordResetToken struct {
+    ID        int
+    UserID    int
+    TokenHash string
+    ExpiresAt time.Time
+    UsedAt    sql.NullTime
+}
+
+type ForgotPasswordRequest struct {
+    Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+    Token    string `json:"token"`
+    Password string `json:"password"`
+}
+
+// パスワードリセットの申請：リセット用リンクをメールで送信する
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request, db Database, mailer Mailer, appBaseURL string) {
+    var req ForgotPasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    // 登録済みかどうかに関わらず同じレスポンスを返し、メールアドレスの存在を漏らさない
+    response := ResponseData{Message: "If the email address is registered, a password reset link has been sent"}
+
+    user, err := db.GetUserByEmail(req.Email)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(response)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+
+    token, err := generateRandomToken()
+    if err != nil {
+        serverError(w, r, "Error generating reset token", err)
+        return
+    }
+
+    err = db.CreatePasswordResetToken(PasswordResetToken{
+        UserID:    user.ID,
+        TokenHash: hashToken(token),
+        ExpiresAt: time.Now().Add(tokenLifetimes.PasswordReset),
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    resetURL := appBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+    body := fmt.Sprintf("パスワードの再設定が申請されました。\n以下のリンクから%d分以内に新しいパスワードを設定してください。\n\n%s\n\nこのメールに心当たりがない場合は破棄してください。",
+        int(tokenLifetimes.PasswordReset.Minutes()), resetURL)
+    if err := mailer.Send(user.Email, "【CCGallery】パスワード再設定のご案内", body); err != nil {
+        requestLogger(r).Error("Failed to send password reset email", "target_user_id", user.ID, "error", err)
+        writeError(w, r, http.StatusInternalServerError, ErrCodeEmailDeliveryFailed)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
+
+// パスワードの再設定：トークンを検証して新しいパスワードを保存する
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    var req ResetPasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    if len(req.Password) < minPasswordLength {
+        writeFieldErrors(w, r, newFieldError("password", FieldErrTooShort, minPasswordLength))
+        return
+    }
+
+    stored, err := db.GetPasswordResetTokenByHash(hashToken(req.Token))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidResetToken)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+
+    if stored.UsedAt.Valid || time.Now().After(stored.ExpiresAt) {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidResetToken)
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+    if err != nil {
+        serverError(w, r, "Error while hashing password", err)
+        return
+    }
+
+    // トークンの使用・パスワードの更新・既存のログインセッションの無効化はまとめて行う
+    var marked bool
+    err = db.Transaction(func(tx Database) error {
+        // トークンを使用済みにする（同時リクエストで先に使われていた場合は無効）
+        var err error
+        if marked, err = tx.MarkPasswordResetTokenUsed(stored.ID); err != nil || !marked {
+            return err
+        }
+        if err := tx.UpdateUserPassword(stored.UserID, string(hashedPassword)); err != nil {
+            return err
+        }
+        return tx.RevokeUserSessions(stored.UserID, "")
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    if !marked {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidResetToken)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{
+        Message: "Password has been reset",
+    })
+}
+
+func (db *SQLDatabase) CreatePasswordResetToken(token PasswordResetToken) error {
+    _, err := db.db.Exec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+        token.UserID, token.TokenHash, token.ExpiresAt)
+    return err
+}
+
+func (db *SQLDatabase) GetPasswordResetTokenByHash(tokenHash string) (PasswordResetToken, error) {
+    var token PasswordResetToken
+    err := db.db.QueryRow("SELECT id, user_id, token_hash, expires_at, used_at FROM password_reset_tokens WHERE token_hash = ?", tokenHash).Scan(
+        &token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &token.UsedAt)
+    if err != nil {
+        return PasswordResetToken{}, err
+    }
+    return token, nil
+}
+
+// 未使用のトークンのみを使用済みに更新し、更新できたかどうかを返す
+func (db *SQLDatabase) MarkPasswordResetTokenUsed(id int) (bool, error) {
+    res, err := db.db.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now(), id)
+    if err != nil {
+        return false, err
+    }
+    rowsAffected, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected == 1, nil
+}
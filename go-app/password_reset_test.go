@@ -0,0 +1,113 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+    "golang.org/x/crypto/bcrypt"
+)
+
+func TestForgotPasswordHandlerSendsResetLink(t *testing.T) {
+    db, _ := setupMock(t)
+    mailer := &MemoryMailer{}
+
+    var storedHash string
+    db.EXPECT().GetUserByEmail("test2@example.com").Return(User{ID: 2, Email: "test2@example.com"}, nil)
+    db.EXPECT().CreatePasswordResetToken(gomock.Any()).DoAndReturn(func(token PasswordResetToken) error {
+        storedHash = token.TokenHash
+        return nil
+    })
+
+    body, _ := json.Marshal(ForgotPasswordRequest{Email: "test2@example.com"})
+    req := httptest.NewRequest("POST", "/api/password/forgot", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    ForgotPasswordHandler(w, req, db, mailer, "http://localhost:3000")
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status OK, got %v", w.Code)
+    }
+
+    msg, ok := mailer.Last()
+    if !ok {
+        t.Fatalf("Expected a reset email to be sent")
+    }
+    if msg.To != "test2@example.com" {
+        t.Errorf("Expected email to 'test2@example.com', got '%v'", msg.To)
+    }
+
+    // メール本文のトークンとDBに保存されたハッシュが対応していること
+    idx := strings.Index(msg.Body, "token=")
+    if idx < 0 {
+        t.Fatalf("Reset link not found in email body: %v", msg.Body)
+    }
+    token := strings.Fields(msg.Body[idx+len("token="):])[0]
+    if hashToken(token) != storedHash {
+        t.Errorf("Token in email does not match stored hash")
+    }
+}
+
+func TestForgotPasswordHandlerUnknownEmail(t *testing.T) {
+    db, _ := setupMock(t)
+    mailer := &MemoryMailer{}
+
+    db.EXPECT().GetUserByEmail("unknown@example.com").Return(User{}, sql.ErrNoRows)
+
+    body, _ := json.Marshal(ForgotPasswordRequest{Email: "unknown@example.com"})
+    req := httptest.NewRequest("POST", "/api/password/forgot", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    ForgotPasswordHandler(w, req, db, mailer, "http://localhost:3000")
+
+    // 未登録でも同じレスポンスを返し、メールは送信しない
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status OK, got %v", w.Code)
+    }
+    if _, ok := mailer.Last(); ok {
+        t.Errorf("Did not expect an email to be sent")
+    }
+}
+
+func TestResetPasswordHandlerUpdatesPassword(t *testing.T) {
+    db, _ := setupMock(t)
+
+    stored := PasswordResetToken{ID: 5, UserID: 2, TokenHash: hashToken("reset-token"), ExpiresAt: time.Now().Add(time.Hour)}
+    db.EXPECT().GetPasswordResetTokenByHash(hashToken("reset-token")).Return(stored, nil)
+    expectTransaction(db)
+    db.EXPECT().MarkPasswordResetTokenUsed(5).Return(true, nil)
+    db.EXPECT().UpdateUserPassword(2, gomock.Any()).DoAndReturn(func(userID int, hashedPassword string) error {
+        if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte("brand-new-password")); err != nil {
+            t.Errorf("Stored password hash does not match the new password")
+        }
+        return nil
+    })
+    db.EXPECT().RevokeUserSessions(2, "").Return(nil)
+
+    body, _ := json.Marshal(ResetPasswordRequest{Token: "reset-token", Password: "brand-new-password"})
+    req := httptest.NewRequest("POST", "/api/password/reset", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    ResetPasswordHandler(w, req, db)
+
+    verifyResponse(t, w, http.StatusOK, "Password has been reset", false)
+}
+
+func TestResetPasswordHandlerRejectsUsedToken(t *testing.T) {
+    db, _ := setupMock(t)
+
+    stored := PasswordResetToken{ID: 5, UserID: 2, ExpiresAt: time.Now().Add(time.Hour), UsedAt: sql.NullTime{Time: time.Now(), Valid: true}}
+    db.EXPECT().GetPasswordResetTokenByHash(hashToken("reset-token")).Return(stored, nil)
+
+    body, _ := json.Marshal(ResetPasswordRequest{Token: "reset-token", Password: "brand-new-password"})
+    req := httptest.NewRequest("POST", "/api/password/reset", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    ResetPasswordHandler(w, req, db)
+
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("Expected status Bad Request, got %v", w.Code)
+    }
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// パーソナルアクセストークンのスコープ
+const (
+    ScopePortfolioRead  = "portfolio:read"
+    ScopePortfolioWrite = "portfolio:write"
+    ScopeImageWrite     = "image:write"
+    ScopeProfileWrite   = "profile:write"
+)
+
+var validScopes = []string{ScopePortfolioRead, ScopePortfolioWrite, ScopeImageWrite, ScopeProfileWrite}
+
+// トークン文字列の形式: ccg_<識別用の16進8文字>_<シークレット>
+const (
+    personalAccessTokenPrefix       = "ccg_"
+    personalAccessTokenPrefixLength = len(personalAccessTokenPrefix) + 8
+)
+
+// last_used_atを更新する最小間隔（リクエストごとの書き込みを避ける）
+const tokenLastUsedInterval = 1 * time.Minute
+
+// personal_access_tokensテーブルの1レコード
+type PersonalAccessToken struct {
+    ID            int        `json:"id"`
+    UserID        int        `json:"-"`
+    Name          string     `json:"name"`
+    Prefix        string     `json:"prefix"`
+    TokenHash     string     `json:"-"`
+    Scopes        []string   `json:"scopes"`
+    ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+    LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+    Revoked       bool       `json:"-"`
+    UserSuspended bool       `json:"-"` // 所有ユーザーが利用停止されているかどうか
+    UserDeleting  bool       `json:"-"` // 所有ユーザーが退会の猶予期間中かどうか
+}
+
+type CreateTokenRequest struct {
+    Name          string   `json:"name"`
+    Scopes        []string `json:"scopes"`
+    ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0の場合は無期限
+}
+
+type CreateTokenResponse struct {
+    Token string `json:"token"` // 平文のトークンは作成時のみ返す
+    PersonalAccessToken
+}
+
+func isValidScope(scope string) bool {
+    for _, s := range validScopes {
+        if s == scope {
+            return true
+        }
+    }
+    return false
+}
+
+// 新しいトークン文字列と、その識別用プレフィックスを生成する
+func generatePersonalAccessToken() (string, string, error) {
+    b := make([]byte, 4)
+    if _, err := rand.Read(b); err != nil {
+        return "", "", err
+    }
+    prefix := personalAccessTokenPrefix + hex.EncodeToString(b)
+
+    secret, err := generateRandomToken()
+    if err != nil {
+        return "", "", err
+    }
+    return prefix + "_" + secret, prefix, nil
+}
+
+func isPersonalAccessToken(token string) bool {
+    return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// トークン文字列を検証し、有効であれば所有ユーザーとスコープを含むClaimsを返す
+func validatePersonalAccessToken(db Database, token string) (*Claims, error) {
+    // シークレット部分にも"_"が含まれうるため、固定長のプレフィックスで切り出す
+    if len(token) <= personalAccessTokenPrefixLength || token[personalAccessTokenPrefixLength] != '_' {
+        return nil, errors.New("Invalid token")
+    }
+
+    stored, err := db.GetPersonalAccessTokenByPrefix(token[:personalAccessTokenPrefixLength])
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, errors.New("Invalid token")
+        }
+        return nil, err
+    }
+
+    if subtle.ConstantTimeCompare([]byte(stored.TokenHash), []byte(hashToken(token))) != 1 {
+        return nil, errors.New("Invalid token")
+    }
+    if stored.Revoked {
+        return nil, errors.New("Token has been revoked")
+    }
+    if stored.ExpiresAt != nil && time.Now().After(*stored.ExpiresAt) {
+        return nil, errors.New("Token has expired")
+    }
+    if stored.UserSuspended {
+        return nil, ErrAccountSuspended
+    }
+    // 退会を申請したユーザーのトークンは、退会を取り消すまで使えない
+    if stored.UserDeleting {
+        return nil, ErrAccountPendingDeletion
+    }
+
+    if err := db.TouchPersonalAccessToken(stored.ID, time.Now()); err != nil {
+        return nil, err
+    }
+
+    return &Claims{ID: stored.UserID, Scopes: stored.Scopes}, nil
+}
+
+// パーソナルアクセストークンの一覧
+// トークンの管理にはトークン自身ではなく、ログインセッションのJWTが必要
+func ListPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    tokens, err := db.ListPersonalAccessTokens(claims.ID)
+    if err != nil {
+        serverError(w, r, "Database query failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(tokens)
+}
+
+// パーソナルアクセストークンの作成（トークン本体は作成時のみ返す）
+func CreatePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    var req CreateTokenRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+    defer r.Body.Close()
+
+    details := validateFields(check("name", req.Name, required()))
+    if len(req.Scopes) == 0 {
+        details = append(details, newFieldError("scopes", FieldErrRequired))
+    }
+    for _, scope := range req.Scopes {
+        if !isValidScope(scope) {
+            details = append(details, newFieldError("scopes", FieldErrUnknownScope, scope))
+            break
+        }
+    }
+    if req.ExpiresInDays < 0 {
+        details = append(details, newFieldError("expires_in_days", FieldErrNegative))
+    }
+    if len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
+
+    token, prefix, err := generatePersonalAccessToken()
+    if err != nil {
+        serverError(w, r, "Error generating token", err)
+        return
+    }
+
+    pat := PersonalAccessToken{
+        UserID:    claims.ID,
+        Name:      strings.TrimSpace(req.Name),
+        Prefix:    prefix,
+        TokenHash: hashToken(token),
+        Scopes:    req.Scopes,
+        CreatedAt: time.Now(),
+    }
+    if req.ExpiresInDays > 0 {
+        expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+        pat.ExpiresAt = &expiresAt
+    }
+
+    pat.ID, err = db.CreatePersonalAccessToken(pat)
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(CreateTokenResponse{Token: token, PersonalAccessToken: pat})
+}
+
+// パーソナルアクセストークンの失効（DELETE /api/tokens/{id}）
+func RevokePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    tokenID, err := strconv.Atoi(pathParam(r, "id", "id"))
+    if err != nil {
+        writeFieldErrors(w, r, newFieldError("id", FieldErrRequired))
+        return
+    }
+
+    revoked, err := db.RevokePersonalAccessToken(tokenID, claims.ID)
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    if !revoked {
+        writeError(w, r, http.StatusNotFound, ErrCodeTokenNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+    if !t.Valid {
+        return nil
+    }
+    return &t.Time
+}
+
+func (db *SQLDatabase) CreatePersonalAccessToken(token PersonalAccessToken) (int, error) {
+    var expiresAt sql.NullTime
+    if token.ExpiresAt != nil {
+        expiresAt = sql.NullTime{Time: *token.ExpiresAt, Valid: true}
+    }
+    id, err := db.db.InsertID("INSERT INTO personal_access_tokens (user_id, name, prefix, token_hash, scopes, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+        token.UserID, token.Name, token.Prefix, token.TokenHash, strings.Join(token.Scopes, " "), expiresAt, token.CreatedAt)
+    return int(id), err
+}
+
+func (db *SQLDatabase) GetPersonalAccessTokenByPrefix(prefix string) (PersonalAccessToken, error) {
+    var token PersonalAccessToken
+    var scopes string
+    var expiresAt, lastUsedAt, revokedAt sql.NullTime
+    err := db.db.QueryRow(`SELECT t.id, t.user_id, t.name, t.prefix, t.token_hash, t.scopes, t.expires_at, t.last_used_at, t.created_at, t.revoked_at, u.suspended_at IS NOT NULL, u.deletion_requested_at IS NOT NULL
+        FROM personal_access_tokens t JOIN users u ON u.id = t.user_id WHERE t.prefix = ?`, prefix).Scan(
+        &token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash, &scopes, &expiresAt, &lastUsedAt, &token.CreatedAt, &revokedAt, &token.UserSuspended, &token.UserDeleting)
+    if err != nil {
+        return PersonalAccessToken{}, err
+    }
+    token.Scopes = strings.Fields(scopes)
+    token.ExpiresAt = nullTimePtr(expiresAt)
+    token.LastUsedAt = nullTimePtr(lastUsedAt)
+    token.Revoked = revokedAt.Valid
+    return token, nil
+}
+
+// 失効していないトークンの一覧を返す（ハッシュは含まない）
+func (db *SQLDatabase) ListPersonalAccessTokens(userID int) ([]PersonalAccessToken, error) {
+    rows, err := db.db.Query("SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at FROM personal_access_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC", userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    tokens := []PersonalAccessToken{}
+    for rows.Next() {
+        token := PersonalAccessToken{UserID: userID}
+        var scopes string
+        var expiresAt, lastUsedAt sql.NullTime
+        if err := rows.Scan(&token.ID, &token.Name, &token.Prefix, &scopes, &expiresAt, &lastUsedAt, &token.CreatedAt); err != nil {
+            return nil, err
+        }
+        token.Scopes = strings.Fields(scopes)
+        token.ExpiresAt = nullTimePtr(expiresAt)
+        token.LastUsedAt = nullTimePtr(lastUsedAt)
+        tokens = append(tokens, token)
+    }
+    return tokens, rows.Err()
+}
+
+// 最終使用日時を更新する（前回の更新から一定時間内であれば書き込まない）
+func (db *SQLDatabase) TouchPersonalAccessToken(id int, usedAt time.Time) error {
+    _, err := db.db.Exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+        usedAt, id, usedAt.Add(-tokenLastUsedInterval))
+    return err
+}
+
+func (db *SQLDatabase) RevokePersonalAccessToken(id int, userID int) (bool, error) {
+    res, err := db.db.Exec("UPDATE personal_access_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", time.Now(), id, userID)
+    if err != nil {
+        return false, err
+    }
+    rowsAffected, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected == 1, nil
+}
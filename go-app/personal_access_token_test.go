@@ -0,0 +1,159 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+// テスト用のトークンと、それに対応する保存済みレコードを作成する
+func setupPersonalAccessToken(t *testing.T, scopes []string) (string, PersonalAccessToken) {
+    token, prefix, err := generatePersonalAccessToken()
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+    return token, PersonalAccessToken{ID: 3, UserID: 2, Prefix: prefix, TokenHash: hashToken(token), Scopes: scopes}
+}
+
+func newTokenRequest(token string) *http.Request {
+    req := httptest.NewRequest("GET", "/api/portfolios", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    return req
+}
+
+func TestAuthenticateWithPersonalAccessToken(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := NewAuthenticator(keys, db)
+
+    token, stored := setupPersonalAccessToken(t, []string{ScopePortfolioRead})
+    db.EXPECT().GetPersonalAccessTokenByPrefix(stored.Prefix).Return(stored, nil).Times(2)
+    db.EXPECT().TouchPersonalAccessToken(3, gomock.Any()).Return(nil).Times(2)
+
+    claims, err := auth.Authenticate(newTokenRequest(token), ScopePortfolioRead)
+    if err != nil {
+        t.Fatalf("Valid token was not accepted: %v", err)
+    }
+    if claims.ID != 2 {
+        t.Errorf("Expected user ID 2, got %v", claims.ID)
+    }
+
+    // スコープが足りない場合は403相当のエラー
+    _, err = auth.Authenticate(newTokenRequest(token), ScopePortfolioWrite)
+    if err != ErrInsufficientScope {
+        t.Errorf("Expected ErrInsufficientScope, got %v", err)
+    }
+}
+
+func TestAuthenticateRejectsInvalidPersonalAccessTokens(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := NewAuthenticator(keys, db)
+
+    token, stored := setupPersonalAccessToken(t, []string{ScopePortfolioRead})
+
+    // プレフィックスが一致してもシークレットが異なる場合
+    db.EXPECT().GetPersonalAccessTokenByPrefix(stored.Prefix).Return(stored, nil)
+    if _, err := auth.Authenticate(newTokenRequest(stored.Prefix+"_wrong-secret"), ScopePortfolioRead); err == nil {
+        t.Errorf("Token with wrong secret was accepted")
+    }
+
+    // 失効済みのトークン
+    revoked := stored
+    revoked.Revoked = true
+    db.EXPECT().GetPersonalAccessTokenByPrefix(stored.Prefix).Return(revoked, nil)
+    if _, err := auth.Authenticate(newTokenRequest(token), ScopePortfolioRead); err == nil {
+        t.Errorf("Revoked token was accepted")
+    }
+
+    // 期限切れのトークン
+    expired := stored
+    expiresAt := time.Now().Add(-time.Hour)
+    expired.ExpiresAt = &expiresAt
+    db.EXPECT().GetPersonalAccessTokenByPrefix(stored.Prefix).Return(expired, nil)
+    if _, err := auth.Authenticate(newTokenRequest(token), ScopePortfolioRead); err == nil {
+        t.Errorf("Expired token was accepted")
+    }
+
+    // 退会の猶予期間中のユーザーのトークン
+    deleting := stored
+    deleting.UserDeleting = true
+    db.EXPECT().GetPersonalAccessTokenByPrefix(stored.Prefix).Return(deleting, nil)
+    if _, err := auth.Authenticate(newTokenRequest(token), ScopePortfolioRead); err != ErrAccountPendingDeletion {
+        t.Errorf("Expected ErrAccountPendingDeletion, got %v", err)
+    }
+}
+
+func TestCreatePersonalAccessTokenHandler(t *testing.T) {
+    db, keys := setupMock(t)
+
+    var stored PersonalAccessToken
+    db.EXPECT().CreatePersonalAccessToken(gomock.Any()).DoAndReturn(func(token PersonalAccessToken) (int, error) {
+        stored = token
+        return 3, nil
+    })
+
+    accessToken, _ := GenerateJWT(2, "test2@example.com", keys)
+    body, _ := json.Marshal(CreateTokenRequest{Name: "CI", Scopes: []string{ScopePortfolioWrite}, ExpiresInDays: 30})
+    req := httptest.NewRequest("POST", "/api/tokens", bytes.NewReader(body))
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected status Created, got %v", w.Code)
+    }
+
+    var response CreateTokenResponse
+    json.NewDecoder(w.Body).Decode(&response)
+    if !strings.HasPrefix(response.Token, response.Prefix+"_") {
+        t.Errorf("Token '%v' does not start with prefix '%v'", response.Token, response.Prefix)
+    }
+    // 平文は保存せず、ハッシュのみ保存する
+    if stored.TokenHash != hashToken(response.Token) || stored.UserID != 2 {
+        t.Errorf("Stored token does not match the returned token")
+    }
+    if stored.ExpiresAt == nil {
+        t.Errorf("Expected expiry to be set")
+    }
+}
+
+func TestPersonalAccessTokenRoutesRejectPersonalAccessToken(t *testing.T) {
+    db, keys := setupMock(t)
+
+    // トークンの管理はパーソナルアクセストークン自身では行えない
+    token, _ := setupPersonalAccessToken(t, []string{ScopePortfolioWrite})
+    req := httptest.NewRequest("GET", "/api/tokens", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+}
+
+func TestCreatePersonalAccessTokenHandlerRejectsUnknownScope(t *testing.T) {
+    db, keys := setupMock(t)
+
+    accessToken, _ := GenerateJWT(2, "test2@example.com", keys)
+    body, _ := json.Marshal(CreateTokenRequest{Name: " ", Scopes: []string{"admin"}, ExpiresInDays: -1})
+    req := httptest.NewRequest("POST", "/api/tokens", bytes.NewReader(body))
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    // 不正な項目はすべてまとめて返す
+    response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    got := map[string]string{}
+    for _, detail := range response.Error.Details {
+        got[detail.Field] = detail.Code
+    }
+    if len(got) != 3 || got["name"] != FieldErrRequired || got["scopes"] != FieldErrUnknownScope || got["expires_in_days"] != FieldErrNegative {
+        t.Errorf("Unexpected field errors: %+v", response.Error.Details)
+    }
+}
@@ -3,9 +3,9 @@ package main
 import (
     "database/sql"
     "encoding/json"
-    "fmt"
     "net/http"
     "strings"
+    "unicode/utf8"
     // "time"
     // "os"
     "github.com/google/uuid"
@@ -24,195 +24,210 @@ type Portfolio struct {
     PortfolioUUID string `json:"portfolio_uuid,omitempty"`
 }
 
+// ポートフォリオの作成・更新で受け付けるリクエストボディの上限
+// 本文はすべて全角文字の場合もあるため、文字数の上限よりも十分大きくする
+const maxPortfolioBodyBytes = 1 << 20
+
+// ポートフォリオの入力値を検証する
+func (p Portfolio) validate() []FieldError {
+    return validateFields(
+        check("title", p.Title, required(), maxLength(100)),
+        check("subtitle", p.Subtitle, maxLength(200)),
+        check("thumbnail", p.Thumbnail, maxLength(2048)),
+        check("github_repo_url", p.GithubRepoURL, maxLength(2048), urlOnHosts("github.com")),
+        check("content", p.Content, maxLength(100000)),
+        check("tags", p.Tags, maxLength(500)),
+        // 0: 非公開、1: 公開、2: 限定公開
+        check("status", p.Status, required(), oneOf("0", "1", "2")),
+    )
+}
 
 
-func PortfolioHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
-    EnableCORS(w)
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
 
-    // AuthorizationヘッダーからJWTトークンを検証
-    claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
+// 公開前にメールアドレスの確認が済んでいるかをチェックする
+func isEmailVerified(db Database, userID int) (bool, error) {
+    user, err := db.GetUserByID(userID)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
-        return
+        return false, err
     }
+    return user.EmailVerified, nil
+}
 
-    db, err := OpenDatabase()
+// requireVerifiedEmailがtrueの場合、メールアドレス未確認のユーザーは公開・限定公開にできない
+// 公開できない場合はエラーレスポンスを書き込んでfalseを返す
+func checkPublishingAllowed(w http.ResponseWriter, r *http.Request, db Database, userID int, status string, requireVerifiedEmail bool) bool {
+    if !requireVerifiedEmail || !isPublishingStatus(status) {
+        return true
+    }
+    verified, err := isEmailVerified(db, userID)
     if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
+        serverError(w, r, "Database query failed", err)
+        return false
     }
-    defer db.Close()
+    if !verified {
+        writeError(w, r, http.StatusForbidden, ErrCodeEmailNotVerified)
+        return false
+    }
+    return true
+}
 
-    switch r.Method {
-    case http.MethodGet:
-        portfolioUUID := r.URL.Query().Get("id")
-        if portfolioUUID == "" {
-            http.Error(w, "Portfolio UUID is required", http.StatusBadRequest)
-            return
-        }
+// 自分のポートフォリオの取得（非公開のものを含む、portfolio:readのスコープが必要）
+func GetPortfolioHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    claims := requestClaims(r)
 
-        sqlStmt := `SELECT title, subtitle, thumbnail, github_repo_url, content, tags, status, updated_at FROM Portfolio WHERE portfolio_uuid=? AND user_id=?`
-        var portfolio Portfolio
-        err = db.QueryRow(sqlStmt, portfolioUUID, claims.ID).Scan(&portfolio.Title, &portfolio.Subtitle, &portfolio.Thumbnail, &portfolio.GithubRepoURL, &portfolio.Content, &portfolio.Tags, &portfolio.Status, &portfolio.UpdatedAt)
-        if err != nil {
-            // レコードが見つからない場合はNotFoundエラーを返す
-            if err == sql.ErrNoRows {
-                http.Error(w, "No portfolio found with the provided UUID for the user", http.StatusNotFound)
-            } else {
-                http.Error(w, "Database query failed", http.StatusInternalServerError)
-            }
-            return
-        }
+    portfolioUUID := pathParam(r, "uuid", "id")
+    if portfolioUUID == "" {
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
+        return
+    }
 
-        // 成功レスポンスを返送
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(portfolio)
-
-    case http.MethodPost:
-        var portfolio Portfolio
-        err = json.NewDecoder(r.Body).Decode(&portfolio)
-        if err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
-            return
+    portfolio, err := db.GetPortfolio(portfolioUUID, claims.ID)
+    if err != nil {
+        // レコードが見つからない場合はNotFoundエラーを返す
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusNotFound, ErrCodePortfolioNotFound)
+        } else {
+            serverError(w, r, "Database query failed", err)
         }
-        defer r.Body.Close()
-
-        // 新しいUUIDを生成
-        portfolioUUID := uuid.NewString()
+        return
+    }
 
-        // データベースに新しいポートフォリオを挿入するSQL文を準備
-        sqlStmt := `INSERT INTO Portfolio (user_id, title, subtitle, thumbnail, github_repo_url, content, tags, status, portfolio_uuid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-        _, err = db.Exec(sqlStmt, claims.ID, portfolio.Title, portfolio.Subtitle, portfolio.Thumbnail, portfolio.GithubRepoURL, portfolio.Content, portfolio.Tags, portfolio.Status, portfolioUUID)
-        if err != nil {
-            http.Error(w, "Database execution failed", http.StatusInternalServerError)
-            return
-        }
+    // 成功レスポンスを返送
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(portfolio)
+}
 
-        // 成功レスポンスを返送
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(http.StatusCreated)
-        json.NewEncoder(w).Encode(map[string]interface{}{
-            "portfolio_uuid": portfolioUUID, // 新しく生成されたUUIDをレスポンスに含める
-        })
+// ポートフォリオの作成（portfolio:writeのスコープが必要）
+func CreatePortfolioHandler(w http.ResponseWriter, r *http.Request, db Database, requireVerifiedEmail bool) {
+    claims := requestClaims(r)
 
-    case http.MethodPut:
-        // UUIDをクエリパラメータから取得
-        portfolioUUID := r.URL.Query().Get("id")
-        if portfolioUUID == "" {
-            http.Error(w, "Portfolio UUID is required", http.StatusBadRequest)
-            return
-        }
+    var portfolio Portfolio
+    if !decodeJSONBody(w, r, &portfolio, maxPortfolioBodyBytes) {
+        return
+    }
+    if details := portfolio.validate(); len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
 
-        // リクエストボディからポートフォリオデータを読み取り
-        var portfolio Portfolio
-        err = json.NewDecoder(r.Body).Decode(&portfolio)
-        if err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
-            return
-        }
-        defer r.Body.Close()
-
-        // データベースを更新
-        sqlStmt := `UPDATE Portfolio SET title=?, subtitle=?, thumbnail=?, github_repo_url=?, content=?, tags=?, status=? WHERE portfolio_uuid=? AND user_id=?`
-        res, err := db.Exec(sqlStmt, portfolio.Title, portfolio.Subtitle, portfolio.Thumbnail, portfolio.GithubRepoURL, portfolio.Content, portfolio.Tags, portfolio.Status, portfolioUUID, claims.ID)
-        if err != nil {
-            http.Error(w, "Database execution failed", http.StatusInternalServerError)
-            return
-        }
+    if !checkPublishingAllowed(w, r, db, claims.ID, portfolio.Status, requireVerifiedEmail) {
+        return
+    }
 
-        // 影響を受けた行数を確認
-        rowsAffected, err := res.RowsAffected()
-        if err != nil {
-            http.Error(w, "Error checking affected rows", http.StatusInternalServerError)
-            return
-        }
+    // 新しいUUIDを生成
+    portfolioUUID := uuid.NewString()
+    portfolio.PortfolioUUID = portfolioUUID
 
-        if rowsAffected == 0 {
-            http.Error(w, "No portfolio found with the provided UUID owned by the user", http.StatusNotFound)
-            return
+    // ポートフォリオとタグ（技術スタックの候補）を同時に登録する
+    err := db.Transaction(func(tx Database) error {
+        if err := tx.CreatePortfolio(claims.ID, portfolio); err != nil {
+            return err
         }
+        return tx.AddTechStacks(splitTags(portfolio.Tags))
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
 
-        // 成功したらクライアントに結果を返す
-        w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+    // 成功レスポンスを返送
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "portfolio_uuid": portfolioUUID, // 新しく生成されたUUIDをレスポンスに含める
+    })
+}
 
+// ポートフォリオの更新（portfolio:writeのスコープが必要）
+func UpdatePortfolioHandler(w http.ResponseWriter, r *http.Request, db Database, requireVerifiedEmail bool) {
+    claims := requestClaims(r)
 
-    case http.MethodDelete:
-        portfolioUUID := r.URL.Query().Get("id")
-        if portfolioUUID == "" {
-            http.Error(w, "Portfolio UUID is required", http.StatusBadRequest)
-            return
-        }
+    portfolioUUID := pathParam(r, "uuid", "id")
+    if portfolioUUID == "" {
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
+        return
+    }
 
-        sqlStmt := `DELETE FROM Portfolio WHERE portfolio_uuid=? AND user_id=?`
-        res, err := db.Exec(sqlStmt, portfolioUUID, claims.ID)
-        if err != nil {
-            http.Error(w, "Database execution failed", http.StatusInternalServerError)
-            return
-        }
+    // リクエストボディからポートフォリオデータを読み取り
+    var portfolio Portfolio
+    if !decodeJSONBody(w, r, &portfolio, maxPortfolioBodyBytes) {
+        return
+    }
+    if details := portfolio.validate(); len(details) > 0 {
+        writeFieldErrors(w, r, details...)
+        return
+    }
 
-        // 影響を受けた行の数をチェック
-        rowsAffected, err := res.RowsAffected()
-        if err != nil {
-            http.Error(w, "Error checking affected rows", http.StatusInternalServerError)
-            return
-        }
+    if !checkPublishingAllowed(w, r, db, claims.ID, portfolio.Status, requireVerifiedEmail) {
+        return
+    }
 
-        if rowsAffected == 0 {
-            http.Error(w, "No portfolio found with the provided UUID owned by the user", http.StatusNotFound)
-            return
+    // データベースを更新
+    portfolio.PortfolioUUID = portfolioUUID
+    var found bool
+    err := db.Transaction(func(tx Database) error {
+        var err error
+        if found, err = tx.UpdatePortfolio(claims.ID, portfolio); err != nil || !found {
+            return err
         }
+        return tx.AddTechStacks(splitTags(portfolio.Tags))
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
 
-        w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"result": "success"})
-
-    default:
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+    if !found {
+        writeError(w, r, http.StatusNotFound, ErrCodePortfolioNotFound)
+        return
     }
-}
 
+    // 成功したらクライアントに結果を返す
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
 
-// ポートフォリオ詳細取得（ポートフォリオID）
-func GetPortfolioByPortfolioID(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w)
+// ポートフォリオの削除（portfolio:writeのスコープが必要）
+func DeletePortfolioHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    claims := requestClaims(r)
 
-    if r.Method == "OPTIONS" {
-        w.WriteHeader(http.StatusOK)
+    portfolioUUID := pathParam(r, "uuid", "id")
+    if portfolioUUID == "" {
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
         return
     }
 
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+    found, err := db.DeletePortfolio(claims.ID, portfolioUUID)
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
         return
     }
 
-    db, err := OpenDatabase()
-    if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
+    if !found {
+        writeError(w, r, http.StatusNotFound, ErrCodePortfolioNotFound)
         return
     }
-    defer db.Close()
 
-    portfolioUUID := r.URL.Query().Get("id")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+
+// ポートフォリオ詳細取得（ポートフォリオID）
+func GetPortfolioByPortfolioID(w http.ResponseWriter, r *http.Request, db Database) {
+    portfolioUUID := pathParam(r, "uuid", "id")
     if portfolioUUID == "" {
-        http.Error(w, "Portfolio UUID is required", http.StatusBadRequest)
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
         return
     }
 
-    sqlStmt := `SELECT title, subtitle, thumbnail, github_repo_url, content, tags, status, updated_at FROM Portfolio WHERE portfolio_uuid=? AND status != '0'`
-    var portfolio Portfolio
-    err = db.QueryRow(sqlStmt, portfolioUUID).Scan(&portfolio.Title, &portfolio.Subtitle, &portfolio.Thumbnail, &portfolio.GithubRepoURL, &portfolio.Content, &portfolio.Tags, &portfolio.Status, &portfolio.UpdatedAt)
+    portfolio, err := db.GetPublishedPortfolio(portfolioUUID)
     if err != nil {
         if err == sql.ErrNoRows {
-            http.Error(w, "No portfolio found with the provided UUID or the portfolio is not published", http.StatusNotFound)
+            writeError(w, r, http.StatusNotFound, ErrCodePortfolioNotFound)
         } else {
-            http.Error(w, "Database query failed", http.StatusInternalServerError)
+            serverError(w, r, "Database query failed", err)
         }
         return
     }
@@ -224,47 +239,19 @@ func GetPortfolioByPortfolioID(w http.ResponseWriter, r *http.Request) {
 
 
 // GetUserPortfolios retrieves all portfolios for a given user ID.
-func GetUserPortfolios(w http.ResponseWriter, r *http.Request, jwtKey string) {
-    EnableCORS(w)
-
-    // OPTIONSリクエストの処理を追加
-    if r.Method == http.MethodOptions {
-        w.WriteHeader(http.StatusOK)
-        return
-    }
-
-    // AuthorizationヘッダーからJWTトークンを検証
-    claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
-        return
-    }
-
-    db, err := OpenDatabase()
-    if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
-    }
-    defer db.Close()
+func GetUserPortfolios(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのAuthMiddleware(ScopePortfolioRead)で認証済み
+    claims := requestClaims(r)
 
     // userIDをJWTクレームから取得し、該当するすべてのポートフォリオを取得
-    sqlStmt := `SELECT portfolio_uuid, title, subtitle, thumbnail, github_repo_url, tags, status FROM Portfolio WHERE user_id=?`
-    rows, err := db.Query(sqlStmt, claims.ID)
+    list, err := db.ListPortfoliosByUser(claims.ID)
     if err != nil {
-        http.Error(w, "Database query failed", http.StatusInternalServerError)
+        serverError(w, r, "Database query failed", err)
         return
     }
-    defer rows.Close()
 
     var portfolios []map[string]interface{}
-    for rows.Next() {
-        var p Portfolio
-        err := rows.Scan(&p.PortfolioUUID, &p.Title, &p.Subtitle, &p.Thumbnail, &p.GithubRepoURL, &p.Tags, &p.Status)
-        if err != nil {
-            http.Error(w, "Failed to scan row", http.StatusInternalServerError)
-            return
-        }
-
+    for _, p := range list {
         portfolios = append(portfolios, map[string]interface{}{
             "portfolio_uuid": p.PortfolioUUID,
             "title":          p.Title,
@@ -277,67 +264,35 @@ func GetUserPortfolios(w http.ResponseWriter, r *http.Request, jwtKey string) {
         })
     }
 
-    if err := rows.Err(); err != nil {
-        http.Error(w, "Failed during rows iteration", http.StatusInternalServerError)
-        return
-    }
-
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(portfolios)
 }
 
 // userid（UUID）からポートフォリオを取得
-func GetUserPortfoliosByUUID(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w)
-
-    if r.Method == http.MethodOptions {
-        w.WriteHeader(http.StatusOK)
-        return
-    }
-
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
-    userUUID := r.URL.Query().Get("id")
+func GetUserPortfoliosByUUID(w http.ResponseWriter, r *http.Request, db Database) {
+    userUUID := pathParam(r, "uuid", "id")
     if userUUID == "" {
-        http.Error(w, "User UUID not provided", http.StatusBadRequest)
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
         return
     }
 
-    db, err := OpenDatabase()
-    if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
-    }
-    defer db.Close()
-
     // user_uuid を使って user_id を取得する
-    var userID int
-    err = db.QueryRow(`SELECT id FROM users WHERE user_uuid = ?`, userUUID).Scan(&userID)
+    userID, err := db.GetUserIDByUUID(userUUID)
     if err != nil {
-        http.Error(w, "User not found", http.StatusNotFound)
+        writeError(w, r, http.StatusNotFound, ErrCodeUserNotFound)
         return
     }
 
     // userID を使ってポートフォリオ情報を取得する
-    rows, err := db.Query(`SELECT portfolio_uuid, title, subtitle, thumbnail, github_repo_url, tags, status FROM Portfolio WHERE user_id = ?`, userID)
+    list, err := db.ListPortfoliosByUser(userID)
     if err != nil {
-        http.Error(w, "Database query failed", http.StatusInternalServerError)
+        serverError(w, r, "Database query failed", err)
         return
     }
-    defer rows.Close()
 
     var portfolios []map[string]interface{}
-    for rows.Next() {
-        var portfolio Portfolio
-        err := rows.Scan(&portfolio.PortfolioUUID, &portfolio.Title, &portfolio.Subtitle, &portfolio.Thumbnail, &portfolio.GithubRepoURL, &portfolio.Tags, &portfolio.Status)
-        if err != nil {
-            http.Error(w, "Failed to scan row", http.StatusInternalServerError)
-            return
-        }
+    for _, portfolio := range list {
         portfolios = append(portfolios, map[string]interface{}{
             "portfolio_uuid":   portfolio.PortfolioUUID,
             "title":            portfolio.Title,
@@ -349,11 +304,6 @@ func GetUserPortfoliosByUUID(w http.ResponseWriter, r *http.Request) {
         })
     }
 
-    if err := rows.Err(); err != nil {
-        http.Error(w, "Failed during rows iteration", http.StatusInternalServerError)
-        return
-    }
-
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(portfolios)
@@ -362,39 +312,164 @@ func GetUserPortfoliosByUUID(w http.ResponseWriter, r *http.Request) {
 
 
 // TechStacks テーブルからタグを検索するためのハンドラー
-func GetTechStacksHandler(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w)
+func GetTechStacksHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // クエリパラメータ 'search' が提供されている場合は前方一致で検索し、ない場合はすべて取得
+    prefix := ""
+    if query, present := r.URL.Query()["search"]; present {
+        prefix = strings.ToUpper(query[0])
+    }
 
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+    techStacks, err := db.SearchTechStacks(prefix)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
         return
     }
 
-    // データベース接続
-    db, err := OpenDatabase()
+    // JSONとしてクライアントに結果を返す
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(techStacks)
+}
+// ポートフォリオの一覧で返すカラム（本文は含まない）
+const portfolioSummaryColumns = "portfolio_uuid, title, subtitle, thumbnail, github_repo_url, tags, status"
+
+// ポートフォリオの詳細で返すカラム（scanPortfolioと順序を合わせる）
+const portfolioDetailColumns = "title, subtitle, thumbnail, github_repo_url, content, tags, status, updated_at"
+
+func scanPortfolio(row *dbRow) (Portfolio, error) {
+    var portfolio Portfolio
+    err := row.Scan(&portfolio.Title, &portfolio.Subtitle, &portfolio.Thumbnail, &portfolio.GithubRepoURL, &portfolio.Content, &portfolio.Tags, &portfolio.Status, &portfolio.UpdatedAt)
     if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
+        return Portfolio{}, err
     }
-    defer db.Close()
+    return portfolio, nil
+}
 
-    // クエリパラメータ 'search' が提供されているか確認
-    query, present := r.URL.Query()["search"]
+// ユーザー本人のポートフォリオを取得する（非公開のものを含む）
+func (db *SQLDatabase) GetPortfolio(portfolioUUID string, userID int) (Portfolio, error) {
+    return scanPortfolio(db.db.QueryRow("SELECT "+portfolioDetailColumns+" FROM Portfolio WHERE portfolio_uuid=? AND user_id=?", portfolioUUID, userID))
+}
 
+// 公開・限定公開のポートフォリオを取得する
+func (db *SQLDatabase) GetPublishedPortfolio(portfolioUUID string) (Portfolio, error) {
+    return scanPortfolio(db.db.QueryRow("SELECT "+portfolioDetailColumns+" FROM Portfolio WHERE portfolio_uuid=? AND status != '0'", portfolioUUID))
+}
 
-    var rows *sql.Rows
-    if present && query[0] != "" {
-        // LIKE演算子を使用してnameカラムで検索
-        likeQuery := fmt.Sprintf("%s%%", strings.ToUpper(query[0]))
-        rows, err = db.Query("SELECT name FROM TechStacks WHERE name LIKE ?", likeQuery)
-    } else {
-        // クエリパラメータがない場合、すべての技術スタックを取得
-        rows, err = db.Query("SELECT name FROM TechStacks")
+func (db *SQLDatabase) GetPortfolioOwnerID(portfolioUUID string) (int, error) {
+    var userID int
+    err := db.db.QueryRow("SELECT user_id FROM Portfolio WHERE portfolio_uuid = ?", portfolioUUID).Scan(&userID)
+    return userID, err
+}
+
+func (db *SQLDatabase) ListPortfoliosByUser(userID int) ([]Portfolio, error) {
+    rows, err := db.db.Query("SELECT "+portfolioSummaryColumns+" FROM Portfolio WHERE user_id = ?", userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var portfolios []Portfolio
+    for rows.Next() {
+        var p Portfolio
+        if err := rows.Scan(&p.PortfolioUUID, &p.Title, &p.Subtitle, &p.Thumbnail, &p.GithubRepoURL, &p.Tags, &p.Status); err != nil {
+            return nil, err
+        }
+        portfolios = append(portfolios, p)
     }
+    return portfolios, rows.Err()
+}
 
+// 公開状態（status）ごとのポートフォリオ数
+func (db *SQLDatabase) CountPortfoliosByStatus() (map[string]int, error) {
+    rows, err := db.db.Query("SELECT status, COUNT(*) FROM Portfolio GROUP BY status")
     if err != nil {
-        http.Error(w, "Database query error", http.StatusInternalServerError)
-        return
+        return nil, err
+    }
+    defer rows.Close()
+
+    counts := map[string]int{}
+    for rows.Next() {
+        var status string
+        var count int
+        if err := rows.Scan(&status, &count); err != nil {
+            return nil, err
+        }
+        counts[status] = count
+    }
+    return counts, rows.Err()
+}
+
+// portfolio.PortfolioUUIDを設定してから呼び出すこと
+func (db *SQLDatabase) CreatePortfolio(userID int, portfolio Portfolio) error {
+    _, err := db.db.Exec("INSERT INTO Portfolio (user_id, title, subtitle, thumbnail, github_repo_url, content, tags, status, portfolio_uuid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+        userID, portfolio.Title, portfolio.Subtitle, portfolio.Thumbnail, portfolio.GithubRepoURL, portfolio.Content, portfolio.Tags, portfolio.Status, portfolio.PortfolioUUID)
+    return err
+}
+
+// ユーザー本人のポートフォリオを更新し、対象が存在したかどうかを返す
+// ポートフォリオを更新し、ユーザーのポートフォリオが存在したかどうかを返す
+// MySQLは値が変わらないUPDATEの件数を0と報告するため、存在の確認には件数を使わない
+func (db *SQLDatabase) UpdatePortfolio(userID int, portfolio Portfolio) (bool, error) {
+    var exists int
+    err := db.db.QueryRow("SELECT 1 FROM Portfolio WHERE portfolio_uuid=? AND user_id=?", portfolio.PortfolioUUID, userID).Scan(&exists)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    _, err = db.db.Exec("UPDATE Portfolio SET title=?, subtitle=?, thumbnail=?, github_repo_url=?, content=?, tags=?, status=?, updated_at=CURRENT_TIMESTAMP WHERE portfolio_uuid=? AND user_id=?",
+        portfolio.Title, portfolio.Subtitle, portfolio.Thumbnail, portfolio.GithubRepoURL, portfolio.Content, portfolio.Tags, portfolio.Status, portfolio.PortfolioUUID, userID)
+    return err == nil, err
+}
+
+func (db *SQLDatabase) DeletePortfolio(userID int, portfolioUUID string) (bool, error) {
+    res, err := db.db.Exec("DELETE FROM Portfolio WHERE portfolio_uuid=? AND user_id=?", portfolioUUID, userID)
+    if err != nil {
+        return false, err
+    }
+    rowsAffected, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected > 0, nil
+}
+
+// 技術スタックとして登録できる名前の最大長（TechStacks.name）
+const maxTechStackNameLength = 100
+
+// カンマ区切りのタグを分割する（空のタグと長すぎるタグは除く）
+func splitTags(tags string) []string {
+    var names []string
+    for _, tag := range strings.Split(tags, ",") {
+        tag = strings.TrimSpace(tag)
+        if tag != "" && utf8.RuneCountInString(tag) <= maxTechStackNameLength {
+            names = append(names, tag)
+        }
+    }
+    return names
+}
+
+// 技術スタックを登録する（登録済みのものは無視する）
+func (db *SQLDatabase) AddTechStacks(names []string) error {
+    for _, name := range names {
+        if _, err := db.db.Exec("INSERT INTO TechStacks (name) VALUES (?)"+db.db.dialect.IgnoreDuplicate("name"), name); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// prefixで始まる技術スタック名を返す（空の場合はすべて）
+func (db *SQLDatabase) SearchTechStacks(prefix string) ([]string, error) {
+    var rows *dbRows
+    var err error
+    if prefix != "" {
+        rows, err = db.db.Query("SELECT name FROM TechStacks WHERE "+db.db.Like("name"), escapeLike(prefix)+"%")
+    } else {
+        rows, err = db.db.Query("SELECT name FROM TechStacks")
+    }
+    if err != nil {
+        return nil, err
     }
     defer rows.Close()
 
@@ -402,13 +477,9 @@ func GetTechStacksHandler(w http.ResponseWriter, r *http.Request) {
     for rows.Next() {
         var name string
         if err := rows.Scan(&name); err != nil {
-            http.Error(w, "Database scan error", http.StatusInternalServerError)
-            return
+            return nil, err
         }
         techStacks = append(techStacks, name)
     }
-
-    // JSONとしてクライアントに結果を返す
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(techStacks)
-}
\ No newline at end of file
+    return techStacks, rows.Err()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// ユーザー(ID 2)としてのリクエストを作成する
+func newPortfolioRequest(t *testing.T, keys *KeySet, method string, target string, body interface{}) *http.Request {
+    token, err := GenerateJWT(2, "test2@example.com", keys)
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+    var payload []byte
+    if body != nil {
+        payload, _ = json.Marshal(body)
+    }
+    req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+    req.Header.Set("Authorization", "Bearer "+token)
+    return req
+}
+
+// SQLiteにユーザー1とユーザー2（newPortfolioRequestのユーザー、user_uuidは"user-uuid"）を登録する
+func newSQLiteTestDatabaseWithUsers(t *testing.T) *SQLDatabase {
+    db := newSQLiteTestDatabase(t)
+    createSQLiteTestUser(t, db, User{Email: "test@example.com"})
+    createSQLiteTestUser(t, db, User{Email: "test2@example.com", user_uuid: "user-uuid"})
+    return db
+}
+
+func TestGetPortfolioHandler(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+    if err := db.CreatePortfolio(2, Portfolio{PortfolioUUID: "portfolio-1", Title: "My Work", Status: "1"}); err != nil {
+        t.Fatalf("Failed to create portfolio: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newPortfolioRequest(t, keys, "GET", "/api/me/portfolios/portfolio-1", nil))
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    var portfolio Portfolio
+    json.NewDecoder(w.Body).Decode(&portfolio)
+    if portfolio.Title != "My Work" {
+        t.Errorf("Unexpected portfolio: %+v", portfolio)
+    }
+}
+
+func TestGetPortfolioHandlerNotFound(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newPortfolioRequest(t, keys, "GET", "/api/me/portfolios/missing", nil))
+
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404, got %v", w.Code)
+    }
+}
+
+func TestCreatePortfolioHandler(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+
+    w := httptest.NewRecorder()
+    req := newPortfolioRequest(t, keys, "POST", "/api/me/portfolios", Portfolio{Title: "New", Content: "body", Tags: "Go, React,", Status: "0"})
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected status 201, got %v: %s", w.Code, w.Body.String())
+    }
+    var response map[string]string
+    json.NewDecoder(w.Body).Decode(&response)
+    if created, err := db.GetPortfolio(response["portfolio_uuid"], 2); err != nil || created.Title != "New" {
+        t.Errorf("Expected portfolio %q to be created, got %+v (%v)", response["portfolio_uuid"], created, err)
+    }
+    // タグは技術スタックとしても登録される
+    if names, err := db.SearchTechStacks("React"); err != nil || len(names) != 1 {
+        t.Errorf("Expected the tags to be added as tech stacks, got %v (%v)", names, err)
+    }
+}
+
+func TestUpdatePortfolioHandlerRequiresVerifiedEmail(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+
+    app := newTestApp(db, keys)
+    app.RequireVerifiedEmail = true
+    w := serveTestRouter(app, newPortfolioRequest(t, keys, "PUT", "/api/me/portfolios/portfolio-1", Portfolio{Title: "New", Status: "1"}))
+
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403, got %v", w.Code)
+    }
+}
+
+func TestDeletePortfolioHandlerNotOwned(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+    if err := db.CreatePortfolio(1, Portfolio{PortfolioUUID: "portfolio-1", Title: "Other", Status: "1"}); err != nil {
+        t.Fatalf("Failed to create portfolio: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newPortfolioRequest(t, keys, "DELETE", "/api/me/portfolios/portfolio-1", nil))
+
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404, got %v", w.Code)
+    }
+    if _, err := db.GetPortfolio("portfolio-1", 1); err != nil {
+        t.Errorf("Expected the portfolio to remain, got %v", err)
+    }
+}
+
+func TestGetPortfolioByPortfolioIDNotPublished(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    if err := db.CreatePortfolio(2, Portfolio{PortfolioUUID: "portfolio-1", Title: "Draft", Status: "0"}); err != nil {
+        t.Fatalf("Failed to create portfolio: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    GetPortfolioByPortfolioID(w, httptest.NewRequest("GET", "/api/portfolio/portfolio?id=portfolio-1", nil), db)
+
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404, got %v", w.Code)
+    }
+}
+
+func TestGetUserPortfoliosByUUID(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    if err := db.CreatePortfolio(2, Portfolio{PortfolioUUID: "portfolio-1", Title: "My Work", Status: "1"}); err != nil {
+        t.Fatalf("Failed to create portfolio: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    GetUserPortfoliosByUUID(w, httptest.NewRequest("GET", "/api/portfolios/user?id=user-uuid", nil), db)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    var portfolios []map[string]interface{}
+    json.NewDecoder(w.Body).Decode(&portfolios)
+    if len(portfolios) != 1 || portfolios[0]["portfolio_uuid"] != "portfolio-1" {
+        t.Errorf("Unexpected portfolios: %+v", portfolios)
+    }
+}
+
+func TestGetTechStacksHandler(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+    if err := db.AddTechStacks([]string{"GO", "GORM", "React"}); err != nil {
+        t.Fatalf("Failed to add tech stacks: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    GetTechStacksHandler(w, httptest.NewRequest("GET", "/api/techstacks?search=go", nil), db)
+
+    var techStacks []string
+    json.NewDecoder(w.Body).Decode(&techStacks)
+    if len(techStacks) != 2 {
+        t.Errorf("Unexpected tech stacks: %v", techStacks)
+    }
+}
+
+func TestCreatePortfolioHandlerValidation(t *testing.T) {
+    db, keys := setupMock(t)
+
+    req := newPortfolioRequest(t, keys, "POST", "/api/me/portfolios", Portfolio{Title: "", Content: "body", Status: "3"})
+    req.Header.Set("Accept-Language", "ja")
+    w := serveTestRouter(newTestApp(db, keys), req)
+
+    response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    if len(response.Error.Details) != 2 || response.Error.Details[0].Field != "title" || response.Error.Details[1].Field != "status" {
+        t.Fatalf("Expected errors for title and status, got %+v", response.Error.Details)
+    }
+    if response.Error.Details[1].Message != "次のいずれかを指定してください: 0, 1, 2" {
+        t.Errorf("Unexpected message: %q", response.Error.Details[1].Message)
+    }
+}
+
+func TestUpdatePortfolioHandlerRejectsLargeBody(t *testing.T) {
+    db, keys := setupMock(t)
+
+    body := map[string]string{"title": "New", "status": "1", "content": strings.Repeat("a", maxPortfolioBodyBytes)}
+    w := serveTestRouter(newTestApp(db, keys), newPortfolioRequest(t, keys, "PUT", "/api/me/portfolios/portfolio-1", body))
+
+    verifyErrorResponse(t, w, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge)
+}
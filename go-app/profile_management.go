@@ -1,9 +1,10 @@
 package main
 
 import (
-    // "database/sql"
+    "database/sql"
     "encoding/json"
     "net/http"
+    "regexp"
 )
 
 type Profile struct {
@@ -19,46 +20,37 @@ type Profile struct {
 	TiktokURL    string `json:"tiktok_url,omitempty"`
 }
 
-func ProfileHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
-	EnableCORS(w) // 通常のリクエストに対するCORSヘッダーの設定
-	
-	// CORSプリフライトリクエストへの対応
-	if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-	}
-
-	switch r.Method {
-	case http.MethodGet:
-    // AuthorizationヘッダーからJWTトークンを検証
-    claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
-        return
-    }
-
-    // データベース接続を開く
-    db, err := OpenDatabase()
-    if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
-    }
-    defer db.Close()
+// プロフィールの保存で受け付けるリクエストボディの上限
+const maxProfileBodyBytes = 64 << 10
+
+// ユーザー名に使える文字（英数字とアンダースコアの3〜30文字）
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// プロフィールの入力値を検証する
+// 登録直後は空のプロフィールのため、ユーザー名を含めて未入力の項目は許可する
+func (p Profile) validate() []FieldError {
+    return validateFields(
+        check("profile_image", p.ProfileImage, maxLength(2048)),
+        check("full_name", p.FullName, maxLength(100)),
+        check("username", p.Username, matchPattern(usernamePattern, FieldErrInvalidUsername)),
+        check("contact_email", p.ContactEmail, maxLength(254), emailAddress()),
+        check("bio", p.Bio, maxLength(1000)),
+        check("twitter_url", p.TwitterURL, maxLength(2048), urlOnHosts("twitter.com", "x.com")),
+        check("github_url", p.GithubURL, maxLength(2048), urlOnHosts("github.com")),
+        check("instagram_url", p.InstagramURL, maxLength(2048), urlOnHosts("instagram.com")),
+        check("youtube_url", p.YoutubeURL, maxLength(2048), urlOnHosts("youtube.com", "m.youtube.com", "youtu.be")),
+        check("tiktok_url", p.TiktokURL, maxLength(2048), urlOnHosts("tiktok.com")),
+    )
+}
 
-    // SQLステートメントを準備
-    sqlStmt := `SELECT profile_image, full_name, username, contact_email, bio, twitter_url, github_url, instagram_url, youtube_url, tiktok_url FROM Profile WHERE user_id=?`
-    stmt, err := db.Prepare(sqlStmt)
-    if err != nil {
-        http.Error(w, "Database prepare statement failed", http.StatusInternalServerError)
-        return
-    }
-    defer stmt.Close()
+// ログイン中のユーザーのプロフィールを取得
+func GetProfileHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    claims := requestClaims(r)
 
-    // SQLステートメントを実行
-    var profile Profile
-    err = stmt.QueryRow(claims.ID).Scan(&profile.ProfileImage, &profile.FullName, &profile.Username, &profile.ContactEmail, &profile.Bio, &profile.TwitterURL, &profile.GithubURL, &profile.InstagramURL, &profile.YoutubeURL, &profile.TiktokURL)
+    // プロフィールを取得
+    profile, err := db.GetProfileByUserID(claims.ID)
     if err != nil {
-        http.Error(w, "Database query failed", http.StatusInternalServerError)
+        serverError(w, r, "Database query failed", err)
         return
     }
 
@@ -66,112 +58,59 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(profile)
-
-	case http.MethodPost, http.MethodPut:
-		// AuthorizationヘッダーからJWTトークンを検証
-		claims, err := ValidateToken(r.Header.Get("Authorization"), jwtKey)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		var profile Profile
-		err = json.NewDecoder(r.Body).Decode(&profile)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer r.Body.Close()
-
-		// データベース接続を開く
-		db, err := OpenDatabase()
-		if err != nil {
-			http.Error(w, "Database connection error", http.StatusInternalServerError)
-			return
-		}
-		defer db.Close()
-
-		// SQLステートメントを準備
-		var sqlStmt string
-		if r.Method == http.MethodPost {
-			sqlStmt = `INSERT INTO Profile (user_id, profile_image, full_name, username, contact_email, bio, twitter_url, github_url, instagram_url, youtube_url, tiktok_url) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-		} else {
-			sqlStmt = `UPDATE Profile SET profile_image=?, full_name=?, username=?, contact_email=?, bio=?, twitter_url=?, github_url=?, instagram_url=?, youtube_url=?, tiktok_url=? WHERE user_id=?`
-		}
-
-		stmt, err := db.Prepare(sqlStmt)
-		if err != nil {
-			http.Error(w, "Database prepare statement failed", http.StatusInternalServerError)
-			return
-		}
-		defer stmt.Close()
-
-		// SQLステートメントを実行
-		if r.Method == http.MethodPost {
-			_, err = stmt.Exec(claims.ID, profile.ProfileImage, profile.FullName, profile.Username, profile.ContactEmail, profile.Bio, profile.TwitterURL, profile.GithubURL, profile.InstagramURL, profile.YoutubeURL, profile.TiktokURL)
-		} else {
-			_, err = stmt.Exec(profile.ProfileImage, profile.FullName, profile.Username, profile.ContactEmail, profile.Bio, profile.TwitterURL, profile.GithubURL, profile.InstagramURL, profile.YoutubeURL, profile.TiktokURL, claims.ID)
-		}
-		if err != nil {
-			http.Error(w, "Database execution failed", http.StatusInternalServerError)
-			return
-		}
-
-		// 成功のレスポンスを送信
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"result": "success"})
-
-	default:
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-	}
 }
 
-// user_uuidからプロフィールを取得
-func GetUserProfileByUUID(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w) // CORSヘッダーの設定
+// ログイン中のユーザーのプロフィールを保存（POST/PUT、profile:writeのスコープが必要）
+// 登録時に空のプロフィールが作成されるため、存在する場合は更新、存在しない場合は作成する
+func SaveProfileHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    claims := requestClaims(r)
 
-    if r.Method == "OPTIONS" {
-        w.WriteHeader(http.StatusOK)
+    var profile Profile
+    if !decodeJSONBody(w, r, &profile, maxProfileBodyBytes) {
         return
     }
-
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+    if details := profile.validate(); len(details) > 0 {
+        writeFieldErrors(w, r, details...)
         return
     }
 
-    // クエリパラメータからuser_uuidを取得
-    queryValues := r.URL.Query()
-    userUUID := queryValues.Get("id")
-    if userUUID == "" {
-        http.Error(w, "User UUID not provided", http.StatusBadRequest)
+    err := db.Transaction(func(tx Database) error {
+        if _, err := tx.GetProfileByUserID(claims.ID); err == sql.ErrNoRows {
+            return tx.CreateProfile(claims.ID, profile)
+        } else if err != nil {
+            return err
+        }
+        return tx.UpdateProfile(claims.ID, profile)
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
         return
     }
 
-    db, err := OpenDatabase()
-    if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
+    // 成功のレスポンスを送信
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// user_uuidからプロフィールを取得
+func GetUserProfileByUUID(w http.ResponseWriter, r *http.Request, db Database) {
+    userUUID := pathParam(r, "uuid", "id")
+    if userUUID == "" {
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
         return
     }
-    defer db.Close()
 
     // user_uuidを使用してuser_idを取得
-    var userID int
-    err = db.QueryRow(`SELECT id FROM users WHERE user_uuid = ?`, userUUID).Scan(&userID)
+    userID, err := db.GetUserIDByUUID(userUUID)
     if err != nil {
-        http.Error(w, "Failed to get user ID from user UUID", http.StatusInternalServerError)
+        serverError(w, r, "Failed to get user ID from user UUID", err)
         return
     }
 
     // user_idを使用してプロファイルを取得
-    var profile Profile
-    err = db.QueryRow(`SELECT profile_image, full_name, username, contact_email, bio, twitter_url, github_url, instagram_url, youtube_url, tiktok_url FROM Profile WHERE user_id = ?`, userID).Scan(
-        &profile.ProfileImage, &profile.FullName, &profile.Username, &profile.ContactEmail,
-        &profile.Bio, &profile.TwitterURL, &profile.GithubURL, &profile.InstagramURL,
-        &profile.YoutubeURL, &profile.TiktokURL,
-    )
+    profile, err := db.GetProfileByUserID(userID)
     if err != nil {
-        http.Error(w, "Failed to get profile data", http.StatusInternalServerError)
+        serverError(w, r, "Failed to get profile data", err)
         return
     }
 
@@ -180,54 +119,52 @@ func GetUserProfileByUUID(w http.ResponseWriter, r *http.Request) {
 }
 
 
-func GetProfileByPortfolioUUID(w http.ResponseWriter, r *http.Request) {
-    EnableCORS(w)
-
-    if r.Method == "OPTIONS" {
-        w.WriteHeader(http.StatusOK)
-        return
-    }
-
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
-    // クエリパラメータからportfolio_uuidを取得
-    queryValues := r.URL.Query()
-    portfolioUUID := queryValues.Get("id")
+func GetProfileByPortfolioUUID(w http.ResponseWriter, r *http.Request, db Database) {
+    portfolioUUID := pathParam(r, "uuid", "id")
     if portfolioUUID == "" {
-        http.Error(w, "Portfolio UUID not provided", http.StatusBadRequest)
+        writeFieldErrors(w, r, newFieldError("uuid", FieldErrRequired))
         return
     }
 
-    db, err := OpenDatabase()
+    // portfolio_uuidを使用してuser_idを取得
+    userID, err := db.GetPortfolioOwnerID(portfolioUUID)
     if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
+        serverError(w, r, "Failed to get user ID from portfolio UUID", err)
         return
     }
-    defer db.Close()
 
-    // portfolio_uuidを使用してuser_idを取得
-    var userID int
-    err = db.QueryRow(`SELECT user_id FROM Portfolio WHERE portfolio_uuid = ?`, portfolioUUID).Scan(&userID)
+    // user_idを使用してプロファイルを取得
+    profile, err := db.GetProfileByUserID(userID)
     if err != nil {
-        http.Error(w, "Failed to get user ID from portfolio UUID", http.StatusInternalServerError)
+        serverError(w, r, "Failed to get profile data", err)
         return
     }
 
-    // user_idを使用してプロファイルを取得
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(profile)
+}
+
+func (db *SQLDatabase) GetProfileByUserID(userID int) (Profile, error) {
     var profile Profile
-    err = db.QueryRow(`SELECT profile_image, full_name, username, contact_email, bio, twitter_url, github_url, instagram_url, youtube_url, tiktok_url FROM Profile WHERE user_id = ?`, userID).Scan(
+    err := db.db.QueryRow(`SELECT profile_image, full_name, username, contact_email, bio, twitter_url, github_url, instagram_url, youtube_url, tiktok_url FROM Profile WHERE user_id = ?`, userID).Scan(
         &profile.ProfileImage, &profile.FullName, &profile.Username, &profile.ContactEmail,
         &profile.Bio, &profile.TwitterURL, &profile.GithubURL, &profile.InstagramURL,
         &profile.YoutubeURL, &profile.TiktokURL,
     )
     if err != nil {
-        http.Error(w, "Failed to get profile data", http.StatusInternalServerError)
-        return
+        return Profile{}, err
     }
+    return profile, nil
+}
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(profile)
+func (db *SQLDatabase) CreateProfile(userID int, profile Profile) error {
+    _, err := db.db.Exec(`INSERT INTO Profile (user_id, profile_image, full_name, username, contact_email, bio, twitter_url, github_url, instagram_url, youtube_url, tiktok_url) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+        userID, profile.ProfileImage, profile.FullName, profile.Username, profile.ContactEmail, profile.Bio, profile.TwitterURL, profile.GithubURL, profile.InstagramURL, profile.YoutubeURL, profile.TiktokURL)
+    return err
+}
+
+func (db *SQLDatabase) UpdateProfile(userID int, profile Profile) error {
+    _, err := db.db.Exec(`UPDATE Profile SET profile_image=?, full_name=?, username=?, contact_email=?, bio=?, twitter_url=?, github_url=?, instagram_url=?, youtube_url=?, tiktok_url=? WHERE user_id=?`,
+        profile.ProfileImage, profile.FullName, profile.Username, profile.ContactEmail, profile.Bio, profile.TwitterURL, profile.GithubURL, profile.InstagramURL, profile.YoutubeURL, profile.TiktokURL, userID)
+    return err
 }
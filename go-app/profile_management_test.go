@@ -0,0 +1,114 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestGetProfileHandler(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+    if err := db.CreateProfile(2, Profile{Username: "tester"}); err != nil {
+        t.Fatalf("Failed to create profile: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newPortfolioRequest(t, keys, "GET", "/api/profile", nil))
+
+    var profile Profile
+    json.NewDecoder(w.Body).Decode(&profile)
+    if w.Code != http.StatusOK || profile.Username != "tester" {
+        t.Errorf("Unexpected response %v: %+v", w.Code, profile)
+    }
+}
+
+func TestSaveProfileHandlerUpdate(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+    if err := db.CreateProfile(2, Profile{Username: "tester", Bio: "bio"}); err != nil {
+        t.Fatalf("Failed to create profile: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newPortfolioRequest(t, keys, "PUT", "/api/profile", Profile{Username: "renamed"}))
+
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    if profile, err := db.GetProfileByUserID(2); err != nil || profile != (Profile{Username: "renamed"}) {
+        t.Errorf("Unexpected profile: %+v (%v)", profile, err)
+    }
+}
+
+// 登録時に作成される空のプロフィールがない場合は、POSTでもPUTでも作成する
+func TestSaveProfileHandlerCreatesMissingProfile(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    _, keys := setupMock(t)
+
+    w := serveTestRouter(newTestApp(db, keys), newPortfolioRequest(t, keys, "PUT", "/api/profile", Profile{Username: "tester"}))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    if profile, err := db.GetProfileByUserID(2); err != nil || profile.Username != "tester" {
+        t.Errorf("Expected the profile to be created, got %+v (%v)", profile, err)
+    }
+}
+
+func TestGetProfileByPortfolioUUID(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+    if err := db.CreateProfile(2, Profile{Username: "tester"}); err != nil {
+        t.Fatalf("Failed to create profile: %v", err)
+    }
+    if err := db.CreatePortfolio(2, Portfolio{PortfolioUUID: "portfolio-1", Title: "My Work", Status: "1"}); err != nil {
+        t.Fatalf("Failed to create portfolio: %v", err)
+    }
+
+    w := httptest.NewRecorder()
+    GetProfileByPortfolioUUID(w, httptest.NewRequest("GET", "/api/profile/portfolio?id=portfolio-1", nil), db)
+
+    var profile Profile
+    json.NewDecoder(w.Body).Decode(&profile)
+    if profile.Username != "tester" {
+        t.Errorf("Unexpected profile: %+v", profile)
+    }
+}
+
+func TestGetUserProfileByUUIDUnknownUser(t *testing.T) {
+    db := newSQLiteTestDatabaseWithUsers(t)
+
+    w := httptest.NewRecorder()
+    GetUserProfileByUUID(w, httptest.NewRequest("GET", "/api/profile/user?id=unknown", nil), db)
+
+    if w.Code != http.StatusInternalServerError {
+        t.Errorf("Expected status 500, got %v", w.Code)
+    }
+}
+
+func TestSaveProfileHandlerValidation(t *testing.T) {
+    db, keys := setupMock(t)
+
+    profile := Profile{Username: "no spaces", ContactEmail: "invalid", TwitterURL: "https://example.com/user", GithubURL: "https://github.com/user"}
+    w := serveTestRouter(newTestApp(db, keys), newPortfolioRequest(t, keys, "PUT", "/api/profile", profile))
+
+    response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    got := map[string]string{}
+    for _, detail := range response.Error.Details {
+        got[detail.Field] = detail.Code
+    }
+    if len(got) != 3 || got["username"] != FieldErrInvalidUsername || got["contact_email"] != FieldErrInvalidEmail || got["twitter_url"] != FieldErrHostNotAllowed {
+        t.Errorf("Unexpected field errors: %+v", response.Error.Details)
+    }
+}
+
+func TestSaveProfileHandlerRejectsUnknownFields(t *testing.T) {
+    db, keys := setupMock(t)
+
+    w := serveTestRouter(newTestApp(db, keys), newPortfolioRequest(t, keys, "PUT", "/api/profile", map[string]string{"username": "tester", "user_id": "1"}))
+
+    response := verifyErrorResponse(t, w, http.StatusUnprocessableEntity, ErrCodeValidationFailed)
+    if len(response.Error.Details) != 1 || response.Error.Details[0].Field != "user_id" || response.Error.Details[0].Code != FieldErrUnknownField {
+        t.Errorf("Unexpected field errors: %+v", response.Error.Details)
+    }
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+
+// refresh_tokensテーブルの1レコード
+// トークン本体は保存せず、SHA-256のハッシュのみを保持する
+type RefreshToken struct {
+    ID        int
+    UserID    int
+    TokenHash string
+    FamilyID  string // ローテーションで連なるトークン群を識別するID
+    ExpiresAt time.Time
+    UsedAt    sql.NullTime
+    RevokedAt sql.NullTime
+}
+
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token"`
+}
+
+// トークン文字列をDB保存用のハッシュに変換する
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// 推測不可能なランダムトークンを生成する
+func generateRandomToken() (string, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 新しいリフレッシュトークンを発行して保存する
+// familyIDが空の場合は新しいファミリー（ログインセッション）を開始する
+func issueRefreshToken(db Database, userID int, familyID string) (string, error) {
+    token, err := generateRandomToken()
+    if err != nil {
+        return "", err
+    }
+    if familyID == "" {
+        familyID = uuid.NewString()
+    }
+
+    err = db.CreateRefreshToken(RefreshToken{
+        UserID:    userID,
+        TokenHash: hashToken(token),
+        FamilyID:  familyID,
+        ExpiresAt: time.Now().Add(tokenLifetimes.Refresh),
+    })
+    if err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+// アクセストークン(JWT)とリフレッシュトークンの組を発行する
+// リフレッシュトークンのファミリーIDにはセッションIDを使う
+func issueTokenPair(db Database, user User, sessionID string, keys *KeySet) (string, string, error) {
+    accessToken, err := GenerateSessionJWT(user, sessionID, keys)
+    if err != nil {
+        return "", "", err
+    }
+    refreshToken, err := issueRefreshToken(db, user.ID, sessionID)
+    if err != nil {
+        return "", "", err
+    }
+    return accessToken, refreshToken, nil
+}
+
+// リクエストボディ（またはCookieセッションモードの場合はCookie）からリフレッシュトークンを読み取る
+// 読み取れなかった場合はエラーレスポンスを書き込んでfalseを返す
+func readRefreshToken(w http.ResponseWriter, r *http.Request, auth *Authenticator) (string, bool) {
+    var req RefreshRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return "", false
+    }
+
+    token, err := auth.refreshTokenFromRequest(r, req.RefreshToken)
+    if err != nil {
+        writeAuthError(w, r, err)
+        return "", false
+    }
+    if token == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return "", false
+    }
+    return token, true
+}
+
+// リフレッシュトークンを使って新しいトークンの組を発行する（ローテーション）
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database) {
+    presented, ok := readRefreshToken(w, r, auth)
+    if !ok {
+        return
+    }
+
+    stored, err := db.GetRefreshTokenByHash(hashToken(presented))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidRefreshToken)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+
+    // 使用済み・失効済みのトークンが再提示された場合は盗用とみなし、ファミリー全体を失効させる
+    if stored.UsedAt.Valid || stored.RevokedAt.Valid {
+        requestLogger(r).Warn("Refresh token reuse detected", "target_user_id", stored.UserID, "family_id", stored.FamilyID)
+        if err := db.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+            serverError(w, r, "Database execution failed", err)
+            return
+        }
+        writeError(w, r, http.StatusUnauthorized, ErrCodeRefreshTokenReused)
+        return
+    }
+
+    if time.Now().After(stored.ExpiresAt) {
+        writeError(w, r, http.StatusUnauthorized, ErrCodeRefreshTokenExpired)
+        return
+    }
+
+    // 使用済みに更新（同時リクエストで先を越された場合も再利用として扱う）
+    marked, err := db.MarkRefreshTokenUsed(stored.ID)
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    if !marked {
+        requestLogger(r).Warn("Refresh token reuse detected", "target_user_id", stored.UserID, "family_id", stored.FamilyID)
+        if err := db.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+            serverError(w, r, "Database execution failed", err)
+            return
+        }
+        writeError(w, r, http.StatusUnauthorized, ErrCodeRefreshTokenReused)
+        return
+    }
+
+    user, err := db.GetUserByID(stored.UserID)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
+        return
+    }
+    // 利用停止中のアカウントにはトークンを再発行しない
+    if user.SuspendedAt.Valid {
+        writeError(w, r, http.StatusForbidden, ErrCodeAccountSuspended)
+        return
+    }
+
+    // セッションの最終アクセス日時を更新する
+    session, err := db.GetSession(stored.FamilyID)
+    switch {
+    case err == sql.ErrNoRows || (err == nil && session.RevokedAt.Valid):
+        // セッションが失効済み・削除済みのファミリーは再開しない
+        writeError(w, r, http.StatusUnauthorized, ErrCodeSessionRevoked)
+        return
+    case err == nil:
+        err = db.TouchSession(session.ID, time.Now())
+    }
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    // 同じファミリーで新しいトークンの組を発行
+    accessToken, refreshToken, err := issueTokenPair(db, user, stored.FamilyID, auth.keys)
+    if err != nil {
+        serverError(w, r, "Error generating tokens", err)
+        return
+    }
+
+    auth.writeTokenResponse(w, r, ResponseData{
+        Message:      "Token refreshed",
+        Token:        accessToken,
+        RefreshToken: refreshToken,
+    })
+}
+
+// ログアウト：提示されたリフレッシュトークンのファミリーを失効させる
+func LogoutHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database) {
+    presented, ok := readRefreshToken(w, r, auth)
+    if !ok {
+        return
+    }
+
+    stored, err := db.GetRefreshTokenByHash(hashToken(presented))
+    if err != nil && err != sql.ErrNoRows {
+        serverError(w, r, "Database query error", err)
+        return
+    }
+
+    // 未知のトークンでもログアウト自体は成功として扱う
+    if err == nil {
+        if err := db.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+            serverError(w, r, "Database execution failed", err)
+            return
+        }
+    }
+
+    auth.clearSessionCookies(w)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{
+        Message: "Logout successful",
+    })
+}
+
+func (db *SQLDatabase) CreateRefreshToken(token RefreshToken) error {
+    _, err := db.db.Exec("INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES (?, ?, ?, ?)",
+        token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt)
+    return err
+}
+
+func (db *SQLDatabase) GetRefreshTokenByHash(tokenHash string) (RefreshToken, error) {
+    var token RefreshToken
+    err := db.db.QueryRow("SELECT id, user_id, token_hash, family_id, expires_at, used_at, revoked_at FROM refresh_tokens WHERE token_hash = ?", tokenHash).Scan(
+        &token.ID, &token.UserID, &token.TokenHash, &token.FamilyID, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+    if err != nil {
+        return RefreshToken{}, err
+    }
+    return token, nil
+}
+
+// 未使用のトークンのみを使用済みに更新し、更新できたかどうかを返す
+func (db *SQLDatabase) MarkRefreshTokenUsed(id int) (bool, error) {
+    res, err := db.db.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL", time.Now(), id)
+    if err != nil {
+        return false, err
+    }
+    rowsAffected, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected == 1, nil
+}
+
+// ファミリーIDはセッションIDを兼ねるため、セッションも合わせて失効させる
+func (db *SQLDatabase) RevokeRefreshTokenFamily(familyID string) error {
+    now := time.Now()
+    return db.inTransaction(func(tx *SQLDatabase) error {
+        _, err := tx.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", now, familyID)
+        if err != nil {
+            return err
+        }
+        _, err = tx.db.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", now, familyID)
+        return err
+    })
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+func newRefreshRequest(path string, token string) *http.Request {
+    body, _ := json.Marshal(RefreshRequest{RefreshToken: token})
+    return httptest.NewRequest("POST", path, bytes.NewReader(body))
+}
+
+func TestRefreshTokenHandlerRotatesToken(t *testing.T) {
+    db, keys := setupMock(t)
+
+    stored := RefreshToken{ID: 1, UserID: 2, TokenHash: hashToken("old-token"), FamilyID: "family-1", ExpiresAt: time.Now().Add(time.Hour)}
+    db.EXPECT().GetRefreshTokenByHash(hashToken("old-token")).Return(stored, nil)
+    db.EXPECT().MarkRefreshTokenUsed(1).Return(true, nil)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com"}, nil)
+    db.EXPECT().GetSession("family-1").Return(Session{ID: "family-1", UserID: 2}, nil)
+    db.EXPECT().TouchSession("family-1", gomock.Any()).Return(nil)
+
+    // 新しいトークンは同じファミリーで発行される
+    db.EXPECT().CreateRefreshToken(gomock.Any()).DoAndReturn(func(token RefreshToken) error {
+        if token.FamilyID != "family-1" {
+            t.Errorf("Expected family 'family-1', got '%v'", token.FamilyID)
+        }
+        if token.TokenHash == stored.TokenHash {
+            t.Errorf("Expected a new refresh token to be issued")
+        }
+        return nil
+    })
+
+    w := httptest.NewRecorder()
+    RefreshTokenHandler(w, newRefreshRequest("/api/token/refresh", "old-token"), NewAuthenticator(keys, db), db)
+
+    verifyResponse(t, w, http.StatusOK, "Token refreshed", true)
+}
+
+func TestRefreshTokenHandlerDetectsReuse(t *testing.T) {
+    db, keys := setupMock(t)
+
+    // 既に使用済みのトークンを再提示した場合はファミリー全体が失効する
+    stored := RefreshToken{ID: 1, UserID: 2, FamilyID: "family-1", ExpiresAt: time.Now().Add(time.Hour), UsedAt: sql.NullTime{Time: time.Now(), Valid: true}}
+    db.EXPECT().GetRefreshTokenByHash(hashToken("used-token")).Return(stored, nil)
+    db.EXPECT().RevokeRefreshTokenFamily("family-1").Return(nil)
+
+    w := httptest.NewRecorder()
+    RefreshTokenHandler(w, newRefreshRequest("/api/token/refresh", "used-token"), NewAuthenticator(keys, db), db)
+
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+}
+
+func TestRefreshTokenHandlerRejectsExpiredToken(t *testing.T) {
+    db, keys := setupMock(t)
+
+    stored := RefreshToken{ID: 1, UserID: 2, FamilyID: "family-1", ExpiresAt: time.Now().Add(-time.Minute)}
+    db.EXPECT().GetRefreshTokenByHash(hashToken("expired-token")).Return(stored, nil)
+
+    w := httptest.NewRecorder()
+    RefreshTokenHandler(w, newRefreshRequest("/api/token/refresh", "expired-token"), NewAuthenticator(keys, db), db)
+
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+}
+
+func TestLogoutHandlerRevokesFamily(t *testing.T) {
+    db, _ := setupMock(t)
+
+    stored := RefreshToken{ID: 1, UserID: 2, FamilyID: "family-1", ExpiresAt: time.Now().Add(time.Hour)}
+    db.EXPECT().GetRefreshTokenByHash(hashToken("current-token")).Return(stored, nil)
+    db.EXPECT().RevokeRefreshTokenFamily("family-1").Return(nil)
+
+    w := httptest.NewRecorder()
+    LogoutHandler(w, newRefreshRequest("/api/logout", "current-token"), NewAuthenticator(NewHMACKeySet("testkey"), db), db)
+
+    verifyResponse(t, w, http.StatusOK, "Logout successful", false)
+}
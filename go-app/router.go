@@ -0,0 +1,310 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "strings"
+    "sync/atomic"
+)
+
+// ルーターのハンドラーが使う依存関係
+type App struct {
+    DB                   Database
+    DBStats              func() sql.DBStats // コネクションプールの統計情報（管理者API）
+    DBPing               func(ctx context.Context) error // データベースへの接続確認（/readyz）
+    CORS                 CORSConfig
+    Auth                 *Authenticator
+    Keys                 *KeySet
+    LoginThrottle        *LoginThrottle
+    Mailer               Mailer
+    OAuth                *OAuthConfig
+    AppBaseURL           string // メール内のリンクに使うフロントエンドのURL
+    ImageDir             string // アップロードされた画像の保存先
+    Metrics              *Metrics // /metricsで公開するメトリクス
+    RequireVerifiedEmail bool   // trueの場合、メールアドレス未確認のユーザーはポートフォリオを公開できない
+
+    draining atomic.Bool // 停止処理中（/readyzが503を返す）
+}
+
+// 停止処理の開始を記録する（以降は/readyzが503を返し、新しいリクエストが振り分けられなくなる）
+func (app *App) StartDraining() {
+    app.draining.Store(true)
+}
+
+// リクエストのコンテキストに結び付けたDatabase（クライアントの切断やタイムアウトでクエリを中断する）
+func (app *App) requestDB(r *http.Request) Database {
+    return withRequestContext(app.DB, r)
+}
+
+// すべてのルートを登録したハンドラーを返す
+// パスは「メソッド パス」のパターンで登録するため、メソッドが一致しない場合はルーターが405を返す
+func NewRouter(app *App) http.Handler {
+    mux := http.NewServeMux()
+    auth := app.Auth
+    session := auth.SessionMiddleware()
+    admin := auth.RoleMiddleware(RoleAdmin)
+
+    handle := func(pattern string, h http.HandlerFunc, middlewares ...Middleware) {
+        mux.Handle(pattern, Chain(h, middlewares...))
+    }
+    // 旧ルート（後継のルートと同じハンドラーを呼び出し、Deprecationヘッダーを付ける）
+    deprecated := func(pattern string, successor string, h http.HandlerFunc, middlewares ...Middleware) {
+        handle(pattern, h, append([]Middleware{DeprecatedMiddleware(successor)}, middlewares...)...)
+    }
+
+    // 画像の保存先ディレクトリを公開する（プリフライトにもCORSMiddlewareが応答する）
+    mux.Handle("GET "+imageURLPath, http.StripPrefix(imageURLPath, http.FileServer(http.Dir(app.ImageDir))))
+
+    // 死活監視（livenessは依存先を確認しない、readinessはデータベースと画像ディレクトリを確認する）
+    handle("GET /healthz", HealthzHandler)
+    handle("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+        ReadyzHandler(w, r, app)
+    })
+    // Prometheusのメトリクス
+    mux.Handle("GET /metrics", app.Metrics.Handler())
+
+    // トークン検証用の公開鍵(JWKS)
+    handle("GET /.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+        JWKSHandler(w, r, app.Keys)
+    })
+
+    // CSRFトークンの発行（Cookieセッションモード）
+    handle("GET /api/csrf", func(w http.ResponseWriter, r *http.Request) {
+        CSRFHandler(w, r, auth)
+    })
+
+    // ログイン認証（認証エラーの扱いが異なるため、ハンドラー内で認証する）
+    handle("/api/auth", func(w http.ResponseWriter, r *http.Request) {
+        AuthHandler(w, r, auth)
+    })
+
+    // アカウント登録・ログイン
+    handle("POST /api/register", func(w http.ResponseWriter, r *http.Request) {
+        RegisterHandler(w, r, auth, app.requestDB(r), app.Mailer, app.AppBaseURL)
+    })
+    handle("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+        LoginHandler(w, r, auth, app.requestDB(r), app.LoginThrottle)
+    })
+    // ログイン（二要素認証の2段階目）
+    handle("POST /api/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+        TwoFactorLoginHandler(w, r, auth, app.requestDB(r), app.LoginThrottle)
+    })
+    // アクセストークンの再発行（リフレッシュトークンのローテーション）
+    handle("POST /api/token/refresh", func(w http.ResponseWriter, r *http.Request) {
+        RefreshTokenHandler(w, r, auth, app.requestDB(r))
+    })
+    // ログアウト（リフレッシュトークンの失効）
+    handle("POST /api/logout", func(w http.ResponseWriter, r *http.Request) {
+        LogoutHandler(w, r, auth, app.requestDB(r))
+    })
+
+    // 二要素認証の登録開始・登録確認（有効化）・無効化
+    handle("POST /api/2fa/setup", func(w http.ResponseWriter, r *http.Request) {
+        TwoFactorSetupHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("POST /api/2fa/confirm", func(w http.ResponseWriter, r *http.Request) {
+        TwoFactorConfirmHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("POST /api/2fa/disable", func(w http.ResponseWriter, r *http.Request) {
+        TwoFactorDisableHandler(w, r, app.requestDB(r))
+    }, session)
+
+    // 外部プロバイダーでのログイン開始・外部ID連携・コールバック
+    handle("GET /api/oauth/login", func(w http.ResponseWriter, r *http.Request) {
+        OAuthLoginHandler(w, r, app.OAuth, app.requestDB(r))
+    })
+    handle("POST /api/oauth/link", func(w http.ResponseWriter, r *http.Request) {
+        OAuthLinkHandler(w, r, app.OAuth, app.requestDB(r))
+    }, session)
+    handle("GET /api/oauth/callback", func(w http.ResponseWriter, r *http.Request) {
+        OAuthCallbackHandler(w, r, auth, app.OAuth, app.requestDB(r), app.AppBaseURL)
+    })
+
+    // パーソナルアクセストークンの管理
+    handle("GET /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+        ListPersonalAccessTokensHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("POST /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+        CreatePersonalAccessTokenHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("DELETE /api/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+        RevokePersonalAccessTokenHandler(w, r, app.requestDB(r))
+    }, session)
+    deprecated("DELETE /api/tokens", "/api/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+        RevokePersonalAccessTokenHandler(w, r, app.requestDB(r))
+    }, session)
+
+    // ログイン中のセッションの一覧と失効
+    handle("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+        ListSessionsHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("DELETE /api/sessions/others", func(w http.ResponseWriter, r *http.Request) {
+        RevokeOtherSessionsHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("DELETE /api/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+        RevokeSessionHandler(w, r, auth, app.requestDB(r))
+    }, session)
+    deprecated("DELETE /api/sessions", "/api/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+        legacyRevokeSessionsHandler(w, r, auth, app.requestDB(r))
+    }, session)
+
+    // アカウント設定（パスワード・メールアドレスの変更、退会の申請と取り消し）
+    handle("POST /api/account/password", func(w http.ResponseWriter, r *http.Request) {
+        ChangePasswordHandler(w, r, app.requestDB(r))
+    }, session)
+    handle("POST /api/account/email", func(w http.ResponseWriter, r *http.Request) {
+        ChangeEmailHandler(w, r, auth, app.requestDB(r), app.Mailer, app.AppBaseURL)
+    }, session)
+    handle("POST /api/account/email/confirm", func(w http.ResponseWriter, r *http.Request) {
+        ConfirmEmailChangeHandler(w, r, app.Keys, app.requestDB(r), app.Mailer)
+    })
+    handle("POST /api/account/delete", func(w http.ResponseWriter, r *http.Request) {
+        DeleteAccountHandler(w, r, auth, app.requestDB(r))
+    }, session)
+    handle("POST /api/account/restore", func(w http.ResponseWriter, r *http.Request) {
+        RestoreAccountHandler(w, r, app.requestDB(r), app.LoginThrottle)
+    })
+
+    // メールアドレスの確認・認証メールの再送信
+    handle("POST /api/verify-email", func(w http.ResponseWriter, r *http.Request) {
+        VerifyEmailHandler(w, r, app.Keys, app.requestDB(r))
+    })
+    handle("POST /api/verify-email/resend", func(w http.ResponseWriter, r *http.Request) {
+        ResendVerificationEmailHandler(w, r, auth, app.requestDB(r), app.Mailer, app.AppBaseURL)
+    }, session)
+
+    // パスワードリセットの申請・再設定
+    handle("POST /api/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+        ForgotPasswordHandler(w, r, app.requestDB(r), app.Mailer, app.AppBaseURL)
+    })
+    handle("POST /api/password/reset", func(w http.ResponseWriter, r *http.Request) {
+        ResetPasswordHandler(w, r, app.requestDB(r))
+    })
+
+    // 管理者API
+    handle("GET /api/admin/db/stats", func(w http.ResponseWriter, r *http.Request) {
+        DBStatsHandler(w, r, app.DBStats)
+    }, admin)
+    handle("GET /api/admin/users", func(w http.ResponseWriter, r *http.Request) {
+        AdminUsersHandler(w, r, app.requestDB(r))
+    }, admin)
+    handle("POST /api/admin/users/{id}/suspend", func(w http.ResponseWriter, r *http.Request) {
+        AdminSuspendUserHandler(w, r, app.requestDB(r))
+    }, admin)
+    deprecated("POST /api/admin/users/suspend", "/api/admin/users/{id}/suspend", func(w http.ResponseWriter, r *http.Request) {
+        AdminSuspendUserHandler(w, r, app.requestDB(r))
+    }, admin)
+    handle("POST /api/admin/portfolios/{uuid}/unpublish", func(w http.ResponseWriter, r *http.Request) {
+        AdminUnpublishPortfolioHandler(w, r, app.requestDB(r))
+    }, admin)
+    deprecated("POST /api/admin/portfolios/unpublish", "/api/admin/portfolios/{uuid}/unpublish", func(w http.ResponseWriter, r *http.Request) {
+        AdminUnpublishPortfolioHandler(w, r, app.requestDB(r))
+    }, admin)
+    handle("POST /api/admin/impersonate", func(w http.ResponseWriter, r *http.Request) {
+        AdminImpersonateHandler(w, r, auth, app.requestDB(r))
+    }, admin)
+
+    // ログイン中のユーザーのプロフィール
+    getProfile := func(w http.ResponseWriter, r *http.Request) {
+        GetProfileHandler(w, r, app.requestDB(r))
+    }
+    saveProfile := func(w http.ResponseWriter, r *http.Request) {
+        SaveProfileHandler(w, r, app.requestDB(r))
+    }
+    handle("GET /api/profile", getProfile, auth.AuthMiddleware(""))
+    handle("POST /api/profile", saveProfile, auth.AuthMiddleware(ScopeProfileWrite))
+    handle("PUT /api/profile", saveProfile, auth.AuthMiddleware(ScopeProfileWrite))
+    // 画像アップロード(Profile)
+    handle("POST /api/profile/image", func(w http.ResponseWriter, r *http.Request) {
+        UploadProfileImageHandler(w, r, app.requestDB(r), app.ImageDir, app.Metrics)
+    }, auth.AuthMiddleware(ScopeImageWrite))
+
+    // 自分のポートフォリオ（非公開のものを含む）
+    listPortfolios := func(w http.ResponseWriter, r *http.Request) {
+        GetUserPortfolios(w, r, app.requestDB(r))
+    }
+    getPortfolio := func(w http.ResponseWriter, r *http.Request) {
+        GetPortfolioHandler(w, r, app.requestDB(r))
+    }
+    createPortfolio := func(w http.ResponseWriter, r *http.Request) {
+        CreatePortfolioHandler(w, r, app.requestDB(r), app.RequireVerifiedEmail)
+    }
+    updatePortfolio := func(w http.ResponseWriter, r *http.Request) {
+        UpdatePortfolioHandler(w, r, app.requestDB(r), app.RequireVerifiedEmail)
+    }
+    deletePortfolio := func(w http.ResponseWriter, r *http.Request) {
+        DeletePortfolioHandler(w, r, app.requestDB(r))
+    }
+    portfolioRead := auth.AuthMiddleware(ScopePortfolioRead)
+    portfolioWrite := auth.AuthMiddleware(ScopePortfolioWrite)
+    handle("GET /api/me/portfolios", listPortfolios, portfolioRead)
+    handle("POST /api/me/portfolios", createPortfolio, portfolioWrite)
+    handle("GET /api/me/portfolios/{uuid}", getPortfolio, portfolioRead)
+    handle("PUT /api/me/portfolios/{uuid}", updatePortfolio, portfolioWrite)
+    handle("DELETE /api/me/portfolios/{uuid}", deletePortfolio, portfolioWrite)
+    // 画像アップロード(Portfolio)
+    handle("POST /api/portfolio/image", func(w http.ResponseWriter, r *http.Request) {
+        UploadPortfolioImageHandler(w, r, app.requestDB(r), app.ImageDir, app.Metrics)
+    }, auth.AuthMiddleware(ScopeImageWrite))
+
+    // 公開されているポートフォリオとプロフィール
+    getPublishedPortfolio := func(w http.ResponseWriter, r *http.Request) {
+        GetPortfolioByPortfolioID(w, r, app.requestDB(r))
+    }
+    getPortfolioProfile := func(w http.ResponseWriter, r *http.Request) {
+        GetProfileByPortfolioUUID(w, r, app.requestDB(r))
+    }
+    getUserPortfolios := func(w http.ResponseWriter, r *http.Request) {
+        GetUserPortfoliosByUUID(w, r, app.requestDB(r))
+    }
+    getUserProfile := func(w http.ResponseWriter, r *http.Request) {
+        GetUserProfileByUUID(w, r, app.requestDB(r))
+    }
+    handle("GET /api/portfolios/{uuid}", getPublishedPortfolio)
+    handle("GET /api/portfolios/{uuid}/profile", getPortfolioProfile)
+    handle("GET /api/users/{uuid}/portfolios", getUserPortfolios)
+    handle("GET /api/users/{uuid}/profile", getUserProfile)
+
+    // 旧ルート（?id=でUUIDを指定する）
+    deprecated("GET /api/portfolio", "/api/me/portfolios/{uuid}", getPortfolio, portfolioRead)
+    deprecated("POST /api/portfolio", "/api/me/portfolios", createPortfolio, portfolioWrite)
+    deprecated("PUT /api/portfolio", "/api/me/portfolios/{uuid}", updatePortfolio, portfolioWrite)
+    deprecated("DELETE /api/portfolio", "/api/me/portfolios/{uuid}", deletePortfolio, portfolioWrite)
+    deprecated("GET /api/portfolios", "/api/me/portfolios", listPortfolios, portfolioRead)
+    deprecated("GET /api/portfolio/portfolio", "/api/portfolios/{uuid}", getPublishedPortfolio)
+    deprecated("GET /api/portfolios/user", "/api/users/{uuid}/portfolios", getUserPortfolios)
+    deprecated("GET /api/profile/user", "/api/users/{uuid}/profile", getUserProfile)
+    deprecated("GET /api/profile/portfolio", "/api/portfolios/{uuid}/profile", getPortfolioProfile)
+
+    // 技術スタック追加用(Portfolio)
+    handle("GET /api/techstacks", func(w http.ResponseWriter, r *http.Request) {
+        GetTechStacksHandler(w, r, app.requestDB(r))
+    })
+    // 限定公開パス検証・発行(Portfolio)
+    handle("GET /api/validate-uuid", func(w http.ResponseWriter, r *http.Request) {
+        ValidateEncryptedUUID(w, r, app.requestDB(r))
+    })
+    handle("GET /api/generate-pass", GenerateEncryptedPass)
+
+    // 先頭のものが最も外側（ログには復旧したpanicの500も記録される）
+    // CORSMiddlewareはプリフライトに応答するため、muxに登録されたメソッドを参照する
+    return Chain(routeNotFoundHandler(mux), RequestIDMiddleware, AccessLogMiddleware, app.Metrics.Middleware(mux), RecoverMiddleware, CORSMiddleware(app.CORS, mux))
+}
+
+// 一致するルートがない場合に、ServeMuxのプレーンテキストの代わりにJSONのエラーを返す
+// パスは登録されているがメソッドが異なる場合は405とAllowヘッダーを返す
+func routeNotFoundHandler(mux *http.ServeMux) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if _, pattern := mux.Handler(r); pattern != "" {
+            mux.ServeHTTP(w, r)
+            return
+        }
+        if methods := routeMethods(mux, r); len(methods) > 0 {
+            w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+            writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed)
+            return
+        }
+        writeError(w, r, http.StatusNotFound, ErrCodeNotFound)
+    })
+}
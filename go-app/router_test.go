@@ -0,0 +1,139 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// モックデータベースを使うAppを作成する（必要に応じてフィールドを書き換えてからNewRouterに渡す）
+func newTestApp(db Database, keys *KeySet) *App {
+    return &App{
+        DB:            db,
+        DBStats:       func() sql.DBStats { return sql.DBStats{} },
+        DBPing:        func(ctx context.Context) error { return nil },
+        CORS:          CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}, AllowCredentials: true, MaxAge: 10 * time.Minute},
+        Auth:          NewAuthenticator(keys, db),
+        Keys:          keys,
+        LoginThrottle: NewLoginThrottle(),
+        Mailer:        &MemoryMailer{},
+        AppBaseURL:    "http://localhost:3000",
+        ImageDir:      "images",
+        Metrics:       NewMetrics(nil, db),
+    }
+}
+
+// リクエストをルーター経由で処理する
+func serveTestRouter(app *App, req *http.Request) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    NewRouter(app).ServeHTTP(w, req)
+    return w
+}
+
+func TestRouterRejectsUnregisteredMethod(t *testing.T) {
+    db, keys := setupMock(t)
+
+    req := httptest.NewRequest("GET", "/api/login", nil)
+    req.Header.Set("Origin", "http://localhost:3000")
+    w := serveTestRouter(newTestApp(db, keys), req)
+    if w.Code != http.StatusMethodNotAllowed {
+        t.Errorf("Expected status 405, got %v", w.Code)
+    }
+    if allow := w.Header().Get("Allow"); !strings.Contains(allow, "POST") {
+        t.Errorf("Expected Allow header to contain POST, got %q", allow)
+    }
+    // エラーレスポンスにもCORSヘッダーが付く
+    if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+        t.Errorf("Expected CORS headers on error responses")
+    }
+}
+
+func TestRouterAnswersPreflight(t *testing.T) {
+    db, keys := setupMock(t)
+
+    // 認証が必要なルートでも、プリフライトには認証なしで応答する
+    req := httptest.NewRequest("OPTIONS", "/api/me/portfolios/abc", nil)
+    req.Header.Set("Origin", "http://localhost:3000")
+    req.Header.Set("Access-Control-Request-Method", "PUT")
+    w := serveTestRouter(newTestApp(db, keys), req)
+    if w.Code != http.StatusNoContent {
+        t.Errorf("Expected status 204, got %v", w.Code)
+    }
+    if methods := w.Header().Get("Access-Control-Allow-Methods"); methods != "GET, HEAD, PUT, DELETE" {
+        t.Errorf("Expected only the methods of the route, got %q", methods)
+    }
+}
+
+func TestRouterRequiresAuthentication(t *testing.T) {
+    db, keys := setupMock(t)
+
+    w := serveTestRouter(newTestApp(db, keys), httptest.NewRequest("GET", "/api/me/portfolios", nil))
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status 401, got %v", w.Code)
+    }
+}
+
+func TestRouterPathParameter(t *testing.T) {
+    db, keys := setupMock(t)
+    db.EXPECT().GetPublishedPortfolio("abc").Return(Portfolio{Title: "Title", PortfolioUUID: "abc"}, nil)
+
+    w := serveTestRouter(newTestApp(db, keys), httptest.NewRequest("GET", "/api/portfolios/abc", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    if w.Header().Get("Deprecation") != "" {
+        t.Errorf("Did not expect a Deprecation header on the new route")
+    }
+}
+
+func TestRouterDeprecatedAlias(t *testing.T) {
+    db, keys := setupMock(t)
+    db.EXPECT().GetPublishedPortfolio("abc").Return(Portfolio{Title: "Title", PortfolioUUID: "abc"}, nil)
+
+    w := serveTestRouter(newTestApp(db, keys), httptest.NewRequest("GET", "/api/portfolio/portfolio?id=abc", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %v: %s", w.Code, w.Body.String())
+    }
+    if w.Header().Get("Deprecation") != "true" {
+        t.Errorf("Expected Deprecation header on the legacy route")
+    }
+    if link := w.Header().Get("Link"); link != `</api/portfolios/{uuid}>; rel="successor-version"` {
+        t.Errorf("Unexpected Link header: %q", link)
+    }
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+    h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        panic("boom")
+    }), RecoverMiddleware)
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+    if w.Code != http.StatusInternalServerError {
+        t.Errorf("Expected status 500, got %v", w.Code)
+    }
+}
+
+func TestChainOrder(t *testing.T) {
+    var order []string
+    mark := func(name string) Middleware {
+        return func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                order = append(order, name)
+                next.ServeHTTP(w, r)
+            })
+        }
+    }
+    h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        order = append(order, "handler")
+    }), mark("first"), mark("second"))
+
+    h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    if strings.Join(order, ",") != "first,second,handler" {
+        t.Errorf("Unexpected order: %v", order)
+    }
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "net"
+    "net/http"
+    "time"
+)
+
+// HTTPサーバーのタイムアウトの既定値（画像のアップロードが途中で切れないように長めにする）
+const (
+    defaultReadHeaderTimeout = 10 * time.Second
+    defaultReadTimeout       = 60 * time.Second
+    defaultWriteTimeout      = 60 * time.Second
+    defaultIdleTimeout       = 120 * time.Second
+    defaultShutdownTimeout   = 30 * time.Second
+)
+
+// HTTPサーバーの設定
+type ServerConfig struct {
+    ReadHeaderTimeout time.Duration // ヘッダーの受信の上限（HTTP_READ_HEADER_TIMEOUT）
+    ReadTimeout       time.Duration // ボディを含むリクエストの受信の上限（HTTP_READ_TIMEOUT）
+    WriteTimeout      time.Duration // レスポンスの送信完了までの上限（HTTP_WRITE_TIMEOUT）
+    IdleTimeout       time.Duration // キープアライブの接続を維持する時間（HTTP_IDLE_TIMEOUT）
+    ShutdownTimeout   time.Duration // 停止時に処理中のリクエストの完了を待つ時間（SHUTDOWN_TIMEOUT）
+}
+
+// HTTPサーバーの設定を読み込む（いずれも正の値でなければならない）
+func loadServerConfig(src configSource) (ServerConfig, error) {
+    config := ServerConfig{}
+    var errs []error
+    for _, field := range []struct {
+        key          string
+        value        *time.Duration
+        defaultValue time.Duration
+    }{
+        {"HTTP_READ_HEADER_TIMEOUT", &config.ReadHeaderTimeout, defaultReadHeaderTimeout},
+        {"HTTP_READ_TIMEOUT", &config.ReadTimeout, defaultReadTimeout},
+        {"HTTP_WRITE_TIMEOUT", &config.WriteTimeout, defaultWriteTimeout},
+        {"HTTP_IDLE_TIMEOUT", &config.IdleTimeout, defaultIdleTimeout},
+        {"SHUTDOWN_TIMEOUT", &config.ShutdownTimeout, defaultShutdownTimeout},
+    } {
+        d, err := src.duration(field.key, field.defaultValue)
+        if err == nil && d <= 0 {
+            err = errors.New(field.key + " must be positive")
+        }
+        if err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        *field.value = d
+    }
+    return config, errors.Join(errs...)
+}
+
+// タイムアウトを設定したHTTPサーバーを作成する
+func NewServer(config ServerConfig, addr string, handler http.Handler) *http.Server {
+    return &http.Server{
+        Addr:              addr,
+        Handler:           handler,
+        ReadHeaderTimeout: config.ReadHeaderTimeout,
+        ReadTimeout:       config.ReadTimeout,
+        WriteTimeout:      config.WriteTimeout,
+        IdleTimeout:       config.IdleTimeout,
+    }
+}
+
+// ctxが終了するまでlistenerでリクエストを受け付け、その後は処理中のリクエストの完了を待って停止する
+// 停止処理の開始時にonShutdownを呼ぶ（/readyzを503にするなど）
+// shutdownTimeoutを過ぎても完了しないリクエストは接続を切断する
+func RunServer(ctx context.Context, server *http.Server, listener net.Listener, shutdownTimeout time.Duration, onShutdown func()) error {
+    serveErr := make(chan error, 1)
+    go func() {
+        serveErr <- server.Serve(listener)
+    }()
+
+    select {
+    case err := <-serveErr:
+        return err
+    case <-ctx.Done():
+    }
+
+    slog.Info("Shutting down: waiting for in-flight requests", "timeout", shutdownTimeout.String())
+    if onShutdown != nil {
+        onShutdown()
+    }
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    if err := server.Shutdown(shutdownCtx); err != nil {
+        server.Close()
+        return err
+    }
+    if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+    "context"
+    "io"
+    "net"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestLoadServerConfig(t *testing.T) {
+    config, err := loadServerConfig(configSource{flags: map[string]string{"HTTP_WRITE_TIMEOUT": "5m"}})
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if config.WriteTimeout != 5*time.Minute || config.ReadTimeout != defaultReadTimeout || config.ShutdownTimeout != defaultShutdownTimeout {
+        t.Errorf("Unexpected config: %+v", config)
+    }
+
+    if _, err := loadServerConfig(configSource{flags: map[string]string{"SHUTDOWN_TIMEOUT": "0s"}}); err == nil {
+        t.Errorf("Expected an error for a zero SHUTDOWN_TIMEOUT")
+    }
+}
+
+func TestRunServerDrainsInFlightRequests(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Failed to listen: %v", err)
+    }
+
+    started := make(chan struct{})
+    release := make(chan struct{})
+    handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        close(started)
+        <-release
+        io.WriteString(w, "done")
+    })
+    server := NewServer(ServerConfig{ReadTimeout: time.Second, WriteTimeout: 5 * time.Second}, "", handler)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    draining := make(chan struct{})
+    stopped := make(chan error, 1)
+    go func() {
+        stopped <- RunServer(ctx, server, listener, 5*time.Second, func() { close(draining) })
+    }()
+
+    // 処理中のリクエストがある状態で停止を開始する
+    responses := make(chan string, 1)
+    go func() {
+        resp, err := http.Get("http://" + listener.Addr().String() + "/")
+        if err != nil {
+            responses <- err.Error()
+            return
+        }
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(resp.Body)
+        responses <- string(body)
+    }()
+    <-started
+    cancel()
+    <-draining
+    close(release)
+
+    if body := <-responses; body != "done" {
+        t.Errorf("Expected the in-flight request to complete, got %q", body)
+    }
+    if err := <-stopped; err != nil {
+        t.Errorf("Expected a clean shutdown, got %v", err)
+    }
+}
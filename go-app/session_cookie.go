@@ -0,0 +1,203 @@
+package main
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// Cookieセッションモードで使うCookieとヘッダーの名前
+const (
+    sessionCookieName = "ccg_session" // アクセストークン(JWT)、HttpOnly
+    refreshCookieName = "ccg_refresh" // リフレッシュトークン、HttpOnly
+    csrfCookieName    = "ccg_csrf"    // CSRFトークン（ダブルサブミット用）
+    csrfHeaderName    = "X-CSRF-TOKEN"
+)
+
+
+// CSRFトークンが送信されていない、またはCookieと一致しない場合のエラー
+var ErrCSRFTokenMismatch = errors.New("CSRF token missing or invalid")
+
+// Cookieセッションモードの設定
+type SessionCookieConfig struct {
+    Secure   bool // HTTPSでのみ送信する
+    SameSite http.SameSite
+    Domain   string
+}
+
+type CSRFResponse struct {
+    CSRFToken string `json:"csrf_token"`
+}
+
+// Cookieセッションモードの設定を読み込む（AUTH_COOKIE_MODEがtrueでない場合はnil）
+// AUTH_COOKIE_SECURE / AUTH_COOKIE_SAMESITE（lax / strict / none） / AUTH_COOKIE_DOMAIN
+func loadSessionCookieConfig(src configSource) (*SessionCookieConfig, error) {
+    enabled, err := src.boolean("AUTH_COOKIE_MODE", false)
+    if err != nil || !enabled {
+        return nil, err
+    }
+
+    secure, err := src.boolean("AUTH_COOKIE_SECURE", true)
+    if err != nil {
+        return nil, err
+    }
+    config := &SessionCookieConfig{
+        Secure:   secure,
+        SameSite: http.SameSiteLaxMode,
+        Domain:   src.get("AUTH_COOKIE_DOMAIN"),
+    }
+    switch sameSite := strings.ToLower(src.get("AUTH_COOKIE_SAMESITE")); sameSite {
+    case "", "lax":
+    case "strict":
+        config.SameSite = http.SameSiteStrictMode
+    case "none":
+        // SameSite=NoneのCookieはSecureでなければブラウザに拒否される
+        if !secure {
+            return nil, errors.New("AUTH_COOKIE_SAMESITE=none requires AUTH_COOKIE_SECURE")
+        }
+        config.SameSite = http.SameSiteNoneMode
+    default:
+        return nil, fmt.Errorf("invalid AUTH_COOKIE_SAMESITE: %q", sameSite)
+    }
+    return config, nil
+}
+
+// Cookieセッションモードを有効にする
+func (a *Authenticator) EnableCookieSessions(config *SessionCookieConfig) {
+    a.cookies = config
+}
+
+// 状態を変更するメソッドかどうか
+func isStateChangingMethod(method string) bool {
+    return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete || method == http.MethodPatch
+}
+
+// ダブルサブミット方式でCSRFトークンを検証する（CookieとX-CSRF-TOKENヘッダーの一致を確認）
+func checkCSRF(r *http.Request) error {
+    if !isStateChangingMethod(r.Method) {
+        return nil
+    }
+
+    cookie, err := r.Cookie(csrfCookieName)
+    if err != nil || cookie.Value == "" {
+        return ErrCSRFTokenMismatch
+    }
+    header := r.Header.Get(csrfHeaderName)
+    if header == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+        return ErrCSRFTokenMismatch
+    }
+    return nil
+}
+
+// セッションCookieのJWTで認証する（状態を変更するリクエストではCSRFトークンも検証する）
+func (a *Authenticator) authenticateCookie(r *http.Request) (*Claims, error) {
+    cookie, err := r.Cookie(sessionCookieName)
+    if err != nil || cookie.Value == "" {
+        return nil, errors.New("Authorization header or session cookie is required")
+    }
+
+    if err := checkCSRF(r); err != nil {
+        return nil, err
+    }
+
+    return a.validateToken(withRequestContext(a.db, r), "Bearer "+cookie.Value)
+}
+
+func (a *Authenticator) newCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+    return &http.Cookie{
+        Name:     name,
+        Value:    value,
+        Path:     path,
+        Domain:   a.cookies.Domain,
+        MaxAge:   int(maxAge.Seconds()),
+        Secure:   a.cookies.Secure,
+        HttpOnly: httpOnly,
+        SameSite: a.cookies.SameSite,
+    }
+}
+
+// 新しいCSRFトークンを発行してCookieに設定する
+func (a *Authenticator) issueCSRFCookie(w http.ResponseWriter) (string, error) {
+    token, err := GenerateCSRFToken()
+    if err != nil {
+        return "", err
+    }
+    // ダブルサブミットのため、JavaScriptから読めるようHttpOnlyにはしない
+    http.SetCookie(w, a.newCookie(csrfCookieName, token, "/", tokenLifetimes.Refresh, false))
+    return token, nil
+}
+
+// 発行したトークンの組をレスポンスとして返す
+// Cookieセッションモードの場合はトークンをHttpOnly Cookieに設定し、レスポンスボディには含めない
+func (a *Authenticator) writeTokenResponse(w http.ResponseWriter, r *http.Request, data ResponseData) {
+    if a.cookies != nil && data.Token != "" {
+        http.SetCookie(w, a.newCookie(sessionCookieName, data.Token, "/", tokenLifetimes.Access, true))
+        if data.RefreshToken != "" {
+            http.SetCookie(w, a.newCookie(refreshCookieName, data.RefreshToken, "/api", tokenLifetimes.Refresh, true))
+        }
+
+        csrfToken, err := a.issueCSRFCookie(w)
+        if err != nil {
+            serverError(w, r, "Error generating CSRF token", err)
+            return
+        }
+
+        data.Token = ""
+        data.RefreshToken = ""
+        data.CSRFToken = csrfToken
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(data)
+}
+
+// リクエストボディにリフレッシュトークンがない場合はCookieから取得する
+// Cookieから取得した場合はCSRFトークンも検証する
+func (a *Authenticator) refreshTokenFromRequest(r *http.Request, bodyToken string) (string, error) {
+    if bodyToken != "" || a.cookies == nil {
+        return bodyToken, nil
+    }
+
+    cookie, err := r.Cookie(refreshCookieName)
+    if err != nil || cookie.Value == "" {
+        return "", nil
+    }
+    if err := checkCSRF(r); err != nil {
+        return "", err
+    }
+    return cookie.Value, nil
+}
+
+// ログアウト時にセッション関連のCookieを削除する
+func (a *Authenticator) clearSessionCookies(w http.ResponseWriter) {
+    if a.cookies == nil {
+        return
+    }
+    for _, c := range []struct{ name, path string }{{sessionCookieName, "/"}, {refreshCookieName, "/api"}, {csrfCookieName, "/"}} {
+        cookie := a.newCookie(c.name, "", c.path, 0, c.name != csrfCookieName)
+        cookie.MaxAge = -1
+        http.SetCookie(w, cookie)
+    }
+}
+
+// CSRFトークンの発行（Cookieに設定し、同じ値をレスポンスボディでも返す）
+// フロントエンドが別オリジンの場合はCookieを読めないため、ボディの値をX-CSRF-TOKENヘッダーに設定する
+func CSRFHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator) {
+    if auth.cookies == nil {
+        writeError(w, r, http.StatusNotFound, ErrCodeCookieSessionsDisabled)
+        return
+    }
+
+    token, err := auth.issueCSRFCookie(w)
+    if err != nil {
+        serverError(w, r, "Error generating CSRF token", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(CSRFResponse{CSRFToken: token})
+}
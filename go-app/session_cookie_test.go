@@ -0,0 +1,135 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/golang/mock/gomock"
+)
+
+func newCookieAuthenticator(keys *KeySet, db Database) *Authenticator {
+    auth := NewAuthenticator(keys, db)
+    auth.EnableCookieSessions(&SessionCookieConfig{Secure: true, SameSite: http.SameSiteLaxMode})
+    return auth
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+    for _, c := range w.Result().Cookies() {
+        if c.Name == name {
+            return c
+        }
+    }
+    return nil
+}
+
+func TestLoginHandlerSetsSessionCookies(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := newCookieAuthenticator(keys, db)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+    db.EXPECT().CreateSession(gomock.Any()).Return(nil)
+    db.EXPECT().CreateRefreshToken(gomock.Any()).Return(nil)
+
+    body, _ := json.Marshal(validCreds)
+    w := httptest.NewRecorder()
+    LoginHandler(w, httptest.NewRequest("POST", "/api/login", bytes.NewReader(body)), auth, db, NewLoginThrottle())
+
+    session := findCookie(w, sessionCookieName)
+    if session == nil || !session.HttpOnly || !session.Secure {
+        t.Fatalf("Expected a secure HttpOnly session cookie, got %+v", session)
+    }
+    if refresh := findCookie(w, refreshCookieName); refresh == nil || !refresh.HttpOnly {
+        t.Errorf("Expected an HttpOnly refresh cookie, got %+v", refresh)
+    }
+
+    // トークンはレスポンスボディに含めず、CSRFトークンのみ返す
+    var response ResponseData
+    json.NewDecoder(w.Body).Decode(&response)
+    if response.Token != "" || response.RefreshToken != "" {
+        t.Errorf("Did not expect tokens in the response body")
+    }
+    csrf := findCookie(w, csrfCookieName)
+    if csrf == nil || csrf.HttpOnly || csrf.Value != response.CSRFToken {
+        t.Errorf("Expected a readable CSRF cookie matching the response body")
+    }
+}
+
+func TestAuthenticateWithSessionCookieRequiresCSRF(t *testing.T) {
+    auth := newCookieAuthenticator(NewHMACKeySet("testkey"), nil)
+    token, _ := GenerateJWT(2, "test2@example.com", NewHMACKeySet("testkey"))
+
+    newRequest := func(method string, csrfCookie string, csrfHeader string) *http.Request {
+        req := httptest.NewRequest(method, "/api/portfolio", nil)
+        req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+        if csrfCookie != "" {
+            req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: csrfCookie})
+        }
+        if csrfHeader != "" {
+            req.Header.Set(csrfHeaderName, csrfHeader)
+        }
+        return req
+    }
+
+    // 参照系のリクエストはCSRFトークン不要
+    if _, err := auth.Authenticate(newRequest("GET", "", ""), ScopePortfolioRead); err != nil {
+        t.Errorf("GET request with session cookie was rejected: %v", err)
+    }
+
+    // 状態を変更するリクエストはCookieとヘッダーの一致が必要
+    if _, err := auth.Authenticate(newRequest("POST", "csrf-value", ""), ScopePortfolioWrite); err != ErrCSRFTokenMismatch {
+        t.Errorf("Expected ErrCSRFTokenMismatch without header, got %v", err)
+    }
+    if _, err := auth.Authenticate(newRequest("DELETE", "csrf-value", "other-value"), ScopePortfolioWrite); err != ErrCSRFTokenMismatch {
+        t.Errorf("Expected ErrCSRFTokenMismatch with mismatched header, got %v", err)
+    }
+    if _, err := auth.Authenticate(newRequest("PUT", "csrf-value", "csrf-value"), ScopePortfolioWrite); err != nil {
+        t.Errorf("Request with matching CSRF token was rejected: %v", err)
+    }
+
+    if authErrorStatus(ErrCSRFTokenMismatch) != http.StatusForbidden {
+        t.Errorf("Expected CSRF mismatch to map to 403")
+    }
+}
+
+func TestAuthenticateIgnoresCookieWhenCookieModeDisabled(t *testing.T) {
+    auth := NewAuthenticator(NewHMACKeySet("testkey"), nil)
+    token, _ := GenerateJWT(2, "test2@example.com", NewHMACKeySet("testkey"))
+
+    req := httptest.NewRequest("GET", "/api/portfolio", nil)
+    req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+    if _, err := auth.Authenticate(req, ScopePortfolioRead); err == nil {
+        t.Errorf("Session cookie was accepted while cookie mode is disabled")
+    }
+}
+
+func TestCSRFHandler(t *testing.T) {
+    auth := newCookieAuthenticator(NewHMACKeySet("testkey"), nil)
+
+    w := httptest.NewRecorder()
+    CSRFHandler(w, httptest.NewRequest("GET", "/api/csrf", nil), auth)
+
+    var response CSRFResponse
+    json.NewDecoder(w.Body).Decode(&response)
+    cookie := findCookie(w, csrfCookieName)
+    if cookie == nil || response.CSRFToken == "" || cookie.Value != response.CSRFToken {
+        t.Errorf("Expected CSRF cookie to match response token")
+    }
+}
+
+func TestRefreshTokenHandlerFromCookieRequiresCSRF(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := newCookieAuthenticator(keys, db)
+
+    req := httptest.NewRequest("POST", "/api/token/refresh", nil)
+    req.AddCookie(&http.Cookie{Name: refreshCookieName, Value: "cookie-token"})
+    w := httptest.NewRecorder()
+    RefreshTokenHandler(w, req, auth, db)
+
+    if w.Code != http.StatusForbidden {
+        t.Errorf("Expected status Forbidden, got %v", w.Code)
+    }
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// last_seen_atを更新する最小間隔（リクエストごとの書き込みを避ける）
+const sessionLastSeenInterval = 1 * time.Minute
+
+// 保存するUser-Agentの最大長
+const maxUserAgentLength = 255
+
+// セッションが失効している場合のエラー
+var ErrSessionRevoked = errors.New("Session has been revoked")
+
+// sessionsテーブルの1レコード（ログインごとに作成される）
+// セッションIDはリフレッシュトークンのファミリーIDを兼ねる
+type Session struct {
+    ID         string       `json:"id"`
+    UserID     int          `json:"-"`
+    UserAgent  string       `json:"user_agent"`
+    IPAddress  string       `json:"ip_address"`
+    CreatedAt  time.Time    `json:"created_at"`
+    LastSeenAt time.Time    `json:"last_seen_at"`
+    RevokedAt  sql.NullTime `json:"-"`
+    Current    bool         `json:"current"` // リクエスト元のセッションかどうか
+}
+
+// ログインに成功したときに新しいセッションを作成し、トークンの組を発行する
+func startSession(db Database, r *http.Request, user User, keys *KeySet) (string, string, error) {
+    session, err := createSession(db, r, user.ID)
+    if err != nil {
+        return "", "", err
+    }
+
+    return issueTokenPair(db, user, session.ID, keys)
+}
+
+// リクエスト元の情報を記録したセッションを作成する
+func createSession(db Database, r *http.Request, userID int) (Session, error) {
+    userAgent := r.UserAgent()
+    if len(userAgent) > maxUserAgentLength {
+        userAgent = userAgent[:maxUserAgentLength]
+    }
+
+    now := time.Now()
+    session := Session{
+        ID:         uuid.NewString(),
+        UserID:     userID,
+        UserAgent:  userAgent,
+        IPAddress:  clientIP(r),
+        CreatedAt:  now,
+        LastSeenAt: now,
+    }
+    if err := db.CreateSession(session); err != nil {
+        return Session{}, err
+    }
+    return session, nil
+}
+
+// アクセストークンのセッションが有効かどうかを確認し、最終アクセス日時を更新する
+func checkSession(db Database, claims *Claims) error {
+    session, err := db.GetSession(claims.SessionID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return ErrSessionRevoked
+        }
+        return err
+    }
+    if session.RevokedAt.Valid || session.UserID != claims.ID {
+        return ErrSessionRevoked
+    }
+
+    now := time.Now()
+    if now.Sub(session.LastSeenAt) >= sessionLastSeenInterval {
+        return db.TouchSession(session.ID, now)
+    }
+    return nil
+}
+
+// ログイン中のセッションの一覧
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    sessions, err := db.ListSessions(claims.ID)
+    if err != nil {
+        serverError(w, r, "Database query failed", err)
+        return
+    }
+    for i := range sessions {
+        sessions[i].Current = sessions[i].ID == claims.SessionID
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(sessions)
+}
+
+// セッションの失効（DELETE /api/sessions/{id}）
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database) {
+    claims := requestClaims(r)
+
+    sessionID := pathParam(r, "id", "id")
+    if sessionID == "" {
+        writeFieldErrors(w, r, newFieldError("id", FieldErrRequired))
+        return
+    }
+
+    revoked, err := db.RevokeSession(sessionID, claims.ID)
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+    if !revoked {
+        writeError(w, r, http.StatusNotFound, ErrCodeSessionNotFound)
+        return
+    }
+
+    // 現在のセッションを失効させた場合はCookieも削除する
+    if sessionID == claims.SessionID {
+        auth.clearSessionCookies(w)
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// 現在のセッション以外をすべて失効させる（DELETE /api/sessions/others）
+func RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    claims := requestClaims(r)
+
+    if claims.SessionID == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeSessionUnknown)
+        return
+    }
+    if err := db.RevokeUserSessions(claims.ID, claims.SessionID); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// 旧ルート：DELETE /api/sessions?id= または ?others=true
+func legacyRevokeSessionsHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database) {
+    if r.URL.Query().Get("others") == "true" {
+        RevokeOtherSessionsHandler(w, r, db)
+        return
+    }
+    RevokeSessionHandler(w, r, auth, db)
+}
+
+func (db *SQLDatabase) CreateSession(session Session) error {
+    _, err := db.db.Exec("INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?)",
+        session.ID, session.UserID, session.UserAgent, session.IPAddress, session.CreatedAt, session.LastSeenAt)
+    return err
+}
+
+func (db *SQLDatabase) GetSession(id string) (Session, error) {
+    var session Session
+    err := db.db.QueryRow("SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, revoked_at FROM sessions WHERE id = ?", id).Scan(
+        &session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+    if err != nil {
+        return Session{}, err
+    }
+    return session, nil
+}
+
+// 失効していないセッションの一覧を最終アクセスの新しい順に返す
+func (db *SQLDatabase) ListSessions(userID int) ([]Session, error) {
+    rows, err := db.db.Query("SELECT id, user_agent, ip_address, created_at, last_seen_at FROM sessions WHERE user_id = ? AND revoked_at IS NULL ORDER BY last_seen_at DESC", userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    sessions := []Session{}
+    for rows.Next() {
+        session := Session{UserID: userID}
+        if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt); err != nil {
+            return nil, err
+        }
+        sessions = append(sessions, session)
+    }
+    return sessions, rows.Err()
+}
+
+func (db *SQLDatabase) TouchSession(id string, seenAt time.Time) error {
+    _, err := db.db.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?", seenAt, id)
+    return err
+}
+
+// セッションと、そのセッションのリフレッシュトークンを失効させる
+func (db *SQLDatabase) RevokeSession(id string, userID int) (bool, error) {
+    now := time.Now()
+    var revoked bool
+    err := db.inTransaction(func(tx *SQLDatabase) error {
+        res, err := tx.db.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", now, id, userID)
+        if err != nil {
+            return err
+        }
+        rowsAffected, err := res.RowsAffected()
+        if err != nil || rowsAffected != 1 {
+            return err
+        }
+
+        _, err = tx.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", now, id)
+        revoked = err == nil
+        return err
+    })
+    return revoked, err
+}
+
+// ユーザーのセッションをexceptSessionID以外すべて失効させる（空の場合はすべて）
+func (db *SQLDatabase) RevokeUserSessions(userID int, exceptSessionID string) error {
+    now := time.Now()
+    return db.inTransaction(func(tx *SQLDatabase) error {
+        _, err := tx.db.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL", now, userID, exceptSessionID)
+        if err != nil {
+            return err
+        }
+        _, err = tx.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL", now, userID, exceptSessionID)
+        return err
+    })
+}
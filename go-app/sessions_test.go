@@ -0,0 +1,178 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+func TestLoginHandlerStartsSession(t *testing.T) {
+    db, keys := setupMock(t)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+
+    var session Session
+    db.EXPECT().CreateSession(gomock.Any()).DoAndReturn(func(s Session) error {
+        session = s
+        return nil
+    })
+    db.EXPECT().CreateRefreshToken(gomock.Any()).DoAndReturn(func(token RefreshToken) error {
+        if token.FamilyID != session.ID {
+            t.Errorf("Expected refresh family to match session ID")
+        }
+        return nil
+    })
+
+    body, _ := json.Marshal(validCreds)
+    req := httptest.NewRequest("POST", "/api/login", bytes.NewReader(body))
+    req.Header.Set("User-Agent", "TestBrowser/1.0")
+    w := httptest.NewRecorder()
+    LoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+    if session.UserID != validUser.ID || session.UserAgent != "TestBrowser/1.0" || session.IPAddress != "192.0.2.1" {
+        t.Errorf("Unexpected session: %+v", session)
+    }
+
+    var response ResponseData
+    json.NewDecoder(w.Body).Decode(&response)
+    claims, err := ValidateToken("Bearer "+response.Token, keys)
+    if err != nil || claims.SessionID != session.ID {
+        t.Errorf("Expected token to carry session ID %v, got %+v (%v)", session.ID, claims, err)
+    }
+}
+
+func TestAuthenticatorRejectsRevokedSession(t *testing.T) {
+    db, keys := setupMock(t)
+    auth := NewAuthenticator(keys, db)
+    token, _ := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com"}, "session-1", keys)
+
+    // 有効なセッション（最終アクセスが古い場合は更新する）
+    db.EXPECT().GetSession("session-1").Return(Session{ID: "session-1", UserID: 2, LastSeenAt: time.Now().Add(-time.Hour)}, nil)
+    db.EXPECT().TouchSession("session-1", gomock.Any()).Return(nil)
+    if _, err := auth.ValidateToken("Bearer " + token); err != nil {
+        t.Errorf("Token with an active session was rejected: %v", err)
+    }
+
+    // 失効したセッション
+    db.EXPECT().GetSession("session-1").Return(Session{ID: "session-1", UserID: 2, RevokedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+    if _, err := auth.ValidateToken("Bearer " + token); err != ErrSessionRevoked {
+        t.Errorf("Expected ErrSessionRevoked, got %v", err)
+    }
+
+    // 存在しないセッション
+    db.EXPECT().GetSession("session-1").Return(Session{}, sql.ErrNoRows)
+    if _, err := auth.ValidateToken("Bearer " + token); err != ErrSessionRevoked {
+        t.Errorf("Expected ErrSessionRevoked, got %v", err)
+    }
+}
+
+func newSessionsRequest(t *testing.T, keys *KeySet, method string, target string) *http.Request {
+    token, err := GenerateSessionJWT(User{ID: 2, Email: "test2@example.com"}, "current", keys)
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+    req := httptest.NewRequest(method, target, nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    return req
+}
+
+func expectCurrentSession(db *MockDatabase) {
+    db.EXPECT().GetSession("current").Return(Session{ID: "current", UserID: 2, LastSeenAt: time.Now()}, nil)
+}
+
+func TestListSessionsHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectCurrentSession(db)
+    db.EXPECT().ListSessions(2).Return([]Session{{ID: "current", UserID: 2}, {ID: "other", UserID: 2}}, nil)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newSessionsRequest(t, keys, "GET", "/api/sessions"))
+
+    var sessions []Session
+    json.NewDecoder(w.Body).Decode(&sessions)
+    if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current {
+        t.Errorf("Expected only the current session to be marked, got %+v", sessions)
+    }
+}
+
+func TestRevokeSessionHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectCurrentSession(db)
+    db.EXPECT().RevokeSession("other", 2).Return(true, nil)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newSessionsRequest(t, keys, "DELETE", "/api/sessions/other"))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status OK, got %v", w.Code)
+    }
+
+    // 他のユーザーのセッションは失効できない
+    expectCurrentSession(db)
+    db.EXPECT().RevokeSession("someone-else", 2).Return(false, nil)
+
+    w = httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newSessionsRequest(t, keys, "DELETE", "/api/sessions/someone-else"))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected status Not Found, got %v", w.Code)
+    }
+}
+
+func TestRevokeOtherSessionsHandler(t *testing.T) {
+    db, keys := setupMock(t)
+    expectCurrentSession(db)
+    db.EXPECT().RevokeUserSessions(2, "current").Return(nil)
+
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newSessionsRequest(t, keys, "DELETE", "/api/sessions/others"))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status OK, got %v", w.Code)
+    }
+
+    // 旧ルート(?others=true)も引き続き使える
+    expectCurrentSession(db)
+    db.EXPECT().RevokeUserSessions(2, "current").Return(nil)
+
+    w = httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, newSessionsRequest(t, keys, "DELETE", "/api/sessions?others=true"))
+    if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" {
+        t.Errorf("Expected status OK with a Deprecation header, got %v", w.Code)
+    }
+}
+
+func TestRefreshTokenHandlerRejectsRevokedSession(t *testing.T) {
+    db, keys := setupMock(t)
+
+    stored := RefreshToken{ID: 1, UserID: 2, TokenHash: hashToken("old-token"), FamilyID: "family-1", ExpiresAt: time.Now().Add(time.Hour)}
+    db.EXPECT().GetRefreshTokenByHash(hashToken("old-token")).Return(stored, nil)
+    db.EXPECT().MarkRefreshTokenUsed(1).Return(true, nil)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com"}, nil)
+    db.EXPECT().GetSession("family-1").Return(Session{ID: "family-1", UserID: 2, RevokedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+
+    w := httptest.NewRecorder()
+    RefreshTokenHandler(w, newRefreshRequest("/api/token/refresh", "old-token"), NewAuthenticator(keys, db), db)
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+}
+
+// セッションの行が削除されたファミリーのリフレッシュトークンでは再開しない
+func TestRefreshTokenHandlerRejectsMissingSession(t *testing.T) {
+    db, keys := setupMock(t)
+
+    stored := RefreshToken{ID: 1, UserID: 2, TokenHash: hashToken("old-token"), FamilyID: "family-1", ExpiresAt: time.Now().Add(time.Hour)}
+    db.EXPECT().GetRefreshTokenByHash(hashToken("old-token")).Return(stored, nil)
+    db.EXPECT().MarkRefreshTokenUsed(1).Return(true, nil)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com"}, nil)
+    db.EXPECT().GetSession("family-1").Return(Session{}, sql.ErrNoRows)
+
+    w := httptest.NewRecorder()
+    RefreshTokenHandler(w, newRefreshRequest("/api/token/refresh", "old-token"), NewAuthenticator(keys, db), db)
+    verifyErrorResponse(t, w, http.StatusUnauthorized, ErrCodeSessionRevoked)
+}
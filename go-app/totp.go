@@ -0,0 +1,151 @@
+package main
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/subtle"
+    "encoding/base32"
+    "encoding/base64"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// RFC 6238 (TOTP) のパラメータ
+const (
+    totpPeriod = 30 // 秒
+    totpDigits = 6
+    totpSkew   = 1 // 前後に許容するステップ数（時計のずれ対策）
+)
+
+// otpauth URIに表示する発行者名
+const totpIssuer = "CCGallery"
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPシークレットの暗号化鍵（起動時にConfigの値で設定する）
+// 共有リンクの鍵とは分け、公開されている共有リンクの暗号化処理から影響を受けないようにする
+var totpKey []byte
+
+// 160ビットのランダムな共有シークレットをBase32で生成する
+func generateTOTPSecret() (string, error) {
+    b := make([]byte, 20)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return totpEncoding.EncodeToString(b), nil
+}
+
+// 認証アプリ登録用のotpauth:// URIを生成する
+func totpURI(secret string, accountName string) string {
+    label := url.PathEscape(totpIssuer + ":" + accountName)
+    params := url.Values{}
+    params.Set("secret", secret)
+    params.Set("issuer", totpIssuer)
+    params.Set("algorithm", "SHA1")
+    params.Set("digits", fmt.Sprint(totpDigits))
+    params.Set("period", fmt.Sprint(totpPeriod))
+    return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// 時刻からTOTPのステップ数（カウンター）を求める
+func totpStep(t time.Time) int64 {
+    return t.Unix() / totpPeriod
+}
+
+// RFC 4226 (HOTP) に従ってカウンターに対応するコードを計算する
+func hotpCode(key []byte, counter uint64, digits int) string {
+    var msg [8]byte
+    binary.BigEndian.PutUint64(msg[:], counter)
+
+    mac := hmac.New(sha1.New, key)
+    mac.Write(msg[:])
+    sum := mac.Sum(nil)
+
+    // 動的切り捨て
+    offset := sum[len(sum)-1] & 0x0f
+    code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+    mod := uint32(1)
+    for i := 0; i < digits; i++ {
+        mod *= 10
+    }
+    return fmt.Sprintf("%0*d", digits, code%mod)
+}
+
+// TOTPコードを検証し、一致したステップ数を返す
+// lastStep以前のステップは再利用とみなして受け付けない
+func verifyTOTP(secret string, code string, t time.Time, lastStep int64) (int64, bool) {
+    key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+    if err != nil {
+        return 0, false
+    }
+
+    code = strings.TrimSpace(code)
+    if len(code) != totpDigits {
+        return 0, false
+    }
+
+    current := totpStep(t)
+    for i := -totpSkew; i <= totpSkew; i++ {
+        step := current + int64(i)
+        if step <= lastStep {
+            continue
+        }
+        expected := hotpCode(key, uint64(step), totpDigits)
+        if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+            return step, true
+        }
+    }
+    return 0, false
+}
+
+func totpAEAD() (cipher.AEAD, error) {
+    if len(totpKey) != aesKeyLength {
+        return nil, errors.New("TOTP key is not configured")
+    }
+    block, err := aes.NewCipher(totpKey)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// シークレットをAES-GCMで暗号化する
+// ユーザーIDを追加認証データに含め、暗号文を別のユーザーに付け替えられないようにする
+func encryptTOTPSecret(userID int, secret string) (string, error) {
+    aead, err := totpAEAD()
+    if err != nil {
+        return "", err
+    }
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(strconv.Itoa(userID)))
+    return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// 暗号化されたシークレットを復号する
+func decryptTOTPSecret(userID int, encrypted string) (string, error) {
+    aead, err := totpAEAD()
+    if err != nil {
+        return "", err
+    }
+    sealed, err := base64.RawURLEncoding.DecodeString(encrypted)
+    if err != nil || len(sealed) < aead.NonceSize() {
+        return "", errors.New("malformed TOTP secret")
+    }
+    plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(strconv.Itoa(userID)))
+    if err != nil {
+        return "", fmt.Errorf("failed to decrypt TOTP secret: %v", err)
+    }
+    return string(plaintext), nil
+}
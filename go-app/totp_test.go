@@ -0,0 +1,102 @@
+package main
+
+import (
+    "encoding/base32"
+    "strings"
+    "testing"
+    "time"
+)
+
+// RFC 6238 Appendix B のテストベクター（SHA1、下6桁）
+func TestHOTPCodeRFC6238Vectors(t *testing.T) {
+    key := []byte("12345678901234567890")
+    testCases := []struct {
+        unix int64
+        code string
+    }{
+        {59, "287082"},
+        {1111111109, "081804"},
+        {1111111111, "050471"},
+        {1234567890, "005924"},
+        {2000000000, "279037"},
+    }
+
+    for _, tc := range testCases {
+        got := hotpCode(key, uint64(totpStep(time.Unix(tc.unix, 0))), totpDigits)
+        if got != tc.code {
+            t.Errorf("At %d: expected code %v, got %v", tc.unix, tc.code, got)
+        }
+    }
+}
+
+func TestVerifyTOTP(t *testing.T) {
+    secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+    now := time.Unix(1111111111, 0)
+
+    step, ok := verifyTOTP(secret, "050471", now, 0)
+    if !ok {
+        t.Fatalf("Valid code was rejected")
+    }
+
+    // 同じステップのコードは再利用できない
+    if _, ok := verifyTOTP(secret, "050471", now, step); ok {
+        t.Errorf("Reused code was accepted")
+    }
+
+    // 1ステップ前のコードは時計のずれとして許容する
+    if _, ok := verifyTOTP(secret, "050471", now.Add(totpPeriod*time.Second), 0); !ok {
+        t.Errorf("Code from previous step was rejected")
+    }
+
+    if _, ok := verifyTOTP(secret, "000000", now, 0); ok {
+        t.Errorf("Invalid code was accepted")
+    }
+}
+
+func TestTOTPURI(t *testing.T) {
+    uri := totpURI("JBSWY3DPEHPK3PXP", "test@example.com")
+    if !strings.HasPrefix(uri, "otpauth://totp/CCGallery:test@example.com?") {
+        t.Errorf("Unexpected otpauth URI: %v", uri)
+    }
+    if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=CCGallery") {
+        t.Errorf("otpauth URI is missing parameters: %v", uri)
+    }
+}
+
+func TestEncryptTOTPSecret(t *testing.T) {
+    setupTOTPKey(t)
+
+    secret, _ := generateTOTPSecret()
+    encrypted, err := encryptTOTPSecret(2, secret)
+    if err != nil || strings.Contains(encrypted, secret) {
+        t.Fatalf("Failed to encrypt secret: %q, %v", encrypted, err)
+    }
+    if decrypted, err := decryptTOTPSecret(2, encrypted); err != nil || decrypted != secret {
+        t.Errorf("Expected %q, got %q (%v)", secret, decrypted, err)
+    }
+
+    // 別のユーザーの暗号文としては復号できない
+    if _, err := decryptTOTPSecret(3, encrypted); err == nil {
+        t.Errorf("Expected decryption for another user to fail")
+    }
+
+    // 改ざんされた暗号文は復号できない
+    tampered := []byte(encrypted)
+    tampered[len(tampered)-1] ^= 'A' ^ 'B'
+    if _, err := decryptTOTPSecret(2, string(tampered)); err == nil {
+        t.Errorf("Expected tampered ciphertext to be rejected")
+    }
+}
+
+// TOTP_SECRET_KEYが未設定の場合は、起動時ではなく暗号化・復号の時点でエラーになる
+func TestEncryptTOTPSecretWithoutKey(t *testing.T) {
+    setupTOTPKey(t)
+    totpKey = nil
+
+    if _, err := encryptTOTPSecret(2, "JBSWY3DPEHPK3PXP"); err == nil {
+        t.Errorf("Expected encryption to fail without a TOTP key")
+    }
+    if _, err := decryptTOTPSecret(2, "c2VjcmV0"); err == nil {
+        t.Errorf("Expected decryption to fail without a TOTP key")
+    }
+}
@@ -0,0 +1,39 @@
+package main
+
+// fnの中で行った書き込みを1つのトランザクションとしてまとめて確定する（unit of work）
+// fnがエラーを返した場合（またはpanicした場合）はすべて取り消す
+// 既にトランザクション中の場合は新しく開始せず、外側のトランザクションに含める
+func (db *SQLDatabase) Transaction(fn func(tx Database) error) error {
+    return db.inTransaction(func(tx *SQLDatabase) error {
+        return fn(tx)
+    })
+}
+
+// リポジトリの実装から直接SQLを実行する場合に使う
+func (db *SQLDatabase) inTransaction(fn func(tx *SQLDatabase) error) error {
+    if db.db.tx != nil {
+        return fn(db)
+    }
+
+    // トランザクション全体にQueryTimeoutを適用する
+    ctx, cancel := db.db.queryContext()
+    defer cancel()
+
+    sqlTx, err := db.db.pool.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if p := recover(); p != nil {
+            sqlTx.Rollback()
+            panic(p)
+        }
+    }()
+
+    tx := &SQLDatabase{db: &dbConn{pool: db.db.pool, tx: sqlTx, dialect: db.db.dialect, ctx: ctx}}
+    if err := fn(tx); err != nil {
+        sqlTx.Rollback()
+        return err
+    }
+    return sqlTx.Commit()
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+    "crypto/rand"
+    "database/sql"
+    "encoding/base32"
+    "encoding/json"
+    "net/http"
+    "strings"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+// ログイン時の二要素認証チャレンジトークンの用途（有効期限はtokenLifetimes.TwoFactorChallenge）
+const twoFactorChallengePurpose = "login-2fa"
+
+// 発行するリカバリーコードの数
+const recoveryCodeCount = 10
+
+type TwoFactorLoginRequest struct {
+    ChallengeToken string `json:"challenge_token"`
+    Code           string `json:"code,omitempty"`
+    RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+type TwoFactorCodeRequest struct {
+    Code string `json:"code"`
+}
+
+type TwoFactorDisableRequest struct {
+    Password string `json:"password"`
+}
+
+type TwoFactorSetupResponse struct {
+    Secret     string `json:"secret"`
+    OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+    Message       string   `json:"message"`
+    RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// "abcde-fghij" 形式のリカバリーコードを生成する
+func generateRecoveryCodes() ([]string, error) {
+    encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+    codes := make([]string, 0, recoveryCodeCount)
+    for i := 0; i < recoveryCodeCount; i++ {
+        b := make([]byte, 7)
+        if _, err := rand.Read(b); err != nil {
+            return nil, err
+        }
+        code := strings.ToLower(encoding.EncodeToString(b))[:10]
+        codes = append(codes, code[:5]+"-"+code[5:])
+    }
+    return codes, nil
+}
+
+// 入力ゆれ（ハイフン・空白・大文字）を吸収してからハッシュ化する
+func hashRecoveryCode(code string) string {
+    normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+    return hashToken(normalized)
+}
+
+// TOTPコードまたはリカバリーコードで二要素目を検証する
+func verifySecondFactor(db Database, user User, code string, recoveryCode string) (bool, error) {
+    if code != "" {
+        secret, err := decryptTOTPSecret(user.ID, user.TOTPSecret)
+        if err != nil {
+            return false, err
+        }
+        step, ok := verifyTOTP(secret, code, time.Now(), user.TOTPLastStep)
+        if !ok {
+            return false, nil
+        }
+        // 同じコードが同時に使われた場合に備えて条件付きで更新する
+        return db.UpdateTOTPLastStep(user.ID, step)
+    }
+
+    if recoveryCode != "" {
+        return db.UseRecoveryCode(user.ID, hashRecoveryCode(recoveryCode))
+    }
+
+    return false, nil
+}
+
+// ログインの2段階目：チャレンジトークンと認証コードを検証してトークンを発行する
+// コードの失敗はユーザーID単位で制限し、ロックされた時点で発行済みのチャレンジトークンを無効にする
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database, throttle *LoginThrottle) {
+    var req TwoFactorLoginRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    claims, err := ValidateActionToken(req.ChallengeToken, twoFactorChallengePurpose, auth.keys)
+    if err != nil {
+        writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidChallengeToken)
+        return
+    }
+
+    ip := clientIP(r)
+    if wait := throttle.TwoFactorRetryAfter(claims.ID, ip); wait > 0 {
+        auth.metrics.ObserveLogin(LoginResultLocked)
+        writeLoginLocked(w, r, wait)
+        return
+    }
+    if throttle.TwoFactorChallengeRevoked(claims.ID, time.Unix(claims.IssuedAt, 0)) {
+        writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidChallengeToken)
+        return
+    }
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidChallengeToken)
+        } else {
+            serverError(w, r, "Database query error", err)
+        }
+        return
+    }
+
+    if !user.TOTPEnabled {
+        writeError(w, r, http.StatusBadRequest, ErrCodeTwoFactorNotEnabled)
+        return
+    }
+
+    ok, err := verifySecondFactor(db, user, req.Code, req.RecoveryCode)
+    if err != nil {
+        serverError(w, r, "Failed to verify authentication code", err)
+        return
+    }
+    if !ok {
+        lockouts := throttle.RecordTwoFactorFailure(user.ID, ip)
+        recordLockouts(r, db, lockouts)
+        // この失敗でロックされた場合は、パスワードの段階と同じく試行の制限を返す
+        if len(lockouts) > 0 {
+            auth.metrics.ObserveLogin(LoginResultLocked)
+            writeLoginLocked(w, r, throttle.TwoFactorRetryAfter(user.ID, ip))
+            return
+        }
+        auth.metrics.ObserveLogin(LoginResultFailure)
+        writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidTwoFactorCode)
+        return
+    }
+    throttle.RecordTwoFactorSuccess(user.ID)
+
+    tokenString, refreshToken, err := startSession(db, r, user, auth.keys)
+    if err != nil {
+        serverError(w, r, "Error generating JWT", err)
+        return
+    }
+
+    auth.metrics.ObserveLogin(LoginResultSuccess)
+    auth.writeTokenResponse(w, r, ResponseData{
+        Message:      "Login successful",
+        Token:        tokenString,
+        RefreshToken: refreshToken,
+    })
+}
+
+// 二要素認証の登録開始：シークレットとotpauth URIを発行する（確認が済むまでは無効）
+func TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
+        return
+    }
+
+    if user.TOTPEnabled {
+        writeError(w, r, http.StatusConflict, ErrCodeTwoFactorAlreadyEnabled)
+        return
+    }
+
+    secret, err := generateTOTPSecret()
+    if err != nil {
+        serverError(w, r, "Error generating secret", err)
+        return
+    }
+
+    // シークレットは暗号化して保存する
+    encryptedSecret, err := encryptTOTPSecret(user.ID, secret)
+    if err != nil {
+        serverError(w, r, "Error encrypting secret", err)
+        return
+    }
+
+    if err := db.SetTOTPSecret(user.ID, encryptedSecret); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(TwoFactorSetupResponse{
+        Secret:     secret,
+        OTPAuthURI: totpURI(secret, user.Email),
+    })
+}
+
+// 二要素認証の登録確認：認証アプリのコードを検証して有効化し、リカバリーコードを返す
+func TwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    var req TwoFactorCodeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
+        return
+    }
+
+    if user.TOTPEnabled {
+        writeError(w, r, http.StatusConflict, ErrCodeTwoFactorAlreadyEnabled)
+        return
+    }
+    if user.TOTPSecret == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeTwoFactorSetupNotStarted)
+        return
+    }
+
+    ok, err := verifySecondFactor(db, user, req.Code, "")
+    if err != nil {
+        serverError(w, r, "Failed to verify authentication code", err)
+        return
+    }
+    if !ok {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidTwoFactorCode)
+        return
+    }
+
+    codes, err := generateRecoveryCodes()
+    if err != nil {
+        serverError(w, r, "Error generating recovery codes", err)
+        return
+    }
+
+    // リカバリーコードはハッシュのみ保存し、平文はこのレスポンスでのみ返す
+    codeHashes := make([]string, len(codes))
+    for i, code := range codes {
+        codeHashes[i] = hashRecoveryCode(code)
+    }
+    // リカバリーコードの保存と有効化はまとめて行う（片方だけが反映されないようにする）
+    err = db.Transaction(func(tx Database) error {
+        if err := tx.ReplaceRecoveryCodes(user.ID, codeHashes); err != nil {
+            return err
+        }
+        return tx.EnableTOTP(user.ID)
+    })
+    if err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(RecoveryCodesResponse{
+        Message:       "Two-factor authentication enabled",
+        RecoveryCodes: codes,
+    })
+}
+
+// 二要素認証の無効化（パスワードの再入力が必要）
+func TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request, db Database) {
+    // ルーターのSessionMiddlewareで認証済み（パーソナルアクセストークンは不可）
+    claims := requestClaims(r)
+
+    var req TwoFactorDisableRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+        return
+    }
+
+    user, err := db.GetUserByID(claims.ID)
+    if err != nil {
+        serverError(w, r, "Database query error", err)
+        return
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+        writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized)
+        return
+    }
+
+    if err := db.DisableTOTP(user.ID); err != nil {
+        serverError(w, r, "Database execution failed", err)
+        return
+    }
+
+    requestLogger(r).Info("Two-factor authentication disabled")
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ResponseData{
+        Message: "Two-factor authentication disabled",
+    })
+}
+
+// 確認前のシークレットを保存する（既存の登録はやり直しになる）
+func (db *SQLDatabase) SetTOTPSecret(userID int, encryptedSecret string) error {
+    _, err := db.db.Exec("UPDATE users SET totp_secret = ?, totp_enabled = FALSE, totp_last_step = 0 WHERE id = ?", encryptedSecret, userID)
+    return err
+}
+
+func (db *SQLDatabase) EnableTOTP(userID int) error {
+    _, err := db.db.Exec("UPDATE users SET totp_enabled = TRUE WHERE id = ?", userID)
+    return err
+}
+
+// シークレットとリカバリーコードを削除して二要素認証を無効にする
+func (db *SQLDatabase) DisableTOTP(userID int) error {
+    return db.inTransaction(func(tx *SQLDatabase) error {
+        if _, err := tx.db.Exec("UPDATE users SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0 WHERE id = ?", userID); err != nil {
+            return err
+        }
+        _, err := tx.db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+        return err
+    })
+}
+
+// 前回より新しいステップの場合のみ更新し、更新できたかどうかを返す
+func (db *SQLDatabase) UpdateTOTPLastStep(userID int, step int64) (bool, error) {
+    res, err := db.db.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+    if err != nil {
+        return false, err
+    }
+    rowsAffected, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected == 1, nil
+}
+
+// 既存のリカバリーコードを破棄して新しいコードを保存する
+func (db *SQLDatabase) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+    return db.inTransaction(func(tx *SQLDatabase) error {
+        if _, err := tx.db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+            return err
+        }
+        for _, codeHash := range codeHashes {
+            if _, err := tx.db.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, codeHash); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// 未使用のリカバリーコードを使用済みにし、使用できたかどうかを返す
+func (db *SQLDatabase) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+    res, err := db.db.Exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL", time.Now(), userID, codeHash)
+    if err != nil {
+        return false, err
+    }
+    rowsAffected, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected == 1, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/golang/mock/gomock"
+)
+
+// テスト用のTOTPシークレットの暗号化鍵と、旧形式の読み込みに使う共有リンクの鍵を設定する
+func setupTOTPKey(t *testing.T) {
+    previousAES, previousTOTP := aesKey, totpKey
+    aesKey = []byte("0123456789abcdef0123456789abcdef")
+    totpKey = []byte("fedcba9876543210fedcba9876543210")
+    t.Cleanup(func() { aesKey, totpKey = previousAES, previousTOTP })
+}
+
+func TestLoginHandlerRequiresSecondFactor(t *testing.T) {
+    db, keys := setupMock(t)
+
+    validCreds, validUser := setupValidLoginCredentials()
+    validUser.TOTPEnabled = true
+    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+
+    body, _ := json.Marshal(validCreds)
+    req := httptest.NewRequest("POST", "/api/login", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    LoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+    // 最終的なトークンは発行されず、チャレンジトークンのみ返される
+    var response ResponseData
+    json.NewDecoder(w.Body).Decode(&response)
+    if response.Token != "" || response.RefreshToken != "" {
+        t.Errorf("Did not expect tokens before the second factor")
+    }
+    if _, err := ValidateActionToken(response.ChallengeToken, twoFactorChallengePurpose, keys); err != nil {
+        t.Errorf("Expected a valid challenge token, got error: %v", err)
+    }
+}
+
+func TestTwoFactorLoginHandlerWithTOTPCode(t *testing.T) {
+    db, keys := setupMock(t)
+    setupTOTPKey(t)
+
+    secret, _ := generateTOTPSecret()
+    encryptedSecret, _ := encryptTOTPSecret(2, secret)
+    key, _ := totpEncoding.DecodeString(secret)
+    now := time.Now()
+    code := hotpCode(key, uint64(totpStep(now)), totpDigits)
+
+    challengeToken, _ := GenerateActionToken(2, "test2@example.com", twoFactorChallengePurpose, time.Minute, keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", TOTPSecret: encryptedSecret, TOTPEnabled: true}, nil)
+    db.EXPECT().UpdateTOTPLastStep(2, gomock.Any()).Return(true, nil)
+    db.EXPECT().CreateSession(gomock.Any()).Return(nil)
+    db.EXPECT().CreateRefreshToken(gomock.Any()).Return(nil)
+
+    body, _ := json.Marshal(TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code})
+    req := httptest.NewRequest("POST", "/api/login/2fa", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    TwoFactorLoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+    verifyResponse(t, w, http.StatusOK, "Login successful", true)
+}
+
+func TestTwoFactorLoginHandlerWithRecoveryCode(t *testing.T) {
+    db, keys := setupMock(t)
+
+    challengeToken, _ := GenerateActionToken(2, "test2@example.com", twoFactorChallengePurpose, time.Minute, keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", TOTPEnabled: true}, nil)
+    db.EXPECT().UseRecoveryCode(2, hashRecoveryCode("abcde-fghij")).Return(true, nil)
+    db.EXPECT().CreateSession(gomock.Any()).Return(nil)
+    db.EXPECT().CreateRefreshToken(gomock.Any()).Return(nil)
+
+    // 大文字・ハイフンなしで入力されても同じコードとして扱う
+    body, _ := json.Marshal(TwoFactorLoginRequest{ChallengeToken: challengeToken, RecoveryCode: "ABCDEFGHIJ"})
+    req := httptest.NewRequest("POST", "/api/login/2fa", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    TwoFactorLoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+    verifyResponse(t, w, http.StatusOK, "Login successful", true)
+}
+
+// コードの失敗が続くとロックされ、ロック前のチャレンジトークンはロック解除後も使えない
+func TestTwoFactorLoginHandlerLocksOutAfterFailures(t *testing.T) {
+    db, keys := setupMock(t)
+
+    now := time.Now()
+    throttle := newTestLoginThrottle(&now)
+    auth := NewAuthenticator(keys, db)
+    challengeToken, _ := GenerateActionToken(2, "test2@example.com", twoFactorChallengePurpose, time.Hour, keys)
+    db.EXPECT().GetUserByID(2).Return(User{ID: 2, Email: "test2@example.com", TOTPEnabled: true}, nil).Times(twoFactorThrottlePolicy.LockoutThreshold)
+    db.EXPECT().UseRecoveryCode(2, gomock.Any()).Return(false, nil).Times(twoFactorThrottlePolicy.LockoutThreshold)
+    db.EXPECT().CreateLoginLockout(gomock.Any()).DoAndReturn(func(lockout LoginLockout) error {
+        if lockout.Scope != LockoutScopeTwoFactor || lockout.Identifier != "2" {
+            t.Errorf("Unexpected lockout: %+v", lockout)
+        }
+        return nil
+    })
+
+    attempt := func() *httptest.ResponseRecorder {
+        body, _ := json.Marshal(TwoFactorLoginRequest{ChallengeToken: challengeToken, RecoveryCode: "wrong-code"})
+        w := httptest.NewRecorder()
+        TwoFactorLoginHandler(w, httptest.NewRequest("POST", "/api/login/2fa", bytes.NewReader(body)), auth, db, throttle)
+        // バックオフの待ち時間を進める
+        now = now.Add(twoFactorThrottlePolicy.LockoutDuration / 2)
+        return w
+    }
+
+    for i := 1; i < twoFactorThrottlePolicy.LockoutThreshold; i++ {
+        verifyErrorResponse(t, attempt(), http.StatusUnauthorized, ErrCodeInvalidTwoFactorCode)
+    }
+    w := attempt()
+    verifyErrorResponse(t, w, http.StatusTooManyRequests, ErrCodeTooManyLoginAttempts)
+    if w.Header().Get("Retry-After") == "" {
+        t.Errorf("Expected a Retry-After header")
+    }
+
+    // ロック中はコードを検証しない
+    verifyErrorResponse(t, attempt(), http.StatusTooManyRequests, ErrCodeTooManyLoginAttempts)
+
+    // ロックが解除されても、同じチャレンジトークンは無効
+    now = now.Add(twoFactorThrottlePolicy.LockoutDuration)
+    verifyErrorResponse(t, attempt(), http.StatusUnauthorized, ErrCodeInvalidChallengeToken)
+}
+
+func TestTwoFactorLoginHandlerRejectsAccessToken(t *testing.T) {
+    db, keys := setupMock(t)
+
+    // 通常のアクセストークンはチャレンジトークンとして使えない
+    accessToken, _ := GenerateJWT(2, "test2@example.com", keys)
+    body, _ := json.Marshal(TwoFactorLoginRequest{ChallengeToken: accessToken, Code: "123456"})
+    req := httptest.NewRequest("POST", "/api/login/2fa", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    TwoFactorLoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+}
+
+func TestTwoFactorDisableHandlerRequiresPassword(t *testing.T) {
+    db, keys := setupMock(t)
+
+    _, validUser := setupValidLoginCredentials()
+    validUser.TOTPEnabled = true
+    accessToken, _ := GenerateJWT(validUser.ID, validUser.Email, keys)
+    db.EXPECT().GetUserByID(validUser.ID).Return(validUser, nil)
+
+    body, _ := json.Marshal(TwoFactorDisableRequest{Password: "wrong-password"})
+    req := httptest.NewRequest("POST", "/api/2fa/disable", bytes.NewReader(body))
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    w := httptest.NewRecorder()
+    NewRouter(newTestApp(db, keys)).ServeHTTP(w, req)
+
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status Unauthorized, got %v", w.Code)
+    }
+}
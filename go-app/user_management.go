@@ -4,7 +4,10 @@ import (
     "database/sql"
     "encoding/json"
     "golang.org/x/crypto/bcrypt"
+    "math"
     "net/http"
+    "strconv"
+    "time"
     "github.com/google/uuid"
 )
 
@@ -14,39 +17,28 @@ type Credentials struct {
 }
 
 type ResponseData struct {
-    Message string `json:"message"`
-    Token   string `json:"token,omitempty"` // JWT トークン用のフィールドを追加
+    Message        string `json:"message"`
+    Token          string `json:"token,omitempty"` // JWT トークン用のフィールドを追加
+    RefreshToken   string `json:"refresh_token,omitempty"` // リフレッシュトークン
+    ChallengeToken string `json:"challenge_token,omitempty"` // 二要素認証が必要な場合のチャレンジトークン
+    CSRFToken      string `json:"csrf_token,omitempty"` // Cookieセッションモードの場合のCSRFトークン
 }
 
 
-func LoginHandler(w http.ResponseWriter, r *http.Request, jwtKey string, db Database) {
-    if r.Method == "OPTIONS" {
-        EnableCORS(w)
-        w.WriteHeader(http.StatusOK)
-        return
-    }
-    
-    // POSTリクエストのみ許可
-    if r.Method != "POST" {
-        http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
-    EnableCORS(w) // 他のHTTPメソッドでもCORSを有効化
-
 
+func LoginHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database, throttle *LoginThrottle) {
     // 認証情報を取得
     var creds Credentials
     err := json.NewDecoder(r.Body).Decode(&creds)
     if err != nil {
-        http.Error(w, "Invalid user credentials", http.StatusBadRequest)
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
         return
     }
 
     // データベース接続を開く
     // db, err := OpenDatabase()
     // if err != nil {
-    //     http.Error(w, "Database connection error", http.StatusInternalServerError)
+    //     serverError(w, r, "Database connection error", err)
     //     return
     // }
     // defer db.Close()
@@ -70,133 +62,173 @@ func LoginHandler(w http.ResponseWriter, r *http.Request, jwtKey string, db Data
     //     return
     // }
 
-    // データベースからユーザーを検索
-    storedUser, err := db.GetUserByEmail(creds.Email)
-    if err != nil {
-        if err == sql.ErrNoRows {
-            http.Error(w, "User not found", http.StatusUnauthorized)
-        } else {
-            http.Error(w, "Database query error", http.StatusInternalServerError)
-        }
+    // メールアドレスとパスワードを検証
+    storedUser, ok := authenticateCredentials(w, r, db, throttle, creds, auth.metrics)
+    if !ok {
         return
     }
 
-    // パスワードが一致するか検証
-    if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(creds.Password)); err != nil {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+    // 利用停止中のアカウントはログインできない
+    if storedUser.SuspendedAt.Valid {
+        auth.metrics.ObserveLogin(LoginResultFailure)
+        writeError(w, r, http.StatusForbidden, ErrCodeAccountSuspended)
         return
     }
 
-    // JWTトークンの生成
-    tokenString, err := GenerateJWT(storedUser.ID, creds.Email, jwtKey)
-    if err != nil {
-        http.Error(w, "Error generating JWT", http.StatusInternalServerError)
+    // 退会の猶予期間中は、退会を取り消すまでログインできない
+    if isPendingDeletion(storedUser) {
+        auth.metrics.ObserveLogin(LoginResultFailure)
+        writeError(w, r, http.StatusForbidden, ErrCodeAccountPendingDeletion)
         return
     }
 
-    // ログイン成功のレスポンスにJWTを含める
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(ResponseData{
-        Message: "Login successful",
-        Token:   tokenString,
-    })
-}
+    // 二要素認証が有効な場合は、最終的なトークンの代わりにチャレンジトークンを返す
+    if storedUser.TOTPEnabled {
+        challengeToken, err := GenerateActionToken(storedUser.ID, storedUser.Email, twoFactorChallengePurpose, tokenLifetimes.TwoFactorChallenge, auth.keys)
+        if err != nil {
+            serverError(w, r, "Error generating JWT", err)
+            return
+        }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request, jwtKey string) {
-    if r.Method == "OPTIONS" {
-        EnableCORS(w)
-        w.WriteHeader(http.StatusOK)
+        auth.metrics.ObserveLogin(LoginResultTwoFactorRequired)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(ResponseData{
+            Message:        "Two-factor authentication required",
+            ChallengeToken: challengeToken,
+        })
         return
     }
 
-    // POSTリクエストのみ許可
-    if r.Method != "POST" {
-        http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+    // JWTトークンとリフレッシュトークンの生成
+    tokenString, refreshToken, err := startSession(db, r, storedUser, auth.keys)
+    if err != nil {
+        serverError(w, r, "Error generating JWT", err)
         return
     }
 
-    EnableCORS(w) // CORSを有効化
+    // ログイン成功のレスポンスにJWTを含める
+    auth.metrics.ObserveLogin(LoginResultSuccess)
+    auth.writeTokenResponse(w, r, ResponseData{
+        Message:      "Login successful",
+        Token:        tokenString,
+        RefreshToken: refreshToken,
+    })
+}
 
-    // ユーザー情報を取得
-    var creds Credentials
-    err := json.NewDecoder(r.Body).Decode(&creds)
-    if err != nil {
-        http.Error(w, "Invalid request payload", http.StatusBadRequest)
-        return
+// 試行回数の制限を適用しながらメールアドレスとパスワードを検証する
+// 失敗した場合はエラーレスポンスを書き込んでfalseを返す（metricsがnilの場合は試行を記録しない）
+func authenticateCredentials(w http.ResponseWriter, r *http.Request, db Database, throttle *LoginThrottle, creds Credentials, metrics *Metrics) (User, bool) {
+    // 失敗が続いているアカウント・IPアドレスは待ち時間が経過するまで試行させない
+    ip := clientIP(r)
+    if wait := throttle.RetryAfter(creds.Email, ip); wait > 0 {
+        metrics.ObserveLogin(LoginResultLocked)
+        writeLoginLocked(w, r, wait)
+        return User{}, false
     }
 
-    // パスワードのハッシュ化
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
-    if err != nil {
-        http.Error(w, "Error while hashing password", http.StatusInternalServerError)
-        return
+    // データベースからユーザーを検索
+    storedUser, err := db.GetUserByEmail(creds.Email)
+    if err != nil && err != sql.ErrNoRows {
+        serverError(w, r, "Database query error", err)
+        return User{}, false
     }
 
-    // データベースにユーザー情報を保存
-    db, err := OpenDatabase() // データベース接続を開く
-    if err != nil {
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
+    // 未登録のメールアドレスとパスワード誤りで同じ応答を返し、登録の有無を推測されないようにする
+    if err == sql.ErrNoRows {
+        // ユーザーが存在しない場合もパスワード検証と同じだけ時間をかける
+        compareDummyPassword(creds.Password)
+        recordLoginFailure(r, db, throttle, creds.Email, ip)
+        metrics.ObserveLogin(LoginResultFailure)
+        writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidCredentials)
+        return User{}, false
     }
-    defer db.Close()
 
-    // メールアドレスの重複チェック
-    err = db.QueryRow("SELECT id FROM users WHERE email = ?", creds.Email).Scan(new(int))
-    if err != sql.ErrNoRows {
-        // メールアドレスが既に存在する場合は、409 Conflictエラーを返す
-        http.Error(w, "Email address already in use", http.StatusConflict)
-        return
+    // パスワードが一致するか検証
+    if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(creds.Password)); err != nil {
+        recordLoginFailure(r, db, throttle, creds.Email, ip)
+        metrics.ObserveLogin(LoginResultFailure)
+        writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidCredentials)
+        return User{}, false
     }
+    throttle.RecordSuccess(creds.Email)
 
-    // トランザクションの開始
-    tx, err := db.Begin()
-    if err != nil {
-        http.Error(w, "Database transaction error", http.StatusInternalServerError)
-        return
-    }
+    return storedUser, true
+}
 
-    // トランザクションを安全に閉じる
-    defer func() {
-        if p := recover(); p != nil {
-            tx.Rollback()
-            panic(p) // re-throw panic after Rollback
-        } else if err != nil {
-            tx.Rollback() // err is non-nil; don't change it
+// ログインの試行が制限されている場合のレスポンスを書き込む
+func writeLoginLocked(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+    writeError(w, r, http.StatusTooManyRequests, ErrCodeTooManyLoginAttempts)
+}
+
+// ログイン失敗を記録し、ロックが発生した場合は監査記録を残す
+func recordLoginFailure(r *http.Request, db Database, throttle *LoginThrottle, email string, ip string) {
+    recordLockouts(r, db, throttle.RecordFailure(email, ip))
+}
+
+// ロックの監査記録を残す
+func recordLockouts(r *http.Request, db Database, lockouts []LoginLockout) {
+    for _, lockout := range lockouts {
+        requestLogger(r).Warn("Login locked out", "scope", lockout.Scope, "identifier", lockout.Identifier,
+            "failures", lockout.Failures, "ip", lockout.IPAddress, "until", lockout.LockedUntil.Format(time.RFC3339))
+        if err := db.CreateLoginLockout(lockout); err != nil {
+            requestLogger(r).Error("Failed to record login lockout", "error", err)
         }
-    }()
+    }
+}
 
-    // ユーザー情報のインサートクエリを実行
-    userUUID := uuid.NewString() // UUIDを生成
-    result, err := db.Exec("INSERT INTO users(email, password, user_uuid) VALUES(?, ?, ?)", creds.Email, hashedPassword, userUUID)
+func RegisterHandler(w http.ResponseWriter, r *http.Request, auth *Authenticator, db Database, mailer Mailer, appBaseURL string) {
+    // ユーザー情報を取得
+    var creds Credentials
+    err := json.NewDecoder(r.Body).Decode(&creds)
     if err != nil {
-        http.Error(w, "Failed to create account", http.StatusInternalServerError)
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
         return
     }
 
-    // INSERTされたレコードのIDを取得
-    userID, err := result.LastInsertId()
+    // パスワードのハッシュ化
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
     if err != nil {
-        http.Error(w, "Failed to retrieve user ID", http.StatusInternalServerError)
+        serverError(w, r, "Error while hashing password", err)
         return
     }
 
-    // トランザクションをコミット
-    if err = tx.Commit(); err != nil {
-        http.Error(w, "Database transaction commit error", http.StatusInternalServerError)
+    // ユーザーと空のプロフィールを1つのトランザクションで登録する
+    // メールアドレスの重複は一意制約で判定するため、同時に登録された場合も片方のみ成功する
+    var userID int
+    err = db.Transaction(func(tx Database) error {
+        var err error
+        userID, err = tx.CreateUser(User{Email: creds.Email, Password: string(hashedPassword), user_uuid: uuid.NewString()})
+        if err != nil {
+            return err
+        }
+        return tx.CreateProfile(userID, Profile{})
+    })
+    if err == ErrEmailTaken {
+        // メールアドレスが既に存在する場合は、409 Conflictエラーを返す
+        writeError(w, r, http.StatusConflict, ErrCodeEmailTaken)
         return
+    } else if err != nil {
+        serverError(w, r, "Failed to create account", err)
+        return
+    }
+
+    // メールアドレス確認用のリンクを送信（送信に失敗しても登録自体は完了させ、再送信で対応する）
+    if err := sendVerificationEmail(db, mailer, appBaseURL, auth.keys, userID, creds.Email); err != nil {
+        requestLogger(r).Warn("Failed to send verification email", "target_user_id", userID, "error", err)
     }
 
-    // JWTの生成(id, email)
-    tokenString, err := GenerateJWT(int(userID), creds.Email, jwtKey)
+    // JWTとリフレッシュトークンの生成(id, email)
+    tokenString, refreshToken, err := startSession(db, r, User{ID: userID, Email: creds.Email, Role: RoleUser}, auth.keys)
     if err != nil {
-        http.Error(w, "Error generating JWT", http.StatusInternalServerError)
+        serverError(w, r, "Error generating JWT", err)
         return
     }
 
     // JSONレスポンスを返す
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(ResponseData{
-        Message: "Account created successfully",
-        Token:   tokenString,
+    auth.writeTokenResponse(w, r, ResponseData{
+        Message:      "Account created successfully",
+        Token:        tokenString,
+        RefreshToken: refreshToken,
     })
 }
\ No newline at end of file
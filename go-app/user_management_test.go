@@ -13,15 +13,22 @@ import (
 )
 
 // モックデータベースとJWT生成関数の作成
-func setupMock(t *testing.T) (*MockDatabase, string) {
+func setupMock(t *testing.T) (*MockDatabase, *KeySet) {
     ctrl := gomock.NewController(t)
     db := NewMockDatabase(ctrl)
 
     // 環境変数のセットアップ（テスト用のJWT鍵など）
     os.Setenv("JWT_SECRET_KEY", "test_jwt_key")
-    jwtKey := os.Getenv("JWT_SECRET_KEY")
+    keys := NewHMACKeySet(os.Getenv("JWT_SECRET_KEY"))
 
-    return db, jwtKey
+    return db, keys
+}
+
+// Transactionに渡された関数を同じモックでそのまま実行する
+func expectTransaction(db *MockDatabase) {
+    db.EXPECT().Transaction(gomock.Any()).DoAndReturn(func(fn func(tx Database) error) error {
+        return fn(db)
+    })
 }
 
 // 正常にログインできるテスト用アカウント情報
@@ -36,13 +43,12 @@ func setupValidLoginCredentials() (Credentials, User) {
 
 
 func TestLoginHandlerWithValidCredentials(t *testing.T) {
-    db, jwtKey := setupMock(t)
+    db := newSQLiteTestDatabase(t)
+    _, keys := setupMock(t)
 
     // 有効なログイン情報
     validCreds, validUser := setupValidLoginCredentials()
-
-    // モックデータベースの期待値を設定
-    db.EXPECT().GetUserByEmail(validCreds.Email).Return(validUser, nil)
+    createSQLiteTestUser(t, db, validUser)
 
     // HTTPリクエストとレスポンスのセットアップ
     body, _ := json.Marshal(validCreds)
@@ -50,16 +56,7 @@ func TestLoginHandlerWithValidCredentials(t *testing.T) {
     w := httptest.NewRecorder()
 
     // ハンドラーの実行
-    LoginHandler(w, req, jwtKey, db)
-
-    // レスポンスの検証
-    res := w.Result()
-    defer res.Body.Close()
-
-    // ステータスコードとレスポンスボディの検証
-    if res.StatusCode != http.StatusOK {
-        t.Errorf("Expected status OK, got %v", res.StatusCode)
-    }
+    LoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
 
     // レスポンスの検証
     verifyResponse(t, w, http.StatusOK, "Login successful", true)
@@ -67,31 +64,60 @@ func TestLoginHandlerWithValidCredentials(t *testing.T) {
 
 
 func TestLoginHandlerWithInvalidCredentials(t *testing.T) {
-    db, jwtKey := setupMock(t)
-
-    // 無効なログイン情報
-    invalidCreds := Credentials{Email: "failtest@example.com", Password: "newpassword"}
+    db := newSQLiteTestDatabase(t)
+    _, keys := setupMock(t)
+    _, validUser := setupValidLoginCredentials()
+    createSQLiteTestUser(t, db, validUser)
+
+    // 未登録のメールアドレスと、登録済みでパスワードが誤っているもの
+    for _, creds := range []Credentials{
+        {Email: "failtest@example.com", Password: "newpassword"},
+        {Email: validUser.Email, Password: "wrongpassword"},
+    } {
+        body, _ := json.Marshal(creds)
+        req := httptest.NewRequest("POST", "/api/login", bytes.NewReader(body))
+        w := httptest.NewRecorder()
+
+        LoginHandler(w, req, NewAuthenticator(keys, db), db, NewLoginThrottle())
+
+        // レスポンスの検証（未登録とパスワード誤りを区別しない）
+        verifyErrorResponse(t, w, http.StatusUnauthorized, ErrCodeInvalidCredentials)
+    }
+}
 
-    // モックデータベースの期待値を設定（ユーザーが見つからない）
-    db.EXPECT().GetUserByEmail(invalidCreds.Email).Return(User{}, sql.ErrNoRows)
+func TestRegisterHandler(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+    _, keys := setupMock(t)
 
-    // HTTPリクエストとレスポンスのセットアップ
-    body, _ := json.Marshal(invalidCreds)
-    req := httptest.NewRequest("POST", "/api/login", bytes.NewReader(body))
+    creds := Credentials{Email: "new@example.com", Password: "password123"}
+    body, _ := json.Marshal(creds)
     w := httptest.NewRecorder()
+    RegisterHandler(w, httptest.NewRequest("POST", "/api/register", bytes.NewReader(body)), NewAuthenticator(keys, db), db, &MemoryMailer{}, "http://localhost:3000")
 
-    // ハンドラーの実行
-    LoginHandler(w, req, jwtKey, db)
-
-    // レスポンスの検証
-    res := w.Result()
-    defer res.Body.Close()
+    verifyResponse(t, w, http.StatusOK, "Account created successfully", true)
 
-    // ステータスコードの検証（ログイン失敗）
-    if res.StatusCode != http.StatusUnauthorized {
-        t.Errorf("Expected status Unauthorized, got %v", res.StatusCode)
+    user, err := db.GetUserByEmail(creds.Email)
+    if err != nil || user.user_uuid == "" || !user.VerificationSentAt.Valid || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)) != nil {
+        t.Fatalf("Unexpected user: %+v (%v)", user, err)
+    }
+    // 空のプロフィールも作成される
+    if _, err := db.GetProfileByUserID(user.ID); err != nil {
+        t.Errorf("Expected a default profile: %v", err)
     }
+}
 
-    // レスポンスの検証
-    verifyResponse(t, w, http.StatusUnauthorized, "User not found", false)
+func TestRegisterHandlerWithDuplicateEmail(t *testing.T) {
+    db := newSQLiteTestDatabase(t)
+    _, keys := setupMock(t)
+    createSQLiteTestUser(t, db, User{Email: "test@example.com"})
+
+    // 大文字と小文字の違いだけのメールアドレスも登録済みとして扱う
+    creds := Credentials{Email: "Test@example.com", Password: "password123"}
+    body, _ := json.Marshal(creds)
+    w := httptest.NewRecorder()
+    RegisterHandler(w, httptest.NewRequest("POST", "/api/register", bytes.NewReader(body)), NewAuthenticator(keys, db), db, &MemoryMailer{}, "http://localhost:3000")
+
+    if w.Code != http.StatusConflict {
+        t.Errorf("Expected status 409, got %v", w.Code)
+    }
 }
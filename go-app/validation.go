@@ -0,0 +1,166 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "net/mail"
+    "net/url"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+)
+
+// 入力値の検証ルール
+// 値が不正な場合はエラーコードと、メッセージの書式に埋め込む値を返す（問題ない場合はcodeが空）
+type rule func(value string) (code string, args []interface{})
+
+// 検証する項目（fieldはJSONのキー名）
+type fieldCheck struct {
+    field string
+    value string
+    rules []rule
+}
+
+// 項目と検証ルールの組を作成する
+func check(field string, value string, rules ...rule) fieldCheck {
+    return fieldCheck{field: field, value: value, rules: rules}
+}
+
+// すべての項目を検証し、不正な項目ごとに最初に違反したルールのエラーを返す
+func validateFields(fields ...fieldCheck) []FieldError {
+    var details []FieldError
+    for _, f := range fields {
+        for _, apply := range f.rules {
+            if code, args := apply(f.value); code != "" {
+                details = append(details, newFieldError(f.field, code, args...))
+                break
+            }
+        }
+    }
+    return details
+}
+
+// 空文字列（空白のみを含む）を許可しない
+// 以降のルールは空の値を未入力として扱い、検証しない
+func required() rule {
+    return func(value string) (string, []interface{}) {
+        if strings.TrimSpace(value) == "" {
+            return FieldErrRequired, nil
+        }
+        return "", nil
+    }
+}
+
+// 文字数（バイト数ではなく文字数）の上限
+func maxLength(limit int) rule {
+    return func(value string) (string, []interface{}) {
+        if utf8.RuneCountInString(value) > limit {
+            return FieldErrTooLong, []interface{}{limit}
+        }
+        return "", nil
+    }
+}
+
+// 指定した値のいずれかであること
+func oneOf(values ...string) rule {
+    return func(value string) (string, []interface{}) {
+        if value == "" {
+            return "", nil
+        }
+        for _, v := range values {
+            if value == v {
+                return "", nil
+            }
+        }
+        return FieldErrNotAllowed, []interface{}{strings.Join(values, ", ")}
+    }
+}
+
+// http(s)のURLで、ホストがhostsのいずれか（サブドメインの"www."は区別しない）であること
+// hostsを指定しない場合はホストを制限しない
+func urlOnHosts(hosts ...string) rule {
+    return func(value string) (string, []interface{}) {
+        if value == "" {
+            return "", nil
+        }
+        u, err := url.Parse(value)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+            return FieldErrInvalidURL, nil
+        }
+        if len(hosts) == 0 {
+            return "", nil
+        }
+        host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+        for _, h := range hosts {
+            if host == h {
+                return "", nil
+            }
+        }
+        return FieldErrHostNotAllowed, []interface{}{strings.Join(hosts, ", ")}
+    }
+}
+
+// メールアドレスの形式であること（表示名付きの形式は許可しない）
+func emailAddress() rule {
+    return func(value string) (string, []interface{}) {
+        if value == "" {
+            return "", nil
+        }
+        if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+            return FieldErrInvalidEmail, nil
+        }
+        return "", nil
+    }
+}
+
+// 正規表現に一致すること（codeは一致しない場合のエラーコード）
+func matchPattern(re *regexp.Regexp, code string) rule {
+    return func(value string) (string, []interface{}) {
+        if value == "" || re.MatchString(value) {
+            return "", nil
+        }
+        return code, nil
+    }
+}
+
+// リクエストボディのJSONをdstに読み込む
+// ボディはmaxBytesまでに制限し、dstにないキーは受け付けない
+// 失敗した場合はエラーレスポンスを書き込んでfalseを返す
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) bool {
+    dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+    dec.DisallowUnknownFields()
+
+    err := dec.Decode(dst)
+    trailing := false
+    if err == nil {
+        // JSONの後に続きがある場合も不正な形式として扱う（"}"や"]"だけが続く場合も含む）
+        if err = dec.Decode(&struct{}{}); err == io.EOF {
+            return true
+        }
+        trailing = true
+        if err == nil {
+            err = errors.New("unexpected data after JSON body")
+        }
+    }
+
+    var maxBytesErr *http.MaxBytesError
+    var typeErr *json.UnmarshalTypeError
+    switch {
+    case errors.As(err, &maxBytesErr):
+        writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, maxBytesErr.Limit)
+    case trailing:
+        // 続きの内容によるエラー（未知のキーなど）は、本体の項目のエラーとして報告しない
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+    case errors.As(err, &typeErr) && typeErr.Field != "":
+        writeFieldErrors(w, r, newFieldError(typeErr.Field, FieldErrInvalidType))
+    case strings.HasPrefix(err.Error(), "json: unknown field "):
+        // DisallowUnknownFieldsのエラーは型が公開されていないため、メッセージからキー名を取り出す
+        field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+        writeFieldErrors(w, r, newFieldError(field, FieldErrUnknownField))
+    default:
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest)
+    }
+    return false
+}
@@ -5,7 +5,6 @@ import 'tailwindcss/tailwind.css';
 import { MdFileUpload, MdCancel } from 'react-icons/md';
 
 type PortfolioData = {
-  id: string;
   title: string;
   subtitle: string;
   thumbnail: string;
@@ -124,7 +123,6 @@ const PostCreation: React.FC = () => {
   // 保存ボタンが押されたときの処理
   const handleSaveButtonClick = () => {
     const portfolioData = {
-      id: portfolioId || '', // 編集時には既存のポートフォリオのIDを使用
       title: title,
       subtitle: subtitle,
       thumbnail: thumbnail,
@@ -49,8 +49,8 @@ const LoginScreen: React.FC = () => {
 
     } catch (error) {
       if (axios.isAxiosError(error) && error.response) {
-        // サーバーからのエラーレスポンスを表示
-        setErrorMessage(error.response.data.message);
+        // サーバーからのエラーレスポンス（{ error: { code, message } }）のメッセージを表示
+        setErrorMessage(error.response.data?.error?.message ?? 'ログインに失敗しました。');
       } else {
         setErrorMessage('ログインに失敗しました。');
       }
@@ -57,8 +57,8 @@ const RegisterScreen: React.FC = () => {
             // メールアドレスが既に使用されている場合の処理
             setErrorMessage('このメールアドレスは既に使用されています。');
           } else {
-            // その他のエラー
-            setErrorMessage('アカウント作成に失敗しました。');
+            // その他のエラー（サーバーからのエラーレスポンス { error: { code, message } } のメッセージを表示）
+            setErrorMessage(error.response.data?.error?.message ?? 'アカウント作成に失敗しました。');
           }
         } else {
           // エラーレスポンスがない場合（ネットワークエラーなど）